@@ -12,6 +12,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"os"
@@ -23,8 +24,12 @@ import (
 
 // Boostraps the application and starts the main event loop.
 func main() {
+	streamPath := flag.String("stream", "", "analyse a pcap stream from a named pipe, or - for stdin, instead of opening the menu")
+	verbose := flag.Bool("verbose", false, "show detailed packet output when analysing a stream")
+	flag.Parse()
+
 	// Root privileges are required for raw socket access (capture)
-	if !isRoot() {
+	if *streamPath == "" && !isRoot() {
 		fmt.Println("⚠️  NetScope requires root/administrator privileges for packet capture.")
 	}
 
@@ -39,14 +44,25 @@ func main() {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
 
+	// A stream arriving on stdin leaves no input for the menu, so it runs on its own
+	if *streamPath != "" {
+		if err := cli.RunStream(*streamPath, *verbose, store); err != nil {
+			log.Fatalf("Stream error: %v", err)
+		}
+		return
+	}
+
 	// Register available CLI operations
 	menu := cli.NewMenu("Main Menu:")
 
 	menu.AddOption("List Network Interfaces", handleListInterfaces)
 	menu.AddOption("Start Packet Capture", func() error { return handleStartCapture(store) })
+	menu.AddOption("Replay Capture File", func() error { return handleReplayCapture(store) })
+	menu.AddOption("Read Pcap Stream (named pipe)", func() error { return handleStreamCapture(store) })
 	menu.AddOption("Query Data", func() error { return handleQueryData(store) })
+	menu.AddOption("Export Evidence (pcapng)", func() error { return handleExportEvidence(store) })
 	menu.AddOption("WiFi Security 📡", func() error { return cli.ShowWiFiMenu(store) }) // New feature
-	menu.AddOption("Capture History", handleCaptureHistory)
+	menu.AddOption("Capture History", func() error { return handleCaptureHistory(store) })
 	menu.AddOption("Settings", handleSettings)
 	menu.AddOption("About", handleAbout)
 	menu.AddOption("Exit", func() error { return nil })
@@ -126,27 +142,29 @@ func handleStartCapture(store storage.Storage) error {
 	return cli.ShowCaptureMenu(store)
 }
 
+// Replays a .pcap/.pcapng file through the analysis pipeline.
+func handleReplayCapture(store storage.Storage) error {
+	return cli.ShowReplayMenu(store)
+}
+
+// Analyses a pcap stream written into a named pipe by a remote capture.
+func handleStreamCapture(store storage.Storage) error {
+	return cli.ShowStreamMenu(store)
+}
+
+// Carves packets retained by the rolling buffer into a pcapng file.
+func handleExportEvidence(store storage.Storage) error {
+	return cli.ShowEvidenceMenu(store)
+}
+
 // Launches the data query interface.
 func handleQueryData(store storage.Storage) error {
 	return cli.ShowQueryMenu(store)
 }
 
-// Shows previous capture sessions (placeholder).
-func handleCaptureHistory() error {
-	cli.ClearScreen()
-	fmt.Println(cli.GetBanner())
-	fmt.Println("Capture History")
-	fmt.Println(string(make([]rune, 60)))
-	fmt.Println()
-	fmt.Println("🚧 Coming soon in Phase 2!")
-	fmt.Println()
-	fmt.Println("This feature will show:")
-	fmt.Println("  • Previous capture sessions")
-	fmt.Println("  • Saved packet captures")
-	fmt.Println("  • Capture statistics and summaries")
-	fmt.Println()
-	cli.PressEnterToContinue()
-	return nil
+// Shows previous capture runs with their limits, stop reasons and statistics.
+func handleCaptureHistory(store storage.Storage) error {
+	return cli.ShowCaptureHistory(store)
 }
 
 // Displays application settings (placeholder).
@@ -10,5 +10,6 @@ require (
 
 require (
 	github.com/oschwald/maxminddb-golang v1.13.0 // indirect
+	golang.org/x/net v0.0.0-20190620200207-3b0461eec859 // indirect
 	golang.org/x/sys v0.20.0 // indirect
 )
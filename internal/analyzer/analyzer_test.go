@@ -160,6 +160,7 @@ func TestPatternEngine(t *testing.T) {
 		{Field: "DstCountry", Operator: OpEquals, Value: "RU"},
 		{Field: "ByteCount", Operator: OpGreaterThan, Value: uint64(1000)},
 		{Field: "DstDomain", Operator: OpContains, Value: "malware"},
+		{Field: "JA4X", Operator: OpStartsWith, Value: "2166164053c1_2166164053c1_"},
 	}
 	engine := NewPatternEngine(rules)
 
@@ -184,6 +185,13 @@ func TestPatternEngine(t *testing.T) {
 		}
 	})
 
+	t.Run("MatchJA4X", func(t *testing.T) {
+		flow := &models.Flow{JA4X: "2166164053c1_2166164053c1_30d204a01551"}
+		if !engine.Match(flow) {
+			t.Error("Expected match for JA4X issuer and subject sections")
+		}
+	})
+
 	t.Run("NoMatch", func(t *testing.T) {
 		flow := &models.Flow{
 			DstCountry: "US",
@@ -25,6 +25,8 @@ const (
 	AnomalyTypeNewGeo      AnomalyType = "NEW_GEOGRAPHY"
 	AnomalyTypeUnusualTime AnomalyType = "UNUSUAL_TIME"
 	AnomalyTypeBeaconing   AnomalyType = "BEACONING_ACTIVITY"
+	AnomalyTypeFragOverlap AnomalyType = "OVERLAPPING_FRAGMENTS"
+	AnomalyTypeZoneXfer    AnomalyType = "DNS_ZONE_TRANSFER"
 )
 
 type AnomalySeverity int
@@ -122,3 +124,27 @@ func (ad *AnomalyDetector) Detect(flow *models.Flow, baseline *DeviceBaseline) [
 
 	return anomalies
 }
+
+// Reports a datagram reassembled from overlapping IP fragments. Overlaps let an
+// attacker show a monitor different bytes than the target reassembles, so they are
+// flagged on sight rather than against a baseline.
+func (ad *AnomalyDetector) OverlappingFragments(flow *models.Flow) Anomaly {
+	return Anomaly{
+		Type:        AnomalyTypeFragOverlap,
+		Severity:    SeverityHigh,
+		Description: fmt.Sprintf("Overlapping IP fragments reassembled for %s (possible IDS evasion)", flow.Key),
+		Flow:        flow,
+	}
+}
+
+// Reports a request for a DNS zone transfer (AXFR or IXFR). Outside secondary name
+// servers, a host pulling whole zones is mapping the network, so requests are
+// flagged on sight rather than against a baseline.
+func (ad *AnomalyDetector) ZoneTransfer(flow *models.Flow, kind, zone string) Anomaly {
+	return Anomaly{
+		Type:        AnomalyTypeZoneXfer,
+		Severity:    SeverityHigh,
+		Description: fmt.Sprintf("%s requested an %s zone transfer of %s from %s", flow.Key.SrcIP, kind, zone, flow.Key.DstIP),
+		Flow:        flow,
+	}
+}
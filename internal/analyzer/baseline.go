@@ -76,7 +76,7 @@ func (bt *BaselineTracker) UpdateBaseline(deviceMAC string, flow *models.Flow) {
 	}
 
 	// Update baseline
-	baseline.LastUpdated = time.Now()
+	baseline.LastUpdated = flow.LastSeen
 	baseline.FlowCount++
 	baseline.TotalBytes += flow.ByteCount
 	baseline.TotalPackets += flow.PacketCount
@@ -117,6 +117,16 @@ func (bt *BaselineTracker) GetBaseline(deviceMAC string) *DeviceBaseline {
 	return bt.baselines[deviceMAC]
 }
 
+// Runs fn against a device's baseline while holding the read lock, so callers on other
+// goroutines can inspect it without racing concurrent updates. fn receives nil when
+// no baseline exists and must not retain the pointer.
+func (bt *BaselineTracker) WithBaseline(deviceMAC string, fn func(*DeviceBaseline)) {
+	bt.mu.RLock()
+	defer bt.mu.RUnlock()
+
+	fn(bt.baselines[deviceMAC])
+}
+
 // Checks if a device's baseline is reliable enough for anomaly detection.
 // Baseline is considered established after minimum flow count is reached.
 func (bt *BaselineTracker) IsEstablished(deviceMAC string) bool {
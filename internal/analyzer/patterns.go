@@ -75,6 +75,16 @@ func checkRule(flow *models.Flow, rule PatternRule) bool {
 		fieldValue = flow.Protocol
 	case "JA3":
 		fieldValue = flow.JA3
+	case "JA3S":
+		fieldValue = flow.JA3S
+	case "JA4":
+		fieldValue = flow.JA4
+	case "JA4S":
+		fieldValue = flow.JA4S
+	case "JA4H":
+		fieldValue = flow.JA4H
+	case "JA4X":
+		fieldValue = flow.JA4X
 	case "ByteCount":
 		fieldValue = flow.ByteCount
 	default:
@@ -1 +1,720 @@
+/**
+ * Rolling Packet Ring Buffer.
+ *
+ * Retains recent raw packets on disk as a rotating set of pcapng segments,
+ * bounded by total size and age, so that traffic behind an alert can be
+ * carved out as evidence after the fact.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
 package capture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/kleaSCM/netscope/internal/models"
+)
+
+const (
+	segmentPrefix  = "ring-"
+	segmentSuffix  = ".pcapng"
+	activeSuffix   = ".pcapng.part"
+	segmentsPerAge = 8 // Age eviction granularity: a segment never spans more than MaxAge/8
+)
+
+// Bounds for the on-disk packet ring buffer.
+type RingBufferConfig struct {
+	Directory    string        // Where segment files are kept
+	MaxBytes     int64         // Total on-disk budget across all segments
+	MaxAge       time.Duration // Packets older than this (relative to the newest packet) are evicted; 0 disables
+	SegmentBytes int64         // Rotation size for a single segment file
+}
+
+// Returns a ring buffer configuration suited to a workstation: 512 MB covering at most one hour.
+func DefaultRingBufferConfig() *RingBufferConfig {
+	return &RingBufferConfig{
+		Directory:    "data/ring",
+		MaxBytes:     512 * 1024 * 1024,
+		MaxAge:       time.Hour,
+		SegmentBytes: 16 * 1024 * 1024,
+	}
+}
+
+// Selects packets to carve out of the ring buffer. Every populated criterion must match.
+type CarveFilter struct {
+	Flow  *models.FlowKey // Matches both directions of the conversation
+	MAC   string          // Matches source or destination hardware address
+	Start time.Time       // Inclusive lower bound; zero means unbounded
+	End   time.Time       // Inclusive upper bound; zero means unbounded
+}
+
+// One pcapng file in the ring. Closed segments carry their time range in the file name
+// so the ring can be reopened without rescanning every packet.
+type ringSegment struct {
+	path  string
+	first time.Time
+	last  time.Time
+	size  int64
+}
+
+// Identifies a capture interface recorded in a segment.
+type ringInterface struct {
+	name     string
+	linkType layers.LinkType
+}
+
+// Counts bytes that actually reach the segment file, beneath the pcapng writer's buffering.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Rolling on-disk store of raw packets written alongside the analysis pipeline.
+type RingBuffer struct {
+	config   RingBufferConfig
+	linkType layers.LinkType
+	segments []*ringSegment // Closed segments, oldest first
+
+	active     *ringSegment
+	file       *os.File
+	counter    *countingWriter
+	writer     *pcapgo.NgWriter
+	interfaces map[ringInterface]int // pcapng interface IDs registered in the active segment
+
+	mu sync.Mutex
+}
+
+// Opens (or creates) a ring buffer directory. Segments left behind by a previous run are
+// adopted so their packets stay carvable, and the size/age bounds are enforced immediately.
+func NewRingBuffer(config *RingBufferConfig, linkType layers.LinkType) (*RingBuffer, error) {
+	if config == nil {
+		return nil, fmt.Errorf("ring buffer config cannot be nil")
+	}
+	if config.Directory == "" {
+		return nil, fmt.Errorf("ring buffer directory cannot be empty")
+	}
+	if config.MaxBytes <= 0 || config.SegmentBytes <= 0 {
+		return nil, fmt.Errorf("ring buffer size limits must be positive")
+	}
+	if config.SegmentBytes > config.MaxBytes {
+		return nil, fmt.Errorf("segment size %d exceeds ring budget %d", config.SegmentBytes, config.MaxBytes)
+	}
+
+	if err := os.MkdirAll(config.Directory, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create ring buffer directory: %w", err)
+	}
+
+	rb := &RingBuffer{
+		config:   *config,
+		linkType: linkType,
+	}
+
+	if err := rb.loadSegments(); err != nil {
+		return nil, err
+	}
+
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	if err := rb.enforceLimits(); err != nil {
+		return nil, err
+	}
+
+	return rb, nil
+}
+
+// Discovers existing segments on disk, finalizing any that were still being written when
+// the previous process exited.
+func (rb *RingBuffer) loadSegments() error {
+	entries, err := os.ReadDir(rb.config.Directory)
+	if err != nil {
+		return fmt.Errorf("failed to read ring buffer directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, segmentPrefix) {
+			continue
+		}
+
+		path := filepath.Join(rb.config.Directory, name)
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("failed to stat segment %s: %w", name, err)
+		}
+
+		var seg *ringSegment
+		if strings.HasSuffix(name, activeSuffix) {
+			seg, err = recoverSegment(path)
+		} else if strings.HasSuffix(name, segmentSuffix) {
+			seg, err = parseSegmentName(path)
+		} else {
+			continue
+		}
+		if err != nil {
+			// A corrupt or foreign file should not prevent capture from starting
+			continue
+		}
+		if seg == nil {
+			os.Remove(path)
+			continue
+		}
+
+		seg.size = info.Size()
+		rb.segments = append(rb.segments, seg)
+	}
+
+	sort.Slice(rb.segments, func(i, j int) bool {
+		return rb.segments[i].first.Before(rb.segments[j].first)
+	})
+	return nil
+}
+
+// Decodes the time range encoded in a closed segment's file name.
+func parseSegmentName(path string) (*ringSegment, error) {
+	name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), segmentPrefix), segmentSuffix)
+	parts := strings.Split(name, "-")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("malformed segment name %s", path)
+	}
+
+	first, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("malformed segment start in %s: %w", path, err)
+	}
+	last, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("malformed segment end in %s: %w", path, err)
+	}
+
+	return &ringSegment{path: path, first: time.Unix(0, first), last: time.Unix(0, last)}, nil
+}
+
+// Scans an unfinished segment to recover its time range and renames it to a closed segment.
+// Returns nil when the file holds no complete packets.
+func recoverSegment(path string) (*ringSegment, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	seg := &ringSegment{}
+	reader, err := pcapgo.NewNgReader(bufio.NewReader(file), pcapgo.DefaultNgReaderOptions)
+	if err == nil {
+		for {
+			// A truncated trailing block from a crash ends the scan like EOF
+			_, ci, err := reader.ReadPacketData()
+			if err != nil {
+				break
+			}
+			if seg.first.IsZero() {
+				seg.first = ci.Timestamp
+			}
+			seg.last = ci.Timestamp
+		}
+	}
+	file.Close()
+
+	if seg.first.IsZero() {
+		return nil, nil
+	}
+
+	seg.path = closedSegmentPath(filepath.Dir(path), seg.first, seg.last)
+	if err := os.Rename(path, seg.path); err != nil {
+		return nil, err
+	}
+	return seg, nil
+}
+
+func closedSegmentPath(dir string, first, last time.Time) string {
+	return filepath.Join(dir, fmt.Sprintf("%s%d-%d%s", segmentPrefix, first.UnixNano(), last.UnixNano(), segmentSuffix))
+}
+
+// Appends a raw packet captured with the ring's default link type.
+func (rb *RingBuffer) Write(ci gopacket.CaptureInfo, data []byte) error {
+	return rb.WriteFrom("", rb.linkType, ci, data)
+}
+
+// Appends a raw packet captured on the named interface, rotating and evicting as the
+// bounds require. Each distinct interface is recorded as its own pcapng interface so
+// packets from sources with different link types can share a segment.
+func (rb *RingBuffer) WriteFrom(source string, linkType layers.LinkType, ci gopacket.CaptureInfo, data []byte) error {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	intf := ringInterface{name: source, linkType: linkType}
+	if rb.active == nil {
+		if err := rb.openSegment(ci.Timestamp, intf); err != nil {
+			return err
+		}
+	}
+
+	id, ok := rb.interfaces[intf]
+	if !ok {
+		var err error
+		if id, err = rb.writer.AddInterface(ngInterface(intf)); err != nil {
+			return fmt.Errorf("failed to register ring interface: %w", err)
+		}
+		rb.interfaces[intf] = id
+	}
+
+	ci.InterfaceIndex = id
+	if err := rb.writer.WritePacket(ci, data); err != nil {
+		return fmt.Errorf("failed to write ring buffer packet: %w", err)
+	}
+
+	if ci.Timestamp.After(rb.active.last) {
+		rb.active.last = ci.Timestamp
+	}
+	rb.active.size = rb.counter.n
+
+	span := rb.active.last.Sub(rb.active.first)
+	if rb.active.size >= rb.config.SegmentBytes ||
+		(rb.config.MaxAge > 0 && span >= rb.config.MaxAge/segmentsPerAge) {
+		if err := rb.closeSegment(); err != nil {
+			return err
+		}
+		return rb.enforceLimits()
+	}
+
+	return nil
+}
+
+func ngInterface(intf ringInterface) pcapgo.NgInterface {
+	ng := pcapgo.DefaultNgInterface
+	ng.LinkType = intf.linkType
+	if intf.name != "" {
+		ng.Name = intf.name
+	}
+	return ng
+}
+
+func (rb *RingBuffer) openSegment(first time.Time, intf ringInterface) error {
+	path := filepath.Join(rb.config.Directory, fmt.Sprintf("%s%d%s", segmentPrefix, first.UnixNano(), activeSuffix))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return fmt.Errorf("failed to create ring segment: %w", err)
+	}
+
+	counter := &countingWriter{w: file}
+	writer, err := pcapgo.NewNgWriterInterface(counter, ngInterface(intf), pcapgo.DefaultNgWriterOptions)
+	if err != nil {
+		file.Close()
+		os.Remove(path)
+		return fmt.Errorf("failed to initialize ring segment: %w", err)
+	}
+
+	rb.active = &ringSegment{path: path, first: first, last: first}
+	rb.file = file
+	rb.counter = counter
+	rb.writer = writer
+	rb.interfaces = map[ringInterface]int{intf: 0}
+	return nil
+}
+
+// Flushes and finalizes the active segment, moving it to the closed list.
+func (rb *RingBuffer) closeSegment() error {
+	if rb.active == nil {
+		return nil
+	}
+
+	seg := rb.active
+	flushErr := rb.writer.Flush()
+	closeErr := rb.file.Close()
+	rb.active, rb.file, rb.counter, rb.writer, rb.interfaces = nil, nil, nil, nil, nil
+
+	if flushErr != nil {
+		return fmt.Errorf("failed to flush ring segment: %w", flushErr)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("failed to close ring segment: %w", closeErr)
+	}
+
+	closedPath := closedSegmentPath(rb.config.Directory, seg.first, seg.last)
+	if err := os.Rename(seg.path, closedPath); err != nil {
+		return fmt.Errorf("failed to finalize ring segment: %w", err)
+	}
+	info, err := os.Stat(closedPath)
+	if err == nil {
+		seg.size = info.Size()
+	}
+	seg.path = closedPath
+
+	rb.segments = append(rb.segments, seg)
+	return nil
+}
+
+// Deletes the oldest closed segments until the ring fits its size and age budget.
+// The active segment is never evicted, so the newest packets are always retained.
+func (rb *RingBuffer) enforceLimits() error {
+	var newest time.Time
+	total := int64(0)
+	for _, seg := range rb.segments {
+		total += seg.size
+		if seg.last.After(newest) {
+			newest = seg.last
+		}
+	}
+	if rb.active != nil {
+		total += rb.active.size
+		if rb.active.last.After(newest) {
+			newest = rb.active.last
+		}
+	}
+
+	for len(rb.segments) > 0 {
+		oldest := rb.segments[0]
+		overSize := total > rb.config.MaxBytes
+		overAge := rb.config.MaxAge > 0 && newest.Sub(oldest.last) > rb.config.MaxAge
+		if !overSize && !overAge {
+			break
+		}
+
+		if err := os.Remove(oldest.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to evict ring segment: %w", err)
+		}
+		total -= oldest.size
+		rb.segments = rb.segments[1:]
+	}
+
+	return nil
+}
+
+// Opens the configured ring buffer once the engine's sources exist. A nil config leaves it disabled.
+func (e *Engine) attachRingBuffer(config *Config) error {
+	if config.RingBuffer == nil || len(e.sources) == 0 {
+		return nil
+	}
+
+	ring, err := NewRingBuffer(config.RingBuffer, e.sources[0].linkType)
+	if err != nil {
+		return fmt.Errorf("failed to open ring buffer: %w", err)
+	}
+	e.ring = ring
+	log.Printf("Ring buffer enabled at %s (%d MB, %v)", config.RingBuffer.Directory,
+		config.RingBuffer.MaxBytes/(1024*1024), config.RingBuffer.MaxAge)
+	return nil
+}
+
+// Returns the time span currently held by the ring, for display and filter defaults.
+func (rb *RingBuffer) Span() (first, last time.Time) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	if len(rb.segments) > 0 {
+		first = rb.segments[0].first
+		last = rb.segments[len(rb.segments)-1].last
+	}
+	if rb.active != nil {
+		if first.IsZero() {
+			first = rb.active.first
+		}
+		last = rb.active.last
+	}
+	return first, last
+}
+
+// Returns the total number of bytes currently retained on disk.
+func (rb *RingBuffer) Size() int64 {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	total := int64(0)
+	for _, seg := range rb.segments {
+		total += seg.size
+	}
+	if rb.active != nil {
+		total += rb.active.size
+	}
+	return total
+}
+
+// Flushes and finalizes the active segment so it survives process exit.
+func (rb *RingBuffer) Close() error {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	if err := rb.closeSegment(); err != nil {
+		return err
+	}
+	// The final flush can push the ring past its budget
+	return rb.enforceLimits()
+}
+
+// Writes every retained packet matching the filter to w as a standalone pcapng stream.
+// Returns the number of packets written.
+func (rb *RingBuffer) Carve(filter CarveFilter, w io.Writer) (int, error) {
+	if filter.Flow == nil && filter.MAC == "" && filter.Start.IsZero() && filter.End.IsZero() {
+		return 0, fmt.Errorf("carve filter must specify a flow, MAC or time window")
+	}
+
+	// Snapshot the segment list under the lock; reading happens without it so a long
+	// export does not stall the capture loop.
+	rb.mu.Lock()
+	segments := make([]ringSegment, 0, len(rb.segments)+1)
+	for _, seg := range rb.segments {
+		segments = append(segments, *seg)
+	}
+	if rb.active != nil {
+		if err := rb.writer.Flush(); err != nil {
+			rb.mu.Unlock()
+			return 0, fmt.Errorf("failed to flush active segment: %w", err)
+		}
+		rb.active.size = rb.counter.n
+		segments = append(segments, *rb.active)
+	}
+	rb.mu.Unlock()
+
+	out := &carveWriter{dst: w, interfaces: make(map[layers.LinkType]int)}
+	matcher := &carveMatcher{filter: filter, decoders: make(map[layers.LinkType]*decoder), fragments: make(map[fragmentKey]bool)}
+	count := 0
+
+	for _, seg := range segments {
+		if !filter.Start.IsZero() && seg.last.Before(filter.Start) {
+			continue
+		}
+		if !filter.End.IsZero() && seg.first.After(filter.End) {
+			continue
+		}
+
+		n, err := carveSegment(seg, matcher, out)
+		count += n
+		if err != nil {
+			return count, err
+		}
+	}
+
+	if out.writer == nil {
+		return 0, nil
+	}
+	if err := out.writer.Flush(); err != nil {
+		return count, fmt.Errorf("failed to flush carved output: %w", err)
+	}
+	return count, nil
+}
+
+// Carves matching packets into a new pcapng file at path. No file is created when nothing matches.
+func (rb *RingBuffer) CarveToFile(filter CarveFilter, path string) (int, error) {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create evidence file: %w", err)
+	}
+
+	count, err := rb.Carve(filter, file)
+	closeErr := file.Close()
+	if err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to close evidence file: %w", closeErr)
+	}
+	if err != nil || count == 0 {
+		os.Remove(tmp)
+		return count, err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return count, fmt.Errorf("failed to finalize evidence file: %w", err)
+	}
+	return count, nil
+}
+
+// Lazily creates the output pcapng writer and registers one interface per link type,
+// so segments recorded from different sources can share one evidence file.
+type carveWriter struct {
+	dst        io.Writer
+	writer     *pcapgo.NgWriter
+	interfaces map[layers.LinkType]int
+}
+
+func (c *carveWriter) write(linkType layers.LinkType, ci gopacket.CaptureInfo, data []byte) error {
+	if c.writer == nil {
+		writer, err := pcapgo.NewNgWriter(c.dst, linkType)
+		if err != nil {
+			return fmt.Errorf("failed to initialize carved output: %w", err)
+		}
+		c.writer = writer
+		c.interfaces[linkType] = 0
+	}
+
+	id, ok := c.interfaces[linkType]
+	if !ok {
+		intf := pcapgo.DefaultNgInterface
+		intf.LinkType = linkType
+		added, err := c.writer.AddInterface(intf)
+		if err != nil {
+			return fmt.Errorf("failed to add carved interface: %w", err)
+		}
+		id = added
+		c.interfaces[linkType] = id
+	}
+
+	ci.InterfaceIndex = id
+	return c.writer.WritePacket(ci, data)
+}
+
+func carveSegment(seg ringSegment, matcher *carveMatcher, out *carveWriter) (int, error) {
+	file, err := os.Open(seg.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil // Evicted between snapshot and read
+		}
+		return 0, fmt.Errorf("failed to open ring segment: %w", err)
+	}
+	defer file.Close()
+
+	// Limit reads to the flushed length so an in-progress segment ends on a block boundary
+	reader, err := pcapgo.NewNgReader(bufio.NewReader(io.LimitReader(file, seg.size)), pcapgo.DefaultNgReaderOptions)
+	if err != nil {
+		return 0, nil
+	}
+
+	count := 0
+	for {
+		data, ci, err := reader.ReadPacketData()
+		if err != nil {
+			break
+		}
+
+		linkType := reader.LinkType()
+		if intf, err := reader.Interface(ci.InterfaceIndex); err == nil {
+			linkType = intf.LinkType
+		}
+
+		if !matcher.matches(linkType, ci, data) {
+			continue
+		}
+		if err := out.write(linkType, ci, data); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Applies a carve filter, decoding packets with the same decapsulating decoder the
+// capture pipeline uses so tunneled flows match on their inner addresses.
+type carveMatcher struct {
+	filter    CarveFilter
+	decoders  map[layers.LinkType]*decoder
+	frame     frame
+	fragments map[fragmentKey]bool // Datagrams whose first fragment matched the flow
+}
+
+// Evaluates the filter against a raw packet. Only packets passing the cheap
+// timestamp check are decoded.
+func (m *carveMatcher) matches(linkType layers.LinkType, ci gopacket.CaptureInfo, data []byte) bool {
+	f := m.filter
+	if !f.Start.IsZero() && ci.Timestamp.Before(f.Start) {
+		return false
+	}
+	if !f.End.IsZero() && ci.Timestamp.After(f.End) {
+		return false
+	}
+	if f.Flow == nil && f.MAC == "" {
+		return true
+	}
+
+	d, ok := m.decoders[linkType]
+	if !ok {
+		d = newDecoder(linkType)
+		m.decoders[linkType] = d
+	}
+	d.decode(data, ci.Timestamp, &m.frame)
+
+	if f.MAC != "" {
+		if m.frame.srcMAC == nil {
+			return false
+		}
+		if !strings.EqualFold(m.frame.srcMAC.String(), f.MAC) && !strings.EqualFold(m.frame.dstMAC.String(), f.MAC) {
+			return false
+		}
+	}
+
+	if f.Flow != nil && !m.matchesFlow(*f.Flow) {
+		return false
+	}
+
+	return true
+}
+
+// Checks the decoded packet against the filter's flow. Fragments are not decoded
+// past the IP layer, so a first fragment is matched on the ports its data starts
+// with, and later fragments on the datagram of a first fragment that matched.
+// Fragments retained before their datagram's first fragment are not carved.
+func (m *carveMatcher) matchesFlow(key models.FlowKey) bool {
+	fr := &m.frame
+	if !fr.fragmented {
+		return matchesFlowKey(fr, key)
+	}
+	datagram := fr.fragmentKey()
+	if fr.fragment.offset != 0 {
+		return m.fragments[datagram]
+	}
+
+	switch fr.protocol {
+	case layers.IPProtocolTCP:
+		fr.transport = layers.LayerTypeTCP
+	case layers.IPProtocolUDP:
+		fr.transport = layers.LayerTypeUDP
+	default:
+		return false
+	}
+	if len(fr.fragment.data) < 4 {
+		return false
+	}
+	fr.srcPort, fr.dstPort = binary.BigEndian.Uint16(fr.fragment.data), binary.BigEndian.Uint16(fr.fragment.data[2:])
+	if !matchesFlowKey(fr, key) {
+		return false
+	}
+	m.fragments[datagram] = true
+	return true
+}
+
+// Checks a decoded packet against a canonical flow key in either direction.
+func matchesFlowKey(fr *frame, key models.FlowKey) bool {
+	if fr.network != layers.LayerTypeIPv4 && fr.network != layers.LayerTypeIPv6 {
+		return false
+	}
+	if fr.vlan != key.VLAN || fr.tunnelID != key.TunnelID {
+		return false
+	}
+	srcIP, dstIP := fr.srcIP.String(), fr.dstIP.String()
+
+	transport := ""
+	switch fr.transport {
+	case layers.LayerTypeTCP:
+		transport = "TCP"
+	case layers.LayerTypeUDP:
+		transport = "UDP"
+	}
+
+	// Stored keys may carry an application label (e.g. "DNS", "TLS") rather than the
+	// transport, so the protocol is only compared when the key names a transport.
+	if (key.Protocol == "TCP" || key.Protocol == "UDP") && key.Protocol != transport {
+		return false
+	}
+
+	forward := srcIP == key.SrcIP && dstIP == key.DstIP && fr.srcPort == key.SrcPort && fr.dstPort == key.DstPort
+	reverse := srcIP == key.DstIP && dstIP == key.SrcIP && fr.srcPort == key.DstPort && fr.dstPort == key.SrcPort
+	return forward || reverse
+}
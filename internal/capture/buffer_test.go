@@ -0,0 +1,256 @@
+/**
+ * Ring Buffer Tests.
+ *
+ * Validates segment rotation, size and age eviction, recovery of
+ * segments left by a previous run, and evidence carving by flow, MAC
+ * address and time window.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package capture
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/kleaSCM/netscope/internal/models"
+)
+
+var (
+	ringClientMAC = net.HardwareAddr{0x00, 0x03, 0x93, 0xAA, 0xBB, 0xCC}
+	ringOtherMAC  = net.HardwareAddr{0x00, 0x03, 0x93, 0x11, 0x22, 0x33}
+	ringRouterMAC = net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+)
+
+// Serializes a TCP segment between two hosts with a payload of the given size.
+func buildRingPacket(t *testing.T, srcMAC, dstMAC net.HardwareAddr, src, dst net.IP, sport, dport uint16, payload int) []byte {
+	t.Helper()
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: src, DstIP: dst}
+	tcp := &layers.TCP{SrcPort: layers.TCPPort(sport), DstPort: layers.TCPPort(dport), ACK: true, Window: 64240}
+	tcp.SetNetworkLayerForChecksum(ip)
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts,
+		&layers.Ethernet{SrcMAC: srcMAC, DstMAC: dstMAC, EthernetType: layers.EthernetTypeIPv4},
+		ip, tcp, gopacket.Payload(make([]byte, payload))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func ringCaptureInfo(ts time.Time, data []byte) gopacket.CaptureInfo {
+	return gopacket.CaptureInfo{Timestamp: ts, CaptureLength: len(data), Length: len(data)}
+}
+
+// Reads every packet back from a carved pcapng stream.
+func readCarved(t *testing.T, data []byte) []gopacket.CaptureInfo {
+	t.Helper()
+	reader, err := pcapgo.NewNgReader(bytes.NewReader(data), pcapgo.DefaultNgReaderOptions)
+	if err != nil {
+		t.Fatalf("Carved output is not valid pcapng: %v", err)
+	}
+
+	var infos []gopacket.CaptureInfo
+	for {
+		_, ci, err := reader.ReadPacketData()
+		if err != nil {
+			break
+		}
+		infos = append(infos, ci)
+	}
+	return infos
+}
+
+// Verifies that the ring rotates segments and keeps its on-disk size within budget.
+func TestRingBuffer_SizeEviction(t *testing.T) {
+	dir := t.TempDir()
+	config := &RingBufferConfig{Directory: dir, MaxBytes: 64 * 1024, SegmentBytes: 8 * 1024}
+
+	ring, err := NewRingBuffer(config, layers.LinkTypeEthernet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC)
+	packet := buildRingPacket(t, ringClientMAC, ringRouterMAC, net.IP{192, 168, 1, 100}, net.IP{93, 184, 216, 34}, 54321, 443, 1000)
+	for i := 0; i < 500; i++ {
+		if err := ring.Write(ringCaptureInfo(start.Add(time.Duration(i)*time.Millisecond), packet), packet); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ring.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) < 2 {
+		t.Fatalf("Expected multiple segments after rotation, got %d", len(entries))
+	}
+
+	total := int64(0)
+	for _, entry := range entries {
+		info, _ := entry.Info()
+		total += info.Size()
+	}
+	if total > config.MaxBytes {
+		t.Errorf("Ring holds %d bytes, budget is %d", total, config.MaxBytes)
+	}
+
+	// The oldest packets must be gone and the newest retained
+	first, last := ring.Span()
+	if !first.After(start) {
+		t.Errorf("Expected oldest packets to be evicted, ring still starts at %v", first)
+	}
+	if want := start.Add(499 * time.Millisecond); !last.Equal(want) {
+		t.Errorf("Expected newest packet at %v, got %v", want, last)
+	}
+}
+
+// Verifies that segments older than MaxAge, measured against packet time, are evicted.
+func TestRingBuffer_AgeEviction(t *testing.T) {
+	config := &RingBufferConfig{Directory: t.TempDir(), MaxBytes: 1 << 30, SegmentBytes: 1 << 20, MaxAge: 10 * time.Minute}
+	ring, err := NewRingBuffer(config, layers.LinkTypeEthernet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ring.Close()
+
+	start := time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC)
+	packet := buildRingPacket(t, ringClientMAC, ringRouterMAC, net.IP{192, 168, 1, 100}, net.IP{93, 184, 216, 34}, 54321, 443, 10)
+	gap := 10 * time.Second
+	for i := 0; i <= 360; i++ {
+		if err := ring.Write(ringCaptureInfo(start.Add(time.Duration(i)*gap), packet), packet); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Eviction is per segment, so up to one segment span beyond MaxAge may remain
+	first, last := ring.Span()
+	if age := last.Sub(first); age > config.MaxAge+config.MaxAge/segmentsPerAge+gap {
+		t.Errorf("Ring spans %v, expected at most about %v", age, config.MaxAge)
+	}
+}
+
+// Verifies carving by flow (both directions, fragments included), MAC and time window,
+// including unflushed packets.
+func TestRingBuffer_Carve(t *testing.T) {
+	ring, err := NewRingBuffer(&RingBufferConfig{Directory: t.TempDir(), MaxBytes: 1 << 20, SegmentBytes: 1 << 20}, layers.LinkTypeEthernet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ring.Close()
+
+	client, server, other := net.IP{192, 168, 1, 100}, net.IP{93, 184, 216, 34}, net.IP{192, 168, 1, 50}
+	start := time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC)
+	packets := [][]byte{
+		buildRingPacket(t, ringClientMAC, ringRouterMAC, client, server, 54321, 443, 10),
+		buildRingPacket(t, ringRouterMAC, ringClientMAC, server, client, 443, 54321, 10),
+		buildRingPacket(t, ringOtherMAC, ringRouterMAC, other, server, 40000, 443, 10),
+		buildRingPacket(t, ringClientMAC, ringRouterMAC, client, server, 54321, 443, 10),
+	}
+	// A DNS response fragmented in three, only the first of which carries the ports
+	resolver := net.IP{8, 8, 8, 8}
+	packets = append(packets, fragmentIPv4(buildLargeDNSResponse(t, resolver, client, false), 77,
+		fragmentCut{0, 512, true}, fragmentCut{512, 512, true}, fragmentCut{1024, 0, false})...)
+	for i, data := range packets {
+		if err := ring.Write(ringCaptureInfo(start.Add(time.Duration(i)*time.Second), data), data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter CarveFilter
+		want   int
+	}{
+		{"flow both directions", CarveFilter{Flow: &models.FlowKey{SrcIP: "192.168.1.100", DstIP: "93.184.216.34", SrcPort: 54321, DstPort: 443, Protocol: "TCP"}}, 3},
+		{"flow with application label", CarveFilter{Flow: &models.FlowKey{SrcIP: "192.168.1.100", DstIP: "93.184.216.34", SrcPort: 54321, DstPort: 443, Protocol: "TLS"}}, 3},
+		{"flow wrong transport", CarveFilter{Flow: &models.FlowKey{SrcIP: "192.168.1.100", DstIP: "93.184.216.34", SrcPort: 54321, DstPort: 443, Protocol: "UDP"}}, 0},
+		{"mac", CarveFilter{MAC: "00:03:93:11:22:33"}, 1},
+		{"time window", CarveFilter{Start: start.Add(time.Second), End: start.Add(2 * time.Second)}, 2},
+		{"fragmented datagram", CarveFilter{Flow: &models.FlowKey{SrcIP: "192.168.1.100", DstIP: "8.8.8.8", SrcPort: 40000, DstPort: 53, Protocol: "UDP"}}, 3},
+		{"fragments of another flow", CarveFilter{Flow: &models.FlowKey{SrcIP: "192.168.1.100", DstIP: "8.8.8.8", SrcPort: 40001, DstPort: 53, Protocol: "UDP"}}, 0},
+		{"flow within window", CarveFilter{Flow: &models.FlowKey{SrcIP: "192.168.1.100", DstIP: "93.184.216.34", SrcPort: 54321, DstPort: 443}, Start: start.Add(2 * time.Second)}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			count, err := ring.Carve(tt.filter, &out)
+			if err != nil {
+				t.Fatalf("Carve failed: %v", err)
+			}
+			if count != tt.want {
+				t.Fatalf("Expected %d packets, got %d", tt.want, count)
+			}
+			if count > 0 {
+				if got := len(readCarved(t, out.Bytes())); got != tt.want {
+					t.Errorf("Expected %d packets in output, read back %d", tt.want, got)
+				}
+			}
+		})
+	}
+
+	t.Run("empty filter rejected", func(t *testing.T) {
+		if _, err := ring.Carve(CarveFilter{}, &bytes.Buffer{}); err == nil {
+			t.Error("Expected an error for an empty filter")
+		}
+	})
+}
+
+// Verifies that a segment left unfinished by a crashed run is recovered and carvable.
+func TestRingBuffer_Recovery(t *testing.T) {
+	dir := t.TempDir()
+	config := &RingBufferConfig{Directory: dir, MaxBytes: 1 << 20, SegmentBytes: 1 << 20}
+
+	ring, err := NewRingBuffer(config, layers.LinkTypeEthernet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC)
+	packet := buildRingPacket(t, ringClientMAC, ringRouterMAC, net.IP{192, 168, 1, 100}, net.IP{93, 184, 216, 34}, 54321, 443, 10)
+	for i := 0; i < 3; i++ {
+		if err := ring.Write(ringCaptureInfo(start.Add(time.Duration(i)*time.Second), packet), packet); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Simulate a crash: flush what was written but never finalize the segment
+	ring.writer.Flush()
+	ring.file.Close()
+
+	reopened, err := NewRingBuffer(config, layers.LinkTypeEthernet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+
+	matches, _ := filepath.Glob(filepath.Join(dir, "*"+activeSuffix))
+	if len(matches) != 0 {
+		t.Errorf("Expected unfinished segment to be finalized, found %v", matches)
+	}
+
+	out := filepath.Join(t.TempDir(), "evidence.pcapng")
+	count, err := reopened.CarveToFile(CarveFilter{MAC: ringClientMAC.String()}, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 recovered packets, got %d", count)
+	}
+	if _, err := os.Stat(out); err != nil {
+		t.Errorf("Expected evidence file to exist: %v", err)
+	}
+}
@@ -0,0 +1,449 @@
+/**
+ * Single-Pass Packet Decoder.
+ *
+ * Decodes each captured frame exactly once with gopacket decoding layers
+ * that are reused from packet to packet, and copies out the fields later
+ * stages need into a compact frame. Every protocol parser runs once per
+ * packet; its result travels downstream in the frame instead of being
+ * recomputed from a full gopacket.Packet.
+ *
+ * VLAN tags, MPLS label stacks and GRE, ERSPAN, VXLAN, GTP-U and IP-in-IP
+ * tunnels are peeled off so that identity, DNS and TLS come from the
+ * innermost packet, while the outer VLAN and tunnel ID are kept with it.
+ * Ethernet, Linux cooked (v1 and v2), loopback, raw IP and PPP links are
+ * understood; on links without MAC addresses the frame simply has none.
+ * IPv4 and IPv6 fragments stop at the network layer; their transport is
+ * decoded once the reader has reassembled the whole datagram.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package capture
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/kleaSCM/netscope/internal/models"
+	"github.com/kleaSCM/netscope/internal/parser"
+)
+
+// Fields of one decoded frame. Address and payload slices alias the captured data,
+// which each packet owns, so a frame stays valid after the decoder moves on.
+type frame struct {
+	srcMAC    net.HardwareAddr // nil when the link layer carries no Ethernet addresses
+	dstMAC    net.HardwareAddr
+	network   gopacket.LayerType // IPv4, IPv6, ARP, or zero when undecoded
+	srcIP     net.IP
+	dstIP     net.IP
+	protocol  layers.IPProtocol
+	ttl       uint8              // TTL or hop limit
+	ipHeader  []byte             // Innermost IP header, for SYN fingerprints
+	transport gopacket.LayerType // TCP, UDP, ICMPv4, ICMPv6, or zero
+	srcPort   uint16
+	dstPort   uint16
+	payload   []byte // Transport payload
+	seq       uint32 // TCP sequence number
+	syn       bool   // TCP SYN flag
+	ack       bool   // TCP ACK flag
+	fin       bool   // TCP FIN flag
+	rst       bool   // TCP RST flag
+	tcpHeader []byte // TCP header with options, for SYN fingerprints
+	arp       []byte // ARP packet, for the neighbor table
+	icmpv6    []byte // ICMPv6 message with its header, for Neighbor Discovery
+
+	// Encapsulation outside the innermost packet
+	vlan     uint16 // Outermost 802.1Q VLAN ID, 0 when untagged
+	tunnel   string // Outermost tunnel type (e.g. "VXLAN"), empty when not tunneled
+	tunnelID uint32 // VNI, GRE key, GTP TEID, ERSPAN session or MPLS VPN label
+
+	// IP fragmentation of the innermost packet
+	fragmented  bool       // The packet is one fragment of a larger datagram
+	fragment    ipFragment // Valid only when fragmented
+	overlapping bool       // Reassembled from fragments that overlapped
+
+	malformed bool // A decoding layer panicked on the data; no other field is set
+
+	// Application results, parsed once here and reused by every later stage
+	dnsQuery    *parser.DNSQuery
+	dnsResponse *parser.DNSResponse
+	dns         *models.DNS
+
+	flowHash uint64 // Symmetric conversation hash used to pick a worker
+}
+
+// One IPv4 or IPv6 fragment, as needed to rebuild its datagram.
+type ipFragment struct {
+	id     uint32 // IPv4 identification or IPv6 fragment identification
+	offset int    // Byte offset of data within the datagram's payload
+	more   bool   // More fragments follow
+	header []byte // IP header, excluding any IPv6 fragment header
+	data   []byte // Fragment payload
+}
+
+// Reusable decoding state for one packet source. Not safe for concurrent use.
+type decoder struct {
+	first  gopacket.LayerType
+	raw    bool // Frames start at an IP header of either version
+	layers gopacket.DecodingLayerContainer
+
+	eth     layers.Ethernet
+	dot1q   layers.Dot1Q
+	sll     layers.LinuxSLL
+	sll2    linuxSLL2
+	loop    layers.Loopback
+	pppoe   pppoeSession
+	ppp     pppFrame
+	mpls    mplsStack
+	ip4     layers.IPv4
+	ip6     layers.IPv6
+	ip6frag ipv6Fragment
+	arp     layers.ARP
+	gre     layers.GRE
+	erspan  layers.ERSPANII
+	tcp     layers.TCP
+	udp     layers.UDP
+	vxlan   layers.VXLAN
+	gtp     layers.GTPv1U
+	icmp4   layers.ICMPv4
+	icmp6   layers.ICMPv6
+	dns     layers.DNS
+	payload gopacket.Payload
+}
+
+// Creates a decoder for frames of the given link type. Link types without a
+// decoding layer (such as 802.11 monitor mode) yield empty frames.
+func newDecoder(linkType layers.LinkType) *decoder {
+	d := &decoder{raw: isRawIPLinkType(linkType)}
+
+	switch linkType {
+	case layers.LinkTypeEthernet:
+		d.first = layers.LayerTypeEthernet
+	case layers.LinkTypeLinuxSLL:
+		d.first = layers.LayerTypeLinuxSLL
+	case linkTypeLinuxSLL2:
+		d.first = layerTypeLinuxSLL2
+	case layers.LinkTypeNull, layers.LinkTypeLoop:
+		d.first = layers.LayerTypeLoopback
+	case layers.LinkTypePPP, layers.LinkTypePPP_HDLC:
+		d.first = layers.LayerTypePPP
+	case layers.LinkTypePPPEthernet:
+		d.first = layers.LayerTypePPPoE
+	}
+
+	d.layers = gopacket.DecodingLayerSparse(nil)
+	for _, layer := range []gopacket.DecodingLayer{
+		&d.eth, &d.dot1q, &d.sll, &d.sll2, &d.loop, &d.pppoe, &d.ppp, &d.mpls,
+		&d.ip4, &d.ip6, &d.ip6frag, &d.arp, &d.gre, &d.erspan,
+		&d.tcp, &d.udp, &d.vxlan, &d.gtp, &d.icmp4, &d.icmp6,
+		&d.dns, &d.payload,
+	} {
+		d.layers = d.layers.Put(layer)
+	}
+
+	return d
+}
+
+// Reports whether the decoder has a first layer for its link type.
+func (d *decoder) decodes() bool {
+	return d.raw || d.first != gopacket.LayerTypeZero
+}
+
+// Decodes data into f, descending through any encapsulation. Layers are walked one
+// at a time rather than with DecodeLayers because a tunnel repeats layer types:
+// each layer's fields are captured before the inner layer of the same type
+// overwrites them. Layers decoded before an error are still recorded, so a
+// truncated or malformed packet keeps whatever identity it had. A layer that
+// indexes past its input instead leaves the frame marked malformed and empty.
+func (d *decoder) decode(data []byte, timestamp time.Time, f *frame) {
+	*f = frame{}
+
+	first := d.first
+	if d.raw {
+		first = rawIPLayerType(data)
+	}
+	d.walk(first, data, timestamp, f)
+}
+
+// Decodes a reassembled IP datagram into f. Link-layer addresses and encapsulation
+// come from the frame of the datagram's first fragment, since the datagram itself
+// starts at the IP header.
+func (d *decoder) decodeDatagram(outer frame, data []byte, timestamp time.Time, f *frame) {
+	*f = frame{
+		srcMAC:   outer.srcMAC,
+		dstMAC:   outer.dstMAC,
+		vlan:     outer.vlan,
+		tunnel:   outer.tunnel,
+		tunnelID: outer.tunnelID,
+	}
+	d.walk(rawIPLayerType(data), data, timestamp, f)
+}
+
+// Walks layers from first, recording each into f.
+func (d *decoder) walk(first gopacket.LayerType, data []byte, timestamp time.Time, f *frame) {
+	var networkFlow, transportFlow gopacket.Flow
+	hasDNS := false
+
+	// A few gopacket layers index past short input. The fields recorded so far may
+	// belong to a layer that was only partly read, so none of them are kept.
+	defer func() {
+		if r := recover(); r != nil {
+			if !isOutOfRange(r) {
+				panic(r)
+			}
+			*f = frame{malformed: true}
+			return
+		}
+		d.finish(f, timestamp, hasDNS, networkFlow, transportFlow)
+	}()
+
+	var network []byte // Data from the start of the innermost IP header
+	previous := gopacket.LayerTypeZero
+	for layerType := first; layerType != gopacket.LayerTypeZero && len(data) > 0; {
+		layer, ok := d.layers.Decoder(layerType)
+		if !ok || layer.DecodeFromBytes(data, gopacket.NilDecodeFeedback) != nil {
+			return
+		}
+
+		switch layerType {
+		case layers.LayerTypeEthernet:
+			// Bridged tunnels (VXLAN, ERSPAN, GRE TEB) carry the inner hosts' addresses
+			f.srcMAC = d.eth.SrcMAC
+			f.dstMAC = d.eth.DstMAC
+		case layers.LayerTypeLinuxSLL:
+			f.srcMAC = cookedSourceMAC(d.sll.AddrType, d.sll.Addr)
+		case layerTypeLinuxSLL2:
+			f.srcMAC = cookedSourceMAC(d.sll2.addrType, d.sll2.addr)
+		case layers.LayerTypeDot1Q:
+			if f.vlan == 0 {
+				f.vlan = d.dot1q.VLANIdentifier
+			}
+		case layers.LayerTypeMPLS:
+			f.setTunnel("MPLS", d.mpls.label)
+		case layers.LayerTypeIPv4, layers.LayerTypeIPv6:
+			if previous == layers.LayerTypeIPv4 || previous == layers.LayerTypeIPv6 {
+				f.setTunnel("IP-in-IP", 0)
+			}
+			f.network = layerType
+			f.clearTransport()
+			transportFlow = gopacket.Flow{}
+			network = data
+			if layerType == layers.LayerTypeIPv4 {
+				f.srcIP, f.dstIP = d.ip4.SrcIP, d.ip4.DstIP
+				f.protocol = d.ip4.Protocol
+				f.ttl = d.ip4.TTL
+				f.ipHeader = d.ip4.Contents
+				networkFlow = d.ip4.NetworkFlow()
+				if d.ip4.Flags&layers.IPv4MoreFragments != 0 || d.ip4.FragOffset != 0 {
+					f.setFragment(ipFragment{
+						id:     uint32(d.ip4.Id),
+						offset: int(d.ip4.FragOffset) * 8,
+						more:   d.ip4.Flags&layers.IPv4MoreFragments != 0,
+						header: d.ip4.Contents,
+						data:   d.ip4.Payload,
+					})
+				}
+			} else {
+				f.srcIP, f.dstIP = d.ip6.SrcIP, d.ip6.DstIP
+				f.protocol = d.ip6.NextHeader
+				f.ttl = d.ip6.HopLimit
+				f.ipHeader = d.ip6.Contents
+				networkFlow = d.ip6.NetworkFlow()
+			}
+		case layers.LayerTypeIPv6Fragment:
+			f.protocol = d.ip6frag.nextHeader
+			if d.ip6frag.offset != 0 || d.ip6frag.more {
+				f.setFragment(ipFragment{
+					id:     d.ip6frag.id,
+					offset: d.ip6frag.offset,
+					more:   d.ip6frag.more,
+					header: network[:cap(network)-cap(data)], // Ends where the fragment header starts
+					data:   d.ip6frag.Payload,
+				})
+			}
+		case layers.LayerTypeARP:
+			f.network = layerType
+			f.srcIP, f.dstIP = d.arp.SourceProtAddress, d.arp.DstProtAddress
+			f.arp = d.arp.Contents
+			f.clearTransport()
+			transportFlow = gopacket.Flow{}
+		case layers.LayerTypeGRE:
+			f.setTunnel("GRE", d.gre.Key)
+		case layers.LayerTypeERSPANII:
+			// ERSPAN rides inside GRE; the session identifies the mirror better than the key
+			if f.tunnel == "GRE" {
+				f.tunnel, f.tunnelID = "", 0
+			}
+			f.setTunnel("ERSPAN", uint32(d.erspan.SessionID))
+		case layers.LayerTypeVXLAN:
+			f.setTunnel("VXLAN", d.vxlan.VNI)
+		case layers.LayerTypeGTPv1U:
+			f.setTunnel("GTP-U", d.gtp.TEID)
+		case layers.LayerTypeTCP:
+			f.transport = layerType
+			f.srcPort, f.dstPort = uint16(d.tcp.SrcPort), uint16(d.tcp.DstPort)
+			f.payload = d.tcp.Payload
+			f.seq = d.tcp.Seq
+			f.syn, f.ack, f.fin, f.rst = d.tcp.SYN, d.tcp.ACK, d.tcp.FIN, d.tcp.RST
+			f.tcpHeader = d.tcp.Contents
+			transportFlow = d.tcp.TransportFlow()
+		case layers.LayerTypeUDP:
+			f.transport = layerType
+			f.srcPort, f.dstPort = uint16(d.udp.SrcPort), uint16(d.udp.DstPort)
+			f.payload = d.udp.Payload
+			transportFlow = d.udp.TransportFlow()
+		case layers.LayerTypeICMPv4, layers.LayerTypeICMPv6:
+			f.transport = layerType
+			if layerType == layers.LayerTypeICMPv6 {
+				f.icmpv6 = data
+			}
+		case layers.LayerTypeDNS:
+			// DNS over TCP is length-prefixed and may span segments; the workers'
+			// stream reassembly parses it
+			hasDNS = f.transport == layers.LayerTypeUDP
+		}
+
+		previous = layerType
+		layerType = layer.NextLayerType()
+		data = layer.LayerPayload()
+	}
+}
+
+// Completes a frame once the innermost layer is known: parses DNS against the
+// innermost addresses and derives the flow hash.
+func (d *decoder) finish(f *frame, timestamp time.Time, hasDNS bool, networkFlow, transportFlow gopacket.Flow) {
+	if hasDNS {
+		// The DNS layer reuses its name buffers, so results are copied out before the next packet
+		f.dnsQuery, f.dnsResponse = parser.ParseDNSLayer(&d.dns, timestamp, f.srcIP.String(), f.dstIP.String())
+		f.dns = dnsModel(f.dnsQuery, f.dnsResponse)
+	}
+
+	// Flow hashes are symmetric, so both directions of a conversation share a worker.
+	// ARP has no network flow and is sharded by its link-layer endpoints.
+	switch {
+	case f.network == layers.LayerTypeIPv4 || f.network == layers.LayerTypeIPv6:
+		f.flowHash = networkFlow.FastHash()
+		if f.transport == layers.LayerTypeTCP || f.transport == layers.LayerTypeUDP {
+			f.flowHash = f.flowHash*31 + transportFlow.FastHash()
+		}
+	case f.srcMAC != nil:
+		f.flowHash = gopacket.NewFlow(layers.EndpointMAC, f.srcMAC, f.dstMAC).FastHash()
+	}
+}
+
+// Records the outermost tunnel; inner tunnels do not replace it.
+func (f *frame) setTunnel(tunnel string, id uint32) {
+	if f.tunnel == "" {
+		f.tunnel, f.tunnelID = tunnel, id
+	}
+}
+
+// Marks the innermost packet as a fragment of a larger datagram.
+func (f *frame) setFragment(fragment ipFragment) {
+	f.fragmented = true
+	f.fragment = fragment
+}
+
+// Forgets transport and fragment fields when a new network layer starts, so an outer
+// UDP header is never reported with an inner packet that has no transport of its own.
+func (f *frame) clearTransport() {
+	f.transport = gopacket.LayerTypeZero
+	f.srcPort, f.dstPort = 0, 0
+	f.payload = nil
+	f.seq, f.syn, f.ack, f.fin, f.rst = 0, false, false, false, false
+	f.tcpHeader = nil
+	f.icmpv6 = nil
+	f.fragmented = false
+	f.fragment = ipFragment{}
+}
+
+// Reports whether a recovered panic is a runtime index or slice bounds error, the
+// way gopacket layers fail on input shorter than they expect.
+func isOutOfRange(r interface{}) bool {
+	err, ok := r.(runtime.Error)
+	return ok && strings.Contains(err.Error(), "out of range")
+}
+
+var errMPLSTruncated = errors.New("MPLS label stack truncated")
+
+// Decodes a whole MPLS label stack as one layer, since gopacket's MPLS layer is
+// not a DecodingLayer. Keeps the bottom label, which identifies the VPN in L3VPNs.
+type mplsStack struct {
+	layers.BaseLayer
+	label uint32
+}
+
+func (m *mplsStack) LayerType() gopacket.LayerType { return layers.LayerTypeMPLS }
+
+func (m *mplsStack) CanDecode() gopacket.LayerClass { return layers.LayerTypeMPLS }
+
+func (m *mplsStack) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	for offset := 0; offset+4 <= len(data); offset += 4 {
+		entry := binary.BigEndian.Uint32(data[offset:])
+		if entry&0x100 != 0 { // Bottom of stack
+			m.label = entry >> 12
+			m.BaseLayer = layers.BaseLayer{Contents: data[:offset+4], Payload: data[offset+4:]}
+			return nil
+		}
+	}
+	return errMPLSTruncated
+}
+
+// MPLS carries no payload type; IP is recognized by its version nibble.
+func (m *mplsStack) NextLayerType() gopacket.LayerType {
+	if len(m.Payload) == 0 {
+		return gopacket.LayerTypeZero
+	}
+	switch m.Payload[0] >> 4 {
+	case 4:
+		return layers.LayerTypeIPv4
+	case 6:
+		return layers.LayerTypeIPv6
+	}
+	return gopacket.LayerTypeZero
+}
+
+var errIPv6FragmentTruncated = errors.New("IPv6 fragment header truncated")
+
+// Decodes the IPv6 fragment extension header, which gopacket does not offer as a
+// DecodingLayer. Decoding stops after it unless the fragment is atomic.
+type ipv6Fragment struct {
+	layers.BaseLayer
+	nextHeader layers.IPProtocol
+	offset     int
+	more       bool
+	id         uint32
+}
+
+func (i *ipv6Fragment) LayerType() gopacket.LayerType { return layers.LayerTypeIPv6Fragment }
+
+func (i *ipv6Fragment) CanDecode() gopacket.LayerClass { return layers.LayerTypeIPv6Fragment }
+
+func (i *ipv6Fragment) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 8 {
+		df.SetTruncated()
+		return errIPv6FragmentTruncated
+	}
+	i.nextHeader = layers.IPProtocol(data[0])
+	offsetFlags := binary.BigEndian.Uint16(data[2:4])
+	i.offset = int(offsetFlags>>3) * 8
+	i.more = offsetFlags&1 != 0
+	i.id = binary.BigEndian.Uint32(data[4:8])
+	i.BaseLayer = layers.BaseLayer{Contents: data[:8], Payload: data[8:]}
+	return nil
+}
+
+// An atomic fragment (offset 0, no more fragments) is a whole packet and decodes on.
+func (i *ipv6Fragment) NextLayerType() gopacket.LayerType {
+	if i.offset != 0 || i.more {
+		return gopacket.LayerTypeFragment
+	}
+	return i.nextHeader.LayerType()
+}
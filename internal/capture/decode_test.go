@@ -0,0 +1,554 @@
+/**
+ * Packet Decoder Tests.
+ *
+ * Validates that the single-pass decoder extracts the same identity and
+ * application results the full gopacket decode did, and benchmarks both
+ * paths over representative packet mixes to track allocations per packet.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package capture
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/kleaSCM/netscope/internal/parser"
+)
+
+var (
+	decodeClient = net.IP{192, 168, 1, 100}
+	decodeServer = net.IP{93, 184, 216, 34}
+	decodeDNS    = net.IP{8, 8, 8, 8}
+)
+
+// Serializes an Ethernet frame from the given layers, fixing lengths and checksums.
+func serializeFrame(tb testing.TB, stack ...gopacket.SerializableLayer) []byte {
+	tb.Helper()
+	// Each transport checksums against the nearest network layer outside it
+	var network gopacket.NetworkLayer
+	for _, layer := range stack {
+		if transport, ok := layer.(interface {
+			SetNetworkLayerForChecksum(gopacket.NetworkLayer) error
+		}); ok && network != nil {
+			transport.SetNetworkLayerForChecksum(network)
+		}
+		if n, ok := layer.(gopacket.NetworkLayer); ok {
+			network = n
+		}
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, stack...); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// Builds a TLS record holding a Client Hello with the given SNI and one supported group.
+func buildClientHello(sni string) []byte {
+	var ext []byte
+	ext = binary.BigEndian.AppendUint16(ext, 0) // server_name
+	ext = binary.BigEndian.AppendUint16(ext, uint16(len(sni)+5))
+	ext = binary.BigEndian.AppendUint16(ext, uint16(len(sni)+3))
+	ext = append(ext, 0) // host_name
+	ext = binary.BigEndian.AppendUint16(ext, uint16(len(sni)))
+	ext = append(ext, sni...)
+	ext = append(ext, 0x00, 0x0a, 0x00, 0x04, 0x00, 0x02, 0x00, 0x1d) // supported_groups: x25519
+
+	body := []byte{0x03, 0x03}
+	body = append(body, make([]byte, 32)...)                // random
+	body = append(body, 0x00)                               // session ID
+	body = append(body, 0x00, 0x04, 0x13, 0x01, 0xc0, 0x2f) // cipher suites
+	body = append(body, 0x01, 0x00)                         // compression methods
+	body = binary.BigEndian.AppendUint16(body, uint16(len(ext)))
+	body = append(body, ext...)
+
+	handshake := []byte{0x01, byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))}
+	handshake = append(handshake, body...)
+
+	record := []byte{0x16, 0x03, 0x01}
+	record = binary.BigEndian.AppendUint16(record, uint16(len(handshake)))
+	return append(record, handshake...)
+}
+
+func ethernetTo(etherType layers.EthernetType) *layers.Ethernet {
+	return &layers.Ethernet{SrcMAC: ringClientMAC, DstMAC: ringRouterMAC, EthernetType: etherType}
+}
+
+func ipv4Between(src, dst net.IP, protocol layers.IPProtocol) *layers.IPv4 {
+	return &layers.IPv4{Version: 4, TTL: 64, Protocol: protocol, SrcIP: src, DstIP: dst}
+}
+
+// Returns one frame of each kind the pipeline commonly sees, keyed by name.
+func decodeTestFrames(tb testing.TB) map[string][]byte {
+	tb.Helper()
+	question := []layers.DNSQuestion{{Name: []byte("example.com"), Type: layers.DNSTypeA, Class: layers.DNSClassIN}}
+
+	return map[string][]byte{
+		"dns query": serializeFrame(tb, ethernetTo(layers.EthernetTypeIPv4),
+			ipv4Between(decodeClient, decodeDNS, layers.IPProtocolUDP),
+			&layers.UDP{SrcPort: 40000, DstPort: 53},
+			&layers.DNS{ID: 7, RD: true, Questions: question}),
+		"dns response": serializeFrame(tb, ethernetTo(layers.EthernetTypeIPv4),
+			ipv4Between(decodeDNS, decodeClient, layers.IPProtocolUDP),
+			&layers.UDP{SrcPort: 53, DstPort: 40000},
+			&layers.DNS{ID: 7, QR: true, RD: true, RA: true, Questions: question, Answers: []layers.DNSResourceRecord{{
+				Name: []byte("example.com"), Type: layers.DNSTypeA, Class: layers.DNSClassIN, TTL: 300, IP: decodeServer,
+			}}}),
+		"tls client hello": serializeFrame(tb, ethernetTo(layers.EthernetTypeIPv4),
+			ipv4Between(decodeClient, decodeServer, layers.IPProtocolTCP),
+			&layers.TCP{SrcPort: 54321, DstPort: 443, PSH: true, ACK: true, Window: 64240},
+			gopacket.Payload(buildClientHello("example.com"))),
+		"tcp data": serializeFrame(tb, ethernetTo(layers.EthernetTypeIPv4),
+			ipv4Between(decodeServer, decodeClient, layers.IPProtocolTCP),
+			&layers.TCP{SrcPort: 443, DstPort: 54321, ACK: true, Window: 64240},
+			gopacket.Payload(make([]byte, 1200))),
+		"vlan udp": serializeFrame(tb, ethernetTo(layers.EthernetTypeDot1Q),
+			&layers.Dot1Q{VLANIdentifier: 20, Type: layers.EthernetTypeIPv4},
+			ipv4Between(decodeClient, decodeServer, layers.IPProtocolUDP),
+			&layers.UDP{SrcPort: 40001, DstPort: 123},
+			gopacket.Payload(make([]byte, 48))),
+		"ipv6 tcp": serializeFrame(tb, ethernetTo(layers.EthernetTypeIPv6),
+			&layers.IPv6{Version: 6, HopLimit: 128, NextHeader: layers.IPProtocolTCP,
+				SrcIP: net.ParseIP("2001:db8::1"), DstIP: net.ParseIP("2001:db8::2")},
+			&layers.TCP{SrcPort: 50000, DstPort: 22, SYN: true, Window: 64240}),
+		"icmp": serializeFrame(tb, ethernetTo(layers.EthernetTypeIPv4),
+			ipv4Between(decodeClient, decodeServer, layers.IPProtocolICMPv4),
+			&layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeEchoRequest, 0)}),
+		"dhcp discover": serializeFrame(tb, ethernetTo(layers.EthernetTypeIPv4),
+			ipv4Between(net.IPv4zero, net.IPv4bcast, layers.IPProtocolUDP),
+			&layers.UDP{SrcPort: 68, DstPort: 67},
+			&layers.DHCPv4{Operation: layers.DHCPOpRequest, HardwareType: layers.LinkTypeEthernet, HardwareLen: 6,
+				ClientIP: net.IPv4zero, YourClientIP: net.IPv4zero, NextServerIP: net.IPv4zero, RelayAgentIP: net.IPv4zero,
+				ClientHWAddr: ringClientMAC, Options: layers.DHCPOptions{
+					layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(layers.DHCPMsgTypeDiscover)}),
+					layers.NewDHCPOption(layers.DHCPOptHostname, []byte("living-room-tv")),
+				}}),
+		"ssdp notify": serializeFrame(tb, ethernetTo(layers.EthernetTypeIPv4),
+			ipv4Between(decodeClient, net.IP{239, 255, 255, 250}, layers.IPProtocolUDP),
+			&layers.UDP{SrcPort: 1900, DstPort: 1900},
+			gopacket.Payload("NOTIFY * HTTP/1.1\r\nNT: urn:schemas-upnp-org:device:ZonePlayer:1\r\n"+
+				"NTS: ssdp:alive\r\nSERVER: Linux UPnP/1.0 Sonos/70.3-35220 (ZPS1)\r\n\r\n")),
+		"arp": serializeFrame(tb, ethernetTo(layers.EthernetTypeARP),
+			&layers.ARP{AddrType: layers.LinkTypeEthernet, Protocol: layers.EthernetTypeIPv4,
+				HwAddressSize: 6, ProtAddressSize: 4, Operation: layers.ARPRequest,
+				SourceHwAddress: ringClientMAC, SourceProtAddress: decodeClient.To4(),
+				DstHwAddress: make([]byte, 6), DstProtAddress: net.IP{192, 168, 1, 1}.To4()}),
+		"ndp advertisement": serializeFrame(tb, ethernetTo(layers.EthernetTypeIPv6),
+			&layers.IPv6{Version: 6, HopLimit: 255, NextHeader: layers.IPProtocolICMPv6,
+				SrcIP: net.ParseIP("fe80::1"), DstIP: net.ParseIP("ff02::1")},
+			&layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypeNeighborAdvertisement, 0)},
+			&layers.ICMPv6NeighborAdvertisement{Flags: 0x20, TargetAddress: net.ParseIP("fe80::1"), Options: layers.ICMPv6Options{
+				{Type: layers.ICMPv6OptTargetAddress, Data: ringClientMAC},
+			}}),
+	}
+}
+
+// Decodes one frame through the same steps the pipeline uses.
+func decodeForTest(t *testing.T, data []byte) PacketInfo {
+	t.Helper()
+	return decodeLinkForTest(t, layers.LinkTypeEthernet, data)
+}
+
+// Decodes one frame of the given link type through the same steps the pipeline uses.
+func decodeLinkForTest(t *testing.T, linkType layers.LinkType, data []byte) PacketInfo {
+	t.Helper()
+	sp := &sourcedPacket{
+		data:   data,
+		ci:     ringCaptureInfo(time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC), data),
+		source: &captureSource{name: "eth0", linkType: linkType},
+	}
+	newDecoder(linkType).decode(sp.data, sp.ci.Timestamp, &sp.frame)
+	return (&Engine{}).extractPacketInfo(sp)
+}
+
+// Verifies the packet summary produced from a single decode for each kind of frame.
+func TestDecoder_PacketInfo(t *testing.T) {
+	frames := decodeTestFrames(t)
+
+	tests := []struct {
+		name     string
+		protocol string
+		srcIP    string
+		dstPort  uint16
+	}{
+		{"dns query", "DNS", "192.168.1.100", 53},
+		{"dns response", "DNS", "8.8.8.8", 40000},
+		{"tls client hello", "TLS", "192.168.1.100", 443},
+		{"tcp data", "TCP", "93.184.216.34", 54321},
+		{"vlan udp", "UDP", "192.168.1.100", 123},
+		{"ipv6 tcp", "TCP", "2001:db8::1", 22},
+		{"icmp", "ICMPv4", "192.168.1.100", 0},
+		{"dhcp discover", "DHCP", "0.0.0.0", 67},
+		{"ssdp notify", "SSDP", "192.168.1.100", 1900},
+		{"arp", "ARP", "192.168.1.100", 0},
+		{"ndp advertisement", "NDP", "fe80::1", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := decodeForTest(t, frames[tt.name])
+			if info.Protocol != tt.protocol {
+				t.Errorf("Expected protocol %s, got %s", tt.protocol, info.Protocol)
+			}
+			if info.SrcIP != tt.srcIP {
+				t.Errorf("Expected source %s, got %s", tt.srcIP, info.SrcIP)
+			}
+			if info.DstPort != tt.dstPort {
+				t.Errorf("Expected destination port %d, got %d", tt.dstPort, info.DstPort)
+			}
+			if info.EthSrcMAC != ringClientMAC.String() {
+				t.Errorf("Expected source MAC %s, got %s", ringClientMAC, info.EthSrcMAC)
+			}
+		})
+	}
+
+	t.Run("application results carried downstream", func(t *testing.T) {
+		query := decodeForTest(t, frames["dns query"])
+		if query.DNSQuery == nil || query.DNSQuery.QueryName != "example.com" {
+			t.Errorf("Expected parsed query for example.com, got %+v", query.DNSQuery)
+		}
+
+		response := decodeForTest(t, frames["dns response"])
+		if response.DNSResponse == nil || len(response.DNSResponse.Answers) != 1 || response.DNSResponse.Answers[0].IP != "93.184.216.34" {
+			t.Errorf("Expected parsed answer 93.184.216.34, got %+v", response.DNSResponse)
+		}
+
+		hello := decodeForTest(t, frames["tls client hello"])
+		if hello.TLS == nil || hello.TLS.SNI != "example.com" {
+			t.Fatalf("Expected Client Hello for example.com, got %+v", hello.TLS)
+		}
+		full := gopacket.NewPacket(frames["tls client hello"], layers.LayerTypeEthernet, gopacket.Default)
+		if want := parser.CalculateJA3(full); hello.TLS.JA3 != want || want == "" {
+			t.Errorf("Expected JA3 %q from the payload, got %q", want, hello.TLS.JA3)
+		}
+
+		discover := decodeForTest(t, frames["dhcp discover"])
+		if discover.DHCP == nil || discover.DHCP.Hostname != "living-room-tv" || discover.DHCP.ClientMAC != ringClientMAC.String() {
+			t.Errorf("Expected a Discover from living-room-tv, got %+v", discover.DHCP)
+		}
+
+		notify := decodeForTest(t, frames["ssdp notify"])
+		if notify.Discovery == nil || notify.Discovery.Model != "Sonos/70.3-35220" {
+			t.Errorf("Expected a Sonos announcement, got %+v", notify.Discovery)
+		}
+
+		arp := decodeForTest(t, frames["arp"])
+		if arp.Neighbor == nil || arp.NeighborInfo != "Who has 192.168.1.1? Tell 192.168.1.100" {
+			t.Errorf("Expected an ARP request for 192.168.1.1, got %q", arp.NeighborInfo)
+		}
+
+		advert := decodeForTest(t, frames["ndp advertisement"])
+		if advert.Neighbor == nil || !advert.Neighbor.Gratuitous || advert.Neighbor.TargetMAC != ringClientMAC.String() {
+			t.Errorf("Expected an unsolicited advertisement of fe80::1, got %+v", advert.Neighbor)
+		}
+	})
+}
+
+// Verifies that tunnels and tags are peeled off: identity and application data come
+// from the innermost packet while the outer VLAN and tunnel ID are kept.
+func TestDecoder_Encapsulation(t *testing.T) {
+	outerA, outerB := net.IP{10, 0, 0, 1}, net.IP{10, 0, 0, 2}
+	innerEth := &layers.Ethernet{SrcMAC: ringOtherMAC, DstMAC: ringRouterMAC, EthernetType: layers.EthernetTypeIPv4}
+	innerTCP := func() []gopacket.SerializableLayer {
+		return []gopacket.SerializableLayer{
+			ipv4Between(decodeClient, decodeServer, layers.IPProtocolTCP),
+			&layers.TCP{SrcPort: 54321, DstPort: 443, PSH: true, ACK: true, Window: 64240},
+			gopacket.Payload(buildClientHello("inner.example")),
+		}
+	}
+	stack := func(outer []gopacket.SerializableLayer, inner []gopacket.SerializableLayer) []gopacket.SerializableLayer {
+		return append(outer, inner...)
+	}
+
+	tests := []struct {
+		name     string
+		layers   []gopacket.SerializableLayer
+		vlan     uint16
+		tunnel   string
+		tunnelID uint32
+		innerMAC bool
+	}{
+		{"qinq", stack([]gopacket.SerializableLayer{ethernetTo(layers.EthernetTypeQinQ),
+			&layers.Dot1Q{VLANIdentifier: 100, Type: layers.EthernetTypeDot1Q},
+			&layers.Dot1Q{VLANIdentifier: 20, Type: layers.EthernetTypeIPv4}}, innerTCP()),
+			100, "", 0, false},
+		{"mpls", stack([]gopacket.SerializableLayer{ethernetTo(layers.EthernetTypeMPLSUnicast),
+			&layers.MPLS{Label: 16, TTL: 64},
+			&layers.MPLS{Label: 3000, StackBottom: true, TTL: 64}}, innerTCP()),
+			0, "MPLS", 3000, false},
+		{"gre", stack([]gopacket.SerializableLayer{ethernetTo(layers.EthernetTypeIPv4),
+			ipv4Between(outerA, outerB, layers.IPProtocolGRE),
+			&layers.GRE{KeyPresent: true, Key: 42, Protocol: layers.EthernetTypeIPv4}}, innerTCP()),
+			0, "GRE", 42, false},
+		{"erspan", stack([]gopacket.SerializableLayer{ethernetTo(layers.EthernetTypeIPv4),
+			ipv4Between(outerA, outerB, layers.IPProtocolGRE),
+			&layers.GRE{SeqPresent: true, Protocol: layers.EthernetTypeERSPAN},
+			&layers.ERSPANII{Version: 1, SessionID: 7}, innerEth}, innerTCP()),
+			0, "ERSPAN", 7, true},
+		{"vxlan", stack([]gopacket.SerializableLayer{ethernetTo(layers.EthernetTypeDot1Q),
+			&layers.Dot1Q{VLANIdentifier: 30, Type: layers.EthernetTypeIPv4},
+			ipv4Between(outerA, outerB, layers.IPProtocolUDP),
+			&layers.UDP{SrcPort: 49152, DstPort: 4789},
+			&layers.VXLAN{ValidIDFlag: true, VNI: 5000}, innerEth}, innerTCP()),
+			30, "VXLAN", 5000, true},
+		{"gtp-u", stack([]gopacket.SerializableLayer{ethernetTo(layers.EthernetTypeIPv4),
+			ipv4Between(outerA, outerB, layers.IPProtocolUDP),
+			&layers.UDP{SrcPort: 2152, DstPort: 2152},
+			&layers.GTPv1U{Version: 1, ProtocolType: 1, MessageType: 255, TEID: 0x1234}}, innerTCP()),
+			0, "GTP-U", 0x1234, false},
+		{"ip-in-ip", stack([]gopacket.SerializableLayer{ethernetTo(layers.EthernetTypeIPv4),
+			ipv4Between(outerA, outerB, layers.IPProtocolIPv4)}, innerTCP()),
+			0, "IP-in-IP", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := decodeForTest(t, serializeFrame(t, tt.layers...))
+
+			if info.SrcIP != "192.168.1.100" || info.DstIP != "93.184.216.34" || info.DstPort != 443 {
+				t.Errorf("Expected inner 192.168.1.100 -> 93.184.216.34:443, got %s -> %s:%d", info.SrcIP, info.DstIP, info.DstPort)
+			}
+			if info.TLS == nil || info.TLS.SNI != "inner.example" {
+				t.Errorf("Expected inner Client Hello for inner.example, got %+v", info.TLS)
+			}
+			if info.VLAN != tt.vlan || info.Tunnel != tt.tunnel || info.TunnelID != tt.tunnelID {
+				t.Errorf("Expected VLAN %d in %q %d, got VLAN %d in %q %d", tt.vlan, tt.tunnel, tt.tunnelID, info.VLAN, info.Tunnel, info.TunnelID)
+			}
+			wantMAC := ringClientMAC
+			if tt.innerMAC {
+				wantMAC = ringOtherMAC
+			}
+			if info.EthSrcMAC != wantMAC.String() {
+				t.Errorf("Expected source MAC %s, got %s", wantMAC, info.EthSrcMAC)
+			}
+		})
+	}
+
+	t.Run("dns inside tunnel", func(t *testing.T) {
+		info := decodeForTest(t, serializeFrame(t, ethernetTo(layers.EthernetTypeIPv4),
+			ipv4Between(outerA, outerB, layers.IPProtocolUDP),
+			&layers.UDP{SrcPort: 49152, DstPort: 4789},
+			&layers.VXLAN{ValidIDFlag: true, VNI: 5000}, innerEth,
+			ipv4Between(decodeClient, decodeDNS, layers.IPProtocolUDP),
+			&layers.UDP{SrcPort: 40000, DstPort: 53},
+			&layers.DNS{ID: 9, RD: true, Questions: []layers.DNSQuestion{{Name: []byte("tunnel.example"), Type: layers.DNSTypeA, Class: layers.DNSClassIN}}}))
+		if info.DNSQuery == nil || info.DNSQuery.QueryName != "tunnel.example" || info.DNSQuery.SrcIP != "192.168.1.100" {
+			t.Errorf("Expected inner DNS query from 192.168.1.100, got %+v", info.DNSQuery)
+		}
+	})
+
+	t.Run("outer transport not reported for inner arp", func(t *testing.T) {
+		info := decodeForTest(t, serializeFrame(t, ethernetTo(layers.EthernetTypeIPv4),
+			ipv4Between(outerA, outerB, layers.IPProtocolUDP),
+			&layers.UDP{SrcPort: 49152, DstPort: 4789},
+			&layers.VXLAN{ValidIDFlag: true, VNI: 5000},
+			&layers.Ethernet{SrcMAC: ringOtherMAC, DstMAC: ringRouterMAC, EthernetType: layers.EthernetTypeARP},
+			&layers.ARP{AddrType: layers.LinkTypeEthernet, Protocol: layers.EthernetTypeIPv4,
+				HwAddressSize: 6, ProtAddressSize: 4, Operation: layers.ARPRequest,
+				SourceHwAddress: ringOtherMAC, SourceProtAddress: decodeClient.To4(),
+				DstHwAddress: make([]byte, 6), DstProtAddress: net.IP{192, 168, 1, 1}.To4()}))
+		if info.Protocol != "ARP" || info.SrcPort != 0 || info.DstPort != 0 {
+			t.Errorf("Expected bare inner ARP, got %s %d -> %d", info.Protocol, info.SrcPort, info.DstPort)
+		}
+	})
+}
+
+// Verifies that each supported link type yields the IP identity and DNS of its
+// payload, with a source MAC only where the link layer records one.
+func TestDecoder_LinkTypes(t *testing.T) {
+	question := []layers.DNSQuestion{{Name: []byte("example.com"), Type: layers.DNSTypeA, Class: layers.DNSClassIN}}
+	dnsQuery := &layers.DNS{ID: 7, RD: true, Questions: question}
+	v4 := serializeFrame(t, ipv4Between(decodeClient, decodeDNS, layers.IPProtocolUDP),
+		&layers.UDP{SrcPort: 40000, DstPort: 53}, dnsQuery)
+	v6 := serializeFrame(t, &layers.IPv6{Version: 6, HopLimit: 64, NextHeader: layers.IPProtocolUDP,
+		SrcIP: net.ParseIP("2001:db8::1"), DstIP: net.ParseIP("2001:db8::53")},
+		&layers.UDP{SrcPort: 40000, DstPort: 53}, dnsQuery)
+
+	cat := func(parts ...[]byte) []byte {
+		var out []byte
+		for _, part := range parts {
+			out = append(out, part...)
+		}
+		return out
+	}
+	macPadded := append(append([]byte{}, ringClientMAC...), 0, 0)
+	sll := cat([]byte{0, 4, 0, 1, 0, 6}, macPadded, []byte{0x08, 0x00})
+	sllLoopback := cat([]byte{0, 4, 0x03, 0x04, 0, 6}, make([]byte, 8), []byte{0x08, 0x00})
+	sll2 := cat([]byte{0x08, 0x00, 0, 0, 0, 0, 0, 2, 0, 1, 4, 6}, macPadded)
+	pppoe := func(payload []byte) []byte {
+		return cat([]byte{0x11, 0x00, 0x12, 0x34, byte((len(payload) + 2) >> 8), byte(len(payload) + 2), 0x00, 0x21}, payload)
+	}
+	ethPPPoE := cat(ringRouterMAC, ringClientMAC, []byte{0x88, 0x64})
+
+	tests := []struct {
+		name     string
+		linkType layers.LinkType
+		data     []byte
+		srcIP    string
+		srcMAC   string
+	}{
+		{"linux sll", layers.LinkTypeLinuxSLL, cat(sll, v4), "192.168.1.100", ringClientMAC.String()},
+		{"linux sll loopback", layers.LinkTypeLinuxSLL, cat(sllLoopback, v4), "192.168.1.100", ""},
+		{"linux sll2", linkTypeLinuxSLL2, cat(sll2, v4), "192.168.1.100", ringClientMAC.String()},
+		{"bsd loopback", layers.LinkTypeNull, cat([]byte{2, 0, 0, 0}, v4), "192.168.1.100", ""},
+		{"raw ipv4", layers.LinkTypeRaw, v4, "192.168.1.100", ""},
+		{"raw ipv6 (DLT_RAW)", linkTypeRawDLT, v6, "2001:db8::1", ""},
+		{"ppp hdlc", layers.LinkTypePPP, cat([]byte{0xff, 0x03, 0x00, 0x21}, v4), "192.168.1.100", ""},
+		{"ppp compressed protocol", layers.LinkTypePPP, cat([]byte{0x21}, v4), "192.168.1.100", ""},
+		{"pppoe over ethernet", layers.LinkTypeEthernet, cat(ethPPPoE, pppoe(v4)), "192.168.1.100", ringClientMAC.String()},
+		{"pppoe link", layers.LinkTypePPPEthernet, pppoe(v4), "192.168.1.100", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !isSupportedLinkType(tt.linkType) {
+				t.Fatalf("Link type %s should be supported", linkTypeName(tt.linkType))
+			}
+			info := decodeLinkForTest(t, tt.linkType, tt.data)
+			if info.SrcIP != tt.srcIP || info.SrcPort != 40000 || info.DstPort != 53 {
+				t.Errorf("Expected %s:40000 -> :53, got %s:%d -> :%d", tt.srcIP, info.SrcIP, info.SrcPort, info.DstPort)
+			}
+			if info.DNSQuery == nil || info.DNSQuery.QueryName != "example.com" {
+				t.Errorf("Expected the DNS query decoded, got %+v", info.DNSQuery)
+			}
+			if info.EthSrcMAC != tt.srcMAC {
+				t.Errorf("Expected source MAC %q, got %q", tt.srcMAC, info.EthSrcMAC)
+			}
+		})
+	}
+
+	if isSupportedLinkType(layers.LinkTypeFDDI) {
+		t.Error("FDDI has no decoder and should be reported unsupported")
+	}
+}
+
+// Verifies that both directions of a conversation shard together, that a truncated
+// frame keeps the identity decoded before the cut, and that a frame a layer indexes
+// past is marked malformed with nothing else kept.
+func TestDecoder_FlowHashAndTruncation(t *testing.T) {
+	forward := serializeFrame(t, ethernetTo(layers.EthernetTypeIPv4),
+		ipv4Between(decodeClient, decodeServer, layers.IPProtocolTCP),
+		&layers.TCP{SrcPort: 54321, DstPort: 443, ACK: true})
+	reverse := serializeFrame(t, ethernetTo(layers.EthernetTypeIPv4),
+		ipv4Between(decodeServer, decodeClient, layers.IPProtocolTCP),
+		&layers.TCP{SrcPort: 443, DstPort: 54321, ACK: true})
+
+	d := newDecoder(layers.LinkTypeEthernet)
+	var a, b frame
+	d.decode(forward, time.Time{}, &a)
+	d.decode(reverse, time.Time{}, &b)
+	if a.flowHash == 0 || a.flowHash != b.flowHash {
+		t.Errorf("Expected matching non-zero hashes for both directions, got %x and %x", a.flowHash, b.flowHash)
+	}
+
+	var cut frame
+	d.decode(forward[:14+20+6], time.Time{}, &cut)
+	if cut.network != layers.LayerTypeIPv4 || !cut.srcIP.Equal(decodeClient) {
+		t.Errorf("Expected IPv4 identity to survive truncation, got %v %v", cut.network, cut.srcIP)
+	}
+	if cut.transport != gopacket.LayerTypeZero {
+		t.Errorf("Expected no transport for a cut TCP header, got %v", cut.transport)
+	}
+
+	// DNS response whose answer ends inside its fixed fields
+	overrun := serializeFrame(t, ethernetTo(layers.EthernetTypeIPv4),
+		ipv4Between(decodeDNS, decodeClient, layers.IPProtocolUDP),
+		&layers.UDP{SrcPort: 53, DstPort: 40000},
+		gopacket.Payload{0, 7, 0x84, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 1})
+	var malformed frame
+	d.decode(overrun, time.Time{}, &malformed)
+	if !malformed.malformed || malformed.srcIP != nil || malformed.transport != gopacket.LayerTypeZero {
+		t.Errorf("Expected an empty frame marked malformed, got %+v", malformed)
+	}
+}
+
+// Reproduces the per-packet work of the previous pipeline: a full gopacket.Packet,
+// DNS parsed for the summary, the flow model and the DNS cache, and TLS parsed for
+// the summary and again for the flow model.
+func decodeFullPacket(data []byte) {
+	packet := gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.Default)
+	isDNS := parser.IsDNSPacket(packet)
+
+	if isDNS {
+		parser.ParseDNS(packet)
+	}
+	tlsInfo, _ := parser.ParseTLS(packet)
+	if isDNS {
+		parser.ParseDNS(packet)
+	}
+	if tlsInfo != nil && tlsInfo.Handshake {
+		parser.ParseTLS(packet)
+	}
+	if isDNS {
+		parser.ParseDNS(packet)
+	}
+}
+
+// Runs the single-pass path: one decode into reused layers, then TLS from the payload.
+func decodeSinglePass(d *decoder, data []byte, f *frame) {
+	d.decode(data, time.Time{}, f)
+	if f.transport == layers.LayerTypeTCP {
+		parser.ParseTLSPayload(f.payload)
+	}
+}
+
+// Compares allocations per packet of the full-packet and single-pass decoding paths
+// over traffic mixes dominated by bulk transfer, web browsing, and DNS.
+func BenchmarkDecode(b *testing.B) {
+	frames := decodeTestFrames(b)
+	mixes := []struct {
+		name  string
+		kinds []string
+	}{
+		{"bulk", []string{"tcp data"}},
+		{"web", []string{"dns query", "dns response", "tls client hello", "tcp data", "tcp data", "tcp data", "tcp data", "tcp data"}},
+		{"dns", []string{"dns query", "dns response"}},
+		{"mixed", []string{"dns query", "dns response", "tls client hello", "tcp data", "vlan udp", "ipv6 tcp", "icmp", "arp"}},
+	}
+
+	for _, mix := range mixes {
+		packets := make([][]byte, len(mix.kinds))
+		for i, kind := range mix.kinds {
+			packets[i] = frames[kind]
+		}
+
+		b.Run(mix.name+"/full-packet", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				decodeFullPacket(packets[i%len(packets)])
+			}
+		})
+
+		b.Run(mix.name+"/single-pass", func(b *testing.B) {
+			d := newDecoder(layers.LinkTypeEthernet)
+			var f frame
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				decodeSinglePass(d, packets[i%len(packets)], &f)
+			}
+		})
+	}
+}
+
+// Verifies that decoding plain TCP and UDP traffic allocates nothing per packet.
+func TestDecoder_ZeroAllocations(t *testing.T) {
+	frames := decodeTestFrames(t)
+	d := newDecoder(layers.LinkTypeEthernet)
+	var f frame
+
+	for _, kind := range []string{"tcp data", "vlan udp", "ipv6 tcp"} {
+		data := frames[kind]
+		if allocs := testing.AllocsPerRun(100, func() { decodeSinglePass(d, data, &f) }); allocs != 0 {
+			t.Errorf("Expected no allocations decoding %s, got %.1f", kind, allocs)
+		}
+	}
+}
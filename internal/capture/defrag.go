@@ -0,0 +1,334 @@
+/**
+ * IP Fragment Reassembly.
+ *
+ * Holds IPv4 and IPv6 fragments in the reader stage until their datagram
+ * is complete, then decodes the rebuilt datagram so that ports, DNS and
+ * TLS are recovered and every piece lands in the right flow. Memory is
+ * bounded by the number of datagrams held and the size of each; datagrams
+ * that do not complete within the timeout are discarded and counted.
+ * Overlapping fragments are reassembled first-arrival-wins and flagged,
+ * since rewriting bytes through overlaps is a known IDS evasion technique.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	// Linux discards incomplete datagrams after 30 seconds (net.ipv4.ipfrag_time)
+	defaultFragmentTimeout = 30 * time.Second
+
+	// Datagrams held at once when the configuration leaves it unset
+	defaultMaxFragmentDatagrams = 1024
+
+	// A datagram needing more fragments than this is discarded; real stacks send a few
+	maxFragmentsPerDatagram = 256
+
+	// Largest payload a reassembled datagram may carry: the IPv4 total length limit less
+	// the longest IPv4 header. Fragments reaching past it are the "ping of death".
+	maxDatagramPayload = 65535 - 60
+)
+
+// Counters for the reassembly stage, updated atomically.
+type defragCounters struct {
+	fragments   uint64
+	reassembled uint64
+	incomplete  uint64
+	overlapping uint64
+}
+
+// Fragments of one datagram are matched on the addresses, identification and
+// protocol, within the same VLAN and tunnel.
+type fragmentKey struct {
+	src, dst netip.Addr
+	id       uint32
+	protocol layers.IPProtocol
+	vlan     uint16
+	tunnel   string
+	tunnelID uint32
+}
+
+// Returns the key shared by every fragment of the frame's datagram.
+func (f *frame) fragmentKey() fragmentKey {
+	src, _ := netip.AddrFromSlice(f.srcIP)
+	dst, _ := netip.AddrFromSlice(f.dstIP)
+	return fragmentKey{
+		src:      src,
+		dst:      dst,
+		id:       f.fragment.id,
+		protocol: f.protocol,
+		vlan:     f.vlan,
+		tunnel:   f.tunnel,
+		tunnelID: f.tunnelID,
+	}
+}
+
+// A datagram under reassembly.
+type fragmentBuffer struct {
+	first       *sourcedPacket // Fragment at offset zero, once seen
+	pieces      []ipFragment   // In arrival order
+	total       int            // Payload length, -1 until the last fragment arrives
+	wireLength  int            // Sum of the fragments' original lengths
+	created     time.Time
+	seq         uint64 // Distinguishes datagrams that reuse a key
+	overlapping bool
+	discarded   bool // Exceeded a size limit; absorbs fragments until it expires
+}
+
+type fragmentRecord struct {
+	key     fragmentKey
+	created time.Time
+	seq     uint64
+}
+
+// Reassembles fragmented datagrams for the reader stage. Expiry is driven by packet
+// timestamps so replayed captures behave identically. Used only from the reader
+// goroutine, so it needs no locking; counters are read concurrently.
+type defragmenter struct {
+	timeout      time.Duration
+	maxDatagrams int
+	pending      map[fragmentKey]*fragmentBuffer
+	order        []fragmentRecord // Creation order for expiry and eviction
+	seq          uint64
+	decoder      *decoder
+	counters     defragCounters
+}
+
+func newDefragmenter(timeout time.Duration, maxDatagrams int) *defragmenter {
+	if timeout <= 0 {
+		timeout = defaultFragmentTimeout
+	}
+	if maxDatagrams <= 0 {
+		maxDatagrams = defaultMaxFragmentDatagrams
+	}
+	return &defragmenter{
+		timeout:      timeout,
+		maxDatagrams: maxDatagrams,
+		pending:      make(map[fragmentKey]*fragmentBuffer),
+		decoder:      newDecoder(layers.LinkTypeNull),
+	}
+}
+
+// Adds a fragment. When it completes its datagram, sp is replaced by the reassembled
+// datagram and true is returned; otherwise the fragment is held and false is returned.
+func (d *defragmenter) add(sp *sourcedPacket) bool {
+	atomic.AddUint64(&d.counters.fragments, 1)
+	ts := sp.ci.Timestamp
+	d.expire(ts)
+
+	key := sp.frame.fragmentKey()
+
+	buf, ok := d.pending[key]
+	if !ok {
+		if len(d.pending) >= d.maxDatagrams {
+			d.evictOldest()
+		}
+		d.seq++
+		buf = &fragmentBuffer{total: -1, created: ts, seq: d.seq}
+		d.pending[key] = buf
+		d.order = append(d.order, fragmentRecord{key: key, created: ts, seq: d.seq})
+	}
+	buf.wireLength += sp.ci.Length
+	if buf.discarded {
+		return false
+	}
+
+	piece := sp.frame.fragment
+	end := piece.offset + len(piece.data)
+	if end > maxDatagramPayload || len(buf.pieces) >= maxFragmentsPerDatagram {
+		buf.discarded = true
+		buf.pieces = nil
+		buf.first = nil
+		return false
+	}
+
+	// An identical retransmitted fragment is harmless; anything else that overlaps is not
+	for _, held := range buf.pieces {
+		heldEnd := held.offset + len(held.data)
+		if piece.offset < heldEnd && held.offset < end {
+			if piece.offset == held.offset && bytes.Equal(piece.data, held.data) {
+				return false
+			}
+			buf.overlapping = true
+		}
+	}
+
+	buf.pieces = append(buf.pieces, piece)
+	if piece.offset == 0 && buf.first == nil {
+		first := *sp
+		buf.first = &first
+	}
+	if !piece.more {
+		// Two last fragments disagreeing on the length rewrite the datagram like an overlap
+		if buf.total >= 0 && buf.total != end {
+			buf.overlapping = true
+		} else {
+			buf.total = end
+		}
+	}
+
+	if !buf.complete() {
+		return false
+	}
+
+	d.remove(key)
+	d.assemble(buf, sp)
+	atomic.AddUint64(&d.counters.reassembled, 1)
+	if buf.overlapping {
+		atomic.AddUint64(&d.counters.overlapping, 1)
+	}
+	return true
+}
+
+// Reports whether the first and last fragments arrived and the pieces cover every byte between.
+func (b *fragmentBuffer) complete() bool {
+	if b.first == nil || b.total < 0 {
+		return false
+	}
+
+	ranges := make([][2]int, len(b.pieces))
+	for i, piece := range b.pieces {
+		ranges[i] = [2]int{piece.offset, piece.offset + len(piece.data)}
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+
+	covered := 0
+	for _, r := range ranges {
+		if r[0] > covered {
+			return false
+		}
+		if r[1] > covered {
+			covered = r[1]
+		}
+	}
+	return covered >= b.total
+}
+
+// Rebuilds the datagram into sp: the first fragment's IP header, adjusted to describe
+// an unfragmented packet, followed by the payload. Earlier fragments win where pieces
+// overlap. The datagram replaces sp's data and frame; the capture length covers the
+// datagram and the original length covers every fragment on the wire.
+func (d *defragmenter) assemble(b *fragmentBuffer, sp *sourcedPacket) {
+	first := b.first
+	header := first.frame.fragment.header
+
+	datagram := make([]byte, len(header)+b.total)
+	copy(datagram, header)
+	payload := datagram[len(header):]
+	for i := len(b.pieces) - 1; i >= 0; i-- {
+		piece := b.pieces[i]
+		if piece.offset < b.total {
+			copy(payload[piece.offset:], piece.data)
+		}
+	}
+
+	if datagram[0]>>4 == 4 {
+		binary.BigEndian.PutUint16(datagram[2:], uint16(len(datagram)))
+		binary.BigEndian.PutUint16(datagram[6:], binary.BigEndian.Uint16(datagram[6:])&0x4000) // Keep only DF
+		binary.BigEndian.PutUint16(datagram[10:], 0)
+		binary.BigEndian.PutUint16(datagram[10:], ipv4Checksum(datagram[:len(header)]))
+	} else {
+		// The fragment header is gone; whatever pointed at it now names the payload protocol
+		nextHeader := 6
+		if len(header) > 40 && layers.IPProtocol(header[6]) == layers.IPProtocolIPv6HopByHop {
+			nextHeader = 40
+		}
+		datagram[nextHeader] = byte(first.frame.protocol)
+		binary.BigEndian.PutUint16(datagram[4:], uint16(len(datagram)-40))
+	}
+
+	ci := gopacket.CaptureInfo{
+		Timestamp:      sp.ci.Timestamp,
+		CaptureLength:  len(datagram),
+		Length:         b.wireLength,
+		InterfaceIndex: first.ci.InterfaceIndex,
+	}
+	*sp = sourcedPacket{data: datagram, ci: ci, source: first.source}
+	d.decoder.decodeDatagram(first.frame, datagram, ci.Timestamp, &sp.frame)
+	sp.frame.overlapping = b.overlapping
+}
+
+// Computes the IPv4 header checksum.
+func ipv4Checksum(header []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(header); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(header[i:]))
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
+
+// Discards datagrams older than the timeout.
+func (d *defragmenter) expire(now time.Time) {
+	cutoff := now.Add(-d.timeout)
+	expired := 0
+	for expired < len(d.order) && d.order[expired].created.Before(cutoff) {
+		d.drop(d.order[expired])
+		expired++
+	}
+	if expired > 0 {
+		d.order = append(d.order[:0], d.order[expired:]...)
+	}
+}
+
+// Discards the oldest datagram to make room for a new one.
+func (d *defragmenter) evictOldest() {
+	for len(d.order) > 0 {
+		record := d.order[0]
+		d.order = d.order[1:]
+		if d.drop(record) {
+			return
+		}
+	}
+}
+
+// Discards every datagram still held, as when the capture ends.
+func (d *defragmenter) flush() {
+	for _, record := range d.order {
+		d.drop(record)
+	}
+	d.order = nil
+}
+
+// Discards the datagram a record refers to, counting it as incomplete. Reports false
+// when the record is stale because the datagram completed or was replaced.
+func (d *defragmenter) drop(record fragmentRecord) bool {
+	buf, ok := d.pending[record.key]
+	if !ok || buf.seq != record.seq {
+		return false
+	}
+	delete(d.pending, record.key)
+	atomic.AddUint64(&d.counters.incomplete, 1)
+	return true
+}
+
+// Forgets a completed datagram. Its order record goes stale and is skipped on expiry;
+// stale records are compacted away so a high completion rate cannot grow the order.
+func (d *defragmenter) remove(key fragmentKey) {
+	delete(d.pending, key)
+
+	if len(d.order) > 2*d.maxDatagrams {
+		live := d.order[:0]
+		for _, record := range d.order {
+			if buf, ok := d.pending[record.key]; ok && buf.seq == record.seq {
+				live = append(live, record)
+			}
+		}
+		d.order = live
+	}
+}
@@ -0,0 +1,309 @@
+/**
+ * IP Fragment Reassembly Tests.
+ *
+ * Validates that fragmented IPv4 and IPv6 datagrams are rebuilt into one
+ * packet carrying ports and DNS, that overlapping fragments are flagged
+ * through to an analyzer anomaly, and that incomplete datagrams expire
+ * and are evicted within the configured bounds.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package capture
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/kleaSCM/netscope/internal/analyzer"
+	"github.com/kleaSCM/netscope/internal/storage"
+)
+
+// Builds a DNS response large enough to need fragmenting, as EDNS answers often are.
+func buildLargeDNSResponse(tb testing.TB, src, dst net.IP, ipv6 bool) []byte {
+	tb.Helper()
+	question := []layers.DNSQuestion{{Name: []byte("example.com"), Type: layers.DNSTypeA, Class: layers.DNSClassIN}}
+	dns := &layers.DNS{ID: 9, QR: true, RD: true, RA: true, Questions: question}
+	for i := 0; i < 120; i++ {
+		dns.Answers = append(dns.Answers, layers.DNSResourceRecord{
+			Name: []byte("example.com"), Type: layers.DNSTypeA, Class: layers.DNSClassIN, TTL: 300, IP: net.IP{10, 0, byte(i >> 8), byte(i)},
+		})
+	}
+
+	udp := &layers.UDP{SrcPort: 53, DstPort: 40000}
+	if ipv6 {
+		return serializeFrame(tb, ethernetTo(layers.EthernetTypeIPv6),
+			&layers.IPv6{Version: 6, HopLimit: 64, NextHeader: layers.IPProtocolUDP, SrcIP: src, DstIP: dst}, udp, dns)
+	}
+	return serializeFrame(tb, ethernetTo(layers.EthernetTypeIPv4), ipv4Between(src, dst, layers.IPProtocolUDP), udp, dns)
+}
+
+// A fragment to cut from a datagram's payload: its byte range and whether more follow.
+type fragmentCut struct {
+	offset, length int
+	more           bool
+}
+
+// Cuts an Ethernet/IPv4 frame into fragments. A zero length runs to the end of the payload.
+func fragmentIPv4(frame []byte, id uint16, cuts ...fragmentCut) [][]byte {
+	header := frame[14 : 14+20]
+	payload := frame[14+20:]
+
+	var fragments [][]byte
+	for _, cut := range cuts {
+		data := cutPayload(payload, cut)
+		out := append(append([]byte{}, frame[:14]...), header...)
+		ip := out[14:]
+		binary.BigEndian.PutUint16(ip[2:], uint16(20+len(data)))
+		binary.BigEndian.PutUint16(ip[4:], id)
+		flags := uint16(cut.offset / 8)
+		if cut.more {
+			flags |= 0x2000
+		}
+		binary.BigEndian.PutUint16(ip[6:], flags)
+		binary.BigEndian.PutUint16(ip[10:], 0)
+		binary.BigEndian.PutUint16(ip[10:], ipv4Checksum(ip[:20]))
+		fragments = append(fragments, append(out, data...))
+	}
+	return fragments
+}
+
+// Cuts an Ethernet/IPv6 frame into fragments carrying a fragment extension header.
+func fragmentIPv6(frame []byte, id uint32, cuts ...fragmentCut) [][]byte {
+	header := frame[14 : 14+40]
+	payload := frame[14+40:]
+
+	var fragments [][]byte
+	for _, cut := range cuts {
+		data := cutPayload(payload, cut)
+		out := append(append([]byte{}, frame[:14]...), header...)
+		ip := out[14:]
+		binary.BigEndian.PutUint16(ip[4:], uint16(8+len(data)))
+		ip[6] = byte(layers.IPProtocolIPv6Fragment)
+
+		offsetFlags := uint16(cut.offset / 8 << 3)
+		if cut.more {
+			offsetFlags |= 1
+		}
+		ext := []byte{header[6], 0, byte(offsetFlags >> 8), byte(offsetFlags)}
+		ext = binary.BigEndian.AppendUint32(ext, id)
+		fragments = append(fragments, append(append(out, ext...), data...))
+	}
+	return fragments
+}
+
+func cutPayload(payload []byte, cut fragmentCut) []byte {
+	if cut.length == 0 {
+		return payload[cut.offset:]
+	}
+	return payload[cut.offset : cut.offset+cut.length]
+}
+
+// Decodes a fragment as its source would, for feeding straight to a defragmenter.
+func fragmentPacket(data []byte, ts time.Time) *sourcedPacket {
+	sp := &sourcedPacket{data: data, ci: ringCaptureInfo(ts, data), source: &captureSource{name: "eth0", linkType: layers.LinkTypeEthernet}}
+	newDecoder(layers.LinkTypeEthernet).decode(data, ts, &sp.frame)
+	return sp
+}
+
+// Verifies that IPv4 and IPv6 datagrams are rebuilt from fragments arriving in any
+// order, recovering the ports and DNS answers only the whole datagram carries.
+func TestDefragmenter_Reassembly(t *testing.T) {
+	start := time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC)
+	v6Server, v6Client := net.ParseIP("2001:db8::53"), net.ParseIP("2001:db8::100")
+
+	v4 := buildLargeDNSResponse(t, decodeDNS, decodeClient, false)
+	v6 := buildLargeDNSResponse(t, v6Server, v6Client, true)
+	tests := []struct {
+		name      string
+		fragments [][]byte
+		whole     []byte
+	}{
+		{"ipv4 in order", fragmentIPv4(v4, 77, fragmentCut{0, 800, true}, fragmentCut{800, 800, true}, fragmentCut{1600, 0, false}), v4},
+		{"ipv4 last first", fragmentIPv4(v4, 78, fragmentCut{1600, 0, false}, fragmentCut{0, 800, true}, fragmentCut{800, 800, true}), v4},
+		{"ipv6 out of order", fragmentIPv6(v6, 0xdeadbeef, fragmentCut{1232, 0, false}, fragmentCut{0, 1232, true}), v6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defrag := newDefragmenter(0, 0)
+
+			var sp *sourcedPacket
+			wire := 0
+			for i, data := range tt.fragments {
+				sp = fragmentPacket(data, start.Add(time.Duration(i)*time.Millisecond))
+				wire += sp.ci.Length
+				if !sp.frame.fragmented || sp.frame.transport != 0 {
+					t.Fatalf("Fragment %d should decode as a fragment without transport", i)
+				}
+				if done := defrag.add(sp); done != (i == len(tt.fragments)-1) {
+					t.Fatalf("Fragment %d: expected completion only on the last fragment, got %v", i, done)
+				}
+			}
+
+			info := (&Engine{}).extractPacketInfo(sp)
+			if info.SrcPort != 53 || info.DstPort != 40000 || info.Protocol != "DNS" {
+				t.Errorf("Expected DNS 53 -> 40000, got %s %d -> %d", info.Protocol, info.SrcPort, info.DstPort)
+			}
+			if info.DNSResponse == nil || len(info.DNSResponse.Answers) != 120 {
+				t.Fatalf("Expected 120 answers from the reassembled response, got %+v", info.DNSResponse)
+			}
+			if info.EthSrcMAC != ringClientMAC.String() {
+				t.Errorf("Expected link addresses from the first fragment, got %s", info.EthSrcMAC)
+			}
+			if len(sp.data) != len(tt.whole)-14 || info.Length != wire {
+				t.Errorf("Expected %d-byte datagram counting %d wire bytes, got %d and %d", len(tt.whole)-14, wire, len(sp.data), info.Length)
+			}
+
+			// The rebuilt datagram shards with the unfragmented conversation
+			var whole frame
+			newDecoder(layers.LinkTypeEthernet).decode(tt.whole, start, &whole)
+			if sp.frame.flowHash != whole.flowHash {
+				t.Error("Reassembled datagram should hash like the unfragmented packet")
+			}
+
+			if defrag.counters.reassembled != 1 || len(defrag.pending) != 0 {
+				t.Errorf("Expected one reassembly and nothing pending, got %d and %d", defrag.counters.reassembled, len(defrag.pending))
+			}
+		})
+	}
+}
+
+// Verifies that overlapping fragments are reassembled first-arrival-wins, counted, and
+// raised as an anomaly by the pipeline, while an identical retransmission is ignored.
+func TestDefragmenter_Overlap(t *testing.T) {
+	start := time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC)
+	whole := buildLargeDNSResponse(t, decodeDNS, decodeClient, false)
+
+	t.Run("identical retransmission", func(t *testing.T) {
+		defrag := newDefragmenter(0, 0)
+		fragments := fragmentIPv4(whole, 5, fragmentCut{0, 800, true}, fragmentCut{0, 800, true}, fragmentCut{800, 0, false})
+		for i, data := range fragments {
+			defrag.add(fragmentPacket(data, start.Add(time.Duration(i)*time.Millisecond)))
+		}
+		if defrag.counters.reassembled != 1 || defrag.counters.overlapping != 0 {
+			t.Errorf("Expected a clean reassembly, got %d reassembled, %d overlapping", defrag.counters.reassembled, defrag.counters.overlapping)
+		}
+	})
+
+	// The second fragment rewrites the first's tail; the rewrite must not win
+	fragments := fragmentIPv4(whole, 6, fragmentCut{0, 800, true}, fragmentCut{792, 0, false})
+	rewritten := fragments[1][14+20:]
+	for i := 0; i < 8; i++ {
+		rewritten[i] ^= 0xff
+	}
+
+	t.Run("first arrival wins", func(t *testing.T) {
+		defrag := newDefragmenter(0, 0)
+		defrag.add(fragmentPacket(fragments[0], start))
+		sp := fragmentPacket(fragments[1], start.Add(time.Millisecond))
+		if !defrag.add(sp) || !sp.frame.overlapping {
+			t.Fatal("Expected a reassembled datagram flagged as overlapping")
+		}
+		if got, want := sp.data[20+792:20+800], whole[14+20+792:14+20+800]; string(got) != string(want) {
+			t.Errorf("Expected the first fragment's bytes %x, got %x", want, got)
+		}
+	})
+
+	store, err := storage.NewSQLiteStorage(filepath.Join(t.TempDir(), "frag.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err := store.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	engine := newPipeline(DefaultConfig(""), store)
+	engine.sources = []*captureSource{newTestSource(t, "eth0", fragments, []time.Time{start, start.Add(time.Millisecond)})}
+	defer engine.Stop()
+
+	var delivered []PacketInfo
+	if err := engine.Start(context.Background(), func(info PacketInfo) {
+		delivered = append(delivered, info)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := engine.PipelineStats()
+	if stats.Read != 2 || stats.Fragments != 2 || stats.Reassembled != 1 || stats.FragmentsOverlapping != 1 || stats.Delivered != 1 {
+		t.Fatalf("Unexpected counters: %+v", stats)
+	}
+	if len(delivered) != 1 || delivered[0].SrcPort != 53 {
+		t.Fatalf("Expected one reassembled DNS packet, got %+v", delivered)
+	}
+
+	found := false
+	for _, anomaly := range delivered[0].Anomalies {
+		found = found || anomaly.Type == analyzer.AnomalyTypeFragOverlap
+	}
+	if !found {
+		t.Errorf("Expected an overlapping fragments anomaly, got %+v", delivered[0].Anomalies)
+	}
+}
+
+// Verifies that incomplete datagrams expire by packet time, that the oldest is evicted
+// when the bound is reached, and that oversized datagrams are discarded.
+func TestDefragmenter_Bounds(t *testing.T) {
+	start := time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC)
+	whole := buildLargeDNSResponse(t, decodeDNS, decodeClient, false)
+	head := func(id uint16) []byte {
+		return fragmentIPv4(whole, id, fragmentCut{0, 800, true})[0]
+	}
+
+	t.Run("timeout", func(t *testing.T) {
+		defrag := newDefragmenter(time.Second, 0)
+		defrag.add(fragmentPacket(head(1), start))
+		defrag.add(fragmentPacket(head(2), start.Add(1500*time.Millisecond)))
+		if defrag.counters.incomplete != 1 || len(defrag.pending) != 1 {
+			t.Errorf("Expected the stale datagram expired, got %d incomplete, %d pending", defrag.counters.incomplete, len(defrag.pending))
+		}
+
+		// A late tail cannot complete the expired datagram
+		tail := fragmentIPv4(whole, 1, fragmentCut{800, 0, false})[0]
+		if defrag.add(fragmentPacket(tail, start.Add(1600*time.Millisecond))) {
+			t.Error("Tail of an expired datagram should not complete it")
+		}
+
+		defrag.flush()
+		if defrag.counters.incomplete != 3 || len(defrag.pending) != 0 {
+			t.Errorf("Expected flush to discard the rest, got %d incomplete, %d pending", defrag.counters.incomplete, len(defrag.pending))
+		}
+	})
+
+	t.Run("eviction", func(t *testing.T) {
+		defrag := newDefragmenter(time.Minute, 2)
+		for id := uint16(1); id <= 3; id++ {
+			defrag.add(fragmentPacket(head(id), start.Add(time.Duration(id)*time.Millisecond)))
+		}
+		if len(defrag.pending) != 2 || defrag.counters.incomplete != 1 {
+			t.Fatalf("Expected the oldest of three evicted, got %d pending, %d incomplete", len(defrag.pending), defrag.counters.incomplete)
+		}
+		tail := fragmentIPv4(whole, 1, fragmentCut{800, 0, false})[0]
+		if defrag.add(fragmentPacket(tail, start.Add(5*time.Millisecond))) {
+			t.Error("Evicted datagram should not complete")
+		}
+	})
+
+	t.Run("oversized", func(t *testing.T) {
+		defrag := newDefragmenter(0, 0)
+		beyond := fragmentIPv4(whole, 4, fragmentCut{0, 800, true}, fragmentCut{800, 0, false})
+		defrag.add(fragmentPacket(beyond[0], start))
+
+		// Move the tail past the largest datagram an IP header can describe
+		binary.BigEndian.PutUint16(beyond[1][14+6:], uint16(65528/8))
+		if defrag.add(fragmentPacket(beyond[1], start)) {
+			t.Error("Datagram reaching past the size limit should not reassemble")
+		}
+		defrag.flush()
+		if defrag.counters.reassembled != 0 || defrag.counters.incomplete != 1 {
+			t.Errorf("Expected the oversized datagram discarded, got %d reassembled, %d incomplete", defrag.counters.reassembled, defrag.counters.incomplete)
+		}
+	})
+}
@@ -12,10 +12,11 @@
 package capture
 
 import (
-	"context"
 	"fmt"
 	"log"
-	"net"
+	"os"
+	"runtime"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -34,9 +35,14 @@ import (
 // Orchestrates the packet capture process, managing the pcap handle and processing pipeline.
 type Engine struct {
 	interfaceName   string
-	handle          *pcap.Handle
-	packetSource    *gopacket.PacketSource
+	sources         []*captureSource
+	dedup           *duplicateFilter // nil unless capturing from several interfaces
+	defrag          *defragmenter
+	reassemblers    []*tcpReassembler // One per worker
+	quicTrackers    []*quicTracker    // One per worker
+	sampler         *sampler          // nil unless sampling is configured
 	flowTable       *correlator.FlowTable
+	neighborTable   *correlator.NeighborTable
 	geoIP           *enricher.GeoIPService
 	deviceTracker   *enricher.DeviceTracker
 	sessionTracker  *correlator.SessionTracker
@@ -45,9 +51,28 @@ type Engine struct {
 	privacyScanner  *analyzer.PrivacyScanner
 	wifiScanner     *wifi.Scanner
 
+	// Offline replay (nil for live capture)
+	replayFile *os.File
+	pacer      *replayPacer
+
+	// Pcap stream from stdin or a named pipe (nil otherwise)
+	stream *streamSource
+
+	// Evidence retention (nil when disabled)
+	ring *RingBuffer
+
+	// Pipeline shape
+	workers   int
+	queueSize int
+
+	// Stop conditions and the one that ended the capture, if any
+	limits       Limits
+	limitReached atomic.Pointer[error]
+
 	// Statistics
 	packetsProcessed uint64
 	bytesProcessed   uint64
+	pipeline         pipelineCounters
 
 	// Control
 	running atomic.Bool
@@ -63,6 +88,45 @@ type Config struct {
 	BPFFilter   string // Berkeley Packet Filter
 	GeoIPCityDB string // Path to City MMDB
 	GeoIPASNDB  string // Path to ASN MMDB
+	P0fDB       string // Path to a p0f v3 signature database; built-in signatures otherwise
+
+	// Offline replay only: sleep for the recorded inter-packet gap instead of
+	// reading the file as fast as possible.
+	ReplayRealtime bool
+
+	// Rolling on-disk packet buffer for evidence export; nil disables it.
+	RingBuffer *RingBufferConfig
+
+	// Capture from several interfaces at once into one shared pipeline; overrides
+	// Interface when set.
+	Interfaces []string
+
+	// Identical frames seen on two interfaces within this window are counted once.
+	// Zero selects the default; only applies when capturing from several interfaces.
+	DedupWindow time.Duration
+
+	// Processing parallelism: packets are sharded by flow across Workers goroutines,
+	// each fed by a queue of QueueSize packets. Zero selects the defaults.
+	Workers   int
+	QueueSize int
+
+	// IP fragment reassembly: datagrams still incomplete after FragmentTimeout are
+	// discarded, and at most MaxFragmentDatagrams are held at once. Zero selects the defaults.
+	FragmentTimeout      time.Duration
+	MaxFragmentDatagrams int
+
+	// TCP stream reassembly for TLS, HTTP and DNS over TCP: each worker follows at most
+	// MaxTCPStreams connections, holding at most MaxTCPStreamBuffer bytes per direction,
+	// and forgets connections idle for TCPStreamTimeout. Zero selects the defaults.
+	TCPStreamTimeout   time.Duration
+	MaxTCPStreams      int
+	MaxTCPStreamBuffer int
+
+	// Stop conditions: the capture ends cleanly once any of them is reached.
+	Limits Limits
+
+	// Packet sampling, always on or engaged under overload; the zero value disables it.
+	Sampling SamplingConfig
 }
 
 // Returns a sensible default configuration (Promiscuous mode, 64k snaplen).
@@ -76,6 +140,9 @@ func DefaultConfig(interfaceName string) *Config {
 		BPFFilter:   "",                              // No filter by default
 		GeoIPCityDB: "data/geoip/GeoLite2-City.mmdb", // Default path
 		GeoIPASNDB:  "data/geoip/GeoLite2-ASN.mmdb",  // Default path
+		P0fDB:       "data/p0f/p0f.fp",               // Default path
+		Workers:     runtime.NumCPU(),
+		QueueSize:   defaultQueueSize,
 	}
 }
 
@@ -85,12 +152,43 @@ func NewEngine(config *Config, store storage.Storage) (*Engine, error) {
 		return nil, fmt.Errorf("config cannot be nil")
 	}
 
+	names := config.CaptureInterfaces()
+
 	// Validate interface availability before initializing
-	_, err := FindInterface(config.Interface)
-	if err != nil {
-		return nil, fmt.Errorf("interface error: %w", err)
+	for _, name := range names {
+		if _, err := FindInterface(name); err != nil {
+			return nil, fmt.Errorf("interface error: %w", err)
+		}
+	}
+
+	engine := newPipeline(config, store)
+	engine.interfaceName = strings.Join(names, ", ")
+
+	for _, name := range names {
+		source, err := openLiveSource(name, config)
+		if err != nil {
+			engine.closeSources()
+			return nil, err
+		}
+		engine.sources = append(engine.sources, source)
 	}
 
+	// Bridged interfaces deliver the same frame more than once
+	if len(engine.sources) > 1 {
+		engine.dedup = newDuplicateFilter(config.DedupWindow)
+	}
+
+	if err := engine.attachRingBuffer(config); err != nil {
+		engine.closeSources()
+		return nil, err
+	}
+
+	return engine, nil
+}
+
+// Builds the source-independent part of the engine: enrichment services and trackers.
+// Live and offline constructors share this so replayed files see the exact same pipeline.
+func newPipeline(config *Config, store storage.Storage) *Engine {
 	// Initialize GeoIP Service
 	// We log error but don't fail, as it's an optional enrichment
 	geoIP, err := enricher.NewGeoIPService(config.GeoIPCityDB, config.GeoIPASNDB)
@@ -102,13 +200,45 @@ func NewEngine(config *Config, store storage.Storage) (*Engine, error) {
 
 	// Initialize Device Tracker
 	tracker := enricher.NewDeviceTracker(store)
+	if config.P0fDB != "" {
+		if err := tracker.LoadP0fDatabase(config.P0fDB); err != nil {
+			log.Printf("Warning: using built-in p0f signatures: %v", err)
+		}
+	}
 	if err := tracker.LoadCache(); err != nil {
 		log.Printf("Warning: Failed to load device cache: %v", err)
 	}
 
-	engine := &Engine{
+	workers := config.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	queueSize := config.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+
+	reassemblers := make([]*tcpReassembler, workers)
+	for i := range reassemblers {
+		reassemblers[i] = newTCPReassembler(config.TCPStreamTimeout, config.MaxTCPStreams, config.MaxTCPStreamBuffer)
+	}
+	quicTrackers := make([]*quicTracker, workers)
+	for i := range quicTrackers {
+		quicTrackers[i] = newQUICTracker()
+	}
+
+	return &Engine{
 		interfaceName:   config.Interface,
+		workers:         workers,
+		queueSize:       queueSize,
+		limits:          config.Limits,
+		pipeline:        pipelineCounters{worked: make([]uint64, workers)},
+		defrag:          newDefragmenter(config.FragmentTimeout, config.MaxFragmentDatagrams),
+		reassemblers:    reassemblers,
+		quicTrackers:    quicTrackers,
+		sampler:         newSampler(config.Sampling),
 		flowTable:       correlator.NewFlowTable(geoIP),
+		neighborTable:   correlator.NewNeighborTable(),
 		geoIP:           geoIP,
 		deviceTracker:   tracker,
 		sessionTracker:  correlator.NewSessionTracker(5 * time.Minute),
@@ -117,60 +247,16 @@ func NewEngine(config *Config, store storage.Storage) (*Engine, error) {
 		privacyScanner:  analyzer.NewPrivacyScanner(),
 		wifiScanner:     wifi.NewScanner(),
 	}
-
-	// Initialize inactive pcap handle first to safely configure options
-	inactive, err := pcap.NewInactiveHandle(config.Interface)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create inactive handle: %w", err)
-	}
-	defer inactive.CleanUp()
-
-	if err := inactive.SetSnapLen(int(config.SnapLen)); err != nil {
-		return nil, fmt.Errorf("failed to set snaplen: %w", err)
-	}
-
-	if err := inactive.SetPromisc(config.Promiscuous); err != nil {
-		return nil, fmt.Errorf("failed to set promiscuous mode: %w", err)
-	}
-
-	if err := inactive.SetTimeout(config.Timeout); err != nil {
-		return nil, fmt.Errorf("failed to set timeout: %w", err)
-	}
-
-	// Optimize kernel buffer size (100MB) to minimize packet drops on high-throughput links
-	if config.BufferSize > 0 {
-		if err := inactive.SetBufferSize(config.BufferSize * 1024 * 1024); err != nil {
-			log.Printf("Warning: failed to set buffer size: %v", err)
-		}
-	}
-
-	// Begin live capture on the interface
-	handle, err := inactive.Activate()
-	if err != nil {
-		return nil, fmt.Errorf("failed to activate handle: %w", err)
-	}
-
-	engine.handle = handle
-
-	// Set kernel-level packet filter
-	if config.BPFFilter != "" {
-		if err := handle.SetBPFFilter(config.BPFFilter); err != nil {
-			handle.Close()
-			return nil, fmt.Errorf("failed to set BPF filter: %w", err)
-		}
-		log.Printf("Applied BPF filter: %s", config.BPFFilter)
-	}
-
-	// Initialize GoPacket source for decoding
-	engine.packetSource = gopacket.NewPacketSource(handle, handle.LinkType())
-
-	return engine, nil
 }
 
 // Contains basic information about a captured packet for model conversion.
 type PacketInfo struct {
 	Timestamp      time.Time
+	Interface      string // Capture interface (or file) the packet was read from
 	Length         int
+	VLAN           uint16 // Outer 802.1Q VLAN ID, 0 when untagged
+	Tunnel         string // Outer tunnel type (e.g. "VXLAN"), empty when not tunneled
+	TunnelID       uint32 // Outer tunnel ID, 0 when none
 	SrcIP          string
 	DstIP          string
 	SrcPort        uint16
@@ -178,12 +264,27 @@ type PacketInfo struct {
 	Protocol       string
 	EthSrcMAC      string
 	EthDstMAC      string
-	DNSInfo        string          // Human-readable DNS info
-	TLSInfo        string          // Human-readable TLS info
-	DstDomain      string          // Correlated domain
-	DeviceVendor   string          // Source device vendor
-	DeviceHostname string          // Source device hostname
-	RawPacket      gopacket.Packet // Full packet for additional parsing
+	DNSInfo        string                  // Human-readable DNS info
+	TLSInfo        string                  // Human-readable TLS info
+	HTTPInfo       string                  // Human-readable HTTP info
+	DHCPInfo       string                  // Human-readable DHCP info
+	DiscoveryInfo  string                  // Human-readable mDNS, LLMNR, NetBIOS or SSDP info
+	SSHInfo        string                  // Human-readable SSH info
+	NeighborInfo   string                  // Human-readable ARP or NDP info
+	DNSQuery       *parser.DNSQuery        // Parsed DNS query, if the packet carries one
+	DNSResponse    *parser.DNSResponse     // Parsed DNS response, if the packet carries one
+	TLS            *parser.TLSInfo         // Parsed TLS Client Hello or Server Hello, if the packet carries one
+	Certificate    *parser.CertificateInfo // Server's leaf certificate, if the packet completes a TLS 1.2 chain
+	HTTP           *parser.HTTPInfo        // Parsed HTTP/1.x request or response headers, if the packet starts one
+	SSH            *parser.SSHInfo         // Parsed SSH identification line or KEXINIT, if the packet completes one
+	Neighbor       *parser.NeighborInfo    // Parsed ARP packet or Neighbor Discovery message
+	QUICVersion    string                  // QUIC version of a long header packet, e.g. "QUIC v1"
+	DHCP           *parser.DHCPInfo        // Parsed DHCPv4 or DHCPv6 message, if the packet carries one
+	Discovery      *parser.DiscoveryInfo   // Parsed local service discovery message, if the packet carries one
+	TCPSignature   *models.TCPSignature    // Stack traits of a SYN or SYN+ACK, for OS fingerprinting
+	DstDomain      string                  // Correlated domain
+	DeviceVendor   string                  // Source device vendor
+	DeviceHostname string                  // Source device hostname
 	Anomalies      []analyzer.Anomaly
 	PrivacyIssues  []analyzer.PrivacyIssue
 	WiFiNetwork    *wifi.WiFiNetwork // New
@@ -191,113 +292,29 @@ type PacketInfo struct {
 	Handshake      *models.Handshake // New
 }
 
-// Begins capturing packets in a blocking loop until the context is canceled.
-func (e *Engine) Start(ctx context.Context, handler func(PacketInfo)) error {
-	if e.running.Load() {
-		return fmt.Errorf("engine already running")
-	}
-
-	e.running.Store(true)
-	defer e.running.Store(false)
-
-	log.Printf("Starting packet capture on %s", e.interfaceName)
-	log.Printf("Capture mode: promiscuous=%v", true)
-
-	packets := e.packetSource.Packets()
-
-	for {
-		select {
-		case <-ctx.Done():
-			log.Println("Capture stopped by context")
-			return ctx.Err()
-
-		case packet, ok := <-packets:
-			if !ok {
-				log.Println("Packet channel closed")
-				return nil
-			}
-
-			if packet == nil {
-				continue
-			}
-
-			// Process raw packet data
-			info := e.extractPacketInfo(packet)
-			info.RawPacket = packet // Include full packet for additional parsing
-
-			// Track Device
-			if e.deviceTracker != nil {
-				device := e.deviceTracker.Track(packet)
-				if device != nil {
-					info.DeviceVendor = device.Vendor
-					info.DeviceHostname = device.Hostname
-					if info.DeviceHostname == "" {
-						info.DeviceHostname = "Unknown Device"
-					}
-				}
-			}
-
-			// Track flow state and stats
-			modelPacket := e.toModelPacket(info)
-			flow := e.flowTable.Update(modelPacket)
-
-			if flow != nil {
-				if flow.DstDomain != "" {
-					info.DstDomain = flow.DstDomain
-				} else if flow.TLSSNI != "" {
-					info.DstDomain = flow.TLSSNI
-				}
-
-				// Track session (groups related flows)
-				if e.sessionTracker != nil {
-					e.sessionTracker.TrackFlow(flow)
-				}
-
-				// Update behavioral baseline
-				if e.baselineTracker != nil && info.EthSrcMAC != "" {
-					e.baselineTracker.UpdateBaseline(info.EthSrcMAC, flow)
-
-					// Detect Anomalies (Real-time)
-					if e.anomalyDetector != nil {
-						baseline := e.baselineTracker.GetBaseline(info.EthSrcMAC)
-						info.Anomalies = e.anomalyDetector.Detect(flow, baseline)
-					}
-				}
-
-				// Scan for Privacy Issues (Real-time)
-				if e.privacyScanner != nil {
-					info.PrivacyIssues = e.privacyScanner.Scan(flow)
-				}
-			}
-
-			if handler != nil {
-				handler(info)
-			}
-
-			// Atomic update of performance metrics
-			atomic.AddUint64(&e.packetsProcessed, 1)
-			atomic.AddUint64(&e.bytesProcessed, uint64(packet.Metadata().Length))
-		}
-	}
-}
-
-// extractPacketInfo extracts basic information from a packet
-func (e *Engine) extractPacketInfo(packet gopacket.Packet) PacketInfo {
+// extractPacketInfo builds the packet summary from the source's single decode
+func (e *Engine) extractPacketInfo(sp *sourcedPacket) PacketInfo {
+	f := &sp.frame
 	info := PacketInfo{
-		Timestamp: packet.Metadata().Timestamp,
-		Length:    packet.Metadata().Length,
+		Timestamp: sp.ci.Timestamp,
+		Interface: sp.source.name,
+		Length:    sp.ci.Length,
+		VLAN:      f.vlan,
+		Tunnel:    f.tunnel,
+		TunnelID:  f.tunnelID,
 		Protocol:  "Unknown",
 	}
 
-	// Parse Ethernet header
-	if ethLayer := packet.Layer(layers.LayerTypeEthernet); ethLayer != nil {
-		eth, _ := ethLayer.(*layers.Ethernet)
-		info.EthSrcMAC = eth.SrcMAC.String()
-		info.EthDstMAC = eth.DstMAC.String()
+	// Ethernet addresses
+	if f.srcMAC != nil {
+		info.EthSrcMAC = f.srcMAC.String()
+		info.EthDstMAC = f.dstMAC.String()
 	}
 
-	// [NEW] Parse WiFi Layers (if Monitor Mode)
-	if e.wifiScanner != nil {
+	// [NEW] Parse WiFi Layers (if Monitor Mode). Management frames span dozens of
+	// layer types, so only 802.11 captures pay for a full gopacket decode.
+	if e.wifiScanner != nil && isWiFiLinkType(sp.source.linkType) {
+		packet := gopacket.NewPacket(sp.data, sp.source.linkType, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
 		if net := e.wifiScanner.ParseBeacon(packet); net != nil {
 			info.WiFiNetwork = net
 			info.Protocol = "802.11 Beacon"
@@ -315,81 +332,174 @@ func (e *Engine) extractPacketInfo(packet gopacket.Packet) PacketInfo {
 		}
 	}
 
-	// Parse IP (v4/v6) header
-	if ipLayer := packet.Layer(layers.LayerTypeIPv4); ipLayer != nil {
-		ip, _ := ipLayer.(*layers.IPv4)
-		info.SrcIP = ip.SrcIP.String()
-		info.DstIP = ip.DstIP.String()
-		info.Protocol = ip.Protocol.String()
-	} else if ipLayer := packet.Layer(layers.LayerTypeIPv6); ipLayer != nil {
-		ip, _ := ipLayer.(*layers.IPv6)
-		info.SrcIP = ip.SrcIP.String()
-		info.DstIP = ip.DstIP.String()
-		info.Protocol = ip.NextHeader.String()
-	}
-
-	// Extract TCP layer
-	if tcpLayer := packet.Layer(layers.LayerTypeTCP); tcpLayer != nil {
-		tcp, _ := tcpLayer.(*layers.TCP)
-		info.SrcPort = uint16(tcp.SrcPort)
-		info.DstPort = uint16(tcp.DstPort)
-		info.Protocol = "TCP"
+	// IP (v4/v6) or ARP addressing
+	switch f.network {
+	case layers.LayerTypeIPv4, layers.LayerTypeIPv6:
+		info.SrcIP = f.srcIP.String()
+		info.DstIP = f.dstIP.String()
+		info.Protocol = f.protocol.String()
+	case layers.LayerTypeARP:
+		// Extract IPv4 addresses from ARP payload
+		info.SrcIP = f.srcIP.String()
+		info.DstIP = f.dstIP.String()
+		info.Protocol = "ARP"
 	}
 
-	// Extract UDP layer
-	if udpLayer := packet.Layer(layers.LayerTypeUDP); udpLayer != nil {
-		udp, _ := udpLayer.(*layers.UDP)
-		info.SrcPort = uint16(udp.SrcPort)
-		info.DstPort = uint16(udp.DstPort)
+	// Transport ports and protocol
+	switch f.transport {
+	case layers.LayerTypeTCP:
+		info.SrcPort, info.DstPort = f.srcPort, f.dstPort
+		info.Protocol = "TCP"
+	case layers.LayerTypeUDP:
+		info.SrcPort, info.DstPort = f.srcPort, f.dstPort
 		info.Protocol = "UDP"
-	}
-
-	// Handle ICMP
-	if packet.Layer(layers.LayerTypeICMPv4) != nil {
+	case layers.LayerTypeICMPv4:
 		info.Protocol = "ICMPv4"
-	} else if packet.Layer(layers.LayerTypeICMPv6) != nil {
+	case layers.LayerTypeICMPv6:
 		info.Protocol = "ICMPv6"
 	}
 
-	// Handle ARP
-	if arpLayer := packet.Layer(layers.LayerTypeARP); arpLayer != nil {
-		info.Protocol = "ARP"
-		arp, _ := arpLayer.(*layers.ARP)
-		// Extract IPv4 addresses from ARP payload
-		info.SrcIP = net.IP(arp.SourceProtAddress).String()
-		info.DstIP = net.IP(arp.DstProtAddress).String()
-	}
-
-	// Decode DNS layer details
-	if parser.IsDNSPacket(packet) {
-		query, response, _ := parser.ParseDNS(packet)
-		if query != nil {
-			info.Protocol = "DNS"
-			info.DNSInfo = fmt.Sprintf("Query: %s (%s)", query.QueryName, query.QueryType)
-		} else if response != nil {
-			info.Protocol = "DNS"
-			info.DNSInfo = response.FormatResponse()
+	// DNS was parsed by the source; reuse its result
+	if f.dnsQuery != nil {
+		info.Protocol = "DNS"
+		info.DNSQuery = f.dnsQuery
+		info.DNSInfo = fmt.Sprintf("Query: %s (%s)", f.dnsQuery.QueryName, f.dnsQuery.QueryType)
+	} else if f.dnsResponse != nil {
+		info.Protocol = "DNS"
+		info.DNSResponse = f.dnsResponse
+		info.DNSInfo = f.dnsResponse.FormatResponse()
+	}
+
+	// Analyze TLS handshake and HTTP metadata. Reassembled streams deliver messages
+	// whole; segments of connections not followed are parsed on their own.
+	if f.transport == layers.LayerTypeTCP {
+		if sp.app != nil {
+			info.setStreamResult(sp.app)
+		} else {
+			app := &streamResult{}
+			app.tls, _ = parser.ParseTLSPayload(f.payload)
+			if app.tls == nil {
+				app.http, _ = parser.ParseHTTPPayload(f.payload)
+			}
+			if app.tls == nil && app.http == nil {
+				if app.ssh, _ = parser.ParseSSHPayload(f.payload); app.ssh != nil {
+					app.ssh.Client = isClientSide(f.srcPort, f.dstPort)
+				}
+			}
+			info.setStreamResult(app)
+		}
+	}
+
+	// QUIC Initial packets were decrypted by the worker's tracker
+	if f.transport == layers.LayerTypeUDP && sp.app != nil {
+		info.setStreamResult(sp.app)
+	}
+
+	// DHCP names the devices on the local network
+	if f.transport == layers.LayerTypeUDP {
+		if dhcp, _ := parser.ParseDHCPPayload(f.payload, f.srcPort, f.dstPort); dhcp != nil {
+			info.Protocol = "DHCP"
+			if dhcp.Version == 6 {
+				info.Protocol = "DHCPv6"
+			}
+			info.DHCP = dhcp
+			info.DHCPInfo = dhcp.Summary()
+		}
+		// As do the names and services they announce
+		if discovery, _ := parser.ParseDiscoveryPayload(f.payload, f.srcPort, f.dstPort); discovery != nil {
+			info.Protocol = discovery.Protocol
+			info.Discovery = discovery
+			info.DiscoveryInfo = discovery.Summary()
 		}
 	}
+	// ARP and Neighbor Discovery bind the link's addresses to MACs
+	var neighbor *parser.NeighborInfo
+	switch {
+	case f.arp != nil:
+		neighbor, _ = parser.ParseARPPacket(f.arp)
+	case f.icmpv6 != nil:
+		neighbor, _ = parser.ParseNDPMessage(f.icmpv6, f.srcIP, f.srcMAC, f.ttl)
+	}
+	if neighbor != nil {
+		info.Protocol = neighbor.Protocol
+		info.Neighbor = neighbor
+		info.NeighborInfo = neighbor.Summary()
+	}
+
+	// The stack's choices in a connection's opening segments fingerprint the OS
+	if f.transport == layers.LayerTypeTCP && f.syn {
+		info.TCPSignature = parser.ParseTCPSignature(f.ipHeader, f.tcpHeader, len(f.payload))
+	}
+
+	return info
+}
 
-	// Analyze TLS handshake metadata
-	tlsInfo, _ := parser.ParseTLS(packet)
-	if tlsInfo != nil && tlsInfo.Handshake {
+// Records the application data a TCP segment or QUIC datagram carried or completed.
+func (info *PacketInfo) setStreamResult(app *streamResult) {
+	if app.tls != nil && app.tls.Handshake {
 		info.Protocol = "TLS" // Override TCP
-		if tlsInfo.SNI != "" {
-			info.TLSInfo = fmt.Sprintf("Client Hello (SNI: %s)", tlsInfo.SNI)
+		info.TLS = app.tls
+		if app.tls.ServerHello {
+			info.TLSInfo = fmt.Sprintf("Server Hello (%s, %s)", app.tls.Version, app.tls.CipherSuite)
+		} else if app.tls.SNI != "" {
+			info.TLSInfo = fmt.Sprintf("Client Hello (SNI: %s)", app.tls.SNI)
 		} else {
 			info.TLSInfo = "Client Hello"
 		}
+	} else if app.cert != nil {
+		info.Protocol = "TLS" // Override TCP
+		info.TLSInfo = fmt.Sprintf("Certificate (%s)", app.cert.Name())
+	} else if app.http != nil {
+		info.Protocol = "HTTP" // Override TCP
+		info.HTTP = app.http
+		info.HTTPInfo = app.http.Summary()
 	}
+	info.Certificate = app.cert
 
-	return info
+	if app.ssh != nil {
+		info.Protocol = "SSH" // Override TCP
+		info.SSH = app.ssh
+		info.SSHInfo = app.ssh.Summary()
+	}
+
+	if app.dnsQuery != nil {
+		info.Protocol = "DNS"
+		info.DNSQuery = app.dnsQuery
+		info.DNSInfo = fmt.Sprintf("Query: %s (%s)", app.dnsQuery.QueryName, app.dnsQuery.QueryType)
+	} else if app.dnsResponse != nil {
+		info.Protocol = "DNS"
+		info.DNSResponse = app.dnsResponse
+		info.DNSInfo = app.dnsResponse.FormatResponse()
+	}
+
+	if app.quicVersion != 0 {
+		info.Protocol = "QUIC" // Override UDP and the TLS carried inside
+		info.QUICVersion = parser.QUICVersionName(app.quicVersion)
+	}
+}
+
+// Reports whether frames of the link type are raw 802.11 from a monitor-mode interface.
+func isWiFiLinkType(linkType layers.LinkType) bool {
+	switch linkType {
+	case layers.LinkTypeIEEE802_11, layers.LinkTypeIEEE80211Radio, layers.LinkTypePrismHeader:
+		return true
+	}
+	return false
 }
 
-// Stops the capture engine and closes the handle.
+// Stops the capture engine and closes its handles.
 func (e *Engine) Stop() {
-	if e.handle != nil {
-		e.handle.Close()
+	e.closeSources()
+	if e.replayFile != nil {
+		e.replayFile.Close()
+	}
+	if e.stream != nil {
+		e.stream.Close()
+	}
+	if e.ring != nil {
+		if err := e.ring.Close(); err != nil {
+			log.Printf("Warning: failed to close ring buffer: %v", err)
+		}
 	}
 	if e.geoIP != nil {
 		e.geoIP.Close()
@@ -403,11 +513,14 @@ func (e *Engine) Stats() (packetsProcessed, packetsDropped, bytesProcessed uint6
 	packetsProcessed = atomic.LoadUint64(&e.packetsProcessed)
 	bytesProcessed = atomic.LoadUint64(&e.bytesProcessed)
 
-	// Get drop statistics from pcap
-	if e.handle != nil {
-		stats, err := e.handle.Stats()
+	// Get drop statistics from pcap, summed across interfaces
+	for _, source := range e.sources {
+		if source.handle == nil {
+			continue
+		}
+		stats, err := source.handle.Stats()
 		if err == nil {
-			packetsDropped = uint64(stats.PacketsDropped)
+			packetsDropped += uint64(stats.PacketsDropped)
 		}
 	}
 
@@ -415,10 +528,14 @@ func (e *Engine) Stats() (packetsProcessed, packetsDropped, bytesProcessed uint6
 }
 
 // toModelPacket converts internal PacketInfo to models.Packet for flow tracking
-func (e *Engine) toModelPacket(info PacketInfo) *models.Packet {
+func (e *Engine) toModelPacket(info PacketInfo, f *frame) *models.Packet {
 	p := &models.Packet{
 		Timestamp: info.Timestamp,
+		Interface: info.Interface,
 		Length:    info.Length,
+		VLAN:      info.VLAN,
+		Tunnel:    info.Tunnel,
+		TunnelID:  info.TunnelID,
 		Layer2: &models.Layer2{
 			SrcMAC: info.EthSrcMAC,
 			DstMAC: info.EthDstMAC,
@@ -427,65 +544,197 @@ func (e *Engine) toModelPacket(info PacketInfo) *models.Packet {
 			SrcIP:    info.SrcIP,
 			DstIP:    info.DstIP,
 			Protocol: info.Protocol, // Note: info.Protocol might be "TCP" or "DNS", models.Layer3.Protocol is typically IP proto
+			TTL:      f.ttl,
 		},
 		Layer4: &models.Layer4{
 			SrcPort:  int(info.SrcPort),
 			DstPort:  int(info.DstPort),
 			Protocol: info.Protocol,
 		},
+		DNS: f.dns, // Built once by the source so the reader can prime the DNS cache
 	}
 
-	// Add enriched info
-	if info.Protocol == "DNS" {
-		// Re-parse the packet to extract structured DNS data.
-		if parser.IsDNSPacket(info.RawPacket) {
-			query, response, _ := parser.ParseDNS(info.RawPacket)
+	// DNS over TCP is only parsed once its stream is reassembled, in the worker
+	if p.DNS == nil && f.transport == layers.LayerTypeTCP {
+		p.DNS = dnsModel(info.DNSQuery, info.DNSResponse)
+	}
 
-			if query != nil {
-				p.DNS = &models.DNS{
-					Query:     query.QueryName,
-					Type:      "Query",
-					QueryType: query.QueryType,
-				}
-			} else if response != nil {
-				answers := make([]models.DNSAnswer, len(response.Answers))
-				for i, a := range response.Answers {
-					answers[i] = models.DNSAnswer{
-						Name:  a.Name,
-						Type:  a.Type,
-						IP:    a.IP,
-						TTL:   a.TTL,
-						CNAME: a.CNAME,
-					}
-				}
+	// TLS and HTTP label single segments of a TCP connection; keying them by the
+	// transport keeps them in the connection's flow so their metadata lands there
+	if f.transport == layers.LayerTypeTCP {
+		p.Layer4.Protocol = "TCP"
+	}
+	// And NDP labels only some of the ICMPv6 messages between two hosts
+	if f.transport == layers.LayerTypeICMPv6 {
+		p.Layer4.Protocol = "ICMPv6"
+	}
+	// Likewise QUIC labels only the long header packets of a UDP connection
+	if info.QUICVersion != "" {
+		p.Layer4.Protocol = "UDP"
+		p.QUIC = &models.QUIC{Version: info.QUICVersion}
+	}
 
-				p.DNS = &models.DNS{
-					Query:   response.QueryName,
-					Answers: answers,
-					Type:    "Response",
-					ResCode: response.ResponseCode,
-				}
-			}
+	if d := info.DHCP; d != nil {
+		p.DHCP = &models.DHCP{
+			Version:     d.Version,
+			MessageType: d.MessageType,
+			FromServer:  d.FromServer,
+			ClientMAC:   d.ClientMAC,
+			Hostname:    d.Name(),
+			VendorClass: d.VendorClass,
+			AssignedIP:  d.AssignedIP,
+			LeaseTime:   d.LeaseTime,
+		}
+		// DHCPv6 option codes are a different space; only DHCPv4 lists are fingerprints
+		if d.Version == 4 {
+			p.DHCP.Fingerprint = d.Fingerprint()
 		}
 	}
 
+	// Queries name what the sender looks for, not the sender
+	if d := info.Discovery; d != nil && !d.Query {
+		p.Discovery = &models.Discovery{
+			Protocol: d.Protocol,
+			Hostname: d.Name(),
+			Services: d.Services,
+			Model:    d.Model,
+			Server:   d.Server,
+		}
+	}
+	p.TCPSig = info.TCPSignature
+
+	if n := info.Neighbor; n != nil {
+		ip, mac := n.Binding()
+		p.Neighbor = &models.NeighborMessage{
+			Protocol:   n.Protocol,
+			IP:         ip,
+			MAC:        mac,
+			Gratuitous: n.Gratuitous,
+			Router:     n.Router,
+			Advert:     n.Advert,
+		}
+		if n.Probe {
+			p.Neighbor.IP, p.Neighbor.MAC, p.Neighbor.Probe = n.TargetIP, n.SenderMAC, true
+		}
+	}
+
+	if s := info.SSH; s != nil {
+		p.SSH = &models.SSH{
+			Client:          s.Client,
+			Software:        s.Software,
+			Banner:          s.Banner,
+			HASSH:           s.HASSH(),
+			HASSHAlgorithms: s.HASSHAlgorithms(),
+		}
+	}
+
+	switch f.network {
+	case layers.LayerTypeIPv4:
+		p.Layer3.Version = "IPv4"
+	case layers.LayerTypeIPv6:
+		p.Layer3.Version = "IPv6"
+	}
+
 	// Add TLS info
-	if info.Protocol == "TLS" {
-		tlsInfo, _ := parser.ParseTLS(info.RawPacket)
-		if tlsInfo != nil {
-			p.TLS = &models.TLS{
-				SNI:         tlsInfo.SNI,
-				Version:     tlsInfo.Version,
-				CipherSuite: tlsInfo.CipherSuite,
-				Handshake:   tlsInfo.Handshake,
-				JA3:         tlsInfo.JA3,
+	if info.TLS != nil {
+		p.TLS = &models.TLS{
+			SNI:         info.TLS.SNI,
+			Version:     info.TLS.Version,
+			CipherSuite: info.TLS.CipherSuite,
+			Handshake:   info.TLS.Handshake,
+			ServerHello: info.TLS.ServerHello,
+			JA3:         info.TLS.JA3,
+			JA3S:        info.TLS.JA3S,
+			JA4:         info.TLS.JA4,
+			JA4S:        info.TLS.JA4S,
+		}
+		if info.TLS.ServerHello {
+			if len(info.TLS.ALPN) > 0 {
+				p.TLS.ALPN = info.TLS.ALPN[0]
+			}
+		} else {
+			p.TLS.ClientHello = &models.ClientHello{
+				RecordVersion:       info.TLS.RecordVersion,
+				LegacyVersion:       info.TLS.LegacyVersion,
+				SupportedVersions:   info.TLS.SupportedVersions,
+				ALPN:                info.TLS.ALPN,
+				SupportedGroups:     info.TLS.SupportedGroups,
+				SignatureAlgorithms: info.TLS.SignatureAlgorithms,
+				ECH:                 info.TLS.ECH,
+				GREASE:              info.TLS.GREASE,
 			}
 		}
 	}
+	if cert := info.Certificate; cert != nil {
+		if p.TLS == nil {
+			p.TLS = &models.TLS{Handshake: true}
+		}
+		p.TLS.Certificate = &models.Certificate{
+			Subject:    cert.Subject,
+			CommonName: cert.CommonName,
+			SANs:       cert.SANs,
+			Issuer:     cert.Issuer,
+			NotBefore:  cert.NotBefore,
+			NotAfter:   cert.NotAfter,
+			Serial:     cert.Serial,
+			SHA256:     cert.SHA256,
+			Chain:      cert.Chain,
+			JA4X:       cert.JA4X,
+		}
+	}
+
+	// Add HTTP info
+	if info.HTTP != nil {
+		p.HTTP = &models.HTTP{
+			IsRequest:   info.HTTP.IsRequest,
+			Method:      info.HTTP.Method,
+			URI:         info.HTTP.URI,
+			Host:        info.HTTP.Host,
+			UserAgent:   info.HTTP.UserAgent,
+			Referer:     info.HTTP.Referer,
+			StatusCode:  info.HTTP.StatusCode,
+			Server:      info.HTTP.Server,
+			ContentType: info.HTTP.ContentType,
+			JA4H:        info.HTTP.JA4H,
+		}
+	}
 
 	return p
 }
 
+// Converts a parsed DNS message into the structured model used for flow correlation.
+// Returns nil when neither a query nor a response was decoded.
+func dnsModel(query *parser.DNSQuery, response *parser.DNSResponse) *models.DNS {
+	if query != nil {
+		return &models.DNS{
+			Query:     query.QueryName,
+			Type:      "Query",
+			QueryType: query.QueryType,
+		}
+	}
+	if response != nil {
+		answers := make([]models.DNSAnswer, len(response.Answers))
+		for i, a := range response.Answers {
+			answers[i] = models.DNSAnswer{
+				Name:  a.Name,
+				Type:  a.Type,
+				IP:    a.IP,
+				TTL:   a.TTL,
+				CNAME: a.CNAME,
+				Data:  a.Data,
+			}
+		}
+
+		return &models.DNS{
+			Query:   response.QueryName,
+			Answers: answers,
+			Type:    "Response",
+			ResCode: response.ResponseCode,
+		}
+	}
+	return nil
+}
+
 // Returns the active flows from the flow table for display and analysis.
 func (e *Engine) GetActiveFlows() []*models.Flow {
 	if e.flowTable == nil {
@@ -494,6 +743,26 @@ func (e *Engine) GetActiveFlows() []*models.Flow {
 	return e.flowTable.GetActiveFlows()
 }
 
+// Records on the live flow what saving a copy returned by GetActiveFlows produced.
+func (e *Engine) MarkFlowPersisted(saved *models.Flow) {
+	if e.flowTable != nil {
+		e.flowTable.MarkPersisted(saved)
+	}
+}
+
+// Returns the IP to MAC bindings learned from ARP and NDP.
+func (e *Engine) GetNeighbors() []*models.Neighbor {
+	if e.neighborTable == nil {
+		return nil
+	}
+	return e.neighborTable.Neighbors()
+}
+
+// Returns the neighbor table, for persisting its changes.
+func (e *Engine) GetNeighborTable() *correlator.NeighborTable {
+	return e.neighborTable
+}
+
 // Returns the session tracker for accessing session data.
 func (e *Engine) GetSessionTracker() *correlator.SessionTracker {
 	return e.sessionTracker
@@ -508,3 +777,29 @@ func (e *Engine) GetBaselineTracker() *analyzer.BaselineTracker {
 func (e *Engine) IsRunning() bool {
 	return e.running.Load()
 }
+
+// Returns the limit that ended the last capture, or nil if none did.
+func (e *Engine) LimitReached() error {
+	if cause := e.limitReached.Load(); cause != nil {
+		return *cause
+	}
+	return nil
+}
+
+// Reports whether the engine is replaying a capture file rather than a live interface.
+func (e *Engine) IsOffline() bool {
+	return e.replayFile != nil
+}
+
+// Returns the evidence ring buffer, or nil when it is disabled.
+func (e *Engine) GetRingBuffer() *RingBuffer {
+	return e.ring
+}
+
+// Writes the retained packets matching filter to a pcapng file at path.
+func (e *Engine) CarveEvidence(filter CarveFilter, path string) (int, error) {
+	if e.ring == nil {
+		return 0, fmt.Errorf("ring buffer is not enabled")
+	}
+	return e.ring.CarveToFile(filter, path)
+}
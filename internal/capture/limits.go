@@ -0,0 +1,161 @@
+/**
+ * Capture Limits and Schedules.
+ *
+ * Stop conditions that let a capture run unattended: a wall-clock
+ * duration, a packet count and a byte count, whichever is reached first.
+ * Daily windows such as 22:00-06:00 describe when recurring captures run;
+ * each occurrence of the window is a separate run bounded by its end.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package capture
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Causes reported by Engine.LimitReached when a stop condition ends a capture.
+var (
+	ErrDurationLimit = errors.New("duration limit reached")
+	ErrPacketLimit   = errors.New("packet limit reached")
+	ErrByteLimit     = errors.New("byte limit reached")
+)
+
+// Stop conditions for one capture run. Zero fields impose no limit.
+type Limits struct {
+	Duration time.Duration // Wall-clock time from Start
+	Packets  uint64        // Packets delivered to the handler
+	Bytes    uint64        // Original wire length of the packets delivered
+}
+
+// Reports whether no stop condition is set.
+func (l Limits) IsZero() bool {
+	return l.Duration <= 0 && l.Packets == 0 && l.Bytes == 0
+}
+
+// Describes the limits for display, e.g. "1h0m0s, 10000 packets".
+func (l Limits) String() string {
+	var parts []string
+	if l.Duration > 0 {
+		parts = append(parts, l.Duration.String())
+	}
+	if l.Packets > 0 {
+		parts = append(parts, fmt.Sprintf("%d packets", l.Packets))
+	}
+	if l.Bytes > 0 {
+		parts = append(parts, fmt.Sprintf("%d bytes", l.Bytes))
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Derives the context a capture runs under: it is canceled with ErrDurationLimit once
+// the duration elapses, and the returned function cancels it with any other cause.
+func (l Limits) context(parent context.Context) (context.Context, context.CancelCauseFunc) {
+	ctx, cancel := context.WithCancelCause(parent)
+	if l.Duration <= 0 {
+		return ctx, cancel
+	}
+
+	timed, stop := context.WithTimeoutCause(ctx, l.Duration, ErrDurationLimit)
+	return timed, func(cause error) {
+		cancel(cause)
+		stop()
+	}
+}
+
+// Reports which limit a delivered packet count and byte total have reached, if any.
+func (l Limits) reached(packets, bytes uint64) error {
+	if l.Packets > 0 && packets >= l.Packets {
+		return ErrPacketLimit
+	}
+	if l.Bytes > 0 && bytes >= l.Bytes {
+		return ErrByteLimit
+	}
+	return nil
+}
+
+// Reports whether err is one of the limit causes.
+func isLimitError(err error) bool {
+	return errors.Is(err, ErrDurationLimit) || errors.Is(err, ErrPacketLimit) || errors.Is(err, ErrByteLimit)
+}
+
+// A daily time-of-day window. An end at or before the start crosses midnight, so
+// 22:00-06:00 runs overnight. Times are interpreted in the local time zone of the
+// instant passed to Next, so windows follow daylight saving changes.
+type Window struct {
+	Start time.Duration // Offset of the start from midnight
+	End   time.Duration // Offset of the end from midnight
+}
+
+// Parses a window written as "HH:MM-HH:MM".
+func ParseWindow(s string) (Window, error) {
+	from, to, ok := strings.Cut(strings.TrimSpace(s), "-")
+	if !ok {
+		return Window{}, fmt.Errorf("invalid window %q: expected HH:MM-HH:MM", s)
+	}
+
+	start, err := parseClock(from)
+	if err != nil {
+		return Window{}, fmt.Errorf("invalid window start: %w", err)
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return Window{}, fmt.Errorf("invalid window end: %w", err)
+	}
+	if start == end {
+		return Window{}, fmt.Errorf("invalid window %q: start and end are equal", s)
+	}
+	return Window{Start: start, End: end}, nil
+}
+
+// Parses an HH:MM time of day into its offset from midnight.
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("%q is not HH:MM", strings.TrimSpace(s))
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Formats the window as "HH:MM-HH:MM".
+func (w Window) String() string {
+	return formatClock(w.Start) + "-" + formatClock(w.End)
+}
+
+func formatClock(offset time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(offset/time.Hour), int(offset%time.Hour/time.Minute))
+}
+
+// Returns the occurrence of the window in progress at t, or else the next one to begin.
+// The start is before or at t when the window is already open.
+func (w Window) Next(t time.Time) (start, end time.Time) {
+	// An overnight occurrence in progress started yesterday
+	year, month, day := t.AddDate(0, 0, -1).Date()
+	for i := 0; i < 3; i++ {
+		start = clockOn(year, month, day+i, w.Start, t.Location())
+		endDay := day + i
+		if w.End <= w.Start {
+			endDay++
+		}
+		end = clockOn(year, month, endDay, w.End, t.Location())
+		if end.After(t) {
+			return start, end
+		}
+	}
+	return start, end
+}
+
+// Returns the wall-clock time offset from midnight on the given day. time.Date
+// normalizes day overflow, so callers may pass day+1.
+func clockOn(year int, month time.Month, day int, offset time.Duration, loc *time.Location) time.Time {
+	return time.Date(year, month, day, int(offset/time.Hour), int(offset%time.Hour/time.Minute), 0, 0, loc)
+}
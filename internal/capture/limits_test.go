@@ -0,0 +1,179 @@
+/**
+ * Capture Limit and Schedule Tests.
+ *
+ * Validates that packet, byte and duration limits end a capture cleanly
+ * and exactly, and that daily windows, including ones crossing midnight,
+ * resolve to the right occurrence.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package capture
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// Verifies that each limit stops the capture cleanly and reports itself.
+func TestEngine_Limits(t *testing.T) {
+	start := time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC)
+	frames := make([][]byte, 5)
+	stamps := make([]time.Time, 5)
+	for i := range frames {
+		frames[i] = buildRingPacket(t, ringClientMAC, ringRouterMAC, net.IP{192, 168, 1, 100}, net.IP{93, 184, 216, 34}, uint16(50000+i), 443, 10)
+		stamps[i] = start.Add(time.Duration(i) * time.Millisecond)
+	}
+	frameLength := uint64(len(frames[0]))
+
+	tests := []struct {
+		name          string
+		limits        Limits
+		wantDelivered uint64
+		wantLimit     error
+	}{
+		{"no limits", Limits{}, 5, nil},
+		{"packet limit", Limits{Packets: 3}, 3, ErrPacketLimit},
+		{"byte limit", Limits{Bytes: 2*frameLength + 1}, 3, ErrByteLimit},
+		{"limit above the capture", Limits{Packets: 10, Duration: time.Hour}, 5, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig("")
+			config.Limits = tt.limits
+			engine := newPipeline(config, newTestStore(t))
+			engine.sources = []*captureSource{newTestSource(t, "eth0", frames, stamps)}
+			defer engine.Stop()
+
+			var delivered uint64
+			if err := engine.Start(context.Background(), func(PacketInfo) { delivered++ }); err != nil {
+				t.Fatalf("Expected a clean end, got %v", err)
+			}
+
+			if delivered != tt.wantDelivered {
+				t.Errorf("Expected %d packets delivered, got %d", tt.wantDelivered, delivered)
+			}
+			if packets, _, _ := engine.Stats(); packets != tt.wantDelivered {
+				t.Errorf("Expected Stats to count %d packets, got %d", tt.wantDelivered, packets)
+			}
+			if got := engine.LimitReached(); !errors.Is(got, tt.wantLimit) || (got == nil) != (tt.wantLimit == nil) {
+				t.Errorf("Expected limit %v, got %v", tt.wantLimit, got)
+			}
+		})
+	}
+
+	// A quiet source never reaches a count, so only the duration can end it
+	t.Run("duration limit", func(t *testing.T) {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+		go w.Write(buildPcapStream(t, 0, start))
+
+		stream, err := newStreamSource("stdin", r, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		engine := newStreamTestEngine(t, stream)
+		engine.limits = Limits{Duration: 50 * time.Millisecond}
+		defer engine.Stop()
+
+		began := time.Now()
+		if err := engine.Start(context.Background(), nil); err != nil {
+			t.Fatalf("Expected a clean end, got %v", err)
+		}
+		if elapsed := time.Since(began); elapsed > 5*time.Second {
+			t.Errorf("Expected the capture to stop after 50ms, took %v", elapsed)
+		}
+		if got := engine.LimitReached(); !errors.Is(got, ErrDurationLimit) {
+			t.Errorf("Expected the duration limit, got %v", got)
+		}
+	})
+
+	// Canceling the caller's context is an interruption, not a limit
+	t.Run("canceled", func(t *testing.T) {
+		config := DefaultConfig("")
+		config.Limits = Limits{Packets: 3}
+		engine := newPipeline(config, newTestStore(t))
+		engine.sources = []*captureSource{newTestSource(t, "eth0", frames, stamps)}
+		defer engine.Stop()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := engine.Start(ctx, nil); !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+		if got := engine.LimitReached(); got != nil {
+			t.Errorf("Expected no limit, got %v", got)
+		}
+	})
+}
+
+// Verifies window parsing and formatting.
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"22:00-06:00", "22:00-06:00", false},
+		{" 9:30 - 17:45 ", "09:30-17:45", false},
+		{"00:00-23:59", "00:00-23:59", false},
+		{"22:00", "", true},
+		{"25:00-06:00", "", true},
+		{"08:00-08:00", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			w, err := ParseWindow(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && w.String() != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, w)
+			}
+		})
+	}
+}
+
+// Verifies that Next finds the open occurrence or the next one, across midnight.
+func TestWindow_Next(t *testing.T) {
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2021, 3, day, hour, minute, 0, 0, time.UTC)
+	}
+	overnight, _ := ParseWindow("22:00-06:00")
+	daytime, _ := ParseWindow("09:00-17:00")
+
+	tests := []struct {
+		name      string
+		window    Window
+		now       time.Time
+		wantStart time.Time
+		wantEnd   time.Time
+	}{
+		{"overnight, before start", overnight, at(14, 20, 0), at(14, 22, 0), at(15, 6, 0)},
+		{"overnight, open before midnight", overnight, at(14, 23, 0), at(14, 22, 0), at(15, 6, 0)},
+		{"overnight, open after midnight", overnight, at(15, 3, 0), at(14, 22, 0), at(15, 6, 0)},
+		{"overnight, at the end", overnight, at(15, 6, 0), at(15, 22, 0), at(16, 6, 0)},
+		{"daytime, open", daytime, at(14, 12, 0), at(14, 9, 0), at(14, 17, 0)},
+		{"daytime, after end", daytime, at(14, 18, 0), at(15, 9, 0), at(15, 17, 0)},
+		{"daytime, at the start", daytime, at(14, 9, 0), at(14, 9, 0), at(14, 17, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := tt.window.Next(tt.now)
+			if !start.Equal(tt.wantStart) || !end.Equal(tt.wantEnd) {
+				t.Errorf("Expected %v to %v, got %v to %v", tt.wantStart, tt.wantEnd, start, end)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+/**
+ * Link-Layer Framing.
+ *
+ * Decoding layers for the pcap link types gopacket cannot decode without
+ * building a full packet: Linux cooked capture v2 (the "any" device on
+ * newer libpcap), PPP as seen on dial-up and PPPoE links, and the PPPoE
+ * session header. Raw IP links (tun, WireGuard) need no layer at all; the
+ * decoder starts at the IP header the version nibble names.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package capture
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Link types gopacket does not name. DLT_RAW is 12 on most platforms and 14 on
+// OpenBSD; capture files use LINKTYPE_RAW (101) instead, but live handles report
+// the platform value. gopacket holds link types in a byte, so LINKTYPE_LINUX_SLL2
+// (276) reaches us truncated to 20, which no other link type uses.
+const (
+	linkTypeRawDLT      layers.LinkType = 12
+	linkTypeRawOpenBSD  layers.LinkType = 14
+	linkTypeLinuxSLL2   layers.LinkType = 276 & 0xff
+	arphrdEther         uint16          = 1 // ARPHRD_ETHER: the cooked header carries a MAC
+	linuxSLL2HeaderSize                 = 20
+)
+
+var layerTypeLinuxSLL2 = gopacket.RegisterLayerType(1276, gopacket.LayerTypeMetadata{
+	Name:    "LinuxSLL2",
+	Decoder: gopacket.DecodeFunc(decodeLinuxSLL2),
+})
+
+// Reports whether the decoder understands frames of the link type.
+func isSupportedLinkType(linkType layers.LinkType) bool {
+	return newDecoder(linkType).decodes() || isWiFiLinkType(linkType)
+}
+
+// Returns a readable name for a link type, covering those gopacket leaves unnamed.
+func linkTypeName(linkType layers.LinkType) string {
+	switch linkType {
+	case linkTypeRawDLT, linkTypeRawOpenBSD, layers.LinkTypeRaw:
+		return "Raw IP"
+	case layers.LinkTypeIPv4:
+		return "Raw IPv4"
+	case layers.LinkTypeIPv6:
+		return "Raw IPv6"
+	case linkTypeLinuxSLL2:
+		return "Linux SLL2"
+	case layers.LinkTypePPP_HDLC:
+		return "PPP (HDLC)"
+	case layers.LinkTypePPPEthernet:
+		return "PPPoE"
+	}
+	return linkType.String()
+}
+
+// Reports whether frames of the link type begin directly with an IP header.
+func isRawIPLinkType(linkType layers.LinkType) bool {
+	switch linkType {
+	case layers.LinkTypeRaw, layers.LinkTypeIPv4, layers.LinkTypeIPv6, linkTypeRawDLT, linkTypeRawOpenBSD:
+		return true
+	}
+	return false
+}
+
+// Names the IP layer a raw packet starts with from its version nibble.
+func rawIPLayerType(data []byte) gopacket.LayerType {
+	if len(data) == 0 {
+		return gopacket.LayerTypeZero
+	}
+	switch data[0] >> 4 {
+	case 4:
+		return layers.LayerTypeIPv4
+	case 6:
+		return layers.LayerTypeIPv6
+	}
+	return gopacket.LayerTypeZero
+}
+
+var errLinuxSLL2Truncated = errors.New("Linux SLL2 header truncated")
+
+// Linux cooked capture v2 header. Unlike v1 it leads with the protocol and adds
+// the interface index, which is not needed here.
+type linuxSLL2 struct {
+	layers.BaseLayer
+	protocol layers.EthernetType
+	addrType uint16
+	addr     net.HardwareAddr
+}
+
+func (s *linuxSLL2) LayerType() gopacket.LayerType { return layerTypeLinuxSLL2 }
+
+func (s *linuxSLL2) CanDecode() gopacket.LayerClass { return layerTypeLinuxSLL2 }
+
+func (s *linuxSLL2) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < linuxSLL2HeaderSize {
+		df.SetTruncated()
+		return errLinuxSLL2Truncated
+	}
+	s.protocol = layers.EthernetType(binary.BigEndian.Uint16(data[0:2]))
+	s.addrType = binary.BigEndian.Uint16(data[8:10])
+	addrLen := int(data[11])
+	if addrLen > 8 {
+		addrLen = 8
+	}
+	s.addr = data[12 : 12+addrLen]
+	s.BaseLayer = layers.BaseLayer{Contents: data[:linuxSLL2HeaderSize], Payload: data[linuxSLL2HeaderSize:]}
+	return nil
+}
+
+func (s *linuxSLL2) NextLayerType() gopacket.LayerType { return s.protocol.LayerType() }
+
+// Decodes an SLL2 header within a full gopacket decode.
+func decodeLinuxSLL2(data []byte, p gopacket.PacketBuilder) error {
+	s := &linuxSLL2{}
+	if err := s.DecodeFromBytes(data, p); err != nil {
+		return err
+	}
+	p.AddLayer(s)
+	return p.NextDecoder(s.protocol)
+}
+
+// Reports the link-layer source address when the cooked header describes an
+// Ethernet device. The destination MAC is not recorded by cooked capture.
+func cookedSourceMAC(addrType uint16, addr net.HardwareAddr) net.HardwareAddr {
+	if addrType == arphrdEther && len(addr) == 6 {
+		return addr
+	}
+	return nil
+}
+
+var errPPPTruncated = errors.New("PPP header truncated")
+
+// Decodes a PPP header, with or without the HDLC address and control bytes and
+// with either a compressed or a full protocol field. gopacket's PPP layer is not
+// a DecodingLayer.
+type pppFrame struct {
+	layers.BaseLayer
+	protocol layers.PPPType
+}
+
+func (p *pppFrame) LayerType() gopacket.LayerType { return layers.LayerTypePPP }
+
+func (p *pppFrame) CanDecode() gopacket.LayerClass { return layers.LayerTypePPP }
+
+func (p *pppFrame) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	offset := 0
+	if len(data) >= 2 && data[0] == 0xff && data[1] == 0x03 {
+		offset = 2
+	}
+
+	switch {
+	case len(data) > offset && data[offset]&1 == 1: // Compressed to one byte
+		p.protocol = layers.PPPType(data[offset])
+		offset++
+	case len(data) >= offset+2:
+		p.protocol = layers.PPPType(binary.BigEndian.Uint16(data[offset:]))
+		offset += 2
+	default:
+		df.SetTruncated()
+		return errPPPTruncated
+	}
+
+	p.BaseLayer = layers.BaseLayer{Contents: data[:offset], Payload: data[offset:]}
+	return nil
+}
+
+func (p *pppFrame) NextLayerType() gopacket.LayerType {
+	switch p.protocol {
+	case layers.PPPTypeIPv4:
+		return layers.LayerTypeIPv4
+	case layers.PPPTypeIPv6:
+		return layers.LayerTypeIPv6
+	case layers.PPPTypeMPLSUnicast, layers.PPPTypeMPLSMulticast:
+		return layers.LayerTypeMPLS
+	}
+	return gopacket.LayerTypeZero
+}
+
+var errPPPoETruncated = errors.New("PPPoE header truncated")
+
+// Decodes a PPPoE header. Only session data (code 0) carries PPP; discovery
+// packets end the decode.
+type pppoeSession struct {
+	layers.BaseLayer
+	code layers.PPPoECode
+}
+
+func (p *pppoeSession) LayerType() gopacket.LayerType { return layers.LayerTypePPPoE }
+
+func (p *pppoeSession) CanDecode() gopacket.LayerClass { return layers.LayerTypePPPoE }
+
+func (p *pppoeSession) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 6 {
+		df.SetTruncated()
+		return errPPPoETruncated
+	}
+	p.code = layers.PPPoECode(data[1])
+	end := 6 + int(binary.BigEndian.Uint16(data[4:6]))
+	if end > len(data) {
+		df.SetTruncated()
+		end = len(data)
+	}
+	p.BaseLayer = layers.BaseLayer{Contents: data[:6], Payload: data[6:end]}
+	return nil
+}
+
+func (p *pppoeSession) NextLayerType() gopacket.LayerType {
+	if p.code != layers.PPPoECodeSession {
+		return gopacket.LayerTypeZero
+	}
+	return layers.LayerTypePPP
+}
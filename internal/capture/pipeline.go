@@ -0,0 +1,467 @@
+/**
+ * Packet Processing Pipeline.
+ *
+ * Splits capture into three stages connected by bounded queues: a reader
+ * that pulls packets from the source, a pool of workers that parse and
+ * correlate them, and a single output stage that invokes the handler.
+ * Packets are sharded across workers by flow so that every packet of a
+ * conversation is processed in order by the same goroutine. IP fragments
+ * are reassembled in the reader, before sharding, so a datagram's pieces
+ * reach the worker owning its flow as one packet. Each worker reassembles
+ * the TCP streams of its shard before parsing them. Under overload the
+ * reader can also shed load by sampling before dispatch.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package capture
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/gopacket/layers"
+	"github.com/kleaSCM/netscope/internal/analyzer"
+)
+
+// Per-worker queue length used when the configuration leaves it unset.
+const defaultQueueSize = 1024
+
+// Live counters for each pipeline stage, updated atomically.
+type pipelineCounters struct {
+	read         uint64
+	duplicates   uint64
+	readerStalls uint64
+	worked       []uint64 // One slot per worker
+	workerStalls uint64
+	delivered    uint64
+	malformed    uint64 // Frames a decoding layer could not read
+}
+
+// Snapshot of per-stage pipeline counters. Packets in flight between the reader
+// and the handler are Read minus Duplicates minus Fragments plus Reassembled
+// minus DecodeErrors minus SampledShed minus Delivered.
+type PipelineStats struct {
+	Workers              int
+	QueueSize            int
+	LinkTypes            map[string]string // Link type of each source, keyed by interface
+	Read                 uint64            // Packets pulled from the sources by the reader stage
+	Duplicates           uint64            // Bridged copies dropped by the reader before dispatch
+	Fragments            uint64            // IP fragments taken in by the reader for reassembly
+	Reassembled          uint64            // Datagrams rebuilt from fragments and dispatched whole
+	FragmentsIncomplete  uint64            // Datagrams discarded before all their fragments arrived
+	FragmentsOverlapping uint64            // Reassembled datagrams whose fragments overlapped
+	DecodeErrors         uint64            // Frames dropped by the reader because a decoding layer could not read them
+	ReaderStalls         uint64            // Times the reader blocked on a full worker queue
+	Worked               []uint64          // Packets finished by each worker
+	WorkerStalls         uint64            // Times a worker blocked on a full output queue
+	Delivered            uint64            // Packets handed to the handler
+	SampleRate           uint32            // Current 1-in-N sampling rate, 0 when not sampling
+	SampledKept          uint64            // Packets dispatched while sampling
+	SampledShed          uint64            // Packets discarded by sampling before the workers
+	SamplingEngaged      uint64            // Times overload switched sampling on
+	StreamBytes          uint64            // Bytes read from a pcap stream, headers included
+	StreamReconnects     uint64            // Times a new writer resumed a pcap stream
+	TCPStreams           uint64            // TCP connections followed by stream reassembly
+	TCPOutOfOrder        uint64            // Segments held until the bytes before them arrived
+	TCPOverflows         uint64            // Stream directions abandoned for exceeding their buffer
+	TCPExpired           uint64            // Connections forgotten after the idle timeout
+	TCPEvicted           uint64            // Connections forgotten to make room for new ones
+	QUICConnections      uint64            // QUIC connections whose Initial packets were decrypted
+	QUICUndecryptable    uint64            // Datagrams whose QUIC Initial packets failed to decrypt
+}
+
+// Begins capturing packets until the context is canceled, the source is exhausted or a
+// configured limit is reached; reaching a limit is a clean end and LimitReached names it.
+// The handler is always called from the calling goroutine, one packet at a time. Packets
+// of the same flow reach it in capture order; packets of different flows may interleave.
+func (e *Engine) Start(ctx context.Context, handler func(PacketInfo)) error {
+	if e.running.Load() {
+		return fmt.Errorf("engine already running")
+	}
+
+	e.running.Store(true)
+	defer e.running.Store(false)
+
+	e.limitReached.Store(nil)
+	ctx, stop := e.limits.context(ctx)
+	defer stop(nil)
+	if !e.limits.IsZero() {
+		log.Printf("Capture limits: %s", e.limits)
+	}
+
+	if e.replayFile != nil {
+		log.Printf("Replaying capture file %s", e.interfaceName)
+	} else if e.stream != nil {
+		log.Printf("Reading pcap stream from %s", e.interfaceName)
+	} else {
+		log.Printf("Starting packet capture on %s", e.interfaceName)
+		log.Printf("Capture mode: promiscuous=%v", true)
+	}
+	for _, source := range e.sources {
+		log.Printf("Link type on %s: %s", source.name, linkTypeName(source.linkType))
+		if !isSupportedLinkType(source.linkType) {
+			log.Printf("Warning: link type %s is not decoded; packets from %s will carry no addresses", linkTypeName(source.linkType), source.name)
+		}
+	}
+	log.Printf("Processing with %d workers (queue size %d)", e.workers, e.queueSize)
+
+	queues := make([]chan sourcedPacket, e.workers)
+	results := make(chan PacketInfo, e.queueSize)
+
+	var workers sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan sourcedPacket, e.queueSize)
+		workers.Add(1)
+		go func(id int) {
+			defer workers.Done()
+			e.runWorker(ctx, id, queues[id], results)
+		}(i)
+	}
+
+	// Adaptive sampling watches the queues for as long as the capture runs
+	if e.sampler != nil && e.sampler.config.Adaptive {
+		monitorDone := make(chan struct{})
+		defer close(monitorDone)
+		go e.monitorOverload(monitorDone, queues)
+	}
+
+	readErr := make(chan error, 1)
+	go func() {
+		err := e.runReader(ctx, queues)
+		for _, queue := range queues {
+			close(queue)
+		}
+		readErr <- err
+	}()
+
+	go func() {
+		workers.Wait()
+		close(results)
+	}()
+
+	// Output stage: results closes once the reader has stopped and every worker drained
+	for info := range results {
+		// After cancellation, finished packets are discarded rather than reported
+		if ctx.Err() != nil {
+			continue
+		}
+
+		if handler != nil {
+			handler(info)
+		}
+
+		// Atomic update of performance metrics
+		atomic.AddUint64(&e.pipeline.delivered, 1)
+		packets := atomic.AddUint64(&e.packetsProcessed, 1)
+		bytes := atomic.AddUint64(&e.bytesProcessed, uint64(info.Length))
+
+		// Packets already past the workers are discarded above once the limit cancels
+		if limit := e.limits.reached(packets, bytes); limit != nil {
+			stop(limit)
+		}
+	}
+
+	err := <-readErr
+	if cause := context.Cause(ctx); isLimitError(cause) {
+		log.Printf("Capture stopped: %v", cause)
+		e.limitReached.Store(&cause)
+		return nil
+	}
+	return err
+}
+
+// Reader stage: pulls packets from the source, applies work that must observe
+// capture order, and dispatches each packet to the worker owning its flow.
+func (e *Engine) runReader(ctx context.Context, queues []chan sourcedPacket) error {
+	packets := e.mergeSources(ctx)
+
+	// Datagrams still waiting for fragments when capture ends will never complete
+	if e.defrag != nil {
+		defer e.defrag.flush()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Capture stopped by context")
+			return ctx.Err()
+
+		case sp, ok := <-packets:
+			if !ok {
+				log.Println("Packet channel closed")
+				return nil
+			}
+
+			// Offline replay in real-time mode reproduces the recorded inter-packet gaps
+			if e.pacer != nil {
+				if err := e.pacer.Wait(ctx, sp.ci.Timestamp); err != nil {
+					log.Println("Capture stopped by context")
+					return err
+				}
+			}
+
+			atomic.AddUint64(&e.pipeline.read, 1)
+
+			// Drop bridged copies before anything is counted or retained twice
+			if e.dedup != nil && e.dedup.isDuplicate(&sp) {
+				atomic.AddUint64(&e.pipeline.duplicates, 1)
+				continue
+			}
+
+			// Retain the raw frame before analysis so evidence exists even if parsing fails
+			if e.ring != nil {
+				if err := e.ring.WriteFrom(sp.source.name, sp.source.linkType, sp.ci, sp.data); err != nil {
+					log.Printf("Warning: ring buffer write failed: %v", err)
+				}
+			}
+
+			// Fragments are held until their datagram is whole, which then travels as one
+			// packet: only the reassembled datagram carries ports and application data.
+			if sp.frame.fragmented && e.defrag != nil && !e.defrag.add(&sp) {
+				continue
+			}
+
+			// A frame that could not be decoded has nothing trustworthy left to analyse
+			if sp.frame.malformed {
+				atomic.AddUint64(&e.pipeline.malformed, 1)
+				continue
+			}
+
+			// A DNS answer and the connection it enables belong to different flows and may
+			// land on different workers; priming the cache here keeps correlation in order.
+			if e.flowTable != nil && sp.frame.dns != nil {
+				e.flowTable.ObserveDNS(sp.frame.dns, sp.ci.Timestamp)
+			}
+
+			// Shed load last, so shed packets still count as read, are retained as
+			// evidence and prime DNS correlation
+			if e.sampler != nil {
+				keep, sampling := e.sampler.keep(&sp)
+				if !keep {
+					continue
+				}
+				if sampling > 1 {
+					sp.sampling = sampling
+				}
+			}
+
+			queue := queues[flowShard(sp.frame.flowHash, len(queues))]
+			select {
+			case queue <- sp:
+			default:
+				// Block rather than drop: backpressure surfaces as kernel drops in Stats()
+				atomic.AddUint64(&e.pipeline.readerStalls, 1)
+				select {
+				case queue <- sp:
+				case <-ctx.Done():
+					log.Println("Capture stopped by context")
+					return ctx.Err()
+				}
+			}
+		}
+	}
+}
+
+// Worker stage: parses, tracks and analyzes packets from one shard in order.
+func (e *Engine) runWorker(ctx context.Context, id int, queue <-chan sourcedPacket, results chan<- PacketInfo) {
+	// Connections still open when capture ends are not resumed by a later run
+	reassembler := e.reassemblers[id]
+	defer reassembler.flush()
+	quic := e.quicTrackers[id]
+	defer quic.flush()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case sp, ok := <-queue:
+			if !ok {
+				return
+			}
+
+			// Reassembly needs every segment of the shard in order, so it runs before parsing
+			switch sp.frame.transport {
+			case layers.LayerTypeTCP:
+				sp.app = reassembler.add(&sp)
+			case layers.LayerTypeUDP:
+				sp.app = quic.add(&sp)
+			}
+
+			info := e.processPacket(&sp)
+			atomic.AddUint64(&e.pipeline.worked[id], 1)
+
+			select {
+			case results <- info:
+			default:
+				atomic.AddUint64(&e.pipeline.workerStalls, 1)
+				select {
+				case results <- info:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}
+}
+
+// Runs the full analysis chain for one packet, reusing the source's decode.
+func (e *Engine) processPacket(sp *sourcedPacket) PacketInfo {
+	info := e.extractPacketInfo(sp)
+
+	// Track flow state and stats
+	modelPacket := e.toModelPacket(info, &sp.frame)
+	modelPacket.Sampling = sp.sampling
+
+	// Track Device. Baselines follow the source MAC, or the tracked device's IP on
+	// links that carry no MAC addresses (tun, PPP, raw IP).
+	deviceKey := info.EthSrcMAC
+	if e.deviceTracker != nil {
+		device := e.deviceTracker.TrackPacket(modelPacket)
+		if device != nil {
+			if deviceKey == "" {
+				deviceKey = device.Identity()
+			}
+			info.DeviceVendor = device.Vendor
+			info.DeviceHostname = device.Hostname
+			if info.DeviceHostname == "" {
+				info.DeviceHostname = "Unknown Device"
+			}
+		}
+	}
+
+	// ARP and NDP bindings fill the neighbor table, and each new one the sender's
+	// address history
+	if e.neighborTable != nil {
+		if learned := e.neighborTable.Update(modelPacket); learned != nil && e.deviceTracker != nil {
+			e.deviceTracker.RecordNeighbor(learned)
+		}
+	}
+
+	flow := e.flowTable.Update(modelPacket)
+
+	if flow != nil {
+		if flow.DstDomain != "" {
+			info.DstDomain = flow.DstDomain
+		} else if flow.TLSSNI != "" {
+			info.DstDomain = flow.TLSSNI
+		} else if flow.HTTPHost != "" {
+			info.DstDomain = flow.HTTPHost
+		} else if flow.Certificate != nil {
+			info.DstDomain = flow.Certificate.CommonName
+		}
+
+		// Track session (groups related flows)
+		if e.sessionTracker != nil {
+			e.sessionTracker.TrackFlow(flow)
+		}
+
+		// Update behavioral baseline
+		if e.baselineTracker != nil && deviceKey != "" {
+			e.baselineTracker.UpdateBaseline(deviceKey, flow)
+
+			// Detect Anomalies (Real-time). Workers share device baselines, so the
+			// detector reads them under the tracker's lock.
+			if e.anomalyDetector != nil {
+				e.baselineTracker.WithBaseline(deviceKey, func(baseline *analyzer.DeviceBaseline) {
+					info.Anomalies = e.anomalyDetector.Detect(flow, baseline)
+				})
+			}
+		}
+
+		// Overlapping fragments are flagged whatever the baseline says
+		if sp.frame.overlapping && e.anomalyDetector != nil {
+			info.Anomalies = append(info.Anomalies, e.anomalyDetector.OverlappingFragments(flow))
+		}
+
+		// As are zone transfer requests
+		if info.DNSQuery != nil && e.anomalyDetector != nil {
+			if kind := info.DNSQuery.ZoneTransfer(); kind != "" {
+				info.Anomalies = append(info.Anomalies, e.anomalyDetector.ZoneTransfer(flow, kind, info.DNSQuery.QueryName))
+			}
+		}
+
+		// Scan for Privacy Issues (Real-time)
+		if e.privacyScanner != nil {
+			info.PrivacyIssues = e.privacyScanner.Scan(flow)
+		}
+	}
+
+	return info
+}
+
+// Assigns a packet to a worker from its symmetric flow hash, so both directions
+// of a conversation map to the same worker.
+func flowShard(hash uint64, workers int) int {
+	if workers <= 1 {
+		return 0
+	}
+
+	// FNV leaves the low bits poorly mixed; fold the high bits down before reducing
+	hash ^= hash >> 33
+	hash *= 0xff51afd7ed558ccd
+	hash ^= hash >> 33
+
+	return int(hash % uint64(workers))
+}
+
+// Returns the link type each source captures under, keyed by interface name.
+func (e *Engine) LinkTypes() map[string]string {
+	linkTypes := make(map[string]string, len(e.sources))
+	for _, source := range e.sources {
+		linkTypes[source.name] = linkTypeName(source.linkType)
+	}
+	return linkTypes
+}
+
+// Returns a snapshot of the per-stage pipeline counters.
+func (e *Engine) PipelineStats() PipelineStats {
+	stats := PipelineStats{
+		Workers:      e.workers,
+		QueueSize:    e.queueSize,
+		LinkTypes:    e.LinkTypes(),
+		Read:         atomic.LoadUint64(&e.pipeline.read),
+		Duplicates:   atomic.LoadUint64(&e.pipeline.duplicates),
+		DecodeErrors: atomic.LoadUint64(&e.pipeline.malformed),
+		ReaderStalls: atomic.LoadUint64(&e.pipeline.readerStalls),
+		Worked:       make([]uint64, len(e.pipeline.worked)),
+		WorkerStalls: atomic.LoadUint64(&e.pipeline.workerStalls),
+		Delivered:    atomic.LoadUint64(&e.pipeline.delivered),
+	}
+	if e.defrag != nil {
+		stats.Fragments = atomic.LoadUint64(&e.defrag.counters.fragments)
+		stats.Reassembled = atomic.LoadUint64(&e.defrag.counters.reassembled)
+		stats.FragmentsIncomplete = atomic.LoadUint64(&e.defrag.counters.incomplete)
+		stats.FragmentsOverlapping = atomic.LoadUint64(&e.defrag.counters.overlapping)
+	}
+	if e.stream != nil {
+		stats.StreamBytes = atomic.LoadUint64(&e.stream.counters.bytes)
+		stats.StreamReconnects = atomic.LoadUint64(&e.stream.counters.reconnects)
+	}
+	for _, reassembler := range e.reassemblers {
+		stats.TCPStreams += atomic.LoadUint64(&reassembler.counters.streams)
+		stats.TCPOutOfOrder += atomic.LoadUint64(&reassembler.counters.outOfOrder)
+		stats.TCPOverflows += atomic.LoadUint64(&reassembler.counters.overflows)
+		stats.TCPExpired += atomic.LoadUint64(&reassembler.counters.expired)
+		stats.TCPEvicted += atomic.LoadUint64(&reassembler.counters.evicted)
+	}
+	for _, quic := range e.quicTrackers {
+		stats.QUICConnections += atomic.LoadUint64(&quic.counters.connections)
+		stats.QUICUndecryptable += atomic.LoadUint64(&quic.counters.undecryptable)
+	}
+	if e.sampler != nil {
+		stats.SampleRate = e.sampler.rate.Load()
+		stats.SampledKept = atomic.LoadUint64(&e.sampler.counters.kept)
+		stats.SampledShed = atomic.LoadUint64(&e.sampler.counters.shed)
+		stats.SamplingEngaged = atomic.LoadUint64(&e.sampler.counters.engaged)
+	}
+	for i := range e.pipeline.worked {
+		stats.Worked[i] = atomic.LoadUint64(&e.pipeline.worked[i])
+	}
+	return stats
+}
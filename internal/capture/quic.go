@@ -0,0 +1,239 @@
+/**
+ * QUIC Initial Tracking.
+ *
+ * Follows the Initial exchange of QUIC connections in the worker stage:
+ * decrypts the client's and server's Initial packets, reassembles the
+ * CRYPTO frames they carry into the TLS Client Hello and Server Hello,
+ * and hands those to the TLS parser. A Client Hello with post-quantum
+ * key shares spans several Initial packets, which may arrive out of
+ * order. State is kept only for the Initial exchange, so connections are
+ * forgotten shortly after their handshake; memory is bounded by the
+ * number of connections followed and the CRYPTO bytes held per direction.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package capture
+
+import (
+	"bytes"
+	"sync/atomic"
+	"time"
+
+	"github.com/kleaSCM/netscope/internal/parser"
+)
+
+const (
+	// The Initial exchange completes within a few round trips; connections are
+	// forgotten once idle this long
+	defaultQUICTimeout = 10 * time.Second
+
+	// Connections each worker follows through their Initial exchange at once
+	defaultMaxQUICConns = 1024
+
+	// CRYPTO bytes held per direction. A Client Hello with post-quantum key shares
+	// is under 2 KiB; anything beyond this is not a hello worth waiting for.
+	maxQUICCrypto = 64 << 10
+
+	// Clients pad the datagrams carrying their Initial packets to at least this size
+	// (RFC 9000 section 14.1), which tells a connection's first packet from a server's
+	minQUICClientInitial = 1200
+)
+
+// Counters for the QUIC stage, updated atomically.
+type quicCounters struct {
+	connections   uint64 // Connections whose Initial exchange was followed
+	undecryptable uint64 // Datagrams whose Initial packets failed to decrypt
+}
+
+// The Initial exchange of one QUIC connection.
+type quicConn struct {
+	dcid       []byte          // Destination Connection ID the Initial keys are derived from
+	clientSCID []byte          // Connection ID the server's Initial packets are addressed to
+	client     int             // Direction the client sends in
+	crypto     [2]cryptoStream // Client, then server
+	lastSeen   time.Time
+}
+
+// The CRYPTO stream of one direction's Initial packets.
+type cryptoStream struct {
+	buf     []byte                   // Bytes from offset 0 on
+	pending []parser.QUICCryptoFrame // Frames that arrived ahead of a gap
+	held    int                      // Bytes in pending
+	done    bool                     // The hello was parsed, or the stream given up on
+}
+
+// Follows the QUIC connections of one worker's shard. Expiry is driven by packet
+// timestamps so replayed captures behave identically. Used only from its worker
+// goroutine; counters are read concurrently.
+type quicTracker struct {
+	timeout   time.Duration
+	maxConns  int
+	conns     map[connKey]*quicConn
+	lastSweep time.Time
+	counters  quicCounters
+}
+
+func newQUICTracker() *quicTracker {
+	return &quicTracker{
+		timeout:  defaultQUICTimeout,
+		maxConns: defaultMaxQUICConns,
+		conns:    make(map[connKey]*quicConn),
+	}
+}
+
+// Adds a UDP datagram. Returns the QUIC version and any hello the datagram completed,
+// or nil when it does not start with a QUIC long header.
+func (t *quicTracker) add(sp *sourcedPacket) *streamResult {
+	f := &sp.frame
+	if f.dnsQuery != nil || f.dnsResponse != nil {
+		return nil
+	}
+	header := parser.ParseQUICHeader(f.payload)
+	if header == nil {
+		return nil
+	}
+	ts := sp.ci.Timestamp
+	t.expire(ts)
+
+	result := &streamResult{quicVersion: header.Version}
+	key, direction := newConnKey(f)
+	conn, ok := t.conns[key]
+	if !ok {
+		// Only a client's first Initial opens a connection; its DCID derives the keys
+		if !header.Initial || len(f.payload) < minQUICClientInitial || len(header.DCID) < 8 {
+			return result
+		}
+		if len(t.conns) >= t.maxConns {
+			t.sweep(ts)
+			if len(t.conns) >= t.maxConns {
+				return result
+			}
+		}
+		conn = &quicConn{
+			dcid:       append([]byte(nil), header.DCID...),
+			clientSCID: append([]byte(nil), header.SCID...),
+			client:     direction,
+		}
+		t.conns[key] = conn
+		atomic.AddUint64(&t.counters.connections, 1)
+	}
+	conn.lastSeen = ts
+
+	fromServer := direction != conn.client
+	stream := &conn.crypto[0]
+	if fromServer {
+		stream = &conn.crypto[1]
+		if !bytes.Equal(header.DCID, conn.clientSCID) {
+			return result // Another connection's packets between the same endpoints
+		}
+	}
+	if !header.Initial || stream.done {
+		return result
+	}
+
+	initials, err := parser.DecryptQUICInitials(f.payload, conn.dcid, fromServer)
+	if err != nil && !fromServer && len(initials) == 0 && !bytes.Equal(header.DCID, conn.dcid) {
+		// After a Retry the client derives its keys from the DCID the server chose
+		if initials, err = parser.DecryptQUICInitials(f.payload, header.DCID, false); err == nil {
+			conn.dcid = append(conn.dcid[:0], header.DCID...)
+		}
+	}
+	if err != nil {
+		atomic.AddUint64(&t.counters.undecryptable, 1)
+	}
+	for _, initial := range initials {
+		for _, frame := range initial.Crypto {
+			stream.add(frame)
+		}
+	}
+	if info := stream.hello(); info != nil {
+		result.tls = info
+	}
+	return result
+}
+
+// Places a CRYPTO frame in the stream, holding it when bytes before it are missing.
+func (s *cryptoStream) add(frame parser.QUICCryptoFrame) {
+	end := frame.Offset + uint64(len(frame.Data))
+	if s.done || end <= uint64(len(s.buf)) {
+		return // Retransmission of bytes already placed
+	}
+	if end > maxQUICCrypto || len(s.buf)+s.held+len(frame.Data) > maxQUICCrypto {
+		s.giveUp()
+		return
+	}
+	if frame.Offset > uint64(len(s.buf)) {
+		s.pending = append(s.pending, frame)
+		s.held += len(frame.Data)
+		return
+	}
+
+	s.buf = append(s.buf, frame.Data[uint64(len(s.buf))-frame.Offset:]...)
+	for progressed := true; progressed; {
+		progressed = false
+		kept := s.pending[:0]
+		for _, held := range s.pending {
+			heldEnd := held.Offset + uint64(len(held.Data))
+			switch {
+			case heldEnd <= uint64(len(s.buf)):
+				s.held -= len(held.Data)
+			case held.Offset <= uint64(len(s.buf)):
+				s.buf = append(s.buf, held.Data[uint64(len(s.buf))-held.Offset:]...)
+				s.held -= len(held.Data)
+				progressed = true
+			default:
+				kept = append(kept, held)
+			}
+		}
+		s.pending = kept
+	}
+}
+
+// Parses the hello at the start of the stream once it is whole. Returns nil until then.
+func (s *cryptoStream) hello() *parser.TLSInfo {
+	if s.done || len(s.buf) < 4 {
+		return nil
+	}
+	length := int(s.buf[1])<<16 | int(s.buf[2])<<8 | int(s.buf[3])
+	if 4+length > maxQUICCrypto {
+		s.giveUp()
+		return nil
+	}
+	if len(s.buf) < 4+length {
+		return nil
+	}
+	info, _ := parser.ParseQUICHandshake(s.buf[:4+length])
+	s.giveUp()
+	return info
+}
+
+// Stops following the stream and releases its buffers.
+func (s *cryptoStream) giveUp() {
+	s.done = true
+	s.buf, s.pending, s.held = nil, nil, 0
+}
+
+// Forgets connections idle past the timeout, at most once per timeout.
+func (t *quicTracker) expire(now time.Time) {
+	if now.Sub(t.lastSweep) >= t.timeout {
+		t.sweep(now)
+	}
+}
+
+// Forgets every connection idle past the timeout.
+func (t *quicTracker) sweep(now time.Time) {
+	t.lastSweep = now
+	cutoff := now.Add(-t.timeout)
+	for key, conn := range t.conns {
+		if conn.lastSeen.Before(cutoff) {
+			delete(t.conns, key)
+		}
+	}
+}
+
+// Forgets every connection, as when the capture ends.
+func (t *quicTracker) flush() {
+	t.conns = make(map[connKey]*quicConn)
+}
@@ -0,0 +1,207 @@
+/**
+ * QUIC Initial Tracking Tests.
+ *
+ * Validates that a Client Hello spread over several Initial datagrams,
+ * out of order, and the server's Initial reply are decrypted and parsed,
+ * and that QUIC flows are tagged with their version and SNI.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package capture
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/kleaSCM/netscope/internal/parser"
+)
+
+var (
+	quicTestDCID = []byte{0x83, 0x94, 0xc8, 0xf0, 0x3e, 0x51, 0x57, 0x08}
+	quicTestSCID = []byte{0xc1, 0x01}
+)
+
+// Derives a QUIC v1 Initial secret (RFC 9001 section 5.2) for building test packets.
+func quicTestSecret(secret []byte, label string, length int) []byte {
+	label = "tls13 " + label
+	info := append([]byte{byte(length >> 8), byte(length), byte(len(label))}, label...)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(append(info, 0, 1))
+	return mac.Sum(nil)[:length]
+}
+
+// Builds a protected QUIC v1 Initial datagram carrying a CRYPTO frame at offset,
+// padded as a client pads its Initials.
+func buildQUICInitial(tb testing.TB, fromServer bool, offset int, data []byte) []byte {
+	tb.Helper()
+	dcid, scid, direction := quicTestDCID, quicTestSCID, "client in"
+	if fromServer {
+		dcid, scid, direction = quicTestSCID, nil, "server in"
+	}
+
+	frames := []byte{0x06}
+	frames = binary.BigEndian.AppendUint16(frames, 0x4000|uint16(offset))
+	frames = binary.BigEndian.AppendUint16(frames, 0x4000|uint16(len(data)))
+	frames = append(frames, data...)
+	if !fromServer && len(frames) < minQUICClientInitial {
+		frames = append(frames, make([]byte, minQUICClientInitial-len(frames))...) // PADDING
+	}
+
+	header := []byte{0xc1, 0, 0, 0, 1, byte(len(dcid))} // Initial, two-byte packet number
+	header = append(header, dcid...)
+	header = append(header, byte(len(scid)))
+	header = append(header, scid...)
+	header = append(header, 0) // Token length
+	header = binary.BigEndian.AppendUint16(header, 0x4000|uint16(2+len(frames)+16))
+	pnOffset := len(header)
+	header = append(header, 0, 0)
+
+	extract := hmac.New(sha256.New, []byte{0x38, 0x76, 0x2c, 0xf7, 0xf5, 0x59, 0x34, 0xb3, 0x4d, 0x17,
+		0x9a, 0xe6, 0xa4, 0xc8, 0x0c, 0xad, 0xcc, 0xbb, 0x7f, 0x0a})
+	extract.Write(quicTestDCID)
+	secret := quicTestSecret(extract.Sum(nil), direction, 32)
+	block, _ := aes.NewCipher(quicTestSecret(secret, "quic key", 16))
+	aead, _ := cipher.NewGCM(block)
+	packet := aead.Seal(append([]byte(nil), header...), quicTestSecret(secret, "quic iv", 12), frames, header)
+
+	hp, _ := aes.NewCipher(quicTestSecret(secret, "quic hp", 16))
+	mask := make([]byte, 16)
+	hp.Encrypt(mask, packet[pnOffset+4:pnOffset+20])
+	packet[0] ^= mask[0] & 0x0f
+	packet[pnOffset] ^= mask[1]
+	packet[pnOffset+1] ^= mask[2]
+	return packet
+}
+
+// Builds the Ethernet frame for a datagram between decodeClient:50000 and decodeServer:443.
+func buildUDPDatagram(tb testing.TB, fromServer bool, payload []byte) []byte {
+	tb.Helper()
+	src, dst := decodeClient, decodeServer
+	udp := &layers.UDP{SrcPort: 50000, DstPort: 443}
+	if fromServer {
+		src, dst = dst, src
+		udp.SrcPort, udp.DstPort = 443, 50000
+	}
+	return serializeFrame(tb, ethernetTo(layers.EthernetTypeIPv4), ipv4Between(src, dst, layers.IPProtocolUDP), udp, gopacket.Payload(payload))
+}
+
+// Builds a TLS 1.3 Server Hello message selecting h3.
+func buildQUICServerHello() []byte {
+	body := []byte{0x03, 0x03}
+	body = append(body, make([]byte, 32)...)           // Random
+	body = append(body, 0x00, 0x13, 0x01, 0x00)        // Session ID, cipher suite, compression
+	exts := []byte{0x00, 0x2b, 0x00, 0x02, 0x03, 0x04} // supported_versions: TLS 1.3
+	exts = append(exts, 0x00, 0x10, 0x00, 0x05, 0x00, 0x03, 0x02, 'h', '3')
+	body = binary.BigEndian.AppendUint16(body, uint16(len(exts)))
+	body = append(body, exts...)
+	return append([]byte{2, 0, byte(len(body) >> 8), byte(len(body))}, body...)
+}
+
+// Verifies that the tracker reassembles a Client Hello from Initial datagrams that
+// arrive out of order, decrypts the server's reply, and leaves other UDP alone.
+func TestQUICTracker(t *testing.T) {
+	start := time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC)
+	sni := strings.Repeat("pq.", 500) + "example.com"
+	hello := buildClientHello(sni)[5:] // Handshake message without its record header
+
+	datagrams := []struct {
+		fromServer bool
+		payload    []byte
+		want       string
+	}{
+		{false, buildQUICInitial(t, false, 1000, hello[1000:]), ""},
+		{false, buildQUICInitial(t, false, 0, hello[:1000]), "client hello"},
+		{false, buildQUICInitial(t, false, 0, hello[:1000]), ""}, // Retransmission
+		{true, buildQUICInitial(t, true, 0, buildQUICServerHello()), "server hello"},
+		{true, append([]byte{0x40}, make([]byte, 40)...), "not quic"}, // Short header
+	}
+
+	tracker := newQUICTracker()
+	for i, d := range datagrams {
+		sp := decodeTCPSegment(t, buildUDPDatagram(t, d.fromServer, d.payload), start.Add(time.Duration(i)*time.Millisecond))
+		result := tracker.add(sp)
+		got := ""
+		switch {
+		case result == nil:
+			got = "not quic"
+		case result.quicVersion != parser.QUICVersion1:
+			t.Fatalf("Datagram %d: expected QUIC v1, got %#x", i, result.quicVersion)
+		case result.tls != nil && result.tls.ServerHello:
+			got = "server hello"
+			if result.tls.JA4S == "" || result.tls.JA4S[0] != 'q' || result.tls.ALPN[0] != "h3" {
+				t.Errorf("Expected a QUIC JA4S and h3, got %+v", result.tls)
+			}
+		case result.tls != nil:
+			got = "client hello"
+			if result.tls.SNI != sni || result.tls.JA4 == "" || result.tls.JA4[0] != 'q' {
+				t.Errorf("Expected the reassembled SNI and a QUIC JA4, got %+v", result.tls)
+			}
+		}
+		if got != d.want {
+			t.Errorf("Datagram %d: expected %q, got %q", i, d.want, got)
+		}
+	}
+	if tracker.counters.connections != 1 || tracker.counters.undecryptable != 0 {
+		t.Errorf("Expected one connection decrypted cleanly, got %+v", tracker.counters)
+	}
+
+	// Connections are forgotten once idle past the timeout
+	tracker.add(decodeTCPSegment(t, buildUDPDatagram(t, false, datagrams[0].payload), start.Add(time.Minute)))
+	if len(tracker.conns) != 1 || tracker.counters.connections != 2 {
+		t.Errorf("Expected the idle connection replaced by a new one, got %d followed", tracker.counters.connections)
+	}
+}
+
+// Verifies that QUIC flows are tagged with their version and named from the SNI.
+func TestEngine_QUIC(t *testing.T) {
+	start := time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC)
+	hello := buildClientHello("www.youtube.com")[5:]
+	frames := [][]byte{
+		buildUDPDatagram(t, false, buildQUICInitial(t, false, 0, hello)),
+		buildUDPDatagram(t, true, buildQUICInitial(t, true, 0, buildQUICServerHello())),
+		buildUDPDatagram(t, false, append([]byte{0x40}, make([]byte, 40)...)),
+	}
+	stamps := []time.Time{start, start.Add(time.Millisecond), start.Add(2 * time.Millisecond)}
+
+	engine := newPipeline(DefaultConfig(""), newTestStore(t))
+	engine.sources = []*captureSource{newTestSource(t, "eth0", frames, stamps)}
+	defer engine.Stop()
+
+	var infos []PacketInfo
+	if err := engine.Start(context.Background(), func(info PacketInfo) { infos = append(infos, info) }); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(infos) != 3 || infos[0].Protocol != "QUIC" || infos[0].QUICVersion != "QUIC v1" || infos[0].TLS == nil {
+		t.Fatalf("Expected the Initial to be labelled QUIC v1 with its Client Hello, got %+v", infos)
+	}
+	if infos[2].Protocol != "UDP" {
+		t.Errorf("Expected short header packets to stay UDP, got %q", infos[2].Protocol)
+	}
+
+	flows := engine.GetActiveFlows()
+	if len(flows) != 1 {
+		t.Fatalf("Expected the connection's packets in one flow, got %d", len(flows))
+	}
+	flow := flows[0]
+	if flow.Protocol != "QUIC" || flow.QUICVersion != "QUIC v1" || flow.TLSSNI != "www.youtube.com" {
+		t.Errorf("Expected a QUIC v1 flow with its SNI, got %q, %q, %q", flow.Protocol, flow.QUICVersion, flow.TLSSNI)
+	}
+	if flow.TLSALPN != "h3" || flow.TLSVersion != "TLS 1.3" || !strings.HasPrefix(flow.JA4, "q") {
+		t.Errorf("Expected the negotiated h3 and a QUIC JA4, got %q, %q, %q", flow.TLSALPN, flow.TLSVersion, flow.JA4)
+	}
+	if stats := engine.PipelineStats(); stats.QUICConnections != 1 {
+		t.Errorf("Expected one QUIC connection followed, got %d", stats.QUICConnections)
+	}
+}
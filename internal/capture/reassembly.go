@@ -0,0 +1,647 @@
+/**
+ * TCP Stream Reassembly.
+ *
+ * Follows TCP connections in the worker stage and hands their payload,
+ * reordered and deduplicated, to the TLS, HTTP, SSH and DNS-over-TCP parsers
+ * as in-order byte streams, so a ClientHello, certificate chain or HTTP
+ * header split across segments is parsed whole. Each worker owns the connections of its
+ * shard, so reassembly needs no locking. Memory is bounded by the number
+ * of connections followed and the bytes held per direction; connections
+ * idle past the timeout are forgotten, and a direction that would exceed
+ * its buffer is abandoned rather than parsed out of sync.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/kleaSCM/netscope/internal/parser"
+)
+
+const (
+	// Connections idle this long are forgotten; long-lived quiet connections simply
+	// restart mid-stream, where nothing more is expected to be parsed
+	defaultTCPStreamTimeout = 2 * time.Minute
+
+	// Connections each worker follows at once when the configuration leaves it unset
+	defaultMaxTCPStreams = 4096
+
+	// Bytes held per direction, out of order or awaiting a complete message. Fits the
+	// largest TLS record (16 KiB plus expansion) with room for reordering.
+	defaultMaxTCPStreamBuffer = 64 << 10
+
+	// TLS records longer than this are not TLS: plaintext records are capped at 2^14
+	// bytes and protected ones at 2^14 + 2048
+	maxTLSRecord = 1<<14 + 2048
+
+	// HTTP headers not terminated within this many bytes are not followed further
+	maxHTTPHeader = 16 << 10
+)
+
+// Counters for the reassembly stage, updated atomically.
+type reassemblyCounters struct {
+	streams    uint64 // Connections followed
+	outOfOrder uint64 // Segments held until the bytes before them arrived
+	overflows  uint64 // Directions abandoned for exceeding their buffer
+	expired    uint64 // Connections forgotten after the idle timeout
+	evicted    uint64 // Connections forgotten to make room for new ones
+}
+
+// Application protocol carried by one direction of a connection.
+type streamApp int
+
+const (
+	streamUndecided streamApp = iota // No payload seen yet
+	streamTLS
+	streamHTTP
+	streamDNS
+	streamSSH
+	streamIgnored // Unrecognised, out of sync, or past the interesting part
+)
+
+// Application data completed by one TCP segment or QUIC datagram. At most one message
+// of each kind is reported per packet.
+type streamResult struct {
+	tls         *parser.TLSInfo
+	cert        *parser.CertificateInfo
+	http        *parser.HTTPInfo
+	dnsQuery    *parser.DNSQuery
+	dnsResponse *parser.DNSResponse
+	ssh         *parser.SSHInfo
+	quicVersion uint32 // Version of a QUIC long header packet, 0 otherwise
+}
+
+// Both directions of a connection share a key: the lower endpoint comes first.
+type connKey struct {
+	a, b     netip.AddrPort
+	vlan     uint16
+	tunnel   string
+	tunnelID uint32
+}
+
+// Returns the key of a frame's connection and the direction the frame travels in:
+// 0 from the key's a to b, 1 from b to a.
+func newConnKey(f *frame) (connKey, int) {
+	src, _ := netip.AddrFromSlice(f.srcIP)
+	dst, _ := netip.AddrFromSlice(f.dstIP)
+	from := netip.AddrPortFrom(src.Unmap(), f.srcPort)
+	to := netip.AddrPortFrom(dst.Unmap(), f.dstPort)
+	key := connKey{a: from, b: to, vlan: f.vlan, tunnel: f.tunnel, tunnelID: f.tunnelID}
+	if order := to.Addr().Compare(from.Addr()); order < 0 || (order == 0 && to.Port() < from.Port()) {
+		key.a, key.b = to, from
+		return key, 1
+	}
+	return key, 0
+}
+
+// One followed connection. Direction 0 carries bytes from a to b.
+type tcpConn struct {
+	halves   [2]halfStream
+	lastSeen time.Time
+	seq      uint64 // Distinguishes connections that reuse a key
+}
+
+// One direction of a connection.
+type halfStream struct {
+	started bool   // nextSeq is valid
+	nextSeq uint32 // Sequence number of the next in-order byte
+	pending []tcpSegment
+	held    int             // Bytes in pending
+	buf     []byte          // In-order bytes awaiting a complete message
+	skip    int64           // Bytes of a message body still to discard
+	tlsMsgs []byte          // TLS handshake messages awaiting the records that complete them
+	ssh     *parser.SSHInfo // Identification line, awaiting the KEXINIT that follows it
+	app     streamApp
+	client  bool // Sent by the side that opened the connection
+	fin     bool
+}
+
+// A segment that arrived ahead of a gap.
+type tcpSegment struct {
+	seq  uint32
+	data []byte
+}
+
+type connRecord struct {
+	key      connKey
+	lastSeen time.Time
+	seq      uint64
+}
+
+// Reassembles the TCP connections of one worker's shard. Expiry is driven by packet
+// timestamps so replayed captures behave identically. Used only from its worker
+// goroutine; counters are read concurrently.
+type tcpReassembler struct {
+	timeout    time.Duration
+	maxStreams int
+	maxBuffer  int
+	conns      map[connKey]*tcpConn
+	order      []connRecord // Least recently seen first, with stale records skipped
+	seq        uint64
+	dns        layers.DNS // Reused across DNS-over-TCP messages
+	counters   reassemblyCounters
+}
+
+func newTCPReassembler(timeout time.Duration, maxStreams, maxBuffer int) *tcpReassembler {
+	if timeout <= 0 {
+		timeout = defaultTCPStreamTimeout
+	}
+	if maxStreams <= 0 {
+		maxStreams = defaultMaxTCPStreams
+	}
+	if maxBuffer <= 0 {
+		maxBuffer = defaultMaxTCPStreamBuffer
+	}
+	return &tcpReassembler{
+		timeout:    timeout,
+		maxStreams: maxStreams,
+		maxBuffer:  maxBuffer,
+		conns:      make(map[connKey]*tcpConn),
+	}
+}
+
+// Adds a TCP segment. Returns what the segment completed, or nil when the connection
+// is not followed and the payload should be parsed on its own.
+func (r *tcpReassembler) add(sp *sourcedPacket) *streamResult {
+	f := &sp.frame
+	ts := sp.ci.Timestamp
+	r.expire(ts)
+
+	key, direction := newConnKey(f)
+	conn, ok := r.conns[key]
+	if !ok {
+		// A bare ACK or a close opens nothing worth following
+		if f.rst || (!f.syn && len(f.payload) == 0) {
+			return nil
+		}
+		if len(r.conns) >= r.maxStreams {
+			r.evictOldest()
+		}
+		r.seq++
+		conn = &tcpConn{seq: r.seq}
+		conn.halves[direction].client = isClientSide(f.srcPort, f.dstPort)
+		conn.halves[1-direction].client = !conn.halves[direction].client
+		r.conns[key] = conn
+		r.order = append(r.order, connRecord{key: key, lastSeen: ts, seq: r.seq})
+		atomic.AddUint64(&r.counters.streams, 1)
+	}
+	conn.lastSeen = ts
+	if f.syn && !f.ack {
+		// The handshake settles which side is the client, whatever the ports suggest
+		conn.halves[direction].client = true
+		conn.halves[1-direction].client = false
+	}
+
+	if f.rst {
+		delete(r.conns, key)
+		return &streamResult{}
+	}
+
+	result := &streamResult{}
+	half := &conn.halves[direction]
+	if half.app != streamIgnored {
+		r.segment(half, f)
+		r.parse(half, f, ts, result)
+	}
+
+	if f.fin {
+		half.fin = true
+		if conn.halves[1-direction].fin {
+			delete(r.conns, key)
+		}
+	}
+	return result
+}
+
+// Places a segment's payload in its direction's stream.
+func (r *tcpReassembler) segment(half *halfStream, f *frame) {
+	seq, payload := f.seq, f.payload
+	if f.syn {
+		// Data on a SYN (TCP Fast Open) follows the sequence number the SYN consumes
+		seq++
+		if !half.started {
+			half.started = true
+			half.nextSeq = seq
+		}
+	}
+	if len(payload) == 0 {
+		return
+	}
+	if !half.started {
+		// Picked up mid-stream: the parser decides whether this is a message boundary
+		half.started = true
+		half.nextSeq = seq
+	}
+
+	offset := int32(seq - half.nextSeq)
+	if offset+int32(len(payload)) <= 0 {
+		return // Retransmission of bytes already delivered
+	}
+	if offset > 0 {
+		r.hold(half, seq, payload)
+		return
+	}
+
+	r.deliver(half, payload[-offset:])
+	for len(half.pending) > 0 && half.app != streamIgnored {
+		next := half.pending[0]
+		gap := int32(next.seq - half.nextSeq)
+		if gap > 0 {
+			break
+		}
+		half.pending = half.pending[1:]
+		half.held -= len(next.data)
+		if gap+int32(len(next.data)) > 0 {
+			r.deliver(half, next.data[-gap:])
+		}
+	}
+}
+
+// Keeps a copy of a segment that arrived ahead of a gap, in sequence order.
+func (r *tcpReassembler) hold(half *halfStream, seq uint32, payload []byte) {
+	if half.held+len(half.buf)+len(payload) > r.maxBuffer {
+		r.abandon(half)
+		return
+	}
+
+	i := sort.Search(len(half.pending), func(i int) bool {
+		return int32(half.pending[i].seq-seq) >= 0
+	})
+	if i < len(half.pending) && half.pending[i].seq == seq && len(half.pending[i].data) >= len(payload) {
+		return // Retransmission of a segment already held
+	}
+	half.pending = append(half.pending, tcpSegment{})
+	copy(half.pending[i+1:], half.pending[i:])
+	half.pending[i] = tcpSegment{seq: seq, data: append([]byte(nil), payload...)}
+	half.held += len(payload)
+	atomic.AddUint64(&r.counters.outOfOrder, 1)
+}
+
+// Appends in-order bytes for the parser, discarding any body being skipped.
+func (r *tcpReassembler) deliver(half *halfStream, data []byte) {
+	half.nextSeq += uint32(len(data))
+	if half.app == streamIgnored {
+		return
+	}
+	if half.skip > 0 {
+		n := int64(len(data))
+		if n > half.skip {
+			n = half.skip
+		}
+		half.skip -= n
+		data = data[n:]
+	}
+	if len(half.buf)+len(data) > r.maxBuffer {
+		r.abandon(half)
+		return
+	}
+	half.buf = append(half.buf, data...)
+}
+
+// Stops following a direction whose buffer overflowed; its parser can no longer stay in sync.
+func (r *tcpReassembler) abandon(half *halfStream) {
+	atomic.AddUint64(&r.counters.overflows, 1)
+	half.ignore()
+}
+
+// Stops parsing a direction and releases its buffers. The connection stays followed
+// so its later segments are not mistaken for the start of a new stream.
+func (h *halfStream) ignore() {
+	h.app = streamIgnored
+	h.buf, h.pending, h.held, h.skip, h.tlsMsgs, h.ssh = nil, nil, 0, 0, nil, nil
+}
+
+// Parses every complete message at the front of a direction's stream.
+func (r *tcpReassembler) parse(half *halfStream, f *frame, ts time.Time, result *streamResult) {
+	consumed := 0
+	for half.app != streamIgnored {
+		data := half.buf[consumed:]
+		if len(data) == 0 {
+			break
+		}
+		if half.skip > 0 {
+			n := int64(len(data))
+			if n > half.skip {
+				n = half.skip
+			}
+			half.skip -= n
+			consumed += int(n)
+			continue
+		}
+
+		if half.app == streamUndecided {
+			half.app = classifyStream(data, f)
+			if half.app == streamUndecided {
+				break // Too few bytes to tell
+			}
+			continue
+		}
+
+		var n int
+		switch half.app {
+		case streamTLS:
+			n = r.parseTLS(half, data, result)
+		case streamHTTP:
+			n = r.parseHTTP(half, data, result)
+		case streamDNS:
+			n = r.parseDNS(half, data, f, ts, result)
+		case streamSSH:
+			n = r.parseSSH(half, data, result)
+		}
+		if n == 0 {
+			break // Waiting for the rest of the message
+		}
+		consumed += n
+	}
+
+	if half.app == streamIgnored {
+		return
+	}
+	half.buf = append(half.buf[:0], half.buf[consumed:]...)
+	if cap(half.buf) > r.maxBuffer && len(half.buf) < r.maxBuffer/2 {
+		half.buf = append([]byte(nil), half.buf...) // Release a buffer grown by a large message
+	}
+}
+
+// Decides which parser a direction's first bytes belong to.
+func classifyStream(data []byte, f *frame) streamApp {
+	if f.srcPort == 53 || f.dstPort == 53 {
+		return streamDNS
+	}
+	if data[0] == 22 {
+		return streamTLS
+	}
+	if len(data) < 4 && bytes.HasPrefix([]byte("SSH-"), data) {
+		return streamUndecided
+	}
+	if bytes.HasPrefix(data, []byte("SSH-")) {
+		return streamSSH
+	}
+
+	// Long enough for "OPTIONS " or "HTTP/1.", the longest starts recognised
+	if len(data) < 8 {
+		if bytes.HasPrefix([]byte("HTTP/1."), data) || httpMethodPrefix(data) {
+			return streamUndecided
+		}
+		return streamIgnored
+	}
+	if bytes.HasPrefix(data, []byte("HTTP/1.")) || httpMethodPrefix(data) {
+		return streamHTTP
+	}
+	return streamIgnored
+}
+
+// Guesses whether a segment travels from client to server when the connection's
+// handshake was missed: towards the SSH port, or else towards the lower port.
+func isClientSide(srcPort, dstPort uint16) bool {
+	switch {
+	case dstPort == 22:
+		return true
+	case srcPort == 22:
+		return false
+	}
+	return dstPort < srcPort
+}
+
+// Reports whether data starts with, or is the start of, an HTTP method and a space.
+func httpMethodPrefix(data []byte) bool {
+	for _, method := range []string{"GET ", "POST ", "HEAD ", "PUT ", "DELETE ", "OPTIONS ", "PATCH ", "CONNECT ", "TRACE "} {
+		n := len(data)
+		if n > len(method) {
+			n = len(method)
+		}
+		if string(data[:n]) == method[:n] {
+			return true
+		}
+	}
+	return false
+}
+
+// Parses one TLS record. Returns the bytes consumed, or 0 until the record is whole.
+func (r *tcpReassembler) parseTLS(half *halfStream, data []byte, result *streamResult) int {
+	if len(data) < 5 {
+		return 0
+	}
+	length := int(binary.BigEndian.Uint16(data[3:5]))
+	if data[1] != 3 || data[0] < 20 || data[0] > 23 || length > maxTLSRecord {
+		half.ignore() // Not TLS, or lost sync with the records
+		return 0
+	}
+	if len(data) < 5+length {
+		return 0
+	}
+
+	switch data[0] {
+	case 22: // Handshake
+		if len(half.tlsMsgs)+length > r.maxBuffer {
+			r.abandon(half)
+			return 0
+		}
+		half.tlsMsgs = append(half.tlsMsgs, data[5:5+length]...)
+		r.parseHandshakes(half, data[1:3], result)
+	case 20, 23: // ChangeCipherSpec or application data: the rest is encrypted
+		half.ignore()
+	}
+	return 5 + length
+}
+
+// Parses every complete handshake message carried by the records so far. A record may
+// hold several messages (Server Hello, Certificate and Server Hello Done in one
+// flight), and a message may span records (a certificate chain beyond 16 KiB).
+func (r *tcpReassembler) parseHandshakes(half *halfStream, version []byte, result *streamResult) {
+	msgs := half.tlsMsgs
+	for len(msgs) >= 4 {
+		length := int(msgs[1])<<16 | int(msgs[2])<<8 | int(msgs[3])
+		if 4+length > r.maxBuffer {
+			r.abandon(half)
+			return
+		}
+		if 4+length > len(msgs) {
+			break // Continued in the next record
+		}
+		msg := msgs[:4+length]
+		msgs = msgs[4+length:]
+
+		switch msg[0] {
+		case 1, 2: // Client Hello or Server Hello, parsed as the single message of a record
+			if len(msg) > 0xffff || result.tls != nil {
+				continue
+			}
+			record := append([]byte{22, version[0], version[1], byte(len(msg) >> 8), byte(len(msg))}, msg...)
+			if info, _ := parser.ParseTLSPayload(record); info != nil {
+				result.tls = info
+			}
+		case 11: // Certificate, in cleartext before TLS 1.3
+			if cert, err := parser.ParseCertificateMessage(msg[4:]); err == nil && result.cert == nil {
+				result.cert = cert
+			}
+		}
+	}
+	half.tlsMsgs = append(half.tlsMsgs[:0], msgs...)
+}
+
+// Parses the headers of one HTTP message and arranges for its body to be skipped.
+// Returns the bytes consumed, or 0 until the headers are whole.
+func (r *tcpReassembler) parseHTTP(half *halfStream, data []byte, result *streamResult) int {
+	end := bytes.Index(data, []byte("\r\n\r\n"))
+	if end >= 0 {
+		end += 4
+	} else if end = bytes.Index(data, []byte("\n\n")); end >= 0 {
+		end += 2
+	} else {
+		if len(data) > maxHTTPHeader {
+			half.ignore()
+		}
+		return 0
+	}
+
+	info, _ := parser.ParseHTTPPayload(data[:end])
+	if info == nil {
+		half.ignore() // Lost sync with the messages
+		return 0
+	}
+	if result.http == nil {
+		result.http = info
+	}
+
+	body, ok := info.BodyLength()
+	if !ok {
+		// The body's end is only known by decoding it; the first message is what matters
+		half.ignore()
+		return 0
+	}
+	half.skip = body
+	return end
+}
+
+// Parses the identification line, then the KEXINIT packet after it, and stops: the
+// rest of the connection is encrypted. Returns the bytes consumed, or 0 until the
+// line or packet is whole.
+func (r *tcpReassembler) parseSSH(half *halfStream, data []byte, result *streamResult) int {
+	if half.ssh == nil {
+		end := bytes.IndexByte(data, '\n')
+		if end < 0 {
+			if len(data) >= parser.MaxSSHBanner {
+				half.ignore()
+			}
+			return 0
+		}
+		info := parser.ParseSSHBanner(data[:end])
+		if info == nil {
+			half.ignore()
+			return 0
+		}
+		info.Client = half.client
+		half.ssh = info
+		result.ssh = info
+		return end + 1
+	}
+
+	payload, n, err := parser.ParseSSHPacket(data)
+	if err != nil {
+		half.ignore() // SSH 1, or lost sync with the packets
+		return 0
+	}
+	if n == 0 {
+		return 0
+	}
+	if kex, err := parser.ParseSSHKexInit(payload); err == nil {
+		info := *half.ssh
+		info.KexInit = kex
+		result.ssh = &info
+	}
+	half.ignore()
+	return 0
+}
+
+// Parses one length-prefixed DNS message. Returns the bytes consumed, or 0 until the
+// message is whole.
+func (r *tcpReassembler) parseDNS(half *halfStream, data []byte, f *frame, ts time.Time, result *streamResult) int {
+	if len(data) < 2 {
+		return 0
+	}
+	length := int(binary.BigEndian.Uint16(data))
+	if len(data) < 2+length {
+		return 0
+	}
+
+	// Report the first message, or a pipelined zone transfer request after it
+	first := result.dnsQuery == nil && result.dnsResponse == nil
+	if parser.DecodeDNS(&r.dns, data[2:2+length]) == nil && (first || !r.dns.QR) {
+		query, response := parser.ParseDNSLayer(&r.dns, ts, f.srcIP.String(), f.dstIP.String())
+		if first || query.ZoneTransfer() != "" {
+			result.dnsQuery, result.dnsResponse = query, response
+		}
+	}
+	return 2 + length
+}
+
+// Forgets connections idle for longer than the timeout. Records of connections seen
+// since they were queued move to the back instead.
+func (r *tcpReassembler) expire(now time.Time) {
+	cutoff := now.Add(-r.timeout)
+	for len(r.order) > 0 && r.order[0].lastSeen.Before(cutoff) {
+		record := r.order[0]
+		r.order = r.order[1:]
+		conn, ok := r.conns[record.key]
+		if !ok || conn.seq != record.seq {
+			continue
+		}
+		if conn.lastSeen.Before(cutoff) {
+			delete(r.conns, record.key)
+			atomic.AddUint64(&r.counters.expired, 1)
+			continue
+		}
+		r.order = append(r.order, connRecord{key: record.key, lastSeen: conn.lastSeen, seq: record.seq})
+	}
+	r.compact()
+}
+
+// Forgets the least recently seen connection to make room for a new one.
+func (r *tcpReassembler) evictOldest() {
+	for len(r.order) > 0 {
+		record := r.order[0]
+		r.order = r.order[1:]
+		conn, ok := r.conns[record.key]
+		if !ok || conn.seq != record.seq {
+			continue
+		}
+		if conn.lastSeen.After(record.lastSeen) {
+			r.order = append(r.order, connRecord{key: record.key, lastSeen: conn.lastSeen, seq: record.seq})
+			continue
+		}
+		delete(r.conns, record.key)
+		atomic.AddUint64(&r.counters.evicted, 1)
+		return
+	}
+}
+
+// Drops records of closed connections so a high close rate cannot grow the order.
+func (r *tcpReassembler) compact() {
+	if len(r.order) <= 2*r.maxStreams {
+		return
+	}
+	live := r.order[:0]
+	for _, record := range r.order {
+		if conn, ok := r.conns[record.key]; ok && conn.seq == record.seq {
+			live = append(live, record)
+		}
+	}
+	r.order = live
+}
+
+// Forgets every connection, as when the capture ends.
+func (r *tcpReassembler) flush() {
+	r.conns = make(map[connKey]*tcpConn)
+	r.order = nil
+}
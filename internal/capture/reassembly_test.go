@@ -0,0 +1,470 @@
+/**
+ * TCP Stream Reassembly Tests.
+ *
+ * Validates that TLS ClientHellos, server certificate chains, HTTP headers,
+ * SSH KEXINITs and DNS-over-TCP messages split across segments, reordered or
+ * retransmitted are parsed whole, and
+ * that buffers, idle connections and the connection count stay bounded.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package capture
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/kleaSCM/netscope/internal/analyzer"
+)
+
+// One TCP segment of a test connection, sent by the client unless fromServer is set.
+type testSegment struct {
+	fromServer bool
+	seq        uint32
+	syn, fin   bool
+	payload    []byte
+}
+
+// Builds the Ethernet frame for a segment between decodeClient:50000 and decodeServer:port.
+func buildTCPSegment(tb testing.TB, port layers.TCPPort, seg testSegment) []byte {
+	tb.Helper()
+	src, dst := decodeClient, decodeServer
+	tcp := &layers.TCP{SrcPort: 50000, DstPort: port, Seq: seg.seq, SYN: seg.syn, FIN: seg.fin, ACK: !seg.syn, Window: 64240}
+	if seg.fromServer {
+		src, dst = dst, src
+		tcp.SrcPort, tcp.DstPort = port, 50000
+	}
+	return serializeFrame(tb, ethernetTo(layers.EthernetTypeIPv4), ipv4Between(src, dst, layers.IPProtocolTCP), tcp, gopacket.Payload(seg.payload))
+}
+
+// Decodes a frame into the packet the reader would dispatch.
+func decodeTCPSegment(tb testing.TB, data []byte, ts time.Time) *sourcedPacket {
+	tb.Helper()
+	sp := &sourcedPacket{data: data, ci: ringCaptureInfo(ts, data)}
+	newDecoder(layers.LinkTypeEthernet).decode(sp.data, sp.ci.Timestamp, &sp.frame)
+	return sp
+}
+
+// Splits data into pieces at the given offsets.
+func splitAt(data []byte, offsets ...int) [][]byte {
+	var pieces [][]byte
+	start := 0
+	for _, offset := range offsets {
+		pieces = append(pieces, data[start:offset])
+		start = offset
+	}
+	return append(pieces, data[start:])
+}
+
+// Returns client segments carrying the pieces back to back from seq.
+func inOrder(seq uint32, pieces ...[]byte) []testSegment {
+	var segments []testSegment
+	for _, piece := range pieces {
+		segments = append(segments, testSegment{seq: seq, payload: piece})
+		seq += uint32(len(piece))
+	}
+	return segments
+}
+
+// Frames a DNS message for TCP with its two-byte length prefix.
+func dnsOverTCP(tb testing.TB, dns *layers.DNS) []byte {
+	tb.Helper()
+	message := serializeFrame(tb, dns)
+	return append(binary.BigEndian.AppendUint16(nil, uint16(len(message))), message...)
+}
+
+// Builds an unencrypted SSH packet carrying a KEXINIT with one algorithm per list.
+func buildKexInitPacket() []byte {
+	msg := append([]byte{20}, make([]byte, 16)...) // Message code, cookie
+	for _, list := range []string{"curve25519-sha256", "ssh-ed25519", "aes128-ctr", "aes128-ctr",
+		"hmac-sha2-256", "hmac-sha2-256", "none", "none", "", ""} {
+		msg = binary.BigEndian.AppendUint32(msg, uint32(len(list)))
+		msg = append(msg, list...)
+	}
+	msg = append(msg, 0, 0, 0, 0, 0) // first_kex_packet_follows, reserved
+	padding := 8 - (5+len(msg))%8
+	if padding < 4 {
+		padding += 8
+	}
+	packet := binary.BigEndian.AppendUint32(nil, uint32(1+len(msg)+padding))
+	packet = append(packet, byte(padding))
+	packet = append(packet, msg...)
+	return append(packet, make([]byte, padding)...)
+}
+
+// Builds a TLS 1.2 server flight (Server Hello, Certificate, Server Hello Done) for a
+// self-signed certificate, splitting the handshake messages into records of at most
+// recordSize bytes.
+func buildServerFlight(tb testing.TB, commonName string, recordSize int) []byte {
+	tb.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	handshake := func(msgType byte, body []byte) []byte {
+		return append([]byte{msgType, byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))}, body...)
+	}
+	serverHello := append([]byte{3, 3}, make([]byte, 32)...) // Version, random
+	serverHello = append(serverHello, 0, 0xc0, 0x2f, 0)      // No session ID, cipher, no compression
+	certs := append([]byte{0, byte(len(der) >> 8), byte(len(der))}, der...)
+	certs = append([]byte{0, byte(len(certs) >> 8), byte(len(certs))}, certs...)
+
+	var msgs []byte
+	msgs = append(msgs, handshake(2, serverHello)...)
+	msgs = append(msgs, handshake(11, certs)...)
+	msgs = append(msgs, handshake(14, nil)...)
+
+	var flight []byte
+	for len(msgs) > 0 {
+		n := recordSize
+		if n > len(msgs) {
+			n = len(msgs)
+		}
+		flight = append(flight, 22, 3, 3, byte(n>>8), byte(n))
+		flight = append(flight, msgs[:n]...)
+		msgs = msgs[n:]
+	}
+	return flight
+}
+
+// Verifies that messages spanning segments are parsed once the bytes before them arrive.
+func TestTCPReassembler_Streams(t *testing.T) {
+	start := time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC)
+
+	// Post-quantum key shares push ClientHellos past one segment
+	sni := strings.Repeat("pq.", 900) + "example.com"
+	hello := splitAt(buildClientHello(sni), 1200, 2400)
+
+	// The second request's body straddles two segments and must be skipped
+	requests := [][]byte{
+		[]byte("GET /a HTTP/1.1\r\nHo"),
+		[]byte("st: first.example\r\n\r\nPOST /b HTTP/1.1\r\n"),
+		[]byte("Host: second.example\r\nContent-Length: 5\r\n\r\nhel"),
+		[]byte("loGET /c HTTP/1.1\r\nHost: third.example\r\n\r\n"),
+	}
+
+	// The certificate spans two records, and the records span segments
+	flight := buildServerFlight(t, "server.example", 200)
+	flightParts := splitAt(flight, 150, 300)
+
+	query := dnsOverTCP(t, &layers.DNS{ID: 7, RD: true, Questions: []layers.DNSQuestion{
+		{Name: []byte("example.com"), Type: layers.DNSTypeA, Class: layers.DNSClassIN},
+	}})
+	queryParts := splitAt(query, 1, 10)
+
+	// A zone transfer request pipelined behind an SOA query in the same segment
+	soa := dnsOverTCP(t, &layers.DNS{ID: 8, Questions: []layers.DNSQuestion{
+		{Name: []byte("example.com"), Type: layers.DNSTypeSOA, Class: layers.DNSClassIN},
+	}})
+	axfr := dnsOverTCP(t, &layers.DNS{ID: 9, Questions: []layers.DNSQuestion{
+		{Name: []byte("corp.example"), Type: 252, Class: layers.DNSClassIN},
+	}})
+
+	// A response whose only answer stops two bytes into its fixed fields, which
+	// gopacket indexes past
+	truncated := []byte{0, 15, 0, 1, 0x81, 0x80, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 1}
+
+	// The client's identification line and KEXINIT, each split across segments
+	kexInit := buildKexInitPacket()
+	sshClient := splitAt(append([]byte("SSH-2.0-paramiko_3.4.0\r\n"), kexInit...), 10, 30, 60)
+
+	tests := []struct {
+		name       string
+		port       layers.TCPPort
+		segments   []testSegment
+		want       []string // What each segment completed, "" for nothing
+		outOfOrder uint64
+	}{
+		{
+			name: "client hello in order",
+			port: 443,
+			segments: []testSegment{
+				{seq: 999, syn: true},
+				{seq: 1000, payload: hello[0]},
+				{seq: 1000 + 1200, payload: hello[1]},
+				{seq: 1000 + 2400, payload: hello[2]},
+			},
+			want: []string{"", "", "", "tls " + sni},
+		},
+		{
+			name: "client hello reordered and retransmitted",
+			port: 443,
+			segments: []testSegment{
+				{seq: 999, syn: true},
+				{seq: 1000 + 2400, payload: hello[2]},
+				{seq: 1000, payload: hello[0]},
+				{seq: 1000 + 2400, payload: hello[2]},
+				{seq: 1000 + 1200, payload: hello[1]},
+				{seq: 1000, payload: hello[0]},
+			},
+			want:       []string{"", "", "", "", "tls " + sni, ""},
+			outOfOrder: 1,
+		},
+		{
+			name: "server flight with a certificate across records",
+			port: 443,
+			segments: []testSegment{
+				{fromServer: true, seq: 7000, payload: flightParts[0]},
+				{fromServer: true, seq: 7150, payload: flightParts[1]},
+				{fromServer: true, seq: 7300, payload: flightParts[2]},
+			},
+			want: []string{"", "tls server hello", "cert server.example"},
+		},
+		{
+			name:     "http keep-alive with a body",
+			port:     80,
+			segments: inOrder(1, requests...),
+			want:     []string{"", "http first.example", "http second.example", "http third.example"},
+		},
+		{
+			name: "http response",
+			port: 80,
+			segments: []testSegment{
+				{fromServer: true, seq: 5000, payload: []byte("HTTP/1.1 200 OK\r\nSer")},
+				{fromServer: true, seq: 5020, payload: []byte("ver: lighttpd\r\n\r\n")},
+			},
+			want: []string{"", "http 200 (lighttpd)"},
+		},
+		{
+			name:     "dns over tcp",
+			port:     53,
+			segments: inOrder(1, queryParts...),
+			want:     []string{"", "", "dns example.com"},
+		},
+		{
+			name:     "pipelined zone transfer",
+			port:     53,
+			segments: inOrder(1, query, append(soa, axfr...)),
+			want:     []string{"dns example.com", "dns corp.example"},
+		},
+		{
+			name:     "truncated dns record",
+			port:     53,
+			segments: inOrder(1, truncated, query),
+			want:     []string{"", "dns example.com"},
+		},
+		{
+			name: "ssh client banner and kexinit",
+			port: 22,
+			segments: append([]testSegment{{seq: 99, syn: true}},
+				inOrder(100, sshClient...)...),
+			want: []string{"", "", "ssh client paramiko_3.4.0", "", "ssh client hassh"},
+		},
+		{
+			name: "ssh server on another port",
+			port: 2222,
+			segments: []testSegment{
+				{fromServer: true, seq: 7000, payload: []byte("SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13\r\n")},
+				{fromServer: true, seq: 7040, payload: kexInit},
+				{fromServer: true, seq: 7040 + uint32(len(kexInit)), payload: []byte("encrypted")},
+			},
+			want: []string{"ssh server OpenSSH_9.6p1", "ssh server hassh", ""},
+		},
+		{
+			name: "unrecognised payload",
+			port: 9000,
+			segments: []testSegment{
+				{seq: 1, payload: []byte("\x00\x01binary protocol")},
+				{seq: 18, payload: []byte("GET / HTTP/1.1\r\nHost: ignored.example\r\n\r\n")},
+			},
+			want: []string{"", ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTCPReassembler(0, 0, 0)
+			for i, seg := range tt.segments {
+				sp := decodeTCPSegment(t, buildTCPSegment(t, tt.port, seg), start.Add(time.Duration(i)*time.Millisecond))
+				result := r.add(sp)
+				if result == nil {
+					t.Fatalf("Segment %d: expected the connection to be followed", i)
+				}
+
+				got := ""
+				switch {
+				case result.tls != nil && result.tls.ServerHello:
+					got = "tls server hello"
+				case result.tls != nil:
+					got = "tls " + result.tls.SNI
+				case result.cert != nil:
+					got = "cert " + result.cert.CommonName
+				case result.http != nil && result.http.IsRequest:
+					got = "http " + result.http.Host
+				case result.http != nil:
+					got = "http " + result.http.Summary()
+				case result.dnsQuery != nil:
+					got = "dns " + result.dnsQuery.QueryName
+				case result.ssh != nil:
+					role := "server"
+					if result.ssh.Client {
+						role = "client"
+					}
+					if result.ssh.KexInit != nil && result.ssh.HASSH() != "" {
+						got = "ssh " + role + " hassh"
+					} else {
+						got = "ssh " + role + " " + result.ssh.Software
+					}
+				}
+				if got != tt.want[i] {
+					t.Errorf("Segment %d: expected %q, got %q", i, tt.want[i], got)
+				}
+			}
+			if r.counters.outOfOrder != tt.outOfOrder {
+				t.Errorf("Expected %d segments held out of order, got %d", tt.outOfOrder, r.counters.outOfOrder)
+			}
+		})
+	}
+}
+
+// Verifies the memory bounds: per-direction buffers, idle timeout and connection count.
+func TestTCPReassembler_Bounds(t *testing.T) {
+	start := time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC)
+	hello := buildClientHello(strings.Repeat("a.", 100) + "example.com")
+	segment := func(r *tcpReassembler, port layers.TCPPort, seq uint32, payload []byte, at time.Duration) *streamResult {
+		return r.add(decodeTCPSegment(t, buildTCPSegment(t, port, testSegment{seq: seq, payload: payload}), start.Add(at)))
+	}
+
+	t.Run("buffer overflow abandons the direction", func(t *testing.T) {
+		r := newTCPReassembler(0, 0, 64)
+		segment(r, 443, 1, hello[:10], 0)
+		segment(r, 443, 1+50, hello[50:], 0) // Beyond the 64-byte buffer, ahead of a gap
+		if r.counters.overflows != 1 {
+			t.Fatalf("Expected one overflow, got %d", r.counters.overflows)
+		}
+		if result := segment(r, 443, 1+10, hello[10:50], 0); result == nil || result.tls != nil {
+			t.Errorf("Expected an abandoned direction to stay followed but unparsed, got %+v", result)
+		}
+	})
+
+	t.Run("idle connections expire", func(t *testing.T) {
+		r := newTCPReassembler(time.Minute, 0, 0)
+		segment(r, 443, 1, hello[:10], 0)
+		segment(r, 8443, 1, hello[:10], 30*time.Second)
+		segment(r, 9443, 1, hello[:10], 90*time.Second)
+		if r.counters.expired != 1 || len(r.conns) != 2 {
+			t.Errorf("Expected one of three connections expired, got %d expired and %d held", r.counters.expired, len(r.conns))
+		}
+	})
+
+	t.Run("the least recently seen connection is evicted", func(t *testing.T) {
+		r := newTCPReassembler(0, 2, 0)
+		segment(r, 443, 1, hello[:10], 0)
+		segment(r, 8443, 1, hello[:10], time.Second)
+		segment(r, 443, 11, hello[10:20], 2*time.Second) // 443 is now the most recent
+		segment(r, 9443, 1, hello[:10], 3*time.Second)
+		if r.counters.evicted != 1 || len(r.conns) != 2 {
+			t.Fatalf("Expected one eviction leaving two connections, got %d and %d", r.counters.evicted, len(r.conns))
+		}
+		if result := segment(r, 443, 21, hello[20:], 4*time.Second); result == nil || result.tls == nil {
+			t.Error("Expected the recently seen connection to survive eviction and complete its ClientHello")
+		}
+	})
+
+	t.Run("closed connections are forgotten", func(t *testing.T) {
+		r := newTCPReassembler(0, 0, 0)
+		segment(r, 443, 1, hello[:10], 0)
+		r.add(decodeTCPSegment(t, buildTCPSegment(t, 443, testSegment{seq: 11, fin: true}), start))
+		r.add(decodeTCPSegment(t, buildTCPSegment(t, 443, testSegment{fromServer: true, seq: 500, fin: true}), start))
+		if len(r.conns) != 0 {
+			t.Errorf("Expected the connection forgotten after both FINs, %d held", len(r.conns))
+		}
+	})
+}
+
+// Verifies that the pipeline reports the SNI of a ClientHello split across segments.
+func TestEngine_TCPReassembly(t *testing.T) {
+	start := time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC)
+	sni := strings.Repeat("pq.", 900) + "example.com"
+	hello := splitAt(buildClientHello(sni), 1400)
+
+	segments := []testSegment{
+		{seq: 999, syn: true},
+		{seq: 1000, payload: hello[0]},
+		{seq: 1000 + 1400, payload: hello[1]},
+	}
+	frames := make([][]byte, len(segments))
+	stamps := make([]time.Time, len(segments))
+	for i, seg := range segments {
+		frames[i] = buildTCPSegment(t, 443, seg)
+		stamps[i] = start.Add(time.Duration(i) * time.Millisecond)
+	}
+
+	engine := newPipeline(DefaultConfig(""), newTestStore(t))
+	engine.sources = []*captureSource{newTestSource(t, "eth0", frames, stamps)}
+	defer engine.Stop()
+
+	var infos []PacketInfo
+	if err := engine.Start(context.Background(), func(info PacketInfo) { infos = append(infos, info) }); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(infos) != 3 || infos[2].TLS == nil || infos[2].TLS.SNI != sni || infos[2].TLS.JA3 == "" {
+		t.Fatalf("Expected the last segment to carry the reassembled ClientHello, got %+v", infos)
+	}
+	if infos[2].DstDomain != sni {
+		t.Errorf("Expected the SNI to reach the flow, got domain %q", infos[2].DstDomain)
+	}
+	if stats := engine.PipelineStats(); stats.TCPStreams != 1 {
+		t.Errorf("Expected one TCP stream followed, got %d", stats.TCPStreams)
+	}
+}
+
+// Verifies that a zone transfer request over TCP is flagged whatever the baseline.
+func TestEngine_ZoneTransfer(t *testing.T) {
+	start := time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC)
+	axfr := dnsOverTCP(t, &layers.DNS{ID: 9, Questions: []layers.DNSQuestion{
+		{Name: []byte("corp.example"), Type: 252, Class: layers.DNSClassIN},
+	}})
+	frames := [][]byte{
+		buildTCPSegment(t, 53, testSegment{seq: 999, syn: true}),
+		buildTCPSegment(t, 53, testSegment{seq: 1000, payload: axfr}),
+	}
+
+	engine := newPipeline(DefaultConfig(""), newTestStore(t))
+	engine.sources = []*captureSource{newTestSource(t, "eth0", frames, []time.Time{start, start.Add(time.Millisecond)})}
+	defer engine.Stop()
+
+	var infos []PacketInfo
+	if err := engine.Start(context.Background(), func(info PacketInfo) { infos = append(infos, info) }); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(infos) != 2 || infos[1].DNSQuery == nil || infos[1].DNSQuery.ZoneTransfer() != "AXFR" {
+		t.Fatalf("Expected the second segment to carry the AXFR request, got %+v", infos)
+	}
+	var found *analyzer.Anomaly
+	for i := range infos[1].Anomalies {
+		if infos[1].Anomalies[i].Type == analyzer.AnomalyTypeZoneXfer {
+			found = &infos[1].Anomalies[i]
+		}
+	}
+	if found == nil || found.Description != "192.168.1.100 requested an AXFR zone transfer of corp.example from "+decodeServer.String() {
+		t.Errorf("Expected a zone transfer anomaly, got %+v", infos[1].Anomalies)
+	}
+}
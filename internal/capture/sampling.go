@@ -0,0 +1,212 @@
+/**
+ * Packet Sampling and Load Shedding.
+ *
+ * Sheds load predictably instead of letting the kernel drop packets at
+ * random once the pipeline falls behind. Packets are kept 1 in N, either
+ * individually or by flow so that whole conversations are kept or shed
+ * together. Sampling can be always on or engage automatically when the
+ * worker queues fill or pcap drops climb; under sustained overload the
+ * rate doubles, and it steps back down once the pipeline keeps up. Kept
+ * packets carry the rate so flow counts are scaled back to estimates.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package capture
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// How packets are selected while sampling.
+type SamplingMode int
+
+const (
+	SamplingOff    SamplingMode = iota // Never sample
+	SamplingPacket                     // Keep every Nth packet
+	SamplingFlow                       // Keep the flows whose hash falls in 1 of N buckets
+)
+
+// Returns the mode's display name.
+func (m SamplingMode) String() string {
+	switch m {
+	case SamplingPacket:
+		return "1-in-N packets"
+	case SamplingFlow:
+		return "1-in-N flows"
+	}
+	return "off"
+}
+
+const (
+	defaultSampleRate        = 10
+	defaultQueueThreshold    = 0.8
+	defaultDropThreshold     = 100
+	defaultSamplingInterval  = time.Second
+	defaultSamplingCalmTicks = 10
+
+	// Escalation stops here; beyond it the capture is effectively not being analysed
+	maxSampleRate = 1 << 16
+)
+
+// Configures sampling. The zero value disables it.
+type SamplingConfig struct {
+	Mode SamplingMode
+	Rate uint32 // Keep 1 in Rate; zero selects the default of 10
+
+	// When set, sampling engages only while the pipeline is overloaded: when any worker
+	// queue is fuller than QueueThreshold (a fraction of its size) or pcap reports more
+	// than DropThreshold drops within one Interval. Otherwise it is always on at Rate.
+	Adaptive       bool
+	QueueThreshold float64
+	DropThreshold  uint64
+	Interval       time.Duration
+	CalmIntervals  int // Consecutive quiet intervals before the rate steps down
+}
+
+// Counters for the sampling stage, updated atomically.
+type samplingCounters struct {
+	kept    uint64 // Packets dispatched while sampling
+	shed    uint64 // Packets discarded by sampling
+	engaged uint64 // Times adaptive sampling switched on
+}
+
+// Decides which packets reach the workers. keep is called only from the reader
+// goroutine; the rate may be changed concurrently by the overload monitor.
+type sampler struct {
+	config   SamplingConfig
+	rate     atomic.Uint32 // Current 1-in-N rate; 0 while not sampling
+	seen     uint64        // Packets offered while sampling, reader goroutine only
+	counters samplingCounters
+
+	// Overload monitor state, monitor goroutine only
+	lastDrops uint64
+	calm      int
+}
+
+// Returns a sampler for the configuration, or nil when sampling is off.
+func newSampler(config SamplingConfig) *sampler {
+	if config.Mode == SamplingOff {
+		return nil
+	}
+	if config.Rate < 2 {
+		config.Rate = defaultSampleRate
+	}
+	if config.QueueThreshold <= 0 || config.QueueThreshold > 1 {
+		config.QueueThreshold = defaultQueueThreshold
+	}
+	if config.DropThreshold == 0 {
+		config.DropThreshold = defaultDropThreshold
+	}
+	if config.Interval <= 0 {
+		config.Interval = defaultSamplingInterval
+	}
+	if config.CalmIntervals <= 0 {
+		config.CalmIntervals = defaultSamplingCalmTicks
+	}
+
+	s := &sampler{config: config}
+	if !config.Adaptive {
+		s.rate.Store(config.Rate)
+	}
+	return s
+}
+
+// Reports whether a packet should be dispatched and, if so, how many packets it
+// stands for: 1 while not sampling, the current rate otherwise.
+func (s *sampler) keep(sp *sourcedPacket) (bool, uint32) {
+	rate := s.rate.Load()
+	if rate < 2 {
+		return true, 1
+	}
+
+	var kept bool
+	if s.config.Mode == SamplingFlow {
+		kept = flowBucket(sp.frame.flowHash)%uint64(rate) == 0
+	} else {
+		s.seen++
+		kept = s.seen%uint64(rate) == 0
+	}
+
+	if !kept {
+		atomic.AddUint64(&s.counters.shed, 1)
+		return false, 0
+	}
+	atomic.AddUint64(&s.counters.kept, 1)
+	return true, rate
+}
+
+// Mixes a flow hash differently from flowShard, so the flows kept are not all owned
+// by the same workers. Rates only ever double from the base rate, so a flow kept at
+// a higher rate is also kept at every lower one and sampled flows stay whole as the
+// rate changes.
+func flowBucket(hash uint64) uint64 {
+	hash ^= hash >> 31
+	hash *= 0x9e3779b97f4a7c15
+	return hash >> 29
+}
+
+// Adjusts the rate from one overload check: engage or double under pressure, and
+// halve after enough quiet intervals, switching off below the base rate. Returns
+// the new rate.
+func (s *sampler) adjust(queueFill float64, drops uint64) uint32 {
+	newDrops := drops - s.lastDrops
+	if drops < s.lastDrops {
+		newDrops = 0
+	}
+	s.lastDrops = drops
+
+	rate := s.rate.Load()
+	overloaded := queueFill >= s.config.QueueThreshold || newDrops > s.config.DropThreshold
+
+	switch {
+	case overloaded && rate == 0:
+		rate = s.config.Rate
+		atomic.AddUint64(&s.counters.engaged, 1)
+		log.Printf("Overload (queues %.0f%% full, %d drops): sampling %s at 1 in %d", queueFill*100, newDrops, s.config.Mode, rate)
+	case overloaded && rate < maxSampleRate:
+		rate *= 2
+		log.Printf("Still overloaded (queues %.0f%% full, %d drops): sampling 1 in %d", queueFill*100, newDrops, rate)
+	case !overloaded && rate != 0:
+		s.calm++
+		if s.calm < s.config.CalmIntervals {
+			return rate
+		}
+		rate /= 2
+		if rate < s.config.Rate {
+			rate = 0
+			log.Println("Load recovered: sampling off")
+		} else {
+			log.Printf("Load easing: sampling 1 in %d", rate)
+		}
+	}
+	s.calm = 0
+	s.rate.Store(rate)
+	return rate
+}
+
+// Watches the worker queues and pcap drops, adjusting the sampling rate, until done closes.
+func (e *Engine) monitorOverload(done <-chan struct{}, queues []chan sourcedPacket) {
+	ticker := time.NewTicker(e.sampler.config.Interval)
+	defer ticker.Stop()
+
+	_, e.sampler.lastDrops, _ = e.Stats()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			fill := 0.0
+			for _, queue := range queues {
+				if f := float64(len(queue)) / float64(cap(queue)); f > fill {
+					fill = f
+				}
+			}
+			_, drops, _ := e.Stats()
+			e.sampler.adjust(fill, drops)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+/**
+ * Sampling Tests.
+ *
+ * Validates 1-in-N packet and flow sampling, the adaptive rate changes
+ * under overload and recovery, and that sampled packets scale the flow
+ * counts they contribute to.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package capture
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// Verifies that packet sampling keeps every Nth packet and flow sampling keeps or
+// sheds whole flows.
+func TestSampler_Keep(t *testing.T) {
+	t.Run("packets", func(t *testing.T) {
+		s := newSampler(SamplingConfig{Mode: SamplingPacket, Rate: 4})
+		kept := 0
+		for i := 0; i < 100; i++ {
+			sp := sourcedPacket{}
+			if keep, sampling := s.keep(&sp); keep {
+				kept++
+				if sampling != 4 {
+					t.Fatalf("Expected kept packets to stand for 4, got %d", sampling)
+				}
+			}
+		}
+		if kept != 25 {
+			t.Errorf("Expected 25 of 100 packets kept, got %d", kept)
+		}
+	})
+
+	t.Run("flows", func(t *testing.T) {
+		s := newSampler(SamplingConfig{Mode: SamplingFlow, Rate: 8})
+		keptFlows := 0
+		for flow := uint64(1); flow <= 4000; flow++ {
+			sp := sourcedPacket{}
+			sp.frame.flowHash = flow * 0x100000001b3
+			first, _ := s.keep(&sp)
+			for i := 0; i < 3; i++ {
+				if again, _ := s.keep(&sp); again != first {
+					t.Fatalf("Expected every packet of flow %d treated alike", flow)
+				}
+			}
+			if first {
+				keptFlows++
+			}
+		}
+		// 500 expected; allow for the hash's spread
+		if keptFlows < 400 || keptFlows > 600 {
+			t.Errorf("Expected about 1 in 8 of 4000 flows kept, got %d", keptFlows)
+		}
+	})
+
+	t.Run("adaptive idle", func(t *testing.T) {
+		s := newSampler(SamplingConfig{Mode: SamplingPacket, Rate: 4, Adaptive: true})
+		sp := sourcedPacket{}
+		if keep, sampling := s.keep(&sp); !keep || sampling != 1 {
+			t.Errorf("Expected every packet kept at full weight before overload, got %v, %d", keep, sampling)
+		}
+	})
+
+	if newSampler(SamplingConfig{}) != nil {
+		t.Error("Expected no sampler when sampling is off")
+	}
+}
+
+// Verifies that overload engages and escalates sampling and that quiet intervals
+// step it back down and off.
+func TestSampler_Adjust(t *testing.T) {
+	s := newSampler(SamplingConfig{Mode: SamplingFlow, Rate: 4, Adaptive: true, DropThreshold: 50, CalmIntervals: 2})
+
+	steps := []struct {
+		name  string
+		fill  float64
+		drops uint64 // Cumulative, as reported by Stats
+		want  uint32
+	}{
+		{"quiet", 0.1, 0, 0},
+		{"drops below threshold", 0.1, 40, 0},
+		{"drop burst", 0.1, 200, 4},
+		{"queues full", 0.95, 200, 8},
+		{"first quiet interval", 0.2, 210, 8},
+		{"second quiet interval", 0.2, 220, 4},
+		{"third quiet interval", 0.2, 220, 4},
+		{"fourth quiet interval", 0.2, 220, 0},
+	}
+
+	for _, step := range steps {
+		if got := s.adjust(step.fill, step.drops); got != step.want {
+			t.Fatalf("%s: expected rate %d, got %d", step.name, step.want, got)
+		}
+	}
+	if s.counters.engaged != 1 {
+		t.Errorf("Expected sampling engaged once, got %d", s.counters.engaged)
+	}
+}
+
+// Verifies that always-on sampling sheds packets before the workers and that the
+// flow's counts are scaled back up and flagged as sampled.
+func TestEngine_Sampling(t *testing.T) {
+	start := time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC)
+	frames := make([][]byte, 10)
+	stamps := make([]time.Time, 10)
+	for i := range frames {
+		frames[i] = buildRingPacket(t, ringClientMAC, ringRouterMAC, net.IP{192, 168, 1, 100}, net.IP{93, 184, 216, 34}, 54321, 443, 10)
+		stamps[i] = start.Add(time.Duration(i) * time.Millisecond)
+	}
+
+	config := DefaultConfig("")
+	config.Sampling = SamplingConfig{Mode: SamplingPacket, Rate: 2}
+	engine := newPipeline(config, newTestStore(t))
+	engine.sources = []*captureSource{newTestSource(t, "eth0", frames, stamps)}
+	defer engine.Stop()
+
+	if err := engine.Start(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := engine.PipelineStats()
+	if stats.Read != 10 || stats.SampledKept != 5 || stats.SampledShed != 5 || stats.Delivered != 5 {
+		t.Errorf("Expected 10 read, 5 kept, 5 shed and 5 delivered, got %+v", stats)
+	}
+	if stats.SampleRate != 2 {
+		t.Errorf("Expected sampling at 1 in 2, got %d", stats.SampleRate)
+	}
+
+	flows := engine.GetActiveFlows()
+	if len(flows) != 1 {
+		t.Fatalf("Expected one flow, got %d", len(flows))
+	}
+	if !flows[0].Sampled || flows[0].PacketCount != 10 || flows[0].ByteCount != uint64(10*len(frames[0])) {
+		t.Errorf("Expected a sampled flow estimated at 10 packets and %d bytes, got %d packets, %d bytes, sampled %v",
+			10*len(frames[0]), flows[0].PacketCount, flows[0].ByteCount, flows[0].Sampled)
+	}
+}
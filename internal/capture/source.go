@@ -0,0 +1,286 @@
+/**
+ * Capture Sources.
+ *
+ * Opens the pcap handles an engine reads from, merges several interfaces
+ * into a single ordered stream for the pipeline, and suppresses copies of
+ * frames that appear on more than one interface when a host bridges them.
+ * Each source decodes its own frames so decoding scales with interfaces.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package capture
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+)
+
+// Default window within which identical frames on different interfaces are treated
+// as one bridged packet. Bridges forward in microseconds; the margin absorbs
+// timestamp skew between capture handles.
+const defaultDedupWindow = 20 * time.Millisecond
+
+// One packet source feeding the pipeline, labelled with the interface it reads.
+type captureSource struct {
+	name     string
+	linkType layers.LinkType
+	reader   gopacket.PacketDataSource
+	handle   *pcap.Handle // nil for offline sources
+	filter   *pcap.BPF    // Applied as packets are read; nil when unfiltered or the handle filters
+}
+
+// A raw packet tagged with the source it was read from and decoded once.
+type sourcedPacket struct {
+	data     []byte
+	ci       gopacket.CaptureInfo
+	source   *captureSource
+	frame    frame
+	sampling uint32        // Packets this one stands for when sampled, 0 otherwise
+	app      *streamResult // Application data the segment completed, nil unless its TCP stream is reassembled or it is QUIC
+}
+
+// Returns the interfaces to capture from: Interfaces when set, otherwise Interface.
+// Repeated names are ignored so a typo cannot double every packet.
+func (c *Config) CaptureInterfaces() []string {
+	if len(c.Interfaces) == 0 {
+		return []string{c.Interface}
+	}
+
+	seen := make(map[string]bool, len(c.Interfaces))
+	names := make([]string, 0, len(c.Interfaces))
+	for _, name := range c.Interfaces {
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// Opens and configures a live pcap handle on one interface.
+func openLiveSource(name string, config *Config) (*captureSource, error) {
+	// Initialize inactive pcap handle first to safely configure options
+	inactive, err := pcap.NewInactiveHandle(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create inactive handle for %s: %w", name, err)
+	}
+	defer inactive.CleanUp()
+
+	if err := inactive.SetSnapLen(int(config.SnapLen)); err != nil {
+		return nil, fmt.Errorf("failed to set snaplen: %w", err)
+	}
+
+	if err := inactive.SetPromisc(config.Promiscuous); err != nil {
+		return nil, fmt.Errorf("failed to set promiscuous mode: %w", err)
+	}
+
+	if err := inactive.SetTimeout(config.Timeout); err != nil {
+		return nil, fmt.Errorf("failed to set timeout: %w", err)
+	}
+
+	// Optimize kernel buffer size to minimize packet drops on high-throughput links
+	if config.BufferSize > 0 {
+		if err := inactive.SetBufferSize(config.BufferSize * 1024 * 1024); err != nil {
+			log.Printf("Warning: failed to set buffer size on %s: %v", name, err)
+		}
+	}
+
+	// Begin live capture on the interface
+	handle, err := inactive.Activate()
+	if err != nil {
+		return nil, fmt.Errorf("failed to activate handle for %s: %w", name, err)
+	}
+
+	// Set kernel-level packet filter
+	if config.BPFFilter != "" {
+		if err := handle.SetBPFFilter(config.BPFFilter); err != nil {
+			handle.Close()
+			return nil, fmt.Errorf("failed to set BPF filter on %s: %w", name, err)
+		}
+		log.Printf("Applied BPF filter on %s: %s", name, config.BPFFilter)
+	}
+
+	return &captureSource{
+		name:     name,
+		linkType: handle.LinkType(),
+		reader:   handle,
+		handle:   handle,
+	}, nil
+}
+
+// Compiles the capture filter for a file or stream source, which has no handle to
+// filter in the kernel and so matches each packet as it is read. Returns nil when
+// no filter is configured.
+func compileSourceFilter(linkType layers.LinkType, config *Config) (*pcap.BPF, error) {
+	if config.BPFFilter == "" {
+		return nil, nil
+	}
+	filter, err := pcap.NewBPF(linkType, int(config.SnapLen), config.BPFFilter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile BPF filter: %w", err)
+	}
+	log.Printf("Applied BPF filter: %s", config.BPFFilter)
+	return filter, nil
+}
+
+// Closes every live handle the engine opened.
+func (e *Engine) closeSources() {
+	for _, source := range e.sources {
+		if source.handle != nil {
+			source.handle.Close()
+		}
+	}
+}
+
+// Fans packets from every source into one channel. The channel closes once all
+// sources are exhausted or the context is canceled.
+func (e *Engine) mergeSources(ctx context.Context) <-chan sourcedPacket {
+	merged := make(chan sourcedPacket, e.queueSize)
+
+	var wg sync.WaitGroup
+	for _, source := range e.sources {
+		wg.Add(1)
+		go func(source *captureSource) {
+			defer wg.Done()
+			readSource(ctx, source, merged)
+		}(source)
+	}
+
+	go func() {
+		wg.Wait()
+		close(merged)
+	}()
+
+	return merged
+}
+
+// Reads and decodes packets from one source until it is exhausted or the context
+// is canceled. Raw reads skip gopacket.Packet construction entirely; the decoder
+// and its layers are reused for every packet of the source.
+func readSource(ctx context.Context, source *captureSource, out chan<- sourcedPacket) {
+	decoder := newDecoder(source.linkType)
+
+	for ctx.Err() == nil {
+		data, ci, err := source.reader.ReadPacketData()
+		if err != nil {
+			if isFinalReadError(err) {
+				return
+			}
+			// Read timeouts on an idle live handle are routine; back off briefly on anything else
+			if !errors.Is(err, pcap.NextErrorTimeoutExpired) {
+				time.Sleep(5 * time.Millisecond)
+			}
+			continue
+		}
+		if source.filter != nil && !source.filter.Matches(ci, data) {
+			continue
+		}
+
+		sp := sourcedPacket{data: data, ci: ci, source: source}
+		decoder.decode(data, ci.Timestamp, &sp.frame)
+
+		select {
+		case out <- sp:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Read errors after which a source cannot deliver more packets.
+var finalReadErrors = []error{io.EOF, io.ErrUnexpectedEOF, io.ErrNoProgress, io.ErrClosedPipe, io.ErrShortBuffer, syscall.EBADF, errStreamLinkTypeChanged}
+
+// Reports whether a read error ends a source, following gopacket.PacketSource:
+// end of file and closed handles are final, anything else is retried.
+func isFinalReadError(err error) bool {
+	for _, final := range finalReadErrors {
+		if errors.Is(err, final) {
+			return true
+		}
+	}
+	return strings.Contains(err.Error(), "use of closed file")
+}
+
+// Suppresses copies of the same frame captured on different interfaces within a
+// short window, as happens when monitoring both sides of a bridge. Identical frames
+// on the same interface are genuine (e.g. retransmissions) and always pass.
+// Used only from the reader goroutine, so it needs no locking.
+type duplicateFilter struct {
+	window time.Duration
+	seed   maphash.Seed
+	seen   map[uint64]dedupEntry
+	order  []dedupRecord // Insertion order for expiry
+}
+
+type dedupEntry struct {
+	source *captureSource
+	length int
+	seen   time.Time
+}
+
+type dedupRecord struct {
+	hash uint64
+	seen time.Time
+}
+
+func newDuplicateFilter(window time.Duration) *duplicateFilter {
+	if window <= 0 {
+		window = defaultDedupWindow
+	}
+	return &duplicateFilter{
+		window: window,
+		seed:   maphash.MakeSeed(),
+		seen:   make(map[uint64]dedupEntry),
+	}
+}
+
+// Reports whether the packet repeats a frame already seen on another interface.
+// Expiry is driven by packet timestamps so replayed captures behave identically.
+func (d *duplicateFilter) isDuplicate(sp *sourcedPacket) bool {
+	ts := sp.ci.Timestamp
+	data := sp.data
+
+	// Expire entries that have fallen out of the window
+	cutoff := ts.Add(-d.window)
+	expired := 0
+	for expired < len(d.order) && d.order[expired].seen.Before(cutoff) {
+		record := d.order[expired]
+		if entry, ok := d.seen[record.hash]; ok && entry.seen.Equal(record.seen) {
+			delete(d.seen, record.hash)
+		}
+		expired++
+	}
+	if expired > 0 {
+		d.order = append(d.order[:0], d.order[expired:]...)
+	}
+
+	hash := maphash.Bytes(d.seed, data)
+	if entry, ok := d.seen[hash]; ok && entry.source != sp.source && entry.length == len(data) {
+		diff := ts.Sub(entry.seen)
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff <= d.window {
+			return true
+		}
+	}
+
+	d.seen[hash] = dedupEntry{source: sp.source, length: len(data), seen: ts}
+	d.order = append(d.order, dedupRecord{hash: hash, seen: ts})
+	return false
+}
@@ -0,0 +1,262 @@
+/**
+ * Capture Source Tests.
+ *
+ * Validates interface selection, bridged-duplicate suppression, and that
+ * packets merged from several interfaces keep their interface label all
+ * the way into the flow table.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package capture
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/kleaSCM/netscope/internal/storage"
+)
+
+// Builds an in-memory offline Ethernet source from raw frames with the given timestamps.
+func newTestSource(t *testing.T, name string, frames [][]byte, stamps []time.Time) *captureSource {
+	t.Helper()
+	return newLinkTestSource(t, name, layers.LinkTypeEthernet, frames, stamps)
+}
+
+// Builds an in-memory offline source of the given link type.
+func newLinkTestSource(t *testing.T, name string, linkType layers.LinkType, frames [][]byte, stamps []time.Time) *captureSource {
+	t.Helper()
+	var buf bytes.Buffer
+	w := pcapgo.NewWriter(&buf)
+	if err := w.WriteFileHeader(65536, linkType); err != nil {
+		t.Fatal(err)
+	}
+	for i, data := range frames {
+		if err := w.WritePacket(ringCaptureInfo(stamps[i], data), data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := pcapgo.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &captureSource{name: name, linkType: r.LinkType(), reader: r}
+}
+
+// Verifies interface list resolution from the single and multi-interface settings.
+func TestConfig_CaptureInterfaces(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   []string
+	}{
+		{"single", Config{Interface: "eth0"}, []string{"eth0"}},
+		{"multiple override single", Config{Interface: "eth0", Interfaces: []string{"lan", "wan"}}, []string{"lan", "wan"}},
+		{"repeats and blanks dropped", Config{Interfaces: []string{"lan", "", "wlan", "lan"}}, []string{"lan", "wlan"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.CaptureInterfaces(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// Verifies that only cross-interface copies inside the window are suppressed.
+func TestDuplicateFilter(t *testing.T) {
+	start := time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC)
+	frame := buildRingPacket(t, ringClientMAC, ringRouterMAC, net.IP{192, 168, 1, 100}, net.IP{93, 184, 216, 34}, 54321, 443, 10)
+	lan, wlan := &captureSource{name: "lan"}, &captureSource{name: "wlan"}
+
+	packetAt := func(source *captureSource, offset time.Duration) *sourcedPacket {
+		return &sourcedPacket{data: frame, ci: ringCaptureInfo(start.Add(offset), frame), source: source}
+	}
+
+	filter := newDuplicateFilter(10 * time.Millisecond)
+	if filter.isDuplicate(packetAt(lan, 0)) {
+		t.Fatal("First sighting must not be a duplicate")
+	}
+	if !filter.isDuplicate(packetAt(wlan, 200*time.Microsecond)) {
+		t.Error("Bridged copy on another interface should be a duplicate")
+	}
+	if filter.isDuplicate(packetAt(lan, time.Millisecond)) {
+		t.Error("Identical frame on the same interface is a genuine repeat")
+	}
+	if filter.isDuplicate(packetAt(wlan, time.Second)) {
+		t.Error("Copy outside the window should not be a duplicate")
+	}
+	if len(filter.seen) != 1 {
+		t.Errorf("Expected expired entries to be pruned, %d remain", len(filter.seen))
+	}
+}
+
+// Verifies that packets whose payloads once panicked their parsers are analysed like
+// any other, each delivered without its application layer, and that a frame the
+// decoder cannot read is counted and skipped. The capture runs to completion.
+func TestEngine_MalformedPackets(t *testing.T) {
+	start := time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC)
+	client, server := net.IP{192, 168, 1, 100}, net.IP{93, 184, 216, 34}
+	frames := [][]byte{
+		// mDNS response whose answer ends inside its fixed fields
+		serializeFrame(t, ethernetTo(layers.EthernetTypeIPv4),
+			ipv4Between(client, net.IP{224, 0, 0, 251}, layers.IPProtocolUDP),
+			&layers.UDP{SrcPort: 5353, DstPort: 5353},
+			gopacket.Payload{0, 0, 0x84, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 1}),
+		// TLS handshake record with no room for a message header
+		serializeFrame(t, ethernetTo(layers.EthernetTypeIPv4),
+			ipv4Between(client, server, layers.IPProtocolTCP),
+			&layers.TCP{SrcPort: 54321, DstPort: 443, ACK: true, PSH: true, Window: 64240},
+			gopacket.Payload{0x16, 0x03, 0x01, 0x00, 0x00}),
+		buildRingPacket(t, ringClientMAC, ringRouterMAC, client, server, 54322, 443, 10),
+		// DNS response the decoder's DNS layer indexes past
+		serializeFrame(t, ethernetTo(layers.EthernetTypeIPv4),
+			ipv4Between(net.IP{8, 8, 8, 8}, client, layers.IPProtocolUDP),
+			&layers.UDP{SrcPort: 53, DstPort: 40000},
+			gopacket.Payload{0, 7, 0x84, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 1}),
+	}
+
+	config := DefaultConfig("")
+	config.Workers = 1
+	engine := newPipeline(config, newTestStore(t))
+	engine.sources = []*captureSource{newTestSource(t, "lan", frames, []time.Time{start, start.Add(time.Millisecond), start.Add(2 * time.Millisecond), start.Add(3 * time.Millisecond)})}
+	defer engine.Stop()
+
+	var delivered []PacketInfo
+	if err := engine.Start(context.Background(), func(info PacketInfo) { delivered = append(delivered, info) }); err != nil {
+		t.Fatal(err)
+	}
+	if stats := engine.PipelineStats(); stats.DecodeErrors != 1 || len(delivered) != len(frames)-1 {
+		t.Fatalf("Expected one decode error and %d packets delivered, got %d and %d", len(frames)-1, stats.DecodeErrors, len(delivered))
+	}
+	for i, want := range []string{"UDP", "TCP", "TCP"} {
+		if info := delivered[i]; info.Protocol != want || info.Discovery != nil || info.TLS != nil {
+			t.Errorf("Packet %d: expected a plain %s packet, got %s", i, want, info.Protocol)
+		}
+	}
+}
+
+// Verifies that two bridged interfaces and a third distinct one share one pipeline,
+// with bridged copies counted once and every packet and flow labelled by interface.
+func TestEngine_MultipleSources(t *testing.T) {
+	store, err := storage.NewSQLiteStorage(filepath.Join(t.TempDir(), "multi.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err := store.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC)
+	bridged := [][]byte{
+		buildRingPacket(t, ringClientMAC, ringRouterMAC, net.IP{192, 168, 1, 100}, net.IP{93, 184, 216, 34}, 54321, 443, 10),
+		buildRingPacket(t, ringRouterMAC, ringClientMAC, net.IP{93, 184, 216, 34}, net.IP{192, 168, 1, 100}, 443, 54321, 10),
+	}
+	wanOnly := [][]byte{
+		buildRingPacket(t, ringOtherMAC, ringRouterMAC, net.IP{203, 0, 113, 5}, net.IP{198, 51, 100, 7}, 40000, 22, 10),
+	}
+	// Offline sources are drained concurrently in no particular order, so every frame
+	// stays inside one dedup window to keep the outcome independent of scheduling
+	stamps := []time.Time{start, start.Add(time.Millisecond)}
+	skewed := []time.Time{start.Add(300 * time.Microsecond), start.Add(1300 * time.Microsecond)}
+
+	config := DefaultConfig("")
+	config.Workers = 2
+	engine := newPipeline(config, store)
+	engine.sources = []*captureSource{
+		newTestSource(t, "lan", bridged, stamps),
+		newTestSource(t, "wlan", bridged, skewed),
+		newTestSource(t, "wan", wanOnly, stamps[:1]),
+	}
+	engine.dedup = newDuplicateFilter(config.DedupWindow)
+	defer engine.Stop()
+
+	interfaces := make(map[string]int)
+	if err := engine.Start(context.Background(), func(info PacketInfo) {
+		interfaces[info.Interface]++
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := engine.PipelineStats()
+	if stats.Read != 5 || stats.Duplicates != 2 || stats.Delivered != 3 {
+		t.Errorf("Expected 5 read, 2 duplicates, 3 delivered; got %d, %d, %d", stats.Read, stats.Duplicates, stats.Delivered)
+	}
+	if interfaces["wan"] != 1 || interfaces["lan"]+interfaces["wlan"] != 2 {
+		t.Errorf("Unexpected per-interface deliveries: %v", interfaces)
+	}
+
+	for _, flow := range engine.GetActiveFlows() {
+		if flow.Interface == "" {
+			t.Errorf("Flow %s has no interface recorded", flow.Key)
+		}
+		if (flow.Key.SrcPort == 22 || flow.Key.DstPort == 22) && flow.Interface != "wan" {
+			t.Errorf("Expected SSH flow on wan, got %q", flow.Interface)
+		}
+		if flow.Key.DstPort == 443 && flow.PacketCount != 2 {
+			t.Errorf("Expected bridged flow counted once per packet (2), got %d", flow.PacketCount)
+		}
+	}
+}
+
+// Verifies that a raw IP link (tun, WireGuard) is reported by name and that its
+// hosts are tracked as devices and baselined by IP in the absence of MACs.
+func TestEngine_RawIPSource(t *testing.T) {
+	store, err := storage.NewSQLiteStorage(filepath.Join(t.TempDir(), "tun.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err := store.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tunnelHost := net.IP{10, 8, 0, 2}
+	packet := serializeFrame(t, ipv4Between(tunnelHost, decodeServer, layers.IPProtocolTCP),
+		&layers.TCP{SrcPort: 50000, DstPort: 443, SYN: true, Window: 64240})
+	start := time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC)
+
+	engine := newPipeline(DefaultConfig(""), store)
+	engine.sources = []*captureSource{newLinkTestSource(t, "tun0", layers.LinkTypeRaw, [][]byte{packet}, []time.Time{start})}
+	defer engine.Stop()
+
+	var delivered []PacketInfo
+	if err := engine.Start(context.Background(), func(info PacketInfo) {
+		delivered = append(delivered, info)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := engine.PipelineStats().LinkTypes["tun0"]; got != "Raw IP" {
+		t.Errorf("Expected link type Raw IP on tun0, got %q", got)
+	}
+	if len(delivered) != 1 || delivered[0].SrcIP != "10.8.0.2" || delivered[0].DstPort != 443 {
+		t.Fatalf("Expected one packet 10.8.0.2 -> :443, got %+v", delivered)
+	}
+	if delivered[0].DeviceHostname == "" || delivered[0].DeviceHostname == "Unknown Device" {
+		t.Errorf("Expected the tunnel host tracked as a device, got %q", delivered[0].DeviceHostname)
+	}
+
+	devices, err := store.ListDevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 1 || devices[0].IPAddress != "10.8.0.2" || devices[0].MACAddress != "" {
+		t.Errorf("Expected one IP-keyed device for 10.8.0.2, got %+v", devices)
+	}
+	if _, ok := engine.baselineTracker.GetAllBaselines()["10.8.0.2"]; !ok {
+		t.Error("Expected a behavioral baseline keyed by the tunnel host's IP")
+	}
+}
@@ -0,0 +1,210 @@
+/**
+ * Pcap Stream Capture.
+ *
+ * Reads a pcap or pcapng stream from stdin or a named pipe and feeds it
+ * through the pipeline as if it were a live interface, so traffic can be
+ * captured on a headless appliance (`tcpdump -w -` over ssh) and analysed
+ * here. A named pipe outlives its writer: when one writer goes away the
+ * source waits for the next, which restarts the stream with a new header.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package capture
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/kleaSCM/netscope/internal/storage"
+)
+
+// Path naming standard input as the stream.
+const StdinPath = "-"
+
+// How often a named pipe without a writer is checked for a new one.
+const streamPollInterval = 250 * time.Millisecond
+
+// Returned when a reconnecting writer sends a different link type; the decoder and
+// evidence buffer are fixed to the first one, so the stream cannot continue.
+var errStreamLinkTypeChanged = errors.New("pcap stream changed link type")
+
+// Counters for a stream source, updated atomically.
+type streamCounters struct {
+	bytes      uint64
+	reconnects uint64
+}
+
+// Counts the bytes read from the stream, headers included.
+type countingReader struct {
+	r     io.Reader
+	count *uint64
+}
+
+func (c countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	atomic.AddUint64(c.count, uint64(n))
+	return n, err
+}
+
+// A pcap stream read from stdin or a named pipe. ReadPacketData is called only from
+// the source's reader goroutine; Close may be called from any goroutine.
+type streamSource struct {
+	name     string
+	file     *os.File
+	reopen   bool // Named pipe: wait for a new writer at end of stream
+	reader   replayReader
+	linkType layers.LinkType
+	counters streamCounters
+	closed   atomic.Bool
+}
+
+// Creates an engine that reads a pcap or pcapng stream from stdin ("-") or a named pipe.
+// It blocks until the stream header arrives, since the link type is needed to decode.
+// Stdin ends the capture at end of stream; a named pipe waits for the next writer.
+func NewStreamEngine(path string, config *Config, store storage.Storage) (*Engine, error) {
+	if config == nil {
+		return nil, fmt.Errorf("config cannot be nil")
+	}
+
+	stream, err := openStreamSource(path)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := compileSourceFilter(stream.linkType, config)
+	if err != nil {
+		stream.Close()
+		return nil, err
+	}
+
+	engine := newPipeline(config, store)
+	engine.interfaceName = stream.name
+	engine.stream = stream
+	engine.sources = []*captureSource{{
+		name:     stream.name,
+		linkType: stream.linkType,
+		reader:   stream,
+		filter:   filter,
+	}}
+
+	if err := engine.attachRingBuffer(config); err != nil {
+		stream.Close()
+		return nil, err
+	}
+
+	return engine, nil
+}
+
+// Opens stdin or a named pipe and reads the stream header.
+func openStreamSource(path string) (*streamSource, error) {
+	if path == StdinPath {
+		return newStreamSource("stdin", os.Stdin, false)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pcap stream: %w", err)
+	}
+	pipe := info.Mode()&os.ModeNamedPipe != 0
+
+	// Opening a pipe for reading normally blocks until a writer appears; non-blocking
+	// lets the reads wait in the runtime poller instead, where Close can interrupt them.
+	flags := os.O_RDONLY
+	if pipe {
+		flags |= syscall.O_NONBLOCK
+	}
+	file, err := os.OpenFile(path, flags, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pcap stream: %w", err)
+	}
+
+	stream, err := newStreamSource(path, file, pipe)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return stream, nil
+}
+
+// Wraps an open stream and waits for its header.
+func newStreamSource(name string, file *os.File, reopen bool) (*streamSource, error) {
+	s := &streamSource{name: name, file: file, reopen: reopen}
+	if reopen {
+		log.Printf("Waiting for a writer on %s", name)
+	}
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	s.linkType = s.reader.LinkType()
+	return s, nil
+}
+
+// Reads a stream header. On a named pipe, an absent writer is waited out; anything
+// else that fails is a malformed stream.
+func (s *streamSource) connect() error {
+	for {
+		if s.closed.Load() {
+			return io.EOF
+		}
+
+		reader, err := openReplayReader(bufio.NewReader(countingReader{r: s.file, count: &s.counters.bytes}))
+		if err == nil {
+			s.reader = reader
+			return nil
+		}
+		if !s.reopen || !errors.Is(err, io.EOF) {
+			return fmt.Errorf("pcap stream %s: %w", s.name, err)
+		}
+		time.Sleep(streamPollInterval)
+	}
+}
+
+// Returns the next packet. When a named pipe's writer goes away, including mid-packet
+// as when an ssh session drops, the source waits for the next writer and carries on.
+// The pipe only reports the end once it is drained, so a writer that connects while
+// the previous one's data is still buffered would splice its header into the stream;
+// restarted writers should follow, not overlap, the ones they replace.
+func (s *streamSource) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	for {
+		data, ci, err := s.reader.ReadPacketData()
+		if err == nil || !s.reopen || s.closed.Load() {
+			return data, ci, err
+		}
+		if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return data, ci, err
+		}
+
+		log.Printf("Pcap stream writer on %s disconnected; waiting for the next one", s.name)
+		if err := s.connect(); err != nil {
+			return nil, gopacket.CaptureInfo{}, err
+		}
+		atomic.AddUint64(&s.counters.reconnects, 1)
+
+		if linkType := s.reader.LinkType(); linkType != s.linkType {
+			log.Printf("Pcap stream on %s switched from %s to %s; ending capture", s.name, linkTypeName(s.linkType), linkTypeName(linkType))
+			return nil, gopacket.CaptureInfo{}, errStreamLinkTypeChanged
+		}
+		log.Printf("Pcap stream writer reconnected on %s", s.name)
+	}
+}
+
+// Stops the stream, interrupting a pending read or a wait for a writer.
+func (s *streamSource) Close() error {
+	s.closed.Store(true)
+	return s.file.Close()
+}
+
+// Reports whether the engine reads a pcap stream from stdin or a named pipe.
+func (e *Engine) IsStream() bool {
+	return e.stream != nil
+}
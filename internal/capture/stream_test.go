@@ -0,0 +1,194 @@
+/**
+ * Pcap Stream Tests.
+ *
+ * Validates that a pcap stream on a pipe is analysed like a live capture,
+ * that stdin-style streams end cleanly even when cut off mid-packet, and
+ * that a named pipe survives its writer going away and coming back.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package capture
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/kleaSCM/netscope/internal/storage"
+)
+
+// Builds a complete pcap stream, header included, carrying the given number of packets.
+func buildPcapStream(t *testing.T, packets int, start time.Time) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := pcapgo.NewWriter(&buf)
+	if err := w.WriteFileHeader(65536, layers.LinkTypeEthernet); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < packets; i++ {
+		data := buildRingPacket(t, ringClientMAC, ringRouterMAC, net.IP{192, 168, 1, 100}, net.IP{93, 184, 216, 34}, uint16(50000+i), 443, 10)
+		if err := w.WritePacket(ringCaptureInfo(start.Add(time.Duration(i)*time.Millisecond), data), data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+// Opens a migrated SQLite store in the test's temporary directory.
+func newTestStore(t *testing.T) storage.Storage {
+	t.Helper()
+	store, err := storage.NewSQLiteStorage(filepath.Join(t.TempDir(), "stream.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	if err := store.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// Creates an engine reading from an already-open stream source.
+func newStreamTestEngine(t *testing.T, stream *streamSource) *Engine {
+	t.Helper()
+	engine := newPipeline(DefaultConfig(""), newTestStore(t))
+	engine.interfaceName = stream.name
+	engine.stream = stream
+	engine.sources = []*captureSource{{name: stream.name, linkType: stream.linkType, reader: stream}}
+	return engine
+}
+
+// Waits until the engine has delivered the expected number of packets.
+func waitForDelivered(t *testing.T, engine *Engine, want uint64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for engine.PipelineStats().Delivered < want {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %d packets, got %d", want, engine.PipelineStats().Delivered)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// Verifies that a stdin-style stream is read to its end, including one cut off
+// mid-packet, and that every byte read is counted.
+func TestStreamSource_Pipe(t *testing.T) {
+	start := time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC)
+	full := buildPcapStream(t, 3, start)
+
+	tests := []struct {
+		name string
+		data []byte
+		want uint64
+	}{
+		{"complete stream", full, 3},
+		{"cut off mid-packet", full[:len(full)-5], 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, w, err := os.Pipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			go func() {
+				w.Write(tt.data)
+				w.Close()
+			}()
+
+			stream, err := newStreamSource("stdin", r, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			engine := newStreamTestEngine(t, stream)
+			defer engine.Stop()
+
+			if err := engine.Start(context.Background(), nil); err != nil {
+				t.Fatal(err)
+			}
+
+			stats := engine.PipelineStats()
+			if stats.Delivered != tt.want {
+				t.Errorf("Expected %d packets, got %d", tt.want, stats.Delivered)
+			}
+			if stats.StreamBytes != uint64(len(tt.data)) {
+				t.Errorf("Expected %d stream bytes, got %d", len(tt.data), stats.StreamBytes)
+			}
+			if stats.StreamReconnects != 0 {
+				t.Errorf("Expected no reconnects on stdin, got %d", stats.StreamReconnects)
+			}
+			if !engine.IsStream() || engine.IsOffline() {
+				t.Error("Expected the engine to report a stream source")
+			}
+		})
+	}
+}
+
+// Verifies that a named pipe keeps the capture running across writers, as when
+// an ssh session running tcpdump drops and is restarted.
+func TestStreamEngine_FIFOReconnect(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.fifo")
+	if err := syscall.Mkfifo(path, 0600); err != nil {
+		t.Skipf("named pipes unavailable: %v", err)
+	}
+
+	start := time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC)
+	first := buildPcapStream(t, 2, start)
+	second := buildPcapStream(t, 1, start.Add(time.Minute))
+
+	writeStream := func(data []byte) {
+		w, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		w.Write(data)
+		w.Close()
+	}
+
+	// The engine waits for the first header, so the writer must already be running
+	go writeStream(first)
+	engine, err := NewStreamEngine(path, DefaultConfig(""), newTestStore(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- engine.Start(ctx, nil) }()
+
+	waitForDelivered(t, engine, 2)
+	// Let the reader see the first writer's end before the second one connects
+	time.Sleep(50 * time.Millisecond)
+	writeStream(second)
+	waitForDelivered(t, engine, 3)
+
+	stats := engine.PipelineStats()
+	if stats.StreamReconnects != 1 {
+		t.Errorf("Expected 1 reconnect, got %d", stats.StreamReconnects)
+	}
+	if want := uint64(len(first) + len(second)); stats.StreamBytes != want {
+		t.Errorf("Expected %d stream bytes, got %d", want, stats.StreamBytes)
+	}
+	if got := engine.LinkTypes()[path]; got != "Ethernet" {
+		t.Errorf("Expected Ethernet on the stream, got %q", got)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Engine did not stop after cancellation")
+	}
+}
@@ -12,9 +12,12 @@ package cli
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
+	"sort"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -28,6 +31,9 @@ import (
 
 var localDeviceIP string
 
+// Set when several interfaces feed one capture, so output shows where each packet came from.
+var showInterface bool
+
 // Holds configuration for packet capture.
 type CaptureConfig struct {
 	Interface string
@@ -37,8 +43,8 @@ type CaptureConfig struct {
 
 // Displays the capture menu and handles packet capture workflow.
 func ShowCaptureMenu(store storage.Storage) error {
-	// First, select interface for capture
-	iface, err := selectInterface()
+	// First, select interface(s) for capture
+	ifaces, err := selectInterfaces()
 	if err != nil {
 		return err
 	}
@@ -50,18 +56,45 @@ func ShowCaptureMenu(store storage.Storage) error {
 
 	verbose := selectOutputMode()
 
+	retain := PromptYesNo("Keep a rolling packet buffer for evidence export?")
+
+	limits, err := selectLimits()
+	if err != nil {
+		return err
+	}
+
+	window, err := selectSchedule()
+	if err != nil {
+		return err
+	}
+
+	sampling, err := selectSampling()
+	if err != nil {
+		return err
+	}
+
 	// Show confirmation summary to avoid accidental large captures
 	ClearScreen()
 	fmt.Print(banner)
 	fmt.Println("Capture Configuration:")
 	fmt.Println(string(make([]rune, 60)))
-	fmt.Printf("  Interface: %s\n", iface.Name)
+	fmt.Printf("  Interface: %s\n", strings.Join(ifaces, ", "))
 	if filter != "" {
 		fmt.Printf("  Filter:    %s\n", filter)
 	} else {
 		fmt.Printf("  Filter:    (none - capturing all traffic)\n")
 	}
 	fmt.Printf("  Mode:      %s\n", map[bool]string{true: "Verbose", false: "Simple"}[verbose])
+	if retain {
+		fmt.Printf("  Evidence:  rolling buffer in %s\n", capture.DefaultRingBufferConfig().Directory)
+	}
+	fmt.Printf("  Limits:    %s\n", limits)
+	if sampling.Mode != capture.SamplingOff {
+		fmt.Printf("  Overload:  sample %s from 1 in %d\n", sampling.Mode, sampling.Rate)
+	}
+	if window != nil {
+		fmt.Printf("  Schedule:  daily %s\n", window)
+	}
 	fmt.Println()
 
 	if !Confirm("Start capture with these settings?") {
@@ -69,9 +102,28 @@ func ShowCaptureMenu(store storage.Storage) error {
 	}
 
 	// Begin blocking capture loop
-	return startCapture(iface.Name, filter, verbose, store)
+	if window != nil {
+		return runSchedule(*window, limits, func(runLimits capture.Limits) (*models.CaptureRun, error) {
+			return startCapture(ifaces, filter, verbose, retain, runLimits, sampling, window.String(), store)
+		})
+	}
+	_, err = startCapture(ifaces, filter, verbose, retain, limits, sampling, "", store)
+	return err
+}
+
+// Selects one interface, or several to capture from simultaneously.
+func selectInterfaces() ([]string, error) {
+	iface, err := selectInterface()
+	if err != nil {
+		return nil, err
+	}
+	if iface != nil {
+		return []string{iface.Name}, nil
+	}
+	return selectInterfaceList()
 }
 
+// Returns nil without error when the user asks to pick multiple interfaces.
 func selectInterface() (*capture.NetworkInterface, error) {
 	interfaces, err := capture.ListInterfaces()
 	if err != nil {
@@ -107,7 +159,8 @@ func selectInterface() (*capture.NetworkInterface, error) {
 		}
 	}
 
-	// Add "Show all interfaces" option
+	// Add "Multiple" and "Show all interfaces" options
+	options = append(options, "Multiple interfaces at once (e.g. LAN + WLAN + WAN)")
 	options = append(options, "Show all interfaces (including loopback/down)")
 
 	// Try to detect and suggest the best interface
@@ -147,6 +200,11 @@ func selectInterface() (*capture.NetworkInterface, error) {
 		return selectInterfaceAll(interfaces)
 	}
 
+	// If user selected "multiple"
+	if idx == len(options)-2 {
+		return nil, nil
+	}
+
 	return &validInterfaces[idx], nil
 }
 
@@ -180,6 +238,41 @@ func selectInterfaceAll(interfaces []capture.NetworkInterface) (*capture.Network
 	return &interfaces[idx], nil
 }
 
+func selectInterfaceList() ([]string, error) {
+	interfaces, err := capture.ListInterfaces()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list interfaces: %w", err)
+	}
+
+	fmt.Println("\nAvailable Interfaces:")
+	fmt.Println(strings.Repeat("━", 60))
+	for i, iface := range interfaces {
+		addrs := "no IP"
+		if len(iface.Addresses) > 0 {
+			addrs = iface.Addresses[0]
+		}
+		fmt.Printf("  %d. %s (%s)\n", i+1, iface.Name, addrs)
+	}
+
+	input, err := Prompt("\nSelect interfaces (comma-separated, e.g. 1,3): ")
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, field := range strings.Split(input, ",") {
+		choice, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || choice < 1 || choice > len(interfaces) {
+			return nil, fmt.Errorf("invalid selection %q", strings.TrimSpace(field))
+		}
+		names = append(names, interfaces[choice-1].Name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no interfaces selected")
+	}
+	return names, nil
+}
+
 func selectFilter() (string, error) {
 	options := []string{
 		"All traffic (no filter)",
@@ -226,27 +319,220 @@ func selectOutputMode() bool {
 	return idx == 1
 }
 
-func startCapture(interfaceName, filter string, verbose bool, store storage.Storage) error {
+// Asks for the conditions that end the capture without Ctrl+C.
+func selectLimits() (capture.Limits, error) {
+	options := []string{
+		"Run until stopped (Ctrl+C)",
+		"Stop after a duration, packet count or byte count",
+	}
+
+	idx, err := Select("Select Stop Condition:", options)
+	if err != nil || idx == 0 {
+		return capture.Limits{}, err
+	}
+
+	var limits capture.Limits
+	input, err := Prompt("Duration (e.g. 30m, 8h; blank for none): ")
+	if err != nil {
+		return limits, err
+	}
+	if input != "" {
+		if limits.Duration, err = time.ParseDuration(input); err != nil || limits.Duration <= 0 {
+			return limits, fmt.Errorf("invalid duration %q", input)
+		}
+	}
+
+	input, err = Prompt("Packet count (blank for none): ")
+	if err != nil {
+		return limits, err
+	}
+	if input != "" {
+		if limits.Packets, err = strconv.ParseUint(input, 10, 64); err != nil {
+			return limits, fmt.Errorf("invalid packet count %q", input)
+		}
+	}
+
+	input, err = Prompt("Byte count (e.g. 500MB, 2GB; blank for none): ")
+	if err != nil {
+		return limits, err
+	}
+	if input != "" {
+		if limits.Bytes, err = parseByteSize(input); err != nil {
+			return limits, err
+		}
+	}
+
+	return limits, nil
+}
+
+// Asks whether the capture should recur in a daily window; nil means run now, once.
+func selectSchedule() (*capture.Window, error) {
+	if !PromptYesNo("Run only during a daily time window (e.g. 22:00-06:00)?") {
+		return nil, nil
+	}
+
+	input, err := Prompt("Window (HH:MM-HH:MM, local time): ")
+	if err != nil {
+		return nil, err
+	}
+	window, err := capture.ParseWindow(input)
+	if err != nil {
+		return nil, err
+	}
+	return &window, nil
+}
+
+// Asks how the capture should shed load when it cannot keep up.
+func selectSampling() (capture.SamplingConfig, error) {
+	options := []string{
+		"None (the kernel drops packets at random when overloaded)",
+		"Sample 1-in-N packets when overloaded",
+		"Sample 1-in-N whole flows when overloaded",
+	}
+
+	idx, err := Select("Select Overload Handling:", options)
+	if err != nil || idx == 0 {
+		return capture.SamplingConfig{}, err
+	}
+
+	config := capture.SamplingConfig{Mode: capture.SamplingPacket, Rate: 10, Adaptive: true}
+	if idx == 2 {
+		config.Mode = capture.SamplingFlow
+	}
+
+	input, err := Prompt("Initial sampling rate N (blank for 10): ")
+	if err != nil {
+		return config, err
+	}
+	if input != "" {
+		rate, err := strconv.ParseUint(input, 10, 32)
+		if err != nil || rate < 2 {
+			return config, fmt.Errorf("invalid sampling rate %q: must be 2 or more", input)
+		}
+		config.Rate = uint32(rate)
+	}
+	return config, nil
+}
+
+// Runs one capture in every occurrence of a daily window until interrupted. Each run is
+// bounded by the window's end as well as the configured limits and recorded on its own;
+// a run that fails is reported and the schedule waits for the next window.
+func runSchedule(window capture.Window, limits capture.Limits, run func(capture.Limits) (*models.CaptureRun, error)) error {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+
+	from := time.Now()
+	for {
+		start, end := window.Next(from)
+		if wait := time.Until(start); wait > 0 {
+			fmt.Printf("⏰ Next capture window %s opens %s (Ctrl+C to cancel the schedule)\n", window, start.Format("Mon Jan 2 15:04"))
+			timer := time.NewTimer(wait)
+			select {
+			case <-sigChan:
+				timer.Stop()
+				fmt.Println("\n🛑 Schedule cancelled")
+				return nil
+			case <-timer.C:
+			}
+		}
+
+		runLimits := limits
+		if remaining := time.Until(end); runLimits.Duration <= 0 || remaining < runLimits.Duration {
+			runLimits.Duration = remaining
+		}
+
+		record, err := run(runLimits)
+		if err != nil {
+			fmt.Printf("⚠️  Scheduled capture failed: %v\n", err)
+		}
+		if record != nil && record.StopReason == models.StopInterrupted {
+			return nil
+		}
+
+		// A count limit can end the run early; the next run waits for the next window
+		from = end
+		if now := time.Now(); now.After(from) {
+			from = now
+		}
+	}
+}
+
+// Runs one live capture and returns its record. Scheduled runs pass the window they
+// belong to, which also makes the run unattended: it ends without waiting for Enter.
+func startCapture(interfaceNames []string, filter string, verbose, retain bool, limits capture.Limits, sampling capture.SamplingConfig, schedule string, store storage.Storage) (*models.CaptureRun, error) {
 	ClearScreen()
 	fmt.Print(banner)
 
 	// Initialize default configuration
-	config := capture.DefaultConfig(interfaceName)
+	config := capture.DefaultConfig(interfaceNames[0])
+	if len(interfaceNames) > 1 {
+		config.Interfaces = interfaceNames
+	}
 	config.BPFFilter = filter
+	config.Limits = limits
+	config.Sampling = sampling
+	if retain {
+		config.RingBuffer = capture.DefaultRingBufferConfig()
+	}
 
 	// Initialize the packet capture engine
 	engine, err := capture.NewEngine(config, store)
 	if err != nil {
-		return fmt.Errorf("failed to create capture engine: %w", err)
+		return nil, fmt.Errorf("failed to create capture engine: %w", err)
 	}
 	defer engine.Stop()
 
+	// Get local interface IP for display (first capture interface with IPv4)
+	localDeviceIP = ""
+	for _, name := range interfaceNames {
+		ifaceInfo, err := capture.FindInterface(name)
+		if err != nil {
+			continue
+		}
+		for _, addr := range ifaceInfo.Addresses {
+			if strings.Contains(addr, ".") {
+				localDeviceIP = addr
+				break
+			}
+		}
+		if localDeviceIP != "" {
+			break
+		}
+	}
+	if verbose {
+		fmt.Printf("ℹ️  Local IP detected: %s\n", localDeviceIP)
+	}
+
+	showInterface = len(interfaceNames) > 1
+	defer func() { showInterface = false }()
+
+	run := &models.CaptureRun{
+		Mode:     "live",
+		Source:   strings.Join(interfaceNames, ", "),
+		Filter:   filter,
+		Schedule: schedule,
+	}
+	return run, runCapture(engine, run, limits, verbose, store)
+}
+
+// Drives an initialized engine until the user interrupts it, its source is exhausted or
+// a limit is reached, then records the run. Shared by live capture, offline replay and
+// streams so all of them print, persist and record identically.
+func runCapture(engine *capture.Engine, run *models.CaptureRun, limits capture.Limits, verbose bool, store storage.Storage) error {
+	source, filter := run.Source, run.Filter
+	run.DurationLimit = limits.Duration
+	run.PacketLimit = limits.Packets
+	run.ByteLimit = limits.Bytes
+	run.StartedAt = time.Now()
+
 	// Ensure clean exit on interrupt signal
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
 
 	// Track statistics to calculate rates
 	var lastStats struct {
@@ -254,21 +540,6 @@ func startCapture(interfaceName, filter string, verbose bool, store storage.Stor
 		bytes   uint64
 	}
 
-	// Get local interface IP for display
-	localDeviceIP = ""
-	ifaceInfo, err := capture.FindInterface(interfaceName)
-	if err == nil && len(ifaceInfo.Addresses) > 0 {
-		for _, addr := range ifaceInfo.Addresses {
-			if strings.Contains(addr, ".") {
-				localDeviceIP = addr
-				break
-			}
-		}
-	}
-	if verbose {
-		fmt.Printf("ℹ️  Local IP detected: %s\n", localDeviceIP)
-	}
-
 	// Periodically report stats and save active flows
 	go func() {
 		ticker := time.NewTicker(5 * time.Second)
@@ -290,21 +561,9 @@ func startCapture(interfaceName, filter string, verbose bool, store storage.Stor
 				lastStats.packets = packets
 				lastStats.bytes = bytes
 
-				// Persist active flows
-			case <-ticker.C:
-				if store != nil {
-					flows := engine.GetActiveFlows()
-					savedCount := 0
-					for _, flow := range flows {
-						// Optimization: only save flows that have updated since last persist
-						if flow.LastSeen.After(flow.LastPersisted) {
-							if err := store.SaveFlow(flow); err == nil {
-								flow.LastPersisted = time.Now()
-								savedCount++
-							}
-						}
-					}
-				}
+				// Persist active flows and the neighbor table
+				persistFlows(engine, store)
+				persistNeighbors(engine, store)
 			}
 		}
 	}()
@@ -319,16 +578,13 @@ func startCapture(interfaceName, filter string, verbose bool, store storage.Stor
 
 		engine.Stats() // Update internal stats (not printed here)
 
-		// Specialized parsing for DNS traffic
-		if parser.IsDNSPacket(info.RawPacket) {
-			query, response, err := parser.ParseDNS(info.RawPacket)
-			if err == nil {
-				if query != nil {
-					printDNSQuery(query, verbose)
-				}
-				if response != nil {
-					printDNSResponse(response, verbose)
-				}
+		// Specialized output for DNS traffic, already parsed by the engine
+		if info.DNSQuery != nil || info.DNSResponse != nil {
+			if info.DNSQuery != nil {
+				printDNSQuery(info.DNSQuery, verbose)
+			}
+			if info.DNSResponse != nil {
+				printDNSResponse(info.DNSResponse, verbose)
 			}
 			return
 		}
@@ -373,10 +629,20 @@ func startCapture(interfaceName, filter string, verbose bool, store storage.Stor
 		errChan <- engine.Start(ctx, packetHandler)
 	}()
 
-	fmt.Printf("🚀 Capturing on %s", interfaceName)
+	if engine.IsOffline() {
+		fmt.Printf("📼 Replaying %s", source)
+	} else if engine.IsStream() {
+		fmt.Printf("📥 Reading pcap stream from %s", source)
+	} else {
+		fmt.Printf("🚀 Capturing on %s", source)
+	}
 	if filter != "" {
 		fmt.Printf(" (filter: %s)", filter)
 	}
+	fmt.Printf("\n   Link type: %s", formatLinkTypes(engine.LinkTypes()))
+	if !limits.IsZero() {
+		fmt.Printf("\n   Limits: %s", limits)
+	}
 	fmt.Println("\n   Press Ctrl+C to stop")
 	fmt.Println()
 	fmt.Println(string(make([]rune, 60)))
@@ -387,30 +653,185 @@ func startCapture(interfaceName, filter string, verbose bool, store storage.Stor
 	case <-sigChan:
 		fmt.Println("\n\n🛑 Stopping capture...")
 		cancel()
+		run.StopReason = models.StopInterrupted
 
-		// Wait a bit for engine to stop
+		// Wait a bit for engine to stop, then save what changed since the last tick
 		time.Sleep(200 * time.Millisecond)
-
-		// Print final stats
-		packets, dropped, bytes := engine.Stats()
-		fmt.Println("\n" + string(make([]rune, 60)))
-		fmt.Println("Final Statistics:")
-		fmt.Printf("  Packets Captured: %d\n", packets)
-		fmt.Printf("  Packets Dropped:  %d\n", dropped)
-		fmt.Printf("  Total Bytes:      %s\n", formatBytes(bytes))
-		fmt.Println(string(make([]rune, 60)))
-
-		PressEnterToContinue()
+		persistFlows(engine, store)
+		persistNeighbors(engine, store)
 
 	case err := <-errChan:
 		if err != nil && err != context.Canceled {
+			run.StopReason = models.StopError
+			recordRun(engine, run, store)
 			return fmt.Errorf("capture error: %w", err)
 		}
+		run.StopReason = models.StopSourceEnded
+
+		// A replayed file can finish before the periodic persistence tick ever fires
+		if limit := engine.LimitReached(); limit != nil {
+			fmt.Printf("\n\n⏱️  Capture stopped: %v\n", limit)
+			run.StopReason = stopReasonForLimit(limit)
+			persistFlows(engine, store)
+			persistNeighbors(engine, store)
+		} else if engine.IsOffline() {
+			fmt.Println("\n\n✅ Replay complete")
+			persistFlows(engine, store)
+			persistNeighbors(engine, store)
+		} else if engine.IsStream() {
+			fmt.Println("\n\n✅ Stream ended")
+			persistFlows(engine, store)
+			persistNeighbors(engine, store)
+		} else {
+			recordRun(engine, run, store)
+			return nil
+		}
+	}
+	recordRun(engine, run, store)
+
+	// Print final stats
+	packets, dropped, bytes := engine.Stats()
+	fmt.Println("\n" + string(make([]rune, 60)))
+	fmt.Println("Final Statistics:")
+	fmt.Printf("  Packets Captured: %d\n", packets)
+	fmt.Printf("  Packets Dropped:  %d\n", dropped)
+	fmt.Printf("  Total Bytes:      %s\n", formatBytes(bytes))
+
+	pipeline := engine.PipelineStats()
+	fmt.Printf("  Link Type:        %s\n", formatLinkTypes(pipeline.LinkTypes))
+	fmt.Printf("  Workers:          %d (queue %d per worker)\n", pipeline.Workers, pipeline.QueueSize)
+	fmt.Printf("  Queue Stalls:     %d reader, %d worker\n", pipeline.ReaderStalls, pipeline.WorkerStalls)
+	if engine.IsStream() {
+		fmt.Printf("  Stream Read:      %s (%d reconnects)\n", formatBytes(pipeline.StreamBytes), pipeline.StreamReconnects)
+	}
+	if pipeline.SampledShed > 0 || pipeline.SamplingEngaged > 0 {
+		fmt.Printf("  Sampling:         %d kept, %d shed (engaged %d times, now 1 in %d)\n",
+			pipeline.SampledKept, pipeline.SampledShed, pipeline.SamplingEngaged, pipeline.SampleRate)
+	}
+	if pipeline.Duplicates > 0 {
+		fmt.Printf("  Bridged Copies:   %d (counted once)\n", pipeline.Duplicates)
+	}
+	if pipeline.DecodeErrors > 0 {
+		fmt.Printf("  Decode Errors:    %d (malformed frames not analysed)\n", pipeline.DecodeErrors)
+	}
+	if pipeline.Fragments > 0 {
+		fmt.Printf("  IP Fragments:     %d (%d datagrams reassembled)\n", pipeline.Fragments, pipeline.Reassembled)
+		fmt.Printf("  Frag Incomplete:  %d\n", pipeline.FragmentsIncomplete)
+		fmt.Printf("  Frag Overlapping: %d\n", pipeline.FragmentsOverlapping)
+	}
+	if pipeline.TCPStreams > 0 {
+		fmt.Printf("  TCP Streams:      %d (%d segments reordered)\n", pipeline.TCPStreams, pipeline.TCPOutOfOrder)
+		fmt.Printf("  Stream Overflows: %d (%d expired, %d evicted)\n", pipeline.TCPOverflows, pipeline.TCPExpired, pipeline.TCPEvicted)
+	}
+	if pipeline.QUICConnections > 0 {
+		fmt.Printf("  QUIC Handshakes:  %d (%d undecryptable)\n", pipeline.QUICConnections, pipeline.QUICUndecryptable)
+	}
+	fmt.Println(string(make([]rune, 60)))
+
+	// Scheduled runs are unattended and go straight on to the next window
+	if run.Schedule == "" {
+		PressEnterToContinue()
 	}
 
 	return nil
 }
 
+// Completes a run with the engine's final statistics and saves it to capture history.
+func recordRun(engine *capture.Engine, run *models.CaptureRun, store storage.Storage) {
+	run.EndedAt = time.Now()
+	run.Packets, run.Dropped, run.Bytes = engine.Stats()
+	if store == nil {
+		return
+	}
+	if err := store.SaveCaptureRun(run); err != nil {
+		fmt.Printf("⚠️  Failed to record capture run: %v\n", err)
+	}
+}
+
+// Maps the limit that ended a capture to the reason recorded for the run.
+func stopReasonForLimit(limit error) string {
+	switch {
+	case errors.Is(limit, capture.ErrPacketLimit):
+		return models.StopPacketLimit
+	case errors.Is(limit, capture.ErrByteLimit):
+		return models.StopByteLimit
+	}
+	return models.StopDurationLimit
+}
+
+// Formats per-interface link types, naming interfaces only when they differ.
+func formatLinkTypes(linkTypes map[string]string) string {
+	names := make([]string, 0, len(linkTypes))
+	distinct := make(map[string]bool)
+	for name, linkType := range linkTypes {
+		names = append(names, name)
+		distinct[linkType] = true
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		if len(distinct) == 1 {
+			return linkTypes[name]
+		}
+		parts = append(parts, fmt.Sprintf("%s on %s", linkTypes[name], name))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Saves flows that changed since they were last written to storage.
+func persistFlows(engine *capture.Engine, store storage.Storage) int {
+	if store == nil {
+		return 0
+	}
+
+	savedCount := 0
+	for _, flow := range engine.GetActiveFlows() {
+		// Optimization: only save flows that have updated since last persist
+		if flow.LastSeen.After(flow.LastPersisted) {
+			if err := store.SaveFlow(flow); err == nil {
+				flow.LastPersisted = flow.LastSeen
+				savedCount++
+			}
+			if hs := flow.TLSHandshake(); hs != nil {
+				if err := store.SaveTLSHandshake(hs); err == nil {
+					flow.TLSHandshakeID = hs.ID
+				}
+			}
+			// The flow is a copy; workers may be updating the original
+			engine.MarkFlowPersisted(flow)
+		}
+	}
+	return savedCount
+}
+
+// Saves the neighbor bindings and routers that changed since the last call. Those
+// that fail to save are kept for the next call.
+func persistNeighbors(engine *capture.Engine, store storage.Storage) int {
+	table := engine.GetNeighborTable()
+	if store == nil || table == nil {
+		return 0
+	}
+
+	savedCount := 0
+	neighbors, routers := table.Changes()
+	for _, n := range neighbors {
+		if err := store.SaveNeighbor(n); err != nil {
+			table.MarkUnsaved(n)
+			continue
+		}
+		savedCount++
+	}
+	for _, advert := range routers {
+		if err := store.SaveRouter(advert); err != nil {
+			table.MarkRouterUnsaved(advert)
+			continue
+		}
+		savedCount++
+	}
+	return savedCount
+}
+
 func printPacketSimple(info capture.PacketInfo) {
 	timestamp := info.Timestamp.Format("15:04:05")
 
@@ -447,8 +868,14 @@ func printPacketSimple(info capture.PacketInfo) {
 		direction = "📥" // Download/Response
 	}
 
+	if showInterface {
+		timestamp = fmt.Sprintf("%s %s", timestamp, info.Interface)
+	}
+
 	// 3. Simplified Output
-	if info.SrcIP != "" && info.DstIP != "" {
+	if info.Neighbor != nil {
+		fmt.Printf("[%s] 🔊 %s\n", timestamp, info.NeighborInfo)
+	} else if info.SrcIP != "" && info.DstIP != "" {
 		// Format: [Time] Dir Proto Source -> Destination (Bytes)
 		fmt.Printf("[%s] %s  %-4s  %s  %s  %s  (%d bytes)\n",
 			timestamp,
@@ -458,8 +885,6 @@ func printPacketSimple(info capture.PacketInfo) {
 			"→",
 			dstLabel,
 			info.Length)
-	} else if info.Protocol == "ARP" {
-		fmt.Printf("[%s] 🔊 ARP: Who has %s? Tell %s\n", timestamp, info.DstIP, info.SrcIP)
 	} else {
 		fmt.Printf("[%s] %s (%d bytes)\n", timestamp, info.Protocol, info.Length)
 	}
@@ -529,12 +954,21 @@ func printPacketVerbose(info capture.PacketInfo) {
 
 	fmt.Println("\n" + string(make([]rune, 60)))
 	fmt.Printf("Timestamp: %s\n", timestamp)
+	if info.Interface != "" {
+		fmt.Printf("Interface: %s\n", info.Interface)
+	}
 	fmt.Printf("Protocol:  %s\n", info.Protocol)
 	fmt.Printf("Length:    %d bytes\n", info.Length)
 
 	if info.EthSrcMAC != "" {
 		fmt.Printf("Ethernet:  %s → %s\n", info.EthSrcMAC, info.EthDstMAC)
 	}
+	if info.VLAN != 0 {
+		fmt.Printf("VLAN:      %d\n", info.VLAN)
+	}
+	if info.Tunnel != "" {
+		fmt.Printf("Tunnel:    %s %d\n", info.Tunnel, info.TunnelID)
+	}
 
 	if info.SrcIP != "" {
 		fmt.Printf("IP:        %s → %s\n", info.SrcIP, info.DstIP)
@@ -542,6 +976,53 @@ func printPacketVerbose(info capture.PacketInfo) {
 			fmt.Printf("Ports:     %d → %d\n", info.SrcPort, info.DstPort)
 		}
 	}
+	if info.TCPSignature != nil {
+		fmt.Printf("TCP sig:   %s\n", parser.FormatTCPSignature(info.TCPSignature))
+	}
+
+	if info.HTTP != nil {
+		fmt.Printf("HTTP:      %s\n", info.HTTPInfo)
+		if info.HTTP.UserAgent != "" {
+			fmt.Printf("UA:        %s\n", info.HTTP.UserAgent)
+		}
+		if info.HTTP.Referer != "" {
+			fmt.Printf("Referer:   %s\n", info.HTTP.Referer)
+		}
+		if info.HTTP.ContentType != "" {
+			fmt.Printf("Type:      %s\n", info.HTTP.ContentType)
+		}
+	}
+
+	if info.DHCP != nil {
+		fmt.Printf("DHCP:      %s\n", info.DHCPInfo)
+		if fingerprint := info.DHCP.Fingerprint(); fingerprint != "" {
+			fmt.Printf("Options:   %s\n", fingerprint)
+		}
+	}
+
+	if info.SSH != nil {
+		fmt.Printf("SSH:       %s\n", info.SSHInfo)
+		if info.SSH.Banner != "" {
+			fmt.Printf("Banner:    %s\n", info.SSH.Banner)
+		}
+		if algorithms := info.SSH.HASSHAlgorithms(); algorithms != "" {
+			fmt.Printf("Offered:   %s\n", algorithms)
+		}
+	}
+
+	if info.Neighbor != nil {
+		fmt.Printf("%-10s %s\n", info.Neighbor.Protocol+":", info.NeighborInfo)
+	}
+
+	if info.Discovery != nil {
+		fmt.Printf("%-10s %s\n", info.Discovery.Protocol+":", info.DiscoveryInfo)
+		if info.Discovery.Server != "" {
+			fmt.Printf("Server:    %s\n", info.Discovery.Server)
+		}
+		if info.Discovery.Location != "" {
+			fmt.Printf("Location:  %s\n", info.Discovery.Location)
+		}
+	}
 
 	// Print Privacy Alerts
 	if len(info.PrivacyIssues) > 0 {
@@ -567,6 +1048,17 @@ func printDNSQuery(query *parser.DNSQuery, verbose bool) {
 		fmt.Printf("Type:      DNS Query\n")
 		fmt.Printf("Query:     %s\n", query.QueryName)
 		fmt.Printf("Type:      %s\n", query.QueryType)
+		for i, q := range query.Questions {
+			if i > 0 {
+				fmt.Printf("Query:     %s (%s)\n", q.Name, q.Type)
+			}
+		}
+		if flags := query.Flags.String(); flags != "" {
+			fmt.Printf("Flags:     %s\n", flags)
+		}
+		if query.EDNS != nil {
+			fmt.Printf("EDNS:      %s\n", query.EDNS)
+		}
 		fmt.Printf("From:      %s\n", query.SrcIP)
 		fmt.Printf("To:        %s\n", query.DstIP)
 		fmt.Printf("TX ID:     %d\n", query.TransactionID)
@@ -589,6 +1081,21 @@ func printDNSResponse(response *parser.DNSResponse, verbose bool) {
 	}
 }
 
+// Parses a byte count with an optional binary unit suffix, e.g. "500MB" or "2 GB".
+func parseByteSize(input string) (uint64, error) {
+	text := strings.ToUpper(strings.TrimSpace(input))
+	number := strings.TrimRight(text, "KMGTB ")
+	unit := strings.TrimSpace(text[len(number):])
+
+	multipliers := map[string]uint64{"": 1, "B": 1, "KB": 1 << 10, "MB": 1 << 20, "GB": 1 << 30, "TB": 1 << 40}
+	multiplier, ok := multipliers[unit]
+	value, err := strconv.ParseUint(strings.TrimSpace(number), 10, 64)
+	if !ok || err != nil {
+		return 0, fmt.Errorf("invalid byte count %q", input)
+	}
+	return value * multiplier, nil
+}
+
 func formatBytes(bytes uint64) string {
 	const unit = 1024
 	if bytes < unit {
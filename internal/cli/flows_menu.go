@@ -13,6 +13,7 @@ package cli
 import (
 	"fmt"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/kleaSCM/netscope/internal/capture"
@@ -132,12 +133,24 @@ func printFlowDetails(f *models.Flow, index int) {
 
 	// Protocol and Application
 	fmt.Printf("    Protocol: %s", f.Protocol)
+	if f.QUICVersion != "" {
+		fmt.Printf(" (%s)", f.QUICVersion)
+	}
 	if f.Application != "" {
 		fmt.Printf(" | App: %s", f.Application)
 	}
 	if f.TrafficClass != "" {
 		fmt.Printf(" | Class: %s", f.TrafficClass)
 	}
+	if f.Interface != "" {
+		fmt.Printf(" | Iface: %s", f.Interface)
+	}
+	if f.Key.VLAN != 0 {
+		fmt.Printf(" | VLAN: %d", f.Key.VLAN)
+	}
+	if f.Tunnel != "" {
+		fmt.Printf(" | %s: %d", f.Tunnel, f.Key.TunnelID)
+	}
 	fmt.Println()
 
 	// Geographic info
@@ -155,14 +168,72 @@ func printFlowDetails(f *models.Flow, index int) {
 	// TLS info
 	if f.JA3 != "" {
 		fmt.Printf("    TLS JA3: %s", f.JA3[:16]+"...")
+		if f.JA3S != "" {
+			fmt.Printf(" | JA3S: %s", f.JA3S[:16]+"...")
+		}
 		if f.JA3Application != "" {
 			fmt.Printf(" (%s)", f.JA3Application)
 		}
 		fmt.Println()
 	}
+	if f.JA4 != "" || f.JA4H != "" {
+		fmt.Printf("    JA4: %s", f.JA4)
+		if f.JA4S != "" {
+			fmt.Printf(" | JA4S: %s", f.JA4S)
+		}
+		if f.JA4H != "" {
+			fmt.Printf(" | JA4H: %s", f.JA4H)
+		}
+		fmt.Println()
+	}
+	if f.TLSVersion != "" {
+		fmt.Printf("    TLS: %s, %s\n", f.TLSVersion, f.TLSCipherSuite)
+	}
+	if hello := f.ClientHello; hello != nil {
+		fmt.Printf("    Offered: %s", strings.Join(hello.SupportedVersions, ", "))
+		if hello.OffersLegacyVersion() {
+			fmt.Print(" [legacy TLS]")
+		}
+		if len(hello.ALPN) > 0 {
+			fmt.Printf(" | ALPN: %s", strings.Join(hello.ALPN, ", "))
+			if f.TLSALPN != "" {
+				fmt.Printf(" (selected %s)", f.TLSALPN)
+			}
+		}
+		if hello.ECH {
+			fmt.Print(" | ECH")
+		}
+		if hello.GREASE {
+			fmt.Print(" | GREASE")
+		}
+		fmt.Println()
+	}
+	if f.SSHClient != "" || f.SSHServer != "" || f.HASSH != "" || f.HASSHServer != "" {
+		fmt.Printf("    SSH: %s → %s", orUnknown(f.SSHClient), orUnknown(f.SSHServer))
+		if f.HASSH != "" {
+			fmt.Printf(" | HASSH: %s", f.HASSH)
+		}
+		if f.HASSHServer != "" {
+			fmt.Printf(" | HASSHServer: %s", f.HASSHServer)
+		}
+		fmt.Println()
+	}
+	if cert := f.Certificate; cert != nil {
+		fmt.Printf("    Cert: %s | Issuer: %s | Valid: %s to %s\n", cert.Subject, cert.Issuer,
+			cert.NotBefore.Format("2006-01-02"), cert.NotAfter.Format("2006-01-02"))
+		if cert.JA4X != "" {
+			fmt.Printf("    JA4X: %s\n", cert.JA4X)
+		}
+		if len(cert.SANs) > 0 {
+			fmt.Printf("    SANs: %s\n", strings.Join(cert.SANs, ", "))
+		}
+	}
 
 	// Traffic stats
 	fmt.Printf("    Stats: %d packets, %s", f.PacketCount, formatBytes(f.ByteCount))
+	if f.Sampled {
+		fmt.Print(" (estimated from samples)")
+	}
 	fmt.Printf(" | Duration: %s | Idle: %s\n", formatDuration(duration), formatDuration(age))
 
 	fmt.Println()
@@ -181,6 +252,14 @@ func formatDuration(d time.Duration) string {
 	return fmt.Sprintf("%.1fh", d.Hours())
 }
 
+// Returns s, or "?" for a side whose SSH software was not seen.
+func orUnknown(s string) string {
+	if s == "" {
+		return "?"
+	}
+	return s
+}
+
 // return top N entries from a map sorted by value
 func sortMapByValue(m map[string]int, topN int) map[string]int {
 	type kv struct {
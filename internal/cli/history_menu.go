@@ -0,0 +1,67 @@
+/**
+ * Capture History Menu Implementation.
+ *
+ * Lists recorded capture runs with the limits and schedule each ran
+ * under, why it stopped, and its final statistics, so the outcome of
+ * unattended captures can be reviewed afterwards.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kleaSCM/netscope/internal/capture"
+	"github.com/kleaSCM/netscope/internal/storage"
+)
+
+// Number of runs shown, newest first.
+const historyLimit = 25
+
+// Displays the most recent capture runs.
+func ShowCaptureHistory(store storage.Storage) error {
+	ClearScreen()
+	fmt.Println(GetBanner())
+	fmt.Println("Capture History")
+	fmt.Println(string(make([]rune, 60)))
+
+	runs, err := store.ListCaptureRuns(historyLimit)
+	if err != nil {
+		return fmt.Errorf("failed to load capture history: %w", err)
+	}
+	if len(runs) == 0 {
+		fmt.Println("\nNo captures recorded yet.")
+		PressEnterToContinue()
+		return nil
+	}
+
+	headers := []string{"Started", "Mode", "Source", "Ran For", "Limits", "Schedule", "Stopped By", "Packets", "Dropped", "Bytes"}
+	rows := make([][]string, 0, len(runs))
+	for _, run := range runs {
+		limits := capture.Limits{Duration: run.DurationLimit, Packets: run.PacketLimit, Bytes: run.ByteLimit}
+		schedule := run.Schedule
+		if schedule == "" {
+			schedule = "-"
+		}
+		rows = append(rows, []string{
+			run.StartedAt.Local().Format("2006-01-02 15:04"),
+			run.Mode,
+			run.Source,
+			run.EndedAt.Sub(run.StartedAt).Round(time.Second).String(),
+			limits.String(),
+			schedule,
+			run.StopReason,
+			fmt.Sprintf("%d", run.Packets),
+			fmt.Sprintf("%d", run.Dropped),
+			formatBytes(run.Bytes),
+		})
+	}
+
+	Table(headers, rows)
+	PressEnterToContinue()
+	return nil
+}
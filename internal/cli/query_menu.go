@@ -12,7 +12,10 @@ package cli
 
 import (
 	"fmt"
+	"strings"
 
+	"github.com/kleaSCM/netscope/internal/models"
+	"github.com/kleaSCM/netscope/internal/parser"
 	"github.com/kleaSCM/netscope/internal/storage"
 )
 
@@ -23,9 +26,18 @@ func ShowQueryMenu(store storage.Storage) error {
 	menu.AddOption("List Devices", func() error {
 		return listDevices(store)
 	})
+	menu.AddOption("Device Address History", func() error {
+		return listDeviceIPs(store)
+	})
 	menu.AddOption("List Recent Flows", func() error {
 		return listRecentFlows(store)
 	})
+	menu.AddOption("Neighbor Table", func() error {
+		return listNeighbors(store)
+	})
+	menu.AddOption("IPv6 Routers", func() error {
+		return listRouters(store)
+	})
 	menu.AddOption("Back to Main Menu", func() error { return ErrExitMenu })
 
 	return menu.Display()
@@ -46,7 +58,7 @@ func listDevices(store storage.Storage) error {
 		fmt.Println("\nNo devices found in database.")
 	} else {
 		// Table Headers
-		headers := []string{"ID", "IP Address", "MAC Address", "Vendor", "Last Seen"}
+		headers := []string{"ID", "IP Address", "MAC Address", "Hostname", "Vendor", "OS", "Last Seen"}
 		rows := make([][]string, 0)
 
 		for _, d := range devices {
@@ -54,7 +66,9 @@ func listDevices(store storage.Storage) error {
 				fmt.Sprintf("%d", d.ID),
 				d.IPAddress,
 				d.MACAddress,
+				d.Hostname,
 				d.Vendor,
+				formatOS(d),
 				d.LastSeen.Format("2006-01-02 15:04:05"),
 			})
 		}
@@ -65,6 +79,144 @@ func listDevices(store storage.Storage) error {
 	return nil
 }
 
+// Returns a device's OS with the confidence of the source that named it.
+func formatOS(d *models.Device) string {
+	if d.OSConfidence == 0 {
+		return d.OSFingerprint
+	}
+	return fmt.Sprintf("%s (%d%%)", d.OSFingerprint, d.OSConfidence)
+}
+
+// Lists the addresses a device has used, from its DHCP leases, ARP and NDP
+// announcements and observed traffic.
+func listDeviceIPs(store storage.Storage) error {
+	id, err := PromptInt("Device ID: ")
+	if err != nil {
+		ShowMessage("⚠️  Enter the device ID shown in the device list.")
+		return nil
+	}
+
+	ClearScreen()
+	fmt.Println(GetBanner())
+	fmt.Printf("Address History of Device %d\n", id)
+	fmt.Println(string(make([]rune, 60)))
+
+	ips, err := store.ListDeviceIPs(int64(id))
+	if err != nil {
+		return fmt.Errorf("failed to list device addresses: %w", err)
+	}
+
+	if len(ips) == 0 {
+		fmt.Println("\nNo addresses recorded for this device.")
+	} else {
+		headers := []string{"IP Address", "Source", "First Seen", "Last Seen", "Lease Expires"}
+		rows := make([][]string, 0)
+
+		for _, ip := range ips {
+			lease := ""
+			if !ip.LeaseExpires.IsZero() {
+				lease = ip.LeaseExpires.Format("2006-01-02 15:04:05")
+			}
+			rows = append(rows, []string{
+				ip.IPAddress,
+				ip.Source,
+				ip.FirstSeen.Format("2006-01-02 15:04:05"),
+				ip.LastSeen.Format("2006-01-02 15:04:05"),
+				lease,
+			})
+		}
+		Table(headers, rows)
+	}
+
+	PressEnterToContinue()
+	return nil
+}
+
+// Lists the IP to MAC bindings learned from ARP and NDP, marking addresses claimed
+// by more than one MAC.
+func listNeighbors(store storage.Storage) error {
+	ClearScreen()
+	fmt.Println(GetBanner())
+	fmt.Println("Neighbor Table")
+	fmt.Println(string(make([]rune, 60)))
+
+	neighbors, err := store.ListNeighbors()
+	if err != nil {
+		return fmt.Errorf("failed to list neighbors: %w", err)
+	}
+
+	if len(neighbors) == 0 {
+		fmt.Println("\nNo neighbors found in database.")
+	} else {
+		macs := make(map[string]int)
+		for _, n := range neighbors {
+			macs[n.IPAddress]++
+		}
+
+		headers := []string{"IP Address", "MAC Address", "VLAN", "Proto", "Gratuitous", "Probes", "First Seen", "Last Seen", "Notes"}
+		rows := make([][]string, 0)
+
+		for _, n := range neighbors {
+			var notes []string
+			if n.Router {
+				notes = append(notes, "router")
+			}
+			if count := macs[n.IPAddress]; count > 1 {
+				notes = append(notes, fmt.Sprintf("⚠️  %d MACs", count))
+			}
+			rows = append(rows, []string{
+				n.IPAddress,
+				n.MACAddress,
+				fmt.Sprintf("%d", n.VLAN),
+				n.Protocol,
+				fmt.Sprintf("%d", n.Gratuitous),
+				fmt.Sprintf("%d", n.Probes),
+				n.FirstSeen.Format("2006-01-02 15:04:05"),
+				n.LastSeen.Format("2006-01-02 15:04:05"),
+				strings.Join(notes, ", "),
+			})
+		}
+		Table(headers, rows)
+	}
+
+	PressEnterToContinue()
+	return nil
+}
+
+// Lists the IPv6 routers seen and what each last advertised.
+func listRouters(store storage.Storage) error {
+	ClearScreen()
+	fmt.Println(GetBanner())
+	fmt.Println("IPv6 Routers")
+	fmt.Println(string(make([]rune, 60)))
+
+	routers, err := store.ListRouters()
+	if err != nil {
+		return fmt.Errorf("failed to list routers: %w", err)
+	}
+
+	if len(routers) == 0 {
+		fmt.Println("\nNo router advertisements found in database.")
+	} else {
+		headers := []string{"Router", "MAC Address", "VLAN", "Advertises", "Last Seen"}
+		rows := make([][]string, 0)
+
+		for _, r := range routers {
+			rows = append(rows, []string{
+				r.RouterIP,
+				r.RouterMAC,
+				fmt.Sprintf("%d", r.VLAN),
+				parser.FormatRouterAdvertisement(r),
+				r.LastSeen.Format("2006-01-02 15:04:05"),
+			})
+		}
+		Table(headers, rows)
+	}
+
+	PressEnterToContinue()
+	return nil
+}
+
 func listRecentFlows(store storage.Storage) error {
 	ClearScreen()
 	fmt.Println(GetBanner())
@@ -80,17 +232,18 @@ func listRecentFlows(store storage.Storage) error {
 		fmt.Println("\nNo flows found in database.")
 	} else {
 		// Table Headers
-		headers := []string{"Time", "Source", "Destination", "Proto", "App", "Bytes"}
+		headers := []string{"Time", "Iface", "Source", "Destination", "Proto", "App", "Bytes"}
 		rows := make([][]string, 0)
 
 		for _, f := range flows {
 			rows = append(rows, []string{
 				f.FirstSeen.Format("15:04:05"),
+				f.Interface,
 				fmt.Sprintf("%s:%d", f.Key.SrcIP, f.Key.SrcPort),
 				fmt.Sprintf("%s:%d", f.Key.DstIP, f.Key.DstPort),
 				f.Key.Protocol,
 				f.Protocol, // App protocol
-				fmt.Sprintf("%d", f.ByteCount),
+				formatFlowBytes(f),
 			})
 		}
 		Table(headers, rows)
@@ -99,3 +252,11 @@ func listRecentFlows(store storage.Storage) error {
 	PressEnterToContinue()
 	return nil
 }
+
+// Formats a stored flow's byte count, marking estimates from sampled packets with "~".
+func formatFlowBytes(f *models.Flow) string {
+	if f.Sampled {
+		return fmt.Sprintf("~%d", f.ByteCount)
+	}
+	return fmt.Sprintf("%d", f.ByteCount)
+}
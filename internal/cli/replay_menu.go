@@ -0,0 +1,99 @@
+/**
+ * Capture Replay Menu Implementation.
+ *
+ * Provides the interactive UI for replaying .pcap and .pcapng files
+ * through the analysis pipeline, either as fast as possible or paced
+ * to match the original capture timing.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kleaSCM/netscope/internal/capture"
+	"github.com/kleaSCM/netscope/internal/models"
+	"github.com/kleaSCM/netscope/internal/storage"
+)
+
+// Displays the replay menu and runs an offline capture from a file on disk.
+func ShowReplayMenu(store storage.Storage) error {
+	path, err := Prompt("Path to .pcap/.pcapng file: ")
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		return nil
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("cannot read capture file: %w", err)
+	}
+
+	realtime, err := selectReplayPacing()
+	if err != nil {
+		return err
+	}
+
+	filter, err := selectFilter()
+	if err != nil {
+		return err
+	}
+
+	verbose := selectOutputMode()
+
+	ClearScreen()
+	fmt.Print(banner)
+	fmt.Println("Replay Configuration:")
+	fmt.Println(string(make([]rune, 60)))
+	fmt.Printf("  File:   %s\n", path)
+	fmt.Printf("  Pacing: %s\n", map[bool]string{true: "Real-time", false: "As fast as possible"}[realtime])
+	if filter != "" {
+		fmt.Printf("  Filter: %s\n", filter)
+	}
+	fmt.Printf("  Mode:   %s\n", map[bool]string{true: "Verbose", false: "Simple"}[verbose])
+	fmt.Println()
+
+	if !Confirm("Start replay with these settings?") {
+		return nil
+	}
+
+	return startReplay(path, filter, realtime, verbose, store)
+}
+
+func selectReplayPacing() (bool, error) {
+	options := []string{
+		"As fast as possible (forensics)",
+		"Real-time (reproduce original packet timing)",
+	}
+
+	idx, err := Select("Select Replay Pacing:", options)
+	if err != nil {
+		return false, err
+	}
+	return idx == 1, nil
+}
+
+func startReplay(path, filter string, realtime, verbose bool, store storage.Storage) error {
+	ClearScreen()
+	fmt.Print(banner)
+
+	config := capture.DefaultConfig("")
+	config.ReplayRealtime = realtime
+	config.BPFFilter = filter
+
+	engine, err := capture.NewOfflineEngine(path, config, store)
+	if err != nil {
+		return fmt.Errorf("failed to create replay engine: %w", err)
+	}
+	defer engine.Stop()
+
+	// There is no local interface to label as "My Device" when replaying
+	localDeviceIP = ""
+
+	return runCapture(engine, &models.CaptureRun{Mode: "replay", Source: path, Filter: filter}, capture.Limits{}, verbose, store)
+}
@@ -0,0 +1,82 @@
+/**
+ * Pcap Stream Menu Implementation.
+ *
+ * Provides the interactive UI for analysing a pcap stream written into a
+ * named pipe, typically by `tcpdump -w -` running on a remote appliance
+ * over ssh. Streams on stdin are started from the command line instead,
+ * since the menu itself reads stdin.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kleaSCM/netscope/internal/capture"
+	"github.com/kleaSCM/netscope/internal/models"
+	"github.com/kleaSCM/netscope/internal/storage"
+)
+
+// Displays the stream menu and captures from a named pipe.
+func ShowStreamMenu(store storage.Storage) error {
+	path, err := Prompt("Path to named pipe (create with mkfifo): ")
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		return nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("cannot read pcap stream: %w", err)
+	}
+	if info.Mode()&os.ModeNamedPipe == 0 {
+		return fmt.Errorf("%s is not a named pipe; use Replay Capture File for saved captures", path)
+	}
+
+	verbose := selectOutputMode()
+
+	ClearScreen()
+	fmt.Print(banner)
+	fmt.Println("Stream Configuration:")
+	fmt.Println(string(make([]rune, 60)))
+	fmt.Printf("  Pipe: %s\n", path)
+	fmt.Printf("  Mode: %s\n", map[bool]string{true: "Verbose", false: "Simple"}[verbose])
+	fmt.Println()
+	fmt.Printf("  Example: ssh appliance 'tcpdump -U -w - -i eth0' > %s\n", path)
+	fmt.Println()
+
+	if !Confirm("Start reading with these settings?") {
+		return nil
+	}
+
+	return RunStream(path, verbose, store)
+}
+
+// Captures from a pcap stream on stdin ("-") or a named pipe until it ends or is interrupted.
+func RunStream(path string, verbose bool, store storage.Storage) error {
+	ClearScreen()
+	fmt.Print(banner)
+
+	name := path
+	if path == capture.StdinPath {
+		name = "stdin"
+	}
+	fmt.Printf("⏳ Waiting for the pcap header on %s...\n", name)
+
+	engine, err := capture.NewStreamEngine(path, capture.DefaultConfig(""), store)
+	if err != nil {
+		return fmt.Errorf("failed to create stream engine: %w", err)
+	}
+	defer engine.Stop()
+
+	// The capturing host is remote, so no local interface can be labelled "My Device"
+	localDeviceIP = ""
+
+	return runCapture(engine, &models.CaptureRun{Mode: "stream", Source: name}, capture.Limits{}, verbose, store)
+}
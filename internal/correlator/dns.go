@@ -37,6 +37,12 @@ func NewDNSCache() *DNSCache {
 
 // Inserts or updates a DNS record in the cache.
 func (C *DNSCache) Add(Domain string, IPS []string, TTL uint32) {
+	C.AddAt(Domain, IPS, TTL, time.Now())
+}
+
+// Inserts a DNS record whose lifetime starts at the supplied observation time.
+// Offline replay passes packet timestamps here so TTLs expire on capture time, not wall-clock time.
+func (C *DNSCache) AddAt(Domain string, IPS []string, TTL uint32, Observed time.Time) {
 	C.mutex.Lock()
 	defer C.mutex.Unlock() // Ensure safe concurrent access
 
@@ -46,7 +52,7 @@ func (C *DNSCache) Add(Domain string, IPS []string, TTL uint32) {
 		effectiveTTL = 300
 	}
 
-	Expiry := time.Now().Add(time.Duration(effectiveTTL) * time.Second)
+	Expiry := Observed.Add(time.Duration(effectiveTTL) * time.Second)
 
 	for _, IP := range IPS {
 		// Store/Update mapping to ensure latest resolution is used
@@ -59,6 +65,11 @@ func (C *DNSCache) Add(Domain string, IPS []string, TTL uint32) {
 
 // Looks up the domain name for a given IP address.
 func (C *DNSCache) Resolve(IP string) string {
+	return C.ResolveAt(IP, time.Now())
+}
+
+// Looks up the domain name for an IP address as of the supplied observation time.
+func (C *DNSCache) ResolveAt(IP string, Observed time.Time) string {
 	C.mutex.RLock()
 	defer C.mutex.RUnlock()
 
@@ -68,7 +79,7 @@ func (C *DNSCache) Resolve(IP string) string {
 	}
 
 	// Validate expiration to ensure we don't return stale data
-	if time.Now().After(Entry.ExpiresAt) {
+	if Observed.After(Entry.ExpiresAt) {
 		return ""
 	}
 
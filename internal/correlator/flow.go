@@ -11,6 +11,7 @@
 package correlator
 
 import (
+	"hash/fnv"
 	"sync"
 	"time"
 
@@ -18,15 +19,24 @@ import (
 	"github.com/kleaSCM/netscope/internal/models"
 )
 
+// Number of independently locked partitions in the flow table. A power of two
+// comfortably above typical worker counts keeps lock contention negligible.
+const flowTableShards = 64
+
 // Manages active network flows.
 type FlowTable struct {
-	flows         map[models.FlowKey]*models.Flow
+	shards        [flowTableShards]flowShard
 	dnsCache      *DNSCache
 	geoIP         *enricher.GeoIPService
 	ja3DB         *enricher.JA3Database
 	appIdentifier *enricher.ApplicationIdentifier
 	classifier    *enricher.TrafficClassifier
-	mu            sync.RWMutex
+}
+
+// One lock-striped partition of the flow table.
+type flowShard struct {
+	flows map[models.FlowKey]*models.Flow
+	mu    sync.RWMutex
 }
 
 // Creates a new flow table.
@@ -34,14 +44,50 @@ func NewFlowTable(geoIP *enricher.GeoIPService) *FlowTable {
 	ja3DB := enricher.NewJA3Database()
 	appID := enricher.NewApplicationIdentifier(ja3DB)
 
-	return &FlowTable{
-		flows:         make(map[models.FlowKey]*models.Flow),
+	table := &FlowTable{
 		dnsCache:      NewDNSCache(),
 		geoIP:         geoIP,
 		ja3DB:         ja3DB,
 		appIdentifier: appID,
 		classifier:    enricher.NewTrafficClassifier(appID),
 	}
+	for i := range table.shards {
+		table.shards[i].flows = make(map[models.FlowKey]*models.Flow)
+	}
+	return table
+}
+
+// Selects the partition owning a flow key.
+func (FT *FlowTable) shardFor(Key models.FlowKey) *flowShard {
+	Hash := fnv.New32a()
+	Hash.Write([]byte(Key.SrcIP))
+	Hash.Write([]byte(Key.DstIP))
+	Hash.Write([]byte{byte(Key.SrcPort >> 8), byte(Key.SrcPort), byte(Key.DstPort >> 8), byte(Key.DstPort)})
+	Hash.Write([]byte(Key.Protocol))
+	Hash.Write([]byte{byte(Key.VLAN >> 8), byte(Key.VLAN), byte(Key.TunnelID >> 24), byte(Key.TunnelID >> 16), byte(Key.TunnelID >> 8), byte(Key.TunnelID)})
+	return &FT.shards[Hash.Sum32()%flowTableShards]
+}
+
+// Records the addresses from a DNS response so later flows to them can be labelled
+// with the queried domain. Exposed separately from Update so a capture pipeline can
+// prime the cache before the response and the connection it enables are processed
+// concurrently.
+func (FT *FlowTable) ObserveDNS(DNS *models.DNS, Observed time.Time) {
+	if DNS == nil || DNS.Type != "Response" {
+		return
+	}
+
+	var IPS []string
+	for _, Answer := range DNS.Answers {
+		if Answer.IP != "" {
+			IPS = append(IPS, Answer.IP)
+		}
+	}
+
+	if len(IPS) > 0 {
+		// Use the TTL from the first answer record to define relevance duration
+		FT.dnsCache.AddAt(DNS.Query, IPS, DNS.Answers[0].TTL, Observed)
+	}
 }
 
 // Processes a packet and updates the corresponding flow.
@@ -51,29 +97,20 @@ func (FT *FlowTable) Update(Packet *models.Packet) *models.Flow {
 	}
 
 	// Inspect DNS responses to populate the cache for future correlation
-	if Packet.DNS != nil && Packet.DNS.Type == "Response" {
-		var IPS []string
-		for _, Answer := range Packet.DNS.Answers {
-			if Answer.IP != "" {
-				IPS = append(IPS, Answer.IP)
-			}
-		}
-
-		if len(IPS) > 0 {
-			// Use the TTL from the first answer record to define relevance duration
-			FT.dnsCache.Add(Packet.DNS.Query, IPS, Packet.DNS.Answers[0].TTL)
-		}
-	}
+	FT.ObserveDNS(Packet.DNS, Packet.Timestamp)
 
 	Key := makeFlowKey(Packet)
+	Shard := FT.shardFor(Key)
 
-	FT.mu.Lock()
-	defer FT.mu.Unlock()
+	Shard.mu.Lock()
+	defer Shard.mu.Unlock()
 
-	Flow, Exists := FT.flows[Key]
+	Flow, Exists := Shard.flows[Key]
 	if !Exists {
 		Flow = &models.Flow{
 			Key:       Key,
+			Interface: Packet.Interface,
+			Tunnel:    Packet.Tunnel,
 			FirstSeen: Packet.Timestamp,
 			Protocol:  Packet.Layer4.Protocol,
 		}
@@ -81,8 +118,8 @@ func (FT *FlowTable) Update(Packet *models.Packet) *models.Flow {
 		// Attempt to correlate domain name for the new flow
 		// Check both source and destination IPs since the flow key canonicalization
 		// might obscure which end is the "destination" in a bidirectional sense.
-		Domain1 := FT.dnsCache.Resolve(Key.SrcIP)
-		Domain2 := FT.dnsCache.Resolve(Key.DstIP)
+		Domain1 := FT.dnsCache.ResolveAt(Key.SrcIP, Packet.Timestamp)
+		Domain2 := FT.dnsCache.ResolveAt(Key.DstIP, Packet.Timestamp)
 
 		if Domain1 != "" {
 			Flow.DstDomain = Domain1
@@ -112,54 +149,150 @@ func (FT *FlowTable) Update(Packet *models.Packet) *models.Flow {
 			}
 		}
 
-		FT.flows[Key] = Flow
+		Shard.flows[Key] = Flow
 	}
 
-	// Update stats
+	// Update stats. A sampled packet stands for the packets shed around it.
 	Flow.LastSeen = Packet.Timestamp
-	Flow.PacketCount++
-	Flow.ByteCount += uint64(Packet.Length)
+	if Packet.Sampling > 1 {
+		Flow.Sampled = true
+		Flow.PacketCount += uint64(Packet.Sampling)
+		Flow.ByteCount += uint64(Packet.Length) * uint64(Packet.Sampling)
+	} else {
+		Flow.PacketCount++
+		Flow.ByteCount += uint64(Packet.Length)
+	}
 
-	// Update enriched info if available
+	// Update enriched info if available. The first SNI, JA3 or Host seen refines the
+	// port-based identification made when the flow opened.
+	refine := false
 	if Packet.DNS != nil && Flow.DNSQuery == "" {
 		Flow.DNSQuery = Packet.DNS.Query
 	}
-	if Packet.TLS != nil && Flow.TLSSNI == "" {
+	if Packet.QUIC != nil && Flow.QUICVersion == "" {
+		Flow.Protocol = "QUIC"
+		Flow.QUICVersion = Packet.QUIC.Version
+	}
+	if Packet.TLS != nil && Flow.TLSSNI == "" && Packet.TLS.SNI != "" {
 		Flow.TLSSNI = Packet.TLS.SNI
+		refine = true
 	}
-	if Packet.TLS != nil && Flow.JA3 == "" {
+	if Packet.TLS != nil && Flow.JA3 == "" && Packet.TLS.JA3 != "" {
 		Flow.JA3 = Packet.TLS.JA3
+		refine = true
 		// Lookup application from JA3 database
-		if Flow.JA3 != "" && FT.ja3DB != nil {
+		if FT.ja3DB != nil {
 			Flow.JA3Application = FT.ja3DB.Lookup(Flow.JA3)
 		}
 	}
+	if Packet.TLS != nil && Packet.TLS.ClientHello != nil && Flow.ClientHello == nil {
+		Flow.ClientHello = Packet.TLS.ClientHello
+	}
+	if Packet.TLS != nil && Flow.JA4 == "" && Packet.TLS.JA4 != "" {
+		Flow.JA4 = Packet.TLS.JA4
+		refine = true
+		if FT.ja3DB != nil && Flow.JA3Application == "" {
+			Flow.JA3Application = FT.ja3DB.LookupJA4(Flow.JA4)
+		}
+	}
+	if Packet.TLS != nil && Packet.TLS.ServerHello && Flow.JA3S == "" {
+		Flow.JA3S = Packet.TLS.JA3S
+		Flow.JA4S = Packet.TLS.JA4S
+		Flow.TLSVersion = Packet.TLS.Version
+		Flow.TLSCipherSuite = Packet.TLS.CipherSuite
+		Flow.TLSALPN = Packet.TLS.ALPN
+		refine = true
+	}
+	if Packet.TLS != nil && Packet.TLS.Certificate != nil && Flow.Certificate == nil {
+		Flow.Certificate = Packet.TLS.Certificate
+		Flow.JA4X = Packet.TLS.Certificate.JA4X
+		refine = true
+	}
+	// A known client and server pair names the application more precisely than the
+	// client alone, whose ClientHello may mimic a browser
+	if refine && FT.ja3DB != nil && Flow.JA3 != "" && Flow.JA3S != "" {
+		if App := FT.ja3DB.LookupPair(Flow.JA3, Flow.JA3S); App != "" {
+			Flow.JA3Application = App
+		}
+	}
+	if Packet.HTTP != nil {
+		if Packet.HTTP.IsRequest {
+			if Flow.HTTPHost == "" && Packet.HTTP.Host != "" {
+				Flow.HTTPHost = Packet.HTTP.Host
+				refine = true
+			}
+			if Flow.HTTPUserAgent == "" {
+				Flow.HTTPUserAgent = Packet.HTTP.UserAgent
+			}
+			if Flow.JA4H == "" && Packet.HTTP.JA4H != "" {
+				Flow.JA4H = Packet.HTTP.JA4H
+				refine = true
+			}
+		} else if Flow.HTTPServer == "" {
+			Flow.HTTPServer = Packet.HTTP.Server
+		}
+	}
 
-	// Application Identification (combines JA3, domain, port)
-	if Flow.Application == "" && FT.appIdentifier != nil {
-		Flow.Application = FT.appIdentifier.Identify(Flow)
+	if s := Packet.SSH; s != nil {
+		software, hassh := &Flow.SSHServer, &Flow.HASSHServer
+		if s.Client {
+			software, hassh = &Flow.SSHClient, &Flow.HASSH
+		}
+		if *software == "" && s.Software != "" {
+			*software = s.Software
+			refine = true
+		}
+		if *hassh == "" {
+			*hassh = s.HASSH
+		}
+	}
+
+	// Application Identification (combines JA3 and JA3S, JA4+, domain, Host, port)
+	if (Flow.Application == "" || refine) && FT.appIdentifier != nil {
+		if App := FT.appIdentifier.Identify(Flow); App != "" {
+			Flow.Application = App
+		}
 	}
 
 	// Traffic Classification
-	if Flow.TrafficClass == "" && FT.classifier != nil {
+	if (Flow.TrafficClass == "" || refine) && FT.classifier != nil {
 		Flow.TrafficClass = FT.classifier.Classify(Flow)
 	}
 
 	return Flow
 }
 
-// Returns a list of all current flows.
+// Returns a copy of every current flow, taken under its shard's lock, so callers can
+// read them while workers keep updating the table.
 func (ft *FlowTable) GetActiveFlows() []*models.Flow {
-	ft.mu.RLock()
-	defer ft.mu.RUnlock()
-
-	flows := make([]*models.Flow, 0, len(ft.flows))
-	for _, flow := range ft.flows {
-		flows = append(flows, flow)
+	var flows []*models.Flow
+	for i := range ft.shards {
+		shard := &ft.shards[i]
+		shard.mu.RLock()
+		for _, flow := range shard.flows {
+			snapshot := *flow
+			flows = append(flows, &snapshot)
+		}
+		shard.mu.RUnlock()
 	}
 	return flows
 }
 
+// Records what saving a copy from GetActiveFlows produced, its database IDs and the
+// time it was persisted up to, on the live flow. Flows that expired meanwhile are
+// left alone.
+func (ft *FlowTable) MarkPersisted(saved *models.Flow) {
+	shard := ft.shardFor(saved.Key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if flow, ok := shard.flows[saved.Key]; ok {
+		flow.ID = saved.ID
+		flow.LastPersisted = saved.LastPersisted
+		flow.TLSHandshakeID = saved.TLSHandshakeID
+	}
+}
+
 // Creates a canonical key for the packet (handling bidirectionality).
 func makeFlowKey(packet *models.Packet) models.FlowKey {
 	srcIP := packet.Layer3.SrcIP
@@ -179,6 +312,8 @@ func makeFlowKey(packet *models.Packet) models.FlowKey {
 
 	key := models.FlowKey{
 		Protocol: packet.Layer4.Protocol,
+		VLAN:     packet.VLAN,
+		TunnelID: packet.TunnelID,
 	}
 
 	if swap {
@@ -198,17 +333,19 @@ func makeFlowKey(packet *models.Packet) models.FlowKey {
 
 // Removes flows inactive for longer than timeout.
 func (ft *FlowTable) Cleanup(timeout time.Duration) int {
-	ft.mu.Lock()
-	defer ft.mu.Unlock()
-
 	now := time.Now()
 	removed := 0
 
-	for key, flow := range ft.flows {
-		if now.Sub(flow.LastSeen) > timeout {
-			delete(ft.flows, key)
-			removed++
+	for i := range ft.shards {
+		shard := &ft.shards[i]
+		shard.mu.Lock()
+		for key, flow := range shard.flows {
+			if now.Sub(flow.LastSeen) > timeout {
+				delete(shard.flows, key)
+				removed++
+			}
 		}
+		shard.mu.Unlock()
 	}
 	return removed
 }
@@ -11,6 +11,8 @@
 package correlator
 
 import (
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -65,3 +67,317 @@ func TestFlowTable_DNSIntegration(t *testing.T) {
 		t.Log("Flow successfully correlated with cached domain.")
 	}
 }
+
+// Verifies that concurrent updates across many flows are neither lost nor merged.
+func TestFlowTable_ConcurrentUpdates(t *testing.T) {
+	ft := NewFlowTable(nil)
+
+	const workers, flowsPerWorker, packetsPerFlow = 8, 50, 20
+	start := time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for f := 0; f < flowsPerWorker; f++ {
+				for p := 0; p < packetsPerFlow; p++ {
+					// Alternate directions so both must land on the same canonical flow
+					src, dst := fmt.Sprintf("10.%d.%d.1", w, f), "192.168.1.1"
+					sport, dport := 40000+f, 443
+					if p%2 == 1 {
+						src, dst, sport, dport = dst, src, dport, sport
+					}
+					ft.Update(&models.Packet{
+						Timestamp: start.Add(time.Duration(p) * time.Millisecond),
+						Length:    100,
+						Layer3:    &models.Layer3{SrcIP: src, DstIP: dst},
+						Layer4:    &models.Layer4{SrcPort: sport, DstPort: dport, Protocol: "TCP"},
+					})
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	flows := ft.GetActiveFlows()
+	if len(flows) != workers*flowsPerWorker {
+		t.Fatalf("Expected %d flows, got %d", workers*flowsPerWorker, len(flows))
+	}
+	for _, flow := range flows {
+		if flow.PacketCount != packetsPerFlow {
+			t.Errorf("Flow %s counted %d packets, expected %d", flow.Key, flow.PacketCount, packetsPerFlow)
+		}
+	}
+}
+
+// Verifies that flows can be read and marked persisted while workers update them, as
+// the capture's persistence ticker does. Run with -race to check the locking.
+func TestFlowTable_PersistWhileUpdating(t *testing.T) {
+	ft := NewFlowTable(nil)
+
+	const workers, packetsPerFlow = 4, 2000
+	start := time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC)
+
+	// Saves every changed flow the way persistFlows does, handing out IDs as storage would
+	var nextID int64
+	persist := func() {
+		for _, flow := range ft.GetActiveFlows() {
+			if !flow.LastSeen.After(flow.LastPersisted) {
+				continue
+			}
+			nextID++
+			flow.ID, flow.LastPersisted = nextID, flow.LastSeen
+			if hs := flow.TLSHandshake(); hs != nil && hs.ID == 0 {
+				flow.TLSHandshakeID = nextID
+			}
+			ft.MarkPersisted(flow)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for p := 0; p < packetsPerFlow; p++ {
+				ft.Update(&models.Packet{
+					Timestamp: start.Add(time.Duration(p) * time.Millisecond),
+					Length:    100,
+					Layer3:    &models.Layer3{SrcIP: fmt.Sprintf("10.0.0.%d", w+1), DstIP: "192.168.1.1"},
+					Layer4:    &models.Layer4{SrcPort: 40000 + w, DstPort: 443, Protocol: "TCP"},
+					TLS:       &models.TLS{Handshake: true, JA3: fmt.Sprintf("ja3-%d", p)},
+				})
+			}
+		}(w)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+			persist()
+		}
+	}
+	persist()
+
+	for _, flow := range ft.GetActiveFlows() {
+		if flow.ID == 0 || flow.TLSHandshakeID == 0 || !flow.LastPersisted.Equal(flow.LastSeen) {
+			t.Errorf("Flow %s not marked persisted up to its last packet: %+v", flow.Key, flow)
+		}
+	}
+}
+
+// Verifies that one 5-tuple seen in different VLANs or tunnels yields separate flows,
+// while both directions inside the same tunnel still share one.
+func TestFlowTable_EncapsulationKeys(t *testing.T) {
+	ft := NewFlowTable(nil)
+	now := time.Now()
+
+	packet := func(src, dst string, sport, dport int, vlan uint16, tunnelID uint32) *models.Packet {
+		return &models.Packet{
+			Timestamp: now,
+			Length:    100,
+			VLAN:      vlan,
+			Tunnel:    "VXLAN",
+			TunnelID:  tunnelID,
+			Layer3:    &models.Layer3{SrcIP: src, DstIP: dst},
+			Layer4:    &models.Layer4{SrcPort: sport, DstPort: dport, Protocol: "TCP"},
+		}
+	}
+
+	ft.Update(packet("10.0.0.5", "10.0.0.9", 40000, 443, 10, 5000))
+	ft.Update(packet("10.0.0.9", "10.0.0.5", 443, 40000, 10, 5000))
+	ft.Update(packet("10.0.0.5", "10.0.0.9", 40000, 443, 20, 5000))
+	flow := ft.Update(packet("10.0.0.5", "10.0.0.9", 40000, 443, 10, 6000))
+
+	if flows := ft.GetActiveFlows(); len(flows) != 3 {
+		t.Fatalf("Expected 3 distinct flows, got %d", len(flows))
+	}
+	if flow.Key.VLAN != 10 || flow.Key.TunnelID != 6000 || flow.Tunnel != "VXLAN" {
+		t.Errorf("Expected flow in VLAN 10, VXLAN 6000; got %s via %s", flow.Key, flow.Tunnel)
+	}
+}
+
+// Verifies that sampled packets scale flow counts and mark the flow as sampled.
+func TestFlowTable_SampledCounts(t *testing.T) {
+	ft := NewFlowTable(nil)
+	packet := func(sampling uint32) *models.Packet {
+		return &models.Packet{
+			Timestamp: time.Now(),
+			Length:    100,
+			Sampling:  sampling,
+			Layer3:    &models.Layer3{SrcIP: "192.168.1.100", DstIP: "93.184.216.34"},
+			Layer4:    &models.Layer4{SrcPort: 54321, DstPort: 443, Protocol: "TCP"},
+		}
+	}
+
+	flow := ft.Update(packet(0))
+	if flow.Sampled || flow.PacketCount != 1 || flow.ByteCount != 100 {
+		t.Fatalf("Expected an unsampled packet counted once, got %d packets, %d bytes, sampled %v", flow.PacketCount, flow.ByteCount, flow.Sampled)
+	}
+
+	flow = ft.Update(packet(10))
+	if !flow.Sampled || flow.PacketCount != 11 || flow.ByteCount != 1100 {
+		t.Errorf("Expected a 1-in-10 packet counted ten times, got %d packets, %d bytes, sampled %v", flow.PacketCount, flow.ByteCount, flow.Sampled)
+	}
+}
+
+// Verifies that the Host header of a plain HTTP request reaches the flow and refines
+// the port-based application identified when the connection opened.
+func TestFlowTable_HTTPHost(t *testing.T) {
+	ft := NewFlowTable(nil)
+	packet := func(srcIP, dstIP string, srcPort, dstPort int, http *models.HTTP) *models.Packet {
+		return &models.Packet{
+			Timestamp: time.Now(),
+			Length:    100,
+			Layer3:    &models.Layer3{SrcIP: srcIP, DstIP: dstIP},
+			Layer4:    &models.Layer4{SrcPort: srcPort, DstPort: dstPort, Protocol: "TCP"},
+			HTTP:      http,
+		}
+	}
+
+	flow := ft.Update(packet("192.168.1.100", "203.0.113.7", 50123, 80, nil))
+	if flow.Application != "HTTP" {
+		t.Fatalf("Expected the SYN to be identified by port as HTTP, got %q", flow.Application)
+	}
+
+	request := &models.HTTP{IsRequest: true, Method: "GET", URI: "/", Host: "www.netflix.com:80", UserAgent: "Roku/DVP-9.10"}
+	flow = ft.Update(packet("192.168.1.100", "203.0.113.7", 50123, 80, request))
+	if flow.HTTPHost != "www.netflix.com:80" || flow.HTTPUserAgent != "Roku/DVP-9.10" {
+		t.Errorf("Expected the request headers on the flow, got Host %q, User-Agent %q", flow.HTTPHost, flow.HTTPUserAgent)
+	}
+	if flow.Application != "Netflix" || flow.TrafficClass != "Streaming" {
+		t.Errorf("Expected the Host to identify Netflix streaming, got %q (%q)", flow.Application, flow.TrafficClass)
+	}
+
+	response := &models.HTTP{StatusCode: 200, Server: "nginx"}
+	flow = ft.Update(packet("203.0.113.7", "192.168.1.100", 80, 50123, response))
+	if flow.HTTPServer != "nginx" || flow.HTTPHost != "www.netflix.com:80" {
+		t.Errorf("Expected the response's Server on the same flow, got Server %q, Host %q", flow.HTTPServer, flow.HTTPHost)
+	}
+}
+
+// Verifies that the Server Hello pairs its JA3S with the client's JA3 on one flow and
+// that a known pair overrides the browser the JA3 alone suggests.
+func TestFlowTable_JA3SPair(t *testing.T) {
+	ft := NewFlowTable(nil)
+	packet := func(fromServer bool, tls *models.TLS) *models.Packet {
+		p := &models.Packet{
+			Timestamp: time.Now(),
+			Length:    300,
+			Layer3:    &models.Layer3{SrcIP: "192.168.1.100", DstIP: "198.51.100.9"},
+			Layer4:    &models.Layer4{SrcPort: 50200, DstPort: 443, Protocol: "TCP"},
+			TLS:       tls,
+		}
+		if fromServer {
+			p.Layer3.SrcIP, p.Layer3.DstIP = p.Layer3.DstIP, p.Layer3.SrcIP
+			p.Layer4.SrcPort, p.Layer4.DstPort = p.Layer4.DstPort, p.Layer4.SrcPort
+		}
+		return p
+	}
+
+	hello := &models.ClientHello{SupportedVersions: []string{"TLS 1.2", "TLS 1.1", "TLS 1.0"}, ALPN: []string{"h2", "http/1.1"}}
+	flow := ft.Update(packet(false, &models.TLS{Handshake: true, JA3: "a0e9f5d64349fb13191bc781f81f42e1", ClientHello: hello}))
+	if flow.JA3Application != "Chrome (Generic)" {
+		t.Fatalf("Expected the JA3 alone to look like Chrome, got %q", flow.JA3Application)
+	}
+
+	serverHello := &models.TLS{
+		Handshake:   true,
+		ServerHello: true,
+		Version:     "TLS 1.2",
+		ALPN:        "h2",
+		CipherSuite: "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+		JA3S:        "b742b407517bac9536a77a7b0fee28e9",
+	}
+	flow = ft.Update(packet(true, serverHello))
+	if flow.JA3 != "a0e9f5d64349fb13191bc781f81f42e1" || flow.JA3S != serverHello.JA3S {
+		t.Errorf("Expected both fingerprints on the same flow, got JA3 %q, JA3S %q", flow.JA3, flow.JA3S)
+	}
+	if flow.TLSVersion != "TLS 1.2" || flow.TLSCipherSuite != serverHello.CipherSuite {
+		t.Errorf("Expected the negotiated parameters on the flow, got %q, %q", flow.TLSVersion, flow.TLSCipherSuite)
+	}
+	if flow.ClientHello != hello || !flow.ClientHello.OffersLegacyVersion() || flow.TLSALPN != "h2" {
+		t.Errorf("Expected the offered versions and selected ALPN on the flow, got %+v, %q", flow.ClientHello, flow.TLSALPN)
+	}
+	if flow.JA3Application != "Cobalt Strike" || flow.Application != "Cobalt Strike" {
+		t.Errorf("Expected the pair to identify Cobalt Strike, got %q (application %q)", flow.JA3Application, flow.Application)
+	}
+}
+
+// Verifies that the JA4+ fingerprints of a connection reach its flow and that a known
+// JA4 names the client.
+func TestFlowTable_JA4(t *testing.T) {
+	ft := NewFlowTable(nil)
+	packet := func(fromServer bool, tls *models.TLS, http *models.HTTP) *models.Packet {
+		p := &models.Packet{
+			Timestamp: time.Now(),
+			Length:    300,
+			Layer3:    &models.Layer3{SrcIP: "192.168.1.100", DstIP: "198.51.100.20"},
+			Layer4:    &models.Layer4{SrcPort: 50300, DstPort: 8443, Protocol: "TCP"},
+			TLS:       tls,
+			HTTP:      http,
+		}
+		if fromServer {
+			p.Layer3.SrcIP, p.Layer3.DstIP = p.Layer3.DstIP, p.Layer3.SrcIP
+			p.Layer4.SrcPort, p.Layer4.DstPort = p.Layer4.DstPort, p.Layer4.SrcPort
+		}
+		return p
+	}
+
+	ja4 := "t13d1516h2_8daaf6152771_02713d6af862"
+	flow := ft.Update(packet(false, &models.TLS{Handshake: true, JA3: "0123456789abcdef0123456789abcdef", JA4: ja4}, nil))
+	if flow.JA4 != ja4 || flow.JA3Application != "Chrome" || flow.Application != "Chrome" {
+		t.Errorf("Expected the JA4 to name Chrome, got %q (%q, %q)", flow.JA4, flow.JA3Application, flow.Application)
+	}
+
+	serverHello := &models.TLS{Handshake: true, ServerHello: true, JA3S: "b742b407517bac9536a77a7b0fee28e9", JA4S: "t120200_c030_a5d8d5a6de5c",
+		Certificate: &models.Certificate{CommonName: "localhost", JA4X: "2166164053c1_2166164053c1_30d204a01551"}}
+	flow = ft.Update(packet(true, serverHello, nil))
+	if flow.JA4S != serverHello.JA4S || flow.JA4X != serverHello.Certificate.JA4X {
+		t.Errorf("Expected JA4S and JA4X on the flow, got %q, %q", flow.JA4S, flow.JA4X)
+	}
+
+	flow = ft.Update(packet(false, nil, &models.HTTP{IsRequest: true, Method: "GET", JA4H: "ge11nn050000_4e59edc1297a_000000000000_000000000000"}))
+	if flow.JA4H != "ge11nn050000_4e59edc1297a_000000000000_000000000000" {
+		t.Errorf("Expected JA4H on the flow, got %q", flow.JA4H)
+	}
+}
+
+// Verifies that each side's SSH software and HASSH land on the flow and that an SSH
+// server on a non-standard port is identified by its banner.
+func TestFlowTable_SSH(t *testing.T) {
+	ft := NewFlowTable(nil)
+	packet := func(client bool, ssh *models.SSH) *models.Packet {
+		p := &models.Packet{
+			Timestamp: time.Now(),
+			Length:    120,
+			Layer3:    &models.Layer3{SrcIP: "192.168.1.100", DstIP: "192.168.1.20"},
+			Layer4:    &models.Layer4{SrcPort: 50400, DstPort: 2222, Protocol: "TCP"},
+			SSH:       ssh,
+		}
+		if !client {
+			p.Layer3.SrcIP, p.Layer3.DstIP = p.Layer3.DstIP, p.Layer3.SrcIP
+			p.Layer4.SrcPort, p.Layer4.DstPort = p.Layer4.DstPort, p.Layer4.SrcPort
+		}
+		return p
+	}
+
+	flow := ft.Update(packet(false, &models.SSH{Software: "OpenSSH_9.6p1", Banner: "SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13"}))
+	if flow.SSHServer != "OpenSSH_9.6p1" || flow.Application != "SSH/SFTP" {
+		t.Errorf("Expected an OpenSSH server identified as SSH, got %q (%q)", flow.SSHServer, flow.Application)
+	}
+
+	ft.Update(packet(true, &models.SSH{Client: true, Software: "Go", Banner: "SSH-2.0-Go"}))
+	ft.Update(packet(true, &models.SSH{Client: true, Software: "Go", HASSH: "client-hassh"}))
+	flow = ft.Update(packet(false, &models.SSH{Software: "OpenSSH_9.6p1", HASSH: "server-hassh"}))
+	if flow.SSHClient != "Go" || flow.HASSH != "client-hassh" || flow.HASSHServer != "server-hassh" {
+		t.Errorf("Expected both sides' software and fingerprints, got %q %q %q", flow.SSHClient, flow.HASSH, flow.HASSHServer)
+	}
+}
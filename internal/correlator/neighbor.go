@@ -0,0 +1,220 @@
+/**
+ * Neighbor Table.
+ *
+ * Passively builds the link's neighbor table from ARP and IPv6 Neighbor
+ * Discovery: every IP to MAC binding a host announces, with when it was
+ * first and last seen, how often it was announced unasked and probed for
+ * duplicates, and what each IPv6 router advertises. An address bound to
+ * more than one MAC keeps an entry per MAC, which is what spoofing shows
+ * up as.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package correlator
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/kleaSCM/netscope/internal/models"
+)
+
+// Bindings and routers the table holds at most. A flood of forged bindings stops
+// being recorded rather than growing the table without bound.
+const maxNeighbors = 16384
+
+// Identifies a binding: the same address may be claimed by several MACs.
+type neighborKey struct {
+	ip   string
+	mac  string
+	vlan uint16
+}
+
+type neighborEntry struct {
+	neighbor models.Neighbor
+	bound    bool // Seen as a binding, not only probed for
+	dirty    bool // Changed since the last call to Changes
+}
+
+type routerEntry struct {
+	advert models.RouterAdvertisement
+	dirty  bool
+}
+
+// NeighborTable maintains the IP to MAC bindings and routers seen on the link.
+type NeighborTable struct {
+	neighbors map[neighborKey]*neighborEntry
+	routers   map[neighborKey]*routerEntry
+	mu        sync.Mutex
+}
+
+// Creates an empty neighbor table.
+func NewNeighborTable() *NeighborTable {
+	return &NeighborTable{
+		neighbors: make(map[neighborKey]*neighborEntry),
+		routers:   make(map[neighborKey]*routerEntry),
+	}
+}
+
+// Records what a packet's ARP or NDP message revealed. Returns a copy of the binding
+// when the packet is the first to show it, so the sender's address history can
+// record it, and nil otherwise.
+func (nt *NeighborTable) Update(packet *models.Packet) *models.Neighbor {
+	msg := packet.Neighbor
+	if msg == nil || msg.IP == "" || msg.MAC == "" {
+		return nil
+	}
+
+	nt.mu.Lock()
+	defer nt.mu.Unlock()
+
+	key := neighborKey{ip: msg.IP, mac: msg.MAC, vlan: packet.VLAN}
+	if msg.Advert != nil {
+		nt.updateRouter(key, packet)
+	}
+
+	entry, ok := nt.neighbors[key]
+	if !ok {
+		if len(nt.neighbors) >= maxNeighbors {
+			return nil
+		}
+		entry = &neighborEntry{neighbor: models.Neighbor{
+			IPAddress:  msg.IP,
+			MACAddress: msg.MAC,
+			VLAN:       packet.VLAN,
+			Protocol:   msg.Protocol,
+			Interface:  packet.Interface,
+			FirstSeen:  packet.Timestamp,
+		}}
+		nt.neighbors[key] = entry
+	}
+
+	n := &entry.neighbor
+	n.LastSeen = packet.Timestamp
+	entry.dirty = true
+	switch {
+	case msg.Probe:
+		n.Probes++
+		return nil // The address is not the sender's until the probes go unanswered
+	case msg.Gratuitous:
+		n.Gratuitous++
+	}
+	if msg.Router {
+		n.Router = true
+	}
+
+	if entry.bound {
+		return nil
+	}
+	entry.bound = true
+	learned := *n
+	return &learned
+}
+
+// Records a Router Advertisement, replacing what the router advertised before.
+func (nt *NeighborTable) updateRouter(key neighborKey, packet *models.Packet) {
+	entry, ok := nt.routers[key]
+	if !ok {
+		if len(nt.routers) >= maxNeighbors {
+			return
+		}
+		entry = &routerEntry{advert: models.RouterAdvertisement{FirstSeen: packet.Timestamp}}
+		nt.routers[key] = entry
+	}
+
+	advert := *packet.Neighbor.Advert
+	advert.FirstSeen, advert.LastSeen = entry.advert.FirstSeen, packet.Timestamp
+	advert.RouterIP, advert.RouterMAC, advert.VLAN = key.ip, key.mac, key.vlan
+	if advert.Interface = entry.advert.Interface; advert.Interface == "" {
+		advert.Interface = packet.Interface
+	}
+	entry.advert = advert
+	entry.dirty = true
+}
+
+// Returns copies of every binding, ordered by address and then MAC.
+func (nt *NeighborTable) Neighbors() []*models.Neighbor {
+	nt.mu.Lock()
+	defer nt.mu.Unlock()
+
+	neighbors := make([]*models.Neighbor, 0, len(nt.neighbors))
+	for _, entry := range nt.neighbors {
+		n := entry.neighbor
+		neighbors = append(neighbors, &n)
+	}
+	sortNeighbors(neighbors)
+	return neighbors
+}
+
+// Returns copies of every router's latest advertisement.
+func (nt *NeighborTable) Routers() []*models.RouterAdvertisement {
+	nt.mu.Lock()
+	defer nt.mu.Unlock()
+
+	routers := make([]*models.RouterAdvertisement, 0, len(nt.routers))
+	for _, entry := range nt.routers {
+		advert := entry.advert
+		routers = append(routers, &advert)
+	}
+	sort.Slice(routers, func(i, j int) bool { return routers[i].RouterIP < routers[j].RouterIP })
+	return routers
+}
+
+// Returns copies of the bindings and routers that changed since the last call, so
+// only they need persisting. Those that then fail to save are handed back with
+// MarkUnsaved and MarkRouterUnsaved.
+func (nt *NeighborTable) Changes() ([]*models.Neighbor, []*models.RouterAdvertisement) {
+	nt.mu.Lock()
+	defer nt.mu.Unlock()
+
+	var neighbors []*models.Neighbor
+	for _, entry := range nt.neighbors {
+		if entry.dirty {
+			entry.dirty = false
+			n := entry.neighbor
+			neighbors = append(neighbors, &n)
+		}
+	}
+	var routers []*models.RouterAdvertisement
+	for _, entry := range nt.routers {
+		if entry.dirty {
+			entry.dirty = false
+			advert := entry.advert
+			routers = append(routers, &advert)
+		}
+	}
+	sortNeighbors(neighbors)
+	return neighbors, routers
+}
+
+// Marks a binding returned by Changes as changed again, after saving it failed.
+func (nt *NeighborTable) MarkUnsaved(n *models.Neighbor) {
+	nt.mu.Lock()
+	defer nt.mu.Unlock()
+
+	if entry, ok := nt.neighbors[neighborKey{ip: n.IPAddress, mac: n.MACAddress, vlan: n.VLAN}]; ok {
+		entry.dirty = true
+	}
+}
+
+// Marks a router returned by Changes as changed again, after saving it failed.
+func (nt *NeighborTable) MarkRouterUnsaved(advert *models.RouterAdvertisement) {
+	nt.mu.Lock()
+	defer nt.mu.Unlock()
+
+	if entry, ok := nt.routers[neighborKey{ip: advert.RouterIP, mac: advert.RouterMAC, vlan: advert.VLAN}]; ok {
+		entry.dirty = true
+	}
+}
+
+// Orders bindings by address and then MAC.
+func sortNeighbors(neighbors []*models.Neighbor) {
+	sort.Slice(neighbors, func(i, j int) bool {
+		if neighbors[i].IPAddress != neighbors[j].IPAddress {
+			return neighbors[i].IPAddress < neighbors[j].IPAddress
+		}
+		return neighbors[i].MACAddress < neighbors[j].MACAddress
+	})
+}
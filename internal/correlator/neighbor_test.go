@@ -0,0 +1,114 @@
+/**
+ * Neighbor Table Tests.
+ *
+ * Verifies that the NeighborTable learns bindings once, counts gratuitous
+ * announcements and probes, keeps a binding per MAC claiming an address,
+ * and reports only what changed since it was last persisted.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package correlator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kleaSCM/netscope/internal/models"
+)
+
+// Builds a packet carrying an ARP or NDP message.
+func neighborPacket(seen time.Time, msg models.NeighborMessage) *models.Packet {
+	return &models.Packet{Timestamp: seen, Interface: "eth0", Neighbor: &msg}
+}
+
+// Verifies that the first sighting of a binding is reported once, that later
+// sightings extend it, and that probes are counted without binding the address.
+func TestNeighborTable_Update(t *testing.T) {
+	nt := NewNeighborTable()
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	const mac = "00:11:22:33:44:55"
+
+	probe := neighborPacket(start, models.NeighborMessage{Protocol: "ARP", IP: "192.168.1.50", MAC: mac, Probe: true})
+	if learned := nt.Update(probe); learned != nil {
+		t.Errorf("Expected a probe not to bind the address, got %+v", learned)
+	}
+
+	announce := neighborPacket(start.Add(time.Second), models.NeighborMessage{Protocol: "ARP", IP: "192.168.1.50", MAC: mac, Gratuitous: true})
+	learned := nt.Update(announce)
+	if learned == nil || learned.IPAddress != "192.168.1.50" || learned.MACAddress != mac || learned.Interface != "eth0" {
+		t.Fatalf("Expected the announcement to bind the address, got %+v", learned)
+	}
+
+	reply := neighborPacket(start.Add(time.Minute), models.NeighborMessage{Protocol: "ARP", IP: "192.168.1.50", MAC: mac})
+	if again := nt.Update(reply); again != nil {
+		t.Errorf("Expected a known binding not to be reported again, got %+v", again)
+	}
+	if nt.Update(neighborPacket(start, models.NeighborMessage{Protocol: "ARP"})) != nil {
+		t.Error("Expected a message without a binding to be ignored")
+	}
+
+	neighbors := nt.Neighbors()
+	if len(neighbors) != 1 {
+		t.Fatalf("Expected one binding, got %d", len(neighbors))
+	}
+	n := neighbors[0]
+	if n.Probes != 1 || n.Gratuitous != 1 || !n.FirstSeen.Equal(start) || !n.LastSeen.Equal(start.Add(time.Minute)) {
+		t.Errorf("Expected one probe and one announcement from first to last sighting, got %+v", n)
+	}
+
+	// A second MAC claiming the address keeps its own entry
+	spoof := neighborPacket(start.Add(2*time.Minute), models.NeighborMessage{Protocol: "ARP", IP: "192.168.1.50", MAC: "de:ad:be:ef:00:01"})
+	if nt.Update(spoof) == nil {
+		t.Error("Expected the second MAC's binding to be reported")
+	}
+	if neighbors := nt.Neighbors(); len(neighbors) != 2 || neighbors[0].MACAddress != mac {
+		t.Errorf("Expected a binding per MAC ordered by MAC, got %+v", neighbors)
+	}
+}
+
+// Verifies that routers keep their latest advertisement and that Changes returns
+// each change once unless it is marked unsaved.
+func TestNeighborTable_Changes(t *testing.T) {
+	nt := NewNeighborTable()
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	const mac = "00:11:22:33:44:55"
+
+	for i, mtu := range []uint32{1500, 1280} {
+		nt.Update(neighborPacket(start.Add(time.Duration(i)*time.Minute), models.NeighborMessage{
+			Protocol: "NDP",
+			IP:       "fe80::1",
+			MAC:      mac,
+			Router:   true,
+			Advert:   &models.RouterAdvertisement{RouterIP: "fe80::1", RouterMAC: mac, MTU: mtu, Lifetime: 30 * time.Minute},
+		}))
+	}
+
+	neighbors, routers := nt.Changes()
+	if len(neighbors) != 1 || !neighbors[0].Router {
+		t.Fatalf("Expected the router's binding, got %+v", neighbors)
+	}
+	if len(routers) != 1 {
+		t.Fatalf("Expected one router, got %d", len(routers))
+	}
+	if r := routers[0]; r.MTU != 1280 || !r.FirstSeen.Equal(start) || !r.LastSeen.Equal(start.Add(time.Minute)) || r.Interface != "eth0" {
+		t.Errorf("Expected the latest advertisement from first to last sighting, got %+v", r)
+	}
+
+	if neighbors, routers := nt.Changes(); len(neighbors) != 0 || len(routers) != 0 {
+		t.Errorf("Expected nothing to have changed, got %d bindings and %d routers", len(neighbors), len(routers))
+	}
+	nt.Update(neighborPacket(start.Add(time.Hour), models.NeighborMessage{Protocol: "NDP", IP: "fe80::1", MAC: mac}))
+	neighbors, routers = nt.Changes()
+	if len(neighbors) != 1 || len(routers) != 0 {
+		t.Fatalf("Expected only the binding to have changed, got %d bindings and %d routers", len(neighbors), len(routers))
+	}
+
+	// Changes that failed to save are returned again by the next call
+	nt.MarkUnsaved(neighbors[0])
+	nt.MarkRouterUnsaved(&models.RouterAdvertisement{RouterIP: "fe80::1", RouterMAC: mac})
+	if neighbors, routers := nt.Changes(); len(neighbors) != 1 || len(routers) != 1 {
+		t.Errorf("Expected the unsaved binding and router back, got %d bindings and %d routers", len(neighbors), len(routers))
+	}
+}
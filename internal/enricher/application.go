@@ -37,28 +37,72 @@ func NewApplicationIdentifier(ja3DB *JA3Database) *ApplicationIdentifier {
 // Determines the application name for a flow using multiple signals.
 // Returns the most confident match or empty string if unknown.
 func (ai *ApplicationIdentifier) Identify(flow *models.Flow) string {
-	// Priority 1: JA3 fingerprint (most specific)
+	// Priority 1: JA3 and JA3S pair (client and server implementation together)
+	if flow.JA3 != "" && flow.JA3S != "" && ai.ja3DB != nil {
+		if app := ai.ja3DB.LookupPair(flow.JA3, flow.JA3S); app != "" {
+			return app
+		}
+	}
+
+	// Priority 2: JA3 fingerprint (degraded by extension-order randomisation)
 	if flow.JA3 != "" && ai.ja3DB != nil {
 		if app := ai.ja3DB.Lookup(flow.JA3); app != "" {
 			return app
 		}
 	}
 
-	// Priority 2: Domain pattern matching (very reliable)
+	// Priority 3: Domain pattern matching (very reliable)
 	if flow.DstDomain != "" {
 		if app := ai.identifyByDomain(flow.DstDomain); app != "" {
 			return app
 		}
 	}
 
-	// Priority 3: TLS SNI (fallback for domain)
+	// Priority 4: TLS SNI (fallback for domain)
 	if flow.TLSSNI != "" {
 		if app := ai.identifyByDomain(flow.TLSSNI); app != "" {
 			return app
 		}
 	}
 
-	// Priority 4: Port-based detection (least specific)
+	// Priority 5: Server certificate names (identity when the client sent no SNI)
+	if flow.Certificate != nil {
+		for _, name := range append([]string{flow.Certificate.CommonName}, flow.Certificate.SANs...) {
+			if name == "" {
+				continue
+			}
+			if app := ai.identifyByDomain(strings.TrimPrefix(name, "*.")); app != "" {
+				return app
+			}
+		}
+	}
+
+	// Priority 6: HTTP Host header (plain HTTP has no SNI)
+	if flow.HTTPHost != "" {
+		if app := ai.identifyByDomain(hostWithoutPort(flow.HTTPHost)); app != "" {
+			return app
+		}
+	}
+
+	// Priority 7: JA4+ fingerprints (client, HTTP client, certificate, then server). Below
+	// the names, so a browser's fingerprint does not hide the service it connects to.
+	if ai.ja3DB != nil {
+		for _, fingerprint := range []string{flow.JA4, flow.JA4H, flow.JA4X, flow.JA4S} {
+			if fingerprint == "" {
+				continue
+			}
+			if app := ai.ja3DB.LookupJA4(fingerprint); app != "" {
+				return app
+			}
+		}
+	}
+
+	// Priority 8: SSH identification lines, on whatever port the server listens
+	if flow.SSHClient != "" || flow.SSHServer != "" {
+		return "SSH/SFTP"
+	}
+
+	// Priority 9: Port-based detection (least specific)
 	dstPort := int(flow.Key.DstPort)
 	if app := ai.identifyByPort(dstPort, flow.Protocol); app != "" {
 		return app
@@ -75,6 +119,19 @@ func (ai *ApplicationIdentifier) identifyByPort(port int, protocol string) strin
 	return ""
 }
 
+// Strips any port from a Host header value, including bracketed IPv6 literals.
+func hostWithoutPort(host string) string {
+	if strings.HasPrefix(host, "[") {
+		if end := strings.IndexByte(host, ']'); end > 0 {
+			return host[1:end]
+		}
+	}
+	if name, _, ok := strings.Cut(host, ":"); ok {
+		return name
+	}
+	return host
+}
+
 // Domain pattern matching is highly reliable for identifying specific services.
 func (ai *ApplicationIdentifier) identifyByDomain(domain string) string {
 	domain = strings.ToLower(domain)
@@ -2,7 +2,10 @@
  * Device Fingerprinting.
  *
  * Analyzes traffic patterns and characteristics to infer device types
- * (e.g., Mobile, IoT, Desktop) and operating systems.
+ * (e.g., Mobile, IoT, Desktop) and operating systems, and learns device
+ * names and address history from DHCP and names and models from local
+ * service discovery announcements. Each source that names the OS carries
+ * a confidence, and only an equally or more confident source replaces it.
  *
  * Author: KleaSCM
  * Email: KleaSCM@gmail.com
@@ -12,8 +15,10 @@ package enricher
 
 import (
 	"log"
+	"net"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/google/gopacket"
 	"github.com/kleaSCM/netscope/internal/models"
@@ -21,11 +26,23 @@ import (
 	"github.com/kleaSCM/netscope/internal/storage"
 )
 
+// How strongly each source identifies a device's OS, as Device.OSConfidence.
+const (
+	confidenceTTL        = 20 // Initial TTL alone
+	confidenceP0fFuzzy   = 40 // p0f signature matched with tolerated differences
+	confidenceP0fGeneric = 60 // Generic p0f signature for the OS family
+	confidenceDHCP       = 70
+	confidenceP0f        = 80 // Specific p0f signature
+	confidenceDiscovery  = 85
+	confidenceUserAgent  = 95
+)
+
 // DeviceTracker maintains real-time state of network devices.
 type DeviceTracker struct {
 	storage      storage.Storage
 	vendorLookup *VendorLookup
-	cache        map[string]*models.Device // MAC -> Device
+	p0f          *P0fDatabase
+	cache        map[string]*models.Device // Identity (MAC, or IP without one) -> Device
 	mu           sync.RWMutex
 }
 
@@ -34,23 +51,50 @@ func NewDeviceTracker(store storage.Storage) *DeviceTracker {
 	return &DeviceTracker{
 		storage:      store,
 		vendorLookup: NewVendorLookup(),
+		p0f:          NewP0fDatabase(),
 		cache:        make(map[string]*models.Device),
 	}
 }
 
+// LoadP0fDatabase replaces the built-in TCP signatures with a p0f v3 database file.
+func (dt *DeviceTracker) LoadP0fDatabase(path string) error {
+	return dt.p0f.LoadFile(path)
+}
+
 // Track processes a packet to update device information.
 // Returns the device associated with the source MAC.
 func (dt *DeviceTracker) Track(packet gopacket.Packet) *models.Device {
-	// We primarily track by Source MAC (Layer 2)
-	layer2 := parser.ParseEthernet(packet)
-	if layer2 == nil {
-		return nil
+	return dt.TrackPacket(&models.Packet{
+		Timestamp: packet.Metadata().Timestamp,
+		Layer2:    parser.ParseEthernet(packet),
+		Layer3:    parser.ParseIP(packet),
+	})
+}
+
+// TrackPacket updates device information from an already parsed packet.
+// Returns the device associated with the source MAC, or with the source IP
+// on links that carry no MAC addresses (tun, PPP, raw IP).
+func (dt *DeviceTracker) TrackPacket(packet *models.Packet) *models.Device {
+	// A DHCP message describes its client, which for a server's reply is not the sender
+	var client *models.Device
+	if packet.DHCP != nil {
+		client = dt.trackDHCP(packet)
 	}
 
-	mac := layer2.SrcMAC
+	device := dt.trackSource(packet)
+	if device == nil && client != nil && !packet.DHCP.FromServer {
+		return client // Clients without an address yet send from 0.0.0.0
+	}
+	return device
+}
 
-	// Check IP Address (Layer 3) for filtering
-	layer3 := parser.ParseIP(packet)
+// Updates the device that sent a packet. Returns nil for remote sources.
+func (dt *DeviceTracker) trackSource(packet *models.Packet) *models.Device {
+	// Check IP Address (Layer 3) for filtering; non-IP frames such as ARP carry no version
+	layer3 := packet.Layer3
+	if layer3 != nil && layer3.Version == "" {
+		layer3 = nil
+	}
 	if layer3 != nil {
 		// Filter: Only track private IPs as "Devices"
 		// This prevents remote servers from being tracked as local devices
@@ -59,57 +103,195 @@ func (dt *DeviceTracker) Track(packet gopacket.Packet) *models.Device {
 		}
 	}
 
+	// We primarily track by Source MAC (Layer 2), falling back to the source IP
+	var mac string
+	if packet.Layer2 != nil {
+		mac = packet.Layer2.SrcMAC
+	}
+	key := mac
+	if key == "" {
+		if layer3 == nil || layer3.SrcIP == "" {
+			return nil
+		}
+		key = layer3.SrcIP
+	}
+
 	dt.mu.Lock()
 	defer dt.mu.Unlock()
 
 	// Check cache first
-	if device, ok := dt.cache[mac]; ok {
+	if device, ok := dt.cache[key]; ok {
 		// Update timestamps and ephemeral data
-		device.LastSeen = packet.Metadata().Timestamp
+		device.LastSeen = packet.Timestamp
 
 		// Passive OS update (if unknown or we want to refine)
 		if device.OSFingerprint == "" || device.OSFingerprint == "Unknown" {
-			os := parser.GuessOS(packet)
-			if os != "" && os != "Unknown" {
-				device.OSFingerprint = os
-				// Ideally, persist this change
+			if setOS(device, guessOS(layer3), confidenceTTL) {
 				dt.persist(device)
 			}
 		}
+		if dt.applyTCPSignature(device, packet.TCPSig) {
+			dt.persist(device)
+		}
 
 		// Update IP if changed or not set
 		if layer3 != nil {
 			if device.IPAddress != layer3.SrcIP {
 				device.IPAddress = layer3.SrcIP
 				dt.persist(device)
+				dt.recordIP(device, layer3.SrcIP, "Observed", packet.Timestamp, 0)
 			}
 		}
 
+		if applyUserAgent(device, packet.HTTP) {
+			dt.persist(device)
+		}
+		if applyDiscovery(device, packet.Discovery) {
+			dt.persist(device)
+		}
+
 		return device
 	}
 
 	// New Device found
-	device := &models.Device{
-		MACAddress: mac,
-		FirstSeen:  packet.Metadata().Timestamp,
-		LastSeen:   packet.Metadata().Timestamp,
-		DeviceType: "Unknown", // Default
-	}
-
-	// Vendor Lookup
-	device.Vendor = dt.vendorLookup.Lookup(mac)
+	device := dt.newDevice(key, mac, packet.Timestamp)
 
 	// OS Fingerprint
-	device.OSFingerprint = parser.GuessOS(packet)
+	device.OSFingerprint = guessOS(layer3)
+	if device.OSFingerprint != "" && device.OSFingerprint != "Unknown" {
+		device.OSConfidence = confidenceTTL
+	}
+	dt.applyTCPSignature(device, packet.TCPSig)
+	applyUserAgent(device, packet.HTTP)
+	applyDiscovery(device, packet.Discovery)
 
 	// IP Address
 	if layer3 != nil {
 		device.IPAddress = layer3.SrcIP
 	}
 
+	// Persist to DB
+	if err := dt.storage.SaveDevice(device); err != nil {
+		log.Printf("Error saving new device %s: %v", key, err)
+	}
+	if device.IPAddress != "" {
+		dt.recordIP(device, device.IPAddress, "Observed", packet.Timestamp, 0)
+	}
+
+	dt.cache[key] = device
+	return device
+}
+
+// Updates the client a DHCP message concerns: its name, vendor class and
+// parameter request list from the client's own messages, and the address and
+// lease a server bound to it. The client's name replaces any guessed hostname,
+// and the OS its DHCP client reveals replaces less confident guesses. Returns
+// the client, or nil when the message does not say which device it concerns.
+func (dt *DeviceTracker) trackDHCP(packet *models.Packet) *models.Device {
+	dhcp := packet.DHCP
+	mac := dhcp.ClientMAC
+	if mac == "" && packet.Layer2 != nil && dhcp.Version == 6 {
+		// DHCPv6 DUIDs need not hold the MAC, but the client sends and is answered
+		// on its link-local address
+		if !dhcp.FromServer {
+			mac = packet.Layer2.SrcMAC
+		} else if !strings.HasPrefix(packet.Layer2.DstMAC, "33:33:") {
+			mac = packet.Layer2.DstMAC
+		}
+	}
+	if mac == "" {
+		return nil
+	}
+
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	device, known := dt.cache[mac]
+	if !known {
+		device = dt.newDevice(mac, mac, packet.Timestamp)
+		dt.cache[mac] = device
+	}
+	changed := !known
+	if !dhcp.FromServer {
+		device.LastSeen = packet.Timestamp
+	}
+
+	if dhcp.Hostname != "" && device.Hostname != dhcp.Hostname {
+		device.Hostname = dhcp.Hostname
+		changed = true
+	}
+	if dhcp.VendorClass != "" && device.DHCPVendorClass != dhcp.VendorClass {
+		device.DHCPVendorClass = dhcp.VendorClass
+		changed = true
+	}
+	if dhcp.Fingerprint != "" && device.DHCPFingerprint != dhcp.Fingerprint {
+		device.DHCPFingerprint = dhcp.Fingerprint
+		changed = true
+	}
+	if !dhcp.FromServer {
+		os, deviceType := ParseDHCPFingerprint(dhcp.Fingerprint, dhcp.VendorClass)
+		if setOS(device, os, confidenceDHCP) {
+			changed = true
+		}
+		if deviceType != "" && (device.DeviceType == "" || device.DeviceType == "Unknown") {
+			device.DeviceType = deviceType
+			changed = true
+		}
+	}
+
+	// An IPv4 lease is the device's address; IPv6 leases sit alongside it
+	if dhcp.AssignedIP != "" && dhcp.Version == 4 && device.IPAddress != dhcp.AssignedIP {
+		device.IPAddress = dhcp.AssignedIP
+		changed = true
+	}
+
+	if changed {
+		dt.persist(device)
+	}
+	if dhcp.AssignedIP != "" {
+		dt.recordIP(device, dhcp.AssignedIP, "DHCP", packet.Timestamp, dhcp.LeaseTime)
+	}
+	return device
+}
+
+// Records an address a device announced over ARP or NDP in its history, and as
+// its address when it has no other IPv4 one. Bindings of MACs not yet tracked
+// are left to the neighbor table.
+func (dt *DeviceTracker) RecordNeighbor(n *models.Neighbor) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	device, ok := dt.cache[n.MACAddress]
+	if !ok {
+		return
+	}
+	if device.IPAddress == "" && net.ParseIP(n.IPAddress).To4() != nil {
+		device.IPAddress = n.IPAddress
+		dt.persist(device)
+	}
+	dt.recordIP(device, n.IPAddress, n.Protocol, n.FirstSeen, 0)
+}
+
+// Creates a device with its vendor and a placeholder hostname. The key names
+// devices seen without a MAC address.
+func (dt *DeviceTracker) newDevice(key, mac string, seen time.Time) *models.Device {
+	device := &models.Device{
+		MACAddress: mac,
+		FirstSeen:  seen,
+		LastSeen:   seen,
+		DeviceType: "Unknown", // Default
+	}
+
+	// Vendor Lookup
+	if mac != "" {
+		device.Vendor = dt.vendorLookup.Lookup(mac)
+	}
+
 	// Basic Hostname guessing
 	if device.Vendor != "" {
 		device.Hostname = device.Vendor + "-Device"
+	} else if mac == "" {
+		device.Hostname = "Device-" + key
 	} else {
 		shortMac := strings.ReplaceAll(mac, ":", "")
 		if len(shortMac) > 4 {
@@ -117,14 +299,105 @@ func (dt *DeviceTracker) Track(packet gopacket.Packet) *models.Device {
 		}
 		device.Hostname = "Device-" + shortMac
 	}
+	return device
+}
 
-	// Persist to DB
-	if err := dt.storage.SaveDevice(device); err != nil {
-		log.Printf("Error saving new device %s: %v", mac, err)
+// Guesses the OS from the IP TTL; frames without an IP header give no hint.
+func guessOS(layer3 *models.Layer3) string {
+	if layer3 == nil {
+		return ""
 	}
+	return parser.GuessOSFromTTL(layer3.TTL)
+}
 
-	dt.cache[mac] = device
-	return device
+// Refines a device from the SYN or SYN+ACK it sent, matched against the p0f
+// signatures. Matches of tools such as scanners say nothing about the OS.
+// Reports whether the device changed.
+func (dt *DeviceTracker) applyTCPSignature(device *models.Device, sig *models.TCPSignature) bool {
+	match := dt.p0f.Match(sig)
+	if match == nil || match.Class == "!" {
+		return false
+	}
+	return setOS(device, match.String(), match.Confidence)
+}
+
+// Refines a device from the User-Agent of an HTTP request it sent. The platform a
+// User-Agent names beats every other source; the device type is only filled in while
+// unknown. Reports whether the device changed.
+func applyUserAgent(device *models.Device, http *models.HTTP) bool {
+	if http == nil || !http.IsRequest || http.UserAgent == "" {
+		return false
+	}
+
+	changed := false
+	os, deviceType := ParseUserAgent(http.UserAgent)
+	if setOS(device, os, confidenceUserAgent) {
+		changed = true
+	}
+	if deviceType != "" && (device.DeviceType == "" || device.DeviceType == "Unknown") {
+		device.DeviceType = deviceType
+		changed = true
+	}
+	return changed
+}
+
+// Refines a device from what it announced about itself over mDNS, LLMNR, NetBIOS
+// or SSDP. An announced name replaces only a guessed hostname, so that a DHCP
+// hostname keeps precedence; the OS replaces less confident guesses and the device
+// type is only filled in while unknown. Reports whether the device changed.
+func applyDiscovery(device *models.Device, discovery *models.Discovery) bool {
+	if discovery == nil {
+		return false
+	}
+
+	changed := false
+	if discovery.Hostname != "" && device.Hostname != discovery.Hostname && isGuessedHostname(device) {
+		device.Hostname = discovery.Hostname
+		changed = true
+	}
+	if discovery.Model != "" && device.Model != discovery.Model {
+		device.Model = discovery.Model
+		changed = true
+	}
+	os, deviceType := ParseDiscovery(discovery)
+	if setOS(device, os, confidenceDiscovery) {
+		changed = true
+	}
+	if deviceType != "" && (device.DeviceType == "" || device.DeviceType == "Unknown") {
+		device.DeviceType = deviceType
+		changed = true
+	}
+	return changed
+}
+
+// Reports whether a device's hostname is still the placeholder newDevice gave it.
+func isGuessedHostname(device *models.Device) bool {
+	return device.Hostname == "" ||
+		strings.HasPrefix(device.Hostname, "Device-") ||
+		(device.Vendor != "" && device.Hostname == device.Vendor+"-Device")
+}
+
+// Names a device's OS when the source is at least as confident as the one that
+// named the current OS. Reports whether the device changed.
+func setOS(device *models.Device, os string, confidence int) bool {
+	if os == "" || os == "Unknown" || confidence < device.OSConfidence {
+		return false
+	}
+	if device.OSFingerprint == os && device.OSConfidence == confidence {
+		return false
+	}
+	device.OSFingerprint = os
+	device.OSConfidence = confidence
+	return true
+}
+
+// Reports whether an OS is one the TTL guess yields.
+func isTTLGuess(os string) bool {
+	switch os {
+	case "", "Unknown", "Windows", "Linux/Apple/iOS", "Solaris/Cisco":
+		return true
+	}
+	return false
 }
 
 // Helper for private IP check
@@ -164,7 +437,22 @@ func isPrivateIP(ip string) bool {
 // Persist updates the device in storage.
 func (dt *DeviceTracker) persist(d *models.Device) {
 	if err := dt.storage.SaveDevice(d); err != nil {
-		log.Printf("Error updating device %s: %v", d.MACAddress, err)
+		log.Printf("Error updating device %s: %v", d.Identity(), err)
+	}
+}
+
+// Records an address in the device's history. Devices that failed to save have
+// no ID to record it under.
+func (dt *DeviceTracker) recordIP(d *models.Device, ip, source string, seen time.Time, lease time.Duration) {
+	if d.ID == 0 {
+		return
+	}
+	entry := &models.DeviceIP{DeviceID: d.ID, IPAddress: ip, Source: source, FirstSeen: seen, LastSeen: seen}
+	if lease > 0 {
+		entry.LeaseExpires = seen.Add(lease)
+	}
+	if err := dt.storage.SaveDeviceIP(entry); err != nil {
+		log.Printf("Error saving address %s of device %s: %v", ip, d.Identity(), err)
 	}
 }
 
@@ -179,7 +467,15 @@ func (dt *DeviceTracker) LoadCache() error {
 	defer dt.mu.Unlock()
 
 	for _, d := range devices {
-		dt.cache[d.MACAddress] = d
+		// Devices saved before confidences were recorded: an OS the TTL cannot
+		// have named came from a more confident source
+		if d.OSConfidence == 0 && d.OSFingerprint != "" && d.OSFingerprint != "Unknown" {
+			d.OSConfidence = confidenceTTL
+			if !isTTLGuess(d.OSFingerprint) {
+				d.OSConfidence = confidenceDHCP
+			}
+		}
+		dt.cache[d.Identity()] = d
 	}
 	return nil
 }
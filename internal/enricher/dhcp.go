@@ -0,0 +1,95 @@
+/**
+ * DHCP Fingerprinting.
+ *
+ * Derives the operating system and device type from what a client puts
+ * in its DHCP requests. Each DHCP client asks for options in its own
+ * fixed order, so the parameter request list identifies the OS family
+ * even without a vendor class; the vendor class, when sent, names the
+ * client outright.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package enricher
+
+import "strings"
+
+// One DHCP rule: a lower-case vendor class prefix, or an exact parameter
+// request list, and what it reveals. Empty fields reveal nothing about that
+// attribute.
+type dhcpRule struct {
+	match      string
+	os         string
+	deviceType string
+}
+
+// Vendor class prefixes, checked in order.
+var dhcpVendorClassRules = []dhcpRule{
+	{"msft", "Windows", ""},
+	{"android-dhcp", "Android", "Mobile"},
+	{"hewlett-packard jetdirect", "", "Printer"},
+	{"udhcp", "Linux", "IoT"}, // BusyBox, on routers, cameras and appliances
+	{"dhcpcd", "Linux", ""},
+}
+
+// Parameter request lists of common DHCP clients, as comma-separated option codes.
+var dhcpFingerprintRules = []dhcpRule{
+	// Windows
+	{"1,3,6,15,31,33,43,44,46,47,119,121,249,252", "Windows", "Desktop"}, // 8, 10, 11
+	{"1,15,3,6,44,46,47,31,33,121,249,43", "Windows", "Desktop"},         // 7
+	{"1,15,3,6,44,46,47,31,33,121,249,43,252", "Windows", "Desktop"},     // 7 with WPAD
+
+	// Apple
+	{"1,121,3,6,15,119,252", "iOS", "Mobile"},
+	{"1,121,3,6,15,108,114,119,252", "iOS", "Mobile"},
+	{"1,121,3,6,15,119,252,95,44,46", "macOS", "Desktop"},
+	{"1,121,3,6,15,108,114,119,252,95,44,46", "macOS", "Desktop"},
+
+	// Android
+	{"1,3,6,15,26,28,51,58,59", "Android", "Mobile"},
+	{"1,3,6,15,26,28,51,58,59,43", "Android", "Mobile"},
+	{"1,3,6,15,26,28,51,58,59,43,114", "Android", "Mobile"},
+	{"1,33,3,6,15,28,51,58,59", "Android", "Mobile"},
+
+	// Linux
+	{"1,28,2,3,15,6,119,12,44,47,26,121,42", "Linux", ""}, // ISC dhclient
+	{"1,3,6,12,15,28,42,121,119", "Linux", ""},            // systemd-networkd
+}
+
+// Returns the OS and device type a DHCP client reveals through its parameter
+// request list (fingerprint) and vendor class; either may be empty.
+func ParseDHCPFingerprint(fingerprint, vendorClass string) (os, deviceType string) {
+	class := strings.ToLower(vendorClass)
+	for _, rule := range dhcpVendorClassRules {
+		if class != "" && strings.HasPrefix(class, rule.match) {
+			os, deviceType = rule.os, rule.deviceType
+			break
+		}
+	}
+	for _, rule := range dhcpFingerprintRules {
+		if fingerprint == rule.match {
+			if os == "" {
+				os = rule.os
+			}
+			if deviceType == "" {
+				deviceType = rule.deviceType
+			}
+			return os, deviceType
+		}
+	}
+
+	// Unlisted versions keep their family's telltale options
+	if os == "" && fingerprint != "" {
+		codes := "," + fingerprint + ","
+		switch {
+		case strings.Contains(codes, ",249,"): // Microsoft classless static routes
+			os = "Windows"
+		case strings.HasPrefix(fingerprint, "1,121,3,6,15,"):
+			os = "macOS/iOS"
+		case strings.HasPrefix(fingerprint, "1,3,6,15,26,28,51,58,59"):
+			os = "Android"
+		}
+	}
+	return os, deviceType
+}
@@ -0,0 +1,104 @@
+/**
+ * Service Discovery Fingerprinting.
+ *
+ * Derives the operating system and device type from what a device
+ * announces over mDNS/DNS-SD and SSDP. The services a device offers say
+ * what it is (a Cast receiver, a printer, a speaker), and the model and
+ * UPnP SERVER header it advertises often name the product outright.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package enricher
+
+import (
+	"strings"
+
+	"github.com/kleaSCM/netscope/internal/models"
+)
+
+// One discovery rule: a lower-case substring of a service type or model, and what
+// it reveals. Empty fields reveal nothing about that attribute.
+type discoveryRule struct {
+	token      string
+	os         string
+	deviceType string
+}
+
+// DNS-SD service types and UPnP device types, checked in order. Services that
+// computers and phones offer as well (AirPlay, SMB, Spotify Connect) say nothing.
+var discoveryServiceRules = []discoveryRule{
+	{"_googlecast._tcp", "", "Smart TV"},
+	{"_androidtvremote", "Android", "Smart TV"},
+	{"_amzn-wplay._tcp", "Fire OS", "Smart TV"},
+	{"_roku", "Roku OS", "Smart TV"},
+	{"dial-multiscreen-org:service:dial", "", "Smart TV"},
+	{"_sonos._tcp", "Sonos", "Speaker"},
+	{"device:zoneplayer", "Sonos", "Speaker"},
+	{"_ipp._tcp", "", "Printer"},
+	{"_ipps._tcp", "", "Printer"},
+	{"_printer._tcp", "", "Printer"},
+	{"_pdl-datastream._tcp", "", "Printer"},
+	{"device:printer", "", "Printer"},
+	{"_axis-video._tcp", "", "Camera"},
+	{"device:digitalsecuritycamera", "", "Camera"},
+	{"_hap._tcp", "", "IoT"}, // HomeKit accessories
+	{"_hue._tcp", "", "IoT"},
+	{"device:internetgatewaydevice", "", "Router"},
+}
+
+// Advertised models, checked in order.
+var discoveryModelRules = []discoveryRule{
+	{"appletv", "tvOS", "Smart TV"},
+	{"iphone", "iOS", "Mobile"},
+	{"ipad", "iPadOS", "Tablet"},
+	{"macbook", "macOS", "Desktop"},
+	{"imac", "macOS", "Desktop"},
+	{"macmini", "macOS", "Desktop"},
+	{"macpro", "macOS", "Desktop"},
+	{"chromecast", "Chromecast", "Smart TV"},
+	{"google home", "", "Speaker"},
+	{"google nest", "", "Speaker"},
+	{"homepod", "", "Speaker"},
+}
+
+// Returns the OS and device type a discovery announcement reveals; either may be
+// empty. The services offered come first, then the model, then the SSDP SERVER
+// header, which reads like a User-Agent.
+func ParseDiscovery(d *models.Discovery) (os, deviceType string) {
+	if d == nil {
+		return "", ""
+	}
+
+	fill := func(rule discoveryRule) {
+		if os == "" {
+			os = rule.os
+		}
+		if deviceType == "" {
+			deviceType = rule.deviceType
+		}
+	}
+	for _, service := range d.Services {
+		service = strings.ToLower(service)
+		for _, rule := range discoveryServiceRules {
+			if strings.Contains(service, rule.token) {
+				fill(rule)
+				break
+			}
+		}
+	}
+	if model := strings.ToLower(d.Model); model != "" {
+		for _, rule := range discoveryModelRules {
+			if strings.Contains(model, rule.token) {
+				fill(rule)
+				break
+			}
+		}
+	}
+	if d.Server != "" {
+		serverOS, serverType := ParseUserAgent(d.Server)
+		fill(discoveryRule{os: serverOS, deviceType: serverType})
+	}
+	return os, deviceType
+}
@@ -13,6 +13,7 @@ package enricher
 import (
 	"net"
 	"testing"
+	"time"
 
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
@@ -24,6 +25,7 @@ import (
 type MockStorage struct {
 	storage.Storage
 	devices map[string]*models.Device
+	ips     []*models.DeviceIP
 }
 
 func NewMockStorage() *MockStorage {
@@ -33,10 +35,18 @@ func NewMockStorage() *MockStorage {
 }
 
 func (m *MockStorage) SaveDevice(d *models.Device) error {
+	if d.ID == 0 {
+		d.ID = int64(len(m.devices) + 1)
+	}
 	m.devices[d.MACAddress] = d
 	return nil
 }
 
+func (m *MockStorage) SaveDeviceIP(ip *models.DeviceIP) error {
+	m.ips = append(m.ips, ip)
+	return nil
+}
+
 func (m *MockStorage) ListDevices() ([]*models.Device, error) {
 	list := make([]*models.Device, 0, len(m.devices))
 	for _, d := range m.devices {
@@ -105,3 +115,294 @@ func parseMAC(s string) net.HardwareAddr {
 func parseIP(s string) net.IP {
 	return net.ParseIP(s)
 }
+
+// Verifies that packets from links without MAC addresses (tun, PPP) still yield a
+// device, keyed by its private source IP, and that remote sources are ignored.
+func TestDeviceTracker_IPFallback(t *testing.T) {
+	tracker := NewDeviceTracker(NewMockStorage())
+	packet := func(src string) *models.Packet {
+		return &models.Packet{
+			Timestamp: time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC),
+			Layer2:    &models.Layer2{},
+			Layer3:    &models.Layer3{SrcIP: src, DstIP: "1.1.1.1", Version: "IPv4", TTL: 128},
+		}
+	}
+
+	device := tracker.TrackPacket(packet("10.8.0.2"))
+	if device == nil {
+		t.Fatal("Expected a device for a private source without a MAC")
+	}
+	if device.MACAddress != "" || device.Identity() != "10.8.0.2" || device.OSFingerprint != "Windows" {
+		t.Errorf("Expected an IP-keyed Windows device, got MAC %q identity %q OS %q", device.MACAddress, device.Identity(), device.OSFingerprint)
+	}
+	if again := tracker.TrackPacket(packet("10.8.0.2")); again != device {
+		t.Error("Expected the same device for the same IP")
+	}
+	if tracker.TrackPacket(packet("8.8.8.8")) != nil {
+		t.Error("Remote sources without a MAC should not become devices")
+	}
+}
+
+// Verifies that the User-Agent of a plain HTTP request refines the TTL-based OS
+// guess and fills in an unknown device type.
+func TestDeviceTracker_UserAgent(t *testing.T) {
+	tracker := NewDeviceTracker(NewMockStorage())
+	packet := func(userAgent string) *models.Packet {
+		return &models.Packet{
+			Timestamp: time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC),
+			Layer2:    &models.Layer2{SrcMAC: "00:11:22:33:44:55"},
+			Layer3:    &models.Layer3{SrcIP: "192.168.1.60", DstIP: "203.0.113.7", Version: "IPv4", TTL: 64},
+			HTTP:      &models.HTTP{IsRequest: true, Method: "GET", URI: "/", UserAgent: userAgent},
+		}
+	}
+
+	device := tracker.TrackPacket(packet("Roku/DVP-9.10 (519.10E04111A)"))
+	if device.OSFingerprint != "Roku OS" || device.DeviceType != "Smart TV" {
+		t.Errorf("Expected a Roku OS Smart TV, got %q %q", device.OSFingerprint, device.DeviceType)
+	}
+
+	// A later request from a different app keeps the known device type
+	device = tracker.TrackPacket(packet("Mozilla/5.0 (X11; Linux armv7l) AppleWebKit/537.36"))
+	if device.OSFingerprint != "Linux" || device.DeviceType != "Smart TV" {
+		t.Errorf("Expected the device type to stick, got %q %q", device.OSFingerprint, device.DeviceType)
+	}
+}
+
+// Verifies OS and device type extraction from common User-Agent strings.
+func TestParseUserAgent(t *testing.T) {
+	tests := []struct {
+		userAgent  string
+		wantOS     string
+		wantDevice string
+	}{
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15", "iOS", "Mobile"},
+		{"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 Mobile Safari/537.36", "Android", "Mobile"},
+		{"Mozilla/5.0 (Linux; Android 13; SM-X200) AppleWebKit/537.36 Safari/537.36", "Android", "Tablet"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Edg/120.0", "Windows", "Desktop"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64; Xbox; Xbox One) Edge/44.18363", "Windows", "Game Console"},
+		{"Mozilla/5.0 (Linux; Android 9; AFTMM Build/PS7233) AppleWebKit/537.36", "Fire OS", "Smart TV"},
+		{"Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36", "ChromeOS", "Desktop"},
+		{"ESP8266HTTPClient", "", "IoT"},
+		{"curl/8.4.0", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.userAgent, func(t *testing.T) {
+			os, deviceType := ParseUserAgent(tt.userAgent)
+			if os != tt.wantOS || deviceType != tt.wantDevice {
+				t.Errorf("Expected %q %q, got %q %q", tt.wantOS, tt.wantDevice, os, deviceType)
+			}
+		})
+	}
+}
+
+// Verifies that DHCP names the client and reveals its OS, even before it has an
+// address, and that the lease a server binds lands in the address history.
+func TestDeviceTracker_DHCP(t *testing.T) {
+	store := NewMockStorage()
+	tracker := NewDeviceTracker(store)
+	start := time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC)
+	const client = "00:02:b3:11:22:33"
+
+	// The client's Request, sent from 0.0.0.0
+	request := &models.Packet{
+		Timestamp: start,
+		Layer2:    &models.Layer2{SrcMAC: client, DstMAC: "ff:ff:ff:ff:ff:ff"},
+		Layer3:    &models.Layer3{SrcIP: "0.0.0.0", DstIP: "255.255.255.255", Version: "IPv4", TTL: 128},
+		DHCP: &models.DHCP{Version: 4, MessageType: "Request", ClientMAC: client, Hostname: "kitchen-laptop",
+			VendorClass: "MSFT 5.0", Fingerprint: "1,3,6,15,31,33,43,44,46,47,119,121,249,252"},
+	}
+	device := tracker.TrackPacket(request)
+	if device == nil || device.Hostname != "kitchen-laptop" || device.Vendor != "Intel" {
+		t.Fatalf("Expected the Intel client named kitchen-laptop, got %+v", device)
+	}
+	if device.OSFingerprint != "Windows" || device.DeviceType != "Desktop" || device.DHCPVendorClass != "MSFT 5.0" {
+		t.Errorf("Expected a Windows desktop, got %q %q %q", device.OSFingerprint, device.DeviceType, device.DHCPVendorClass)
+	}
+
+	// The server's Ack, which is about the client rather than the server sending it
+	ack := &models.Packet{
+		Timestamp: start.Add(time.Millisecond),
+		Layer2:    &models.Layer2{SrcMAC: "00:03:93:00:00:01", DstMAC: client},
+		Layer3:    &models.Layer3{SrcIP: "192.168.1.1", DstIP: "192.168.1.23", Version: "IPv4", TTL: 64},
+		DHCP:      &models.DHCP{Version: 4, MessageType: "Ack", FromServer: true, ClientMAC: client, AssignedIP: "192.168.1.23", LeaseTime: time.Hour},
+	}
+	if router := tracker.TrackPacket(ack); router == nil || router.MACAddress != "00:03:93:00:00:01" {
+		t.Errorf("Expected the Ack attributed to the router, got %+v", router)
+	}
+	if device.IPAddress != "192.168.1.23" {
+		t.Errorf("Expected the client to take its leased address, got %q", device.IPAddress)
+	}
+	var lease *models.DeviceIP
+	for _, ip := range store.ips {
+		if ip.DeviceID == device.ID && ip.Source == "DHCP" {
+			lease = ip
+		}
+	}
+	if lease == nil || lease.IPAddress != "192.168.1.23" || !lease.LeaseExpires.Equal(start.Add(time.Millisecond+time.Hour)) {
+		t.Errorf("Expected the lease in the client's address history, got %+v", lease)
+	}
+
+	// A User-Agent still refines the OS that DHCP revealed
+	browse := &models.Packet{
+		Timestamp: start.Add(time.Second),
+		Layer2:    &models.Layer2{SrcMAC: client},
+		Layer3:    &models.Layer3{SrcIP: "192.168.1.23", DstIP: "203.0.113.7", Version: "IPv4", TTL: 128},
+		HTTP:      &models.HTTP{IsRequest: true, UserAgent: "Mozilla/5.0 (X11; CrOS x86_64 14541.0.0)"},
+	}
+	if tracker.TrackPacket(browse) != device || device.OSFingerprint != "ChromeOS" {
+		t.Errorf("Expected the User-Agent to refine the OS, got %q", device.OSFingerprint)
+	}
+}
+
+// Verifies OS and device type detection from DHCP parameter request lists and
+// vendor classes.
+func TestParseDHCPFingerprint(t *testing.T) {
+	tests := []struct {
+		fingerprint string
+		vendorClass string
+		wantOS      string
+		wantDevice  string
+	}{
+		{"1,3,6,15,31,33,43,44,46,47,119,121,249,252", "MSFT 5.0", "Windows", "Desktop"},
+		{"1,121,3,6,15,119,252", "", "iOS", "Mobile"},
+		{"1,121,3,6,15,119,252,95,44,46", "", "macOS", "Desktop"},
+		{"1,3,6,15,26,28,51,58,59,43", "android-dhcp-9", "Android", "Mobile"},
+		{"1,3,6,12,15,28,42", "udhcp 1.30.1", "Linux", "IoT"},
+		{"1,3,6,15,44,46,47,249", "", "Windows", ""},
+		{"1,121,3,6,15,119,252,95,44,46,101", "", "macOS/iOS", ""},
+		{"1,3,6", "", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fingerprint, func(t *testing.T) {
+			os, deviceType := ParseDHCPFingerprint(tt.fingerprint, tt.vendorClass)
+			if os != tt.wantOS || deviceType != tt.wantDevice {
+				t.Errorf("Expected %q %q, got %q %q", tt.wantOS, tt.wantDevice, os, deviceType)
+			}
+		})
+	}
+}
+
+// Verifies that discovery announcements name a device and reveal its model and
+// type, without overriding the name it gave over DHCP.
+func TestDeviceTracker_Discovery(t *testing.T) {
+	store := NewMockStorage()
+	tracker := NewDeviceTracker(store)
+	start := time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC)
+
+	announce := &models.Packet{
+		Timestamp: start,
+		Layer2:    &models.Layer2{SrcMAC: "f4:f5:d8:aa:bb:cc", DstMAC: "01:00:5e:00:00:fb"},
+		Layer3:    &models.Layer3{SrcIP: "192.168.1.40", DstIP: "224.0.0.251", Version: "IPv4", TTL: 255},
+		Discovery: &models.Discovery{Protocol: "mDNS", Hostname: "Living Room TV",
+			Services: []string{"_googlecast._tcp"}, Model: "Chromecast Ultra"},
+	}
+	device := tracker.TrackPacket(announce)
+	if device == nil || device.Hostname != "Living Room TV" || device.Model != "Chromecast Ultra" {
+		t.Fatalf("Expected the announced name and model, got %+v", device)
+	}
+	if device.OSFingerprint != "Chromecast" || device.DeviceType != "Smart TV" {
+		t.Errorf("Expected a Chromecast smart TV, got %q %q", device.OSFingerprint, device.DeviceType)
+	}
+
+	// A DHCP hostname beats any name announced later
+	const laptop = "00:02:b3:11:22:33"
+	tracker.TrackPacket(&models.Packet{
+		Timestamp: start,
+		Layer2:    &models.Layer2{SrcMAC: laptop, DstMAC: "ff:ff:ff:ff:ff:ff"},
+		Layer3:    &models.Layer3{SrcIP: "0.0.0.0", DstIP: "255.255.255.255", Version: "IPv4", TTL: 128},
+		DHCP:      &models.DHCP{Version: 4, MessageType: "Request", ClientMAC: laptop, Hostname: "kitchen-laptop"},
+	})
+	device = tracker.TrackPacket(&models.Packet{
+		Timestamp: start.Add(time.Second),
+		Layer2:    &models.Layer2{SrcMAC: laptop, DstMAC: "01:00:5e:00:00:fc"},
+		Layer3:    &models.Layer3{SrcIP: "192.168.1.23", DstIP: "224.0.0.252", Version: "IPv4", TTL: 128},
+		Discovery: &models.Discovery{Protocol: "LLMNR", Hostname: "KITCHEN-LAPTOP"},
+	})
+	if device == nil || device.Hostname != "kitchen-laptop" {
+		t.Errorf("Expected the DHCP hostname to stand, got %+v", device)
+	}
+}
+
+// Verifies OS and device type detection from announced services, models and SSDP
+// SERVER headers.
+func TestParseDiscovery(t *testing.T) {
+	tests := []struct {
+		name       string
+		discovery  *models.Discovery
+		wantOS     string
+		wantDevice string
+	}{
+		{"cast", &models.Discovery{Services: []string{"_googlecast._tcp"}, Model: "Chromecast"}, "Chromecast", "Smart TV"},
+		{"printer", &models.Discovery{Services: []string{"_http._tcp", "_ipp._tcp"}, Model: "HP LaserJet M404"}, "", "Printer"},
+		{"apple tv", &models.Discovery{Services: []string{"_airplay._tcp"}, Model: "AppleTV11,1"}, "tvOS", "Smart TV"},
+		{"macbook", &models.Discovery{Services: []string{"_smb._tcp"}, Model: "MacBookPro18,3"}, "macOS", "Desktop"},
+		{"sonos", &models.Discovery{Services: []string{"urn:schemas-upnp-org:device:ZonePlayer:1"}, Server: "Linux UPnP/1.0 Sonos/70.3-35220 (ZPS1)"}, "Sonos", "Speaker"},
+		{"router", &models.Discovery{Services: []string{"urn:schemas-upnp-org:device:InternetGatewayDevice:1"}, Server: "Linux/3.4 UPnP/1.0 MiniUPnPd/2.1"}, "Linux", "Router"},
+		{"homekit", &models.Discovery{Services: []string{"_hap._tcp"}}, "", "IoT"},
+		{"nothing", &models.Discovery{Services: []string{"_spotify-connect._tcp"}}, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os, deviceType := ParseDiscovery(tt.discovery)
+			if os != tt.wantOS || deviceType != tt.wantDevice {
+				t.Errorf("Expected %q %q, got %q %q", tt.wantOS, tt.wantDevice, os, deviceType)
+			}
+		})
+	}
+}
+
+// Verifies that a SYN's p0f match names the OS with its confidence, that less
+// confident sources leave it alone and more confident ones replace it, and that
+// scanner signatures name no OS.
+func TestDeviceTracker_TCPSignature(t *testing.T) {
+	tracker := NewDeviceTracker(NewMockStorage())
+	start := time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC)
+	const mac = "00:11:22:33:44:55"
+	syn := &models.Packet{
+		Timestamp: start,
+		Layer2:    &models.Layer2{SrcMAC: mac},
+		Layer3:    &models.Layer3{SrcIP: "192.168.1.60", DstIP: "203.0.113.7", Version: "IPv4", TTL: 64},
+		TCPSig: &models.TCPSignature{Version: 4, TTL: 64, MSS: 1460, Window: 64240, WindowScale: 7,
+			Options: "mss,sok,ts,nop,ws", Quirks: "df,id+"},
+	}
+	device := tracker.TrackPacket(syn)
+	if device.OSFingerprint != "Linux 3.11 and newer" || device.OSConfidence != confidenceP0f {
+		t.Fatalf("Expected Linux 3.11 and newer from the SYN, got %q at %d%%", device.OSFingerprint, device.OSConfidence)
+	}
+
+	// DHCP is less sure than a specific signature
+	tracker.TrackPacket(&models.Packet{
+		Timestamp: start.Add(time.Second),
+		Layer2:    &models.Layer2{SrcMAC: mac, DstMAC: "ff:ff:ff:ff:ff:ff"},
+		Layer3:    &models.Layer3{SrcIP: "192.168.1.60", DstIP: "255.255.255.255", Version: "IPv4", TTL: 64},
+		DHCP:      &models.DHCP{Version: 4, MessageType: "Request", ClientMAC: mac, Fingerprint: "1,3,6,12,15,28,42,121,119"},
+	})
+	if device.OSFingerprint != "Linux 3.11 and newer" {
+		t.Errorf("Expected DHCP to leave the p0f match, got %q", device.OSFingerprint)
+	}
+
+	// A port scan from the same host is a tool, not its OS
+	tracker.TrackPacket(&models.Packet{
+		Timestamp: start.Add(2 * time.Second),
+		Layer2:    &models.Layer2{SrcMAC: mac},
+		Layer3:    &models.Layer3{SrcIP: "192.168.1.60", DstIP: "192.168.1.1", Version: "IPv4", TTL: 41},
+		TCPSig:    &models.TCPSignature{Version: 4, TTL: 41, MSS: 1460, Window: 1024, Options: "mss"},
+	})
+	if device.OSFingerprint != "Linux 3.11 and newer" {
+		t.Errorf("Expected the scan to leave the OS, got %q", device.OSFingerprint)
+	}
+
+	// The User-Agent names the distribution's platform outright
+	tracker.TrackPacket(&models.Packet{
+		Timestamp: start.Add(3 * time.Second),
+		Layer2:    &models.Layer2{SrcMAC: mac},
+		Layer3:    &models.Layer3{SrcIP: "192.168.1.60", DstIP: "203.0.113.7", Version: "IPv4", TTL: 64},
+		HTTP:      &models.HTTP{IsRequest: true, UserAgent: "Mozilla/5.0 (X11; CrOS x86_64 14541.0.0)"},
+	})
+	if device.OSFingerprint != "ChromeOS" || device.OSConfidence != confidenceUserAgent {
+		t.Errorf("Expected the User-Agent to replace the p0f match, got %q at %d%%", device.OSFingerprint, device.OSConfidence)
+	}
+}
@@ -2,7 +2,11 @@
  * JA3 Fingerprint Database.
  *
  * Maps known JA3 fingerprints to application names for identification.
- * Uses an embedded database of common client fingerprints.
+ * Uses an embedded database of common client fingerprints, and of client
+ * and server (JA3 and JA3S) pairs that single out tools whose ClientHello
+ * alone is indistinguishable from a browser. JA4+ fingerprints (JA4, JA4S,
+ * JA4H, JA4X) are held alongside, since JA3 no longer identifies clients
+ * that randomise their extension order.
  *
  * Author: KleaSCM
  * Email: KleaSCM@gmail.com
@@ -11,12 +15,15 @@
 package enricher
 
 import (
+	"strings"
 	"sync"
 )
 
 // JA3Database holds known JA3 fingerprints and their associated applications.
 type JA3Database struct {
 	fingerprints map[string]string
+	pairs        map[string]string // Keyed by pairKey(ja3, ja3s)
+	ja4          map[string]string // Whole JA4+ fingerprints, or their first two sections
 	mu           sync.RWMutex
 }
 
@@ -24,6 +31,8 @@ type JA3Database struct {
 func NewJA3Database() *JA3Database {
 	db := &JA3Database{
 		fingerprints: make(map[string]string),
+		pairs:        make(map[string]string),
+		ja4:          make(map[string]string),
 	}
 	db.loadDefaults()
 	return db
@@ -49,6 +58,57 @@ func (db *JA3Database) Add(ja3, application string) {
 	db.fingerprints[ja3] = application
 }
 
+// LookupPair returns the application name for a JA3 and JA3S pair.
+// Returns empty string if the pair is unknown.
+func (db *JA3Database) LookupPair(ja3, ja3s string) string {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.pairs[pairKey(ja3, ja3s)]
+}
+
+// AddPair adds a JA3 and JA3S pair to the database.
+func (db *JA3Database) AddPair(ja3, ja3s, application string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.pairs[pairKey(ja3, ja3s)] = application
+}
+
+// LookupJA4 returns the application name for a JA4, JA4S, JA4H or JA4X fingerprint.
+// An entry for the first two sections alone ("t13d1516h2_8daaf6152771") matches
+// every fingerprint that starts with them. Returns empty string if unknown.
+func (db *JA3Database) LookupJA4(fingerprint string) string {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if app, ok := db.ja4[fingerprint]; ok {
+		return app
+	}
+	// JA4H has four sections and the others three, so the prefix ends at the second '_'
+	first := strings.IndexByte(fingerprint, '_')
+	if first < 0 {
+		return ""
+	}
+	if second := strings.IndexByte(fingerprint[first+1:], '_'); second >= 0 {
+		return db.ja4[fingerprint[:first+1+second]]
+	}
+	return ""
+}
+
+// AddJA4 adds a JA4+ fingerprint, whole or as its first two sections, to the database.
+func (db *JA3Database) AddJA4(fingerprint, application string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.ja4[fingerprint] = application
+}
+
+// pairKey joins a client and server fingerprint into one map key.
+func pairKey(ja3, ja3s string) string {
+	return ja3 + "," + ja3s
+}
+
 // loadDefaults populates the database with known fingerprints.
 // Source: https://github.com/salesforce/ja3/blob/master/lists/osx-nix-ja3.csv
 func (db *JA3Database) loadDefaults() {
@@ -89,4 +149,28 @@ func (db *JA3Database) loadDefaults() {
 	for ja3, app := range defaults {
 		db.fingerprints[ja3] = app
 	}
+
+	// Client and server pairs. The Cobalt Strike client shares its JA3 with Chrome
+	// above; only the server's reply tells them apart.
+	// Source: https://engineering.salesforce.com/tls-fingerprinting-with-ja3-and-ja3s-247362855967/
+	pairs := []struct{ ja3, ja3s, app string }{
+		{"72a589da586844d7f0818ce684948eea", "70999de61602be74d4b25185843bd18e", "Metasploit (Meterpreter)"},
+		{"a0e9f5d64349fb13191bc781f81f42e1", "b742b407517bac9536a77a7b0fee28e9", "Cobalt Strike"},
+	}
+
+	for _, p := range pairs {
+		db.pairs[pairKey(p.ja3, p.ja3s)] = p.app
+	}
+
+	// JA4 by protocol, counts and sorted cipher suites: stable across a browser's
+	// releases while the extension hash changes with new features.
+	// Source: https://github.com/FoxIO-LLC/ja4/blob/main/ja4plus-mapping.csv
+	ja4 := map[string]string{
+		"t13d1516h2_8daaf6152771": "Chrome",
+		"t13d1715h2_5b57614c22b0": "Firefox",
+	}
+
+	for fingerprint, app := range ja4 {
+		db.ja4[fingerprint] = app
+	}
 }
@@ -0,0 +1,44 @@
+/**
+ * JA3 and JA4+ Database Tests.
+ *
+ * Verifies that JA4+ fingerprints match entries for the whole fingerprint
+ * or for its first two sections, whatever the number of sections.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package enricher
+
+import "testing"
+
+// Verifies whole and two-section prefix matches for JA4, JA4S and JA4H.
+func TestJA3Database_LookupJA4(t *testing.T) {
+	db := NewJA3Database()
+	db.AddJA4("t13d1516h2_8daaf6152771_02713d6af862", "Exact Client")
+	db.AddJA4("t13d1715h2_5b57614c22b0", "Prefix Client")
+	db.AddJA4("t130200_1301", "Prefix Server")
+	db.AddJA4("ge11cn05enus_974ebe531c03", "Prefix HTTP Client")
+
+	tests := []struct {
+		name        string
+		fingerprint string
+		want        string
+	}{
+		{"whole ja4", "t13d1516h2_8daaf6152771_02713d6af862", "Exact Client"},
+		{"ja4 prefix", "t13d1715h2_5b57614c22b0_3d5424432f57", "Prefix Client"},
+		{"ja4s prefix", "t130200_1301_234ea6891581", "Prefix Server"},
+		{"ja4h prefix", "ge11cn05enus_974ebe531c03_000000000000_000000000000", "Prefix HTTP Client"},
+		{"ja4h other headers", "ge11cn05enus_1a2b3c4d5e6f_000000000000_000000000000", ""},
+		{"unknown", "t12d0909h1_aaaaaaaaaaaa_bbbbbbbbbbbb", ""},
+		{"no sections", "t13d1516h2", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := db.LookupJA4(tt.fingerprint); got != tt.want {
+				t.Errorf("Expected %q for %s, got %q", tt.want, tt.fingerprint, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,715 @@
+/**
+ * p0f TCP Signature Database.
+ *
+ * Identifies operating systems from the SYN and SYN+ACK packets they send,
+ * using signatures in the p0f v3 format: initial TTL, IP options length,
+ * MSS, window size and scale, TCP option layout, quirks and payload. The
+ * database loads from a p0f.fp file; a built-in subset of the signatures
+ * p0f ships covers the common desktop, mobile and server stacks when no
+ * file is available. Only the [tcp:request] and [tcp:response] sections
+ * are used.
+ *
+ * Matching follows p0f: the option layout and IP options must match
+ * exactly, quirks may differ only in ways that firewalls and NAT cause,
+ * and a TTL too far below the initial TTL makes the match fuzzy.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package enricher
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/kleaSCM/netscope/internal/models"
+	"github.com/kleaSCM/netscope/internal/parser"
+)
+
+// Hops below the initial TTL beyond which p0f no longer trusts a match.
+const p0fMaxDistance = 35
+
+// Window size forms in a signature.
+const (
+	p0fWindowAny    = iota // *
+	p0fWindowExact         // N
+	p0fWindowMSS           // mss*N
+	p0fWindowMTU           // mtu*N
+	p0fWindowModulo        // %N
+)
+
+// Quirks in p0f order; each is one bit of a signature's quirk set.
+var p0fQuirks = []string{
+	"df", "id+", "id-", "ecn", "0+", "flow", "seq-", "ack+", "ack-",
+	"uptr+", "urgf+", "pushf+", "ts1-", "ts2+", "opt+", "exws", "bad",
+}
+
+// Bits of the quirks that only IPv4 or only IPv6 headers can have.
+var (
+	p0fQuirksIPv4 = p0fQuirkSet("df,id+,id-,0+")
+	p0fQuirksIPv6 = p0fQuirkSet("flow")
+)
+
+// P0fDatabase holds p0f v3 signatures of SYN packets (requests) and SYN+ACK
+// packets (responses).
+type P0fDatabase struct {
+	requests  []p0fSignature
+	responses []p0fSignature
+	mu        sync.RWMutex
+}
+
+// One parsed signature line and the label it belongs to.
+type p0fSignature struct {
+	label       *p0fLabel
+	version     int   // 4 or 6, 0 for either
+	ttl         uint8 // Initial TTL
+	badTTL      bool  // "N-": the TTL says nothing about distance
+	ipOptionLen int
+	mss         int // -1 for any
+	windowType  int
+	window      int
+	scale       int // -1 for any
+	options     string
+	quirks      uint32
+	payload     int // 0 none, 1 some, -1 either
+}
+
+// A signature's label: "s:unix:Linux:3.11 and newer".
+type p0fLabel struct {
+	generic bool   // "g" rather than "s"pecific
+	class   string // "unix", "win", "other", or "!" for tools rather than systems
+	name    string
+	flavor  string
+}
+
+// P0fMatch describes the signature a SYN or SYN+ACK matched.
+type P0fMatch struct {
+	Name       string // e.g. "Linux"
+	Flavor     string // e.g. "3.11 and newer"
+	Class      string // "unix", "win", "other", or "!" for tools such as scanners
+	Generic    bool   // Matched a generic signature for the OS family
+	Fuzzy      bool   // Matched only with tolerated differences
+	Distance   int    // Hops from the initial TTL
+	Confidence int    // Percent, as Device.OSConfidence
+}
+
+// String returns the OS with its flavor, e.g. "Linux 3.11 and newer".
+func (m *P0fMatch) String() string {
+	if m.Flavor == "" {
+		return m.Name
+	}
+	return m.Name + " " + m.Flavor
+}
+
+// NewP0fDatabase creates a database holding the built-in signatures.
+func NewP0fDatabase() *P0fDatabase {
+	db := &P0fDatabase{}
+	if err := db.Load(strings.NewReader(p0fDefaults)); err != nil {
+		panic(fmt.Sprintf("p0f: built-in signatures: %v", err))
+	}
+	return db
+}
+
+// LoadFile replaces the signatures with those of a p0f v3 database file.
+func (db *P0fDatabase) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open p0f database: %w", err)
+	}
+	defer f.Close()
+
+	if err := db.Load(f); err != nil {
+		return fmt.Errorf("failed to load %s: %w", path, err)
+	}
+	return nil
+}
+
+// Load replaces the signatures with those read from a p0f v3 database. The
+// database is left unchanged when any line fails to parse.
+func (db *P0fDatabase) Load(r io.Reader) error {
+	var requests, responses []p0fSignature
+	var section *[]p0fSignature
+	var label *p0fLabel
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if line[0] == '[' {
+			label = nil
+			switch line {
+			case "[tcp:request]":
+				section = &requests
+			case "[tcp:response]":
+				section = &responses
+			default:
+				section = nil // MTU and HTTP signatures
+			}
+			continue
+		}
+		if section == nil {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("line %d: expected key = value", n)
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "label":
+			l, err := parseP0fLabel(value)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", n, err)
+			}
+			label = l
+		case "sig":
+			if label == nil {
+				return fmt.Errorf("line %d: signature without a label", n)
+			}
+			sig, err := parseP0fSignature(value)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", n, err)
+			}
+			sig.label = label
+			*section = append(*section, sig)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.requests, db.responses = requests, responses
+	return nil
+}
+
+// Len returns the number of SYN and SYN+ACK signatures held.
+func (db *P0fDatabase) Len() (requests, responses int) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return len(db.requests), len(db.responses)
+}
+
+// Match returns the best signature for a SYN or SYN+ACK: the first specific
+// match, else the first generic one, else the first fuzzy one. Returns nil when
+// none matches.
+func (db *P0fDatabase) Match(sig *models.TCPSignature) *P0fMatch {
+	if sig == nil {
+		return nil
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	signatures := db.requests
+	if sig.Response {
+		signatures = db.responses
+	}
+
+	quirks := p0fQuirkSet(sig.Quirks)
+	multiple, mtu := p0fWindowMultiple(sig)
+	var generic, fuzzy *p0fSignature
+	for i := range signatures {
+		ref := &signatures[i]
+		if ref.version != 0 && ref.version != sig.Version {
+			continue
+		}
+		if ref.options != sig.Options || ref.ipOptionLen != sig.IPOptionLen {
+			continue
+		}
+
+		inexact := false
+		refQuirks, observed := ref.quirks, quirks
+		if ref.version == 0 {
+			// Either version: only the quirks the observed header can have count.
+			// Such signatures are written for IPv4, so unlike p0f the flow label
+			// IPv6 stacks set on every connection does not count against them.
+			if sig.Version == 4 {
+				refQuirks &^= p0fQuirksIPv6
+			} else {
+				refQuirks &^= p0fQuirksIPv4
+				observed &^= p0fQuirksIPv6
+			}
+		}
+		if refQuirks != observed {
+			// Firewalls clear DF and rewrite IDs, and ECN comes and goes
+			lost := refQuirks &^ observed
+			gained := observed &^ refQuirks
+			if lost&^p0fQuirkSet("df,id+") != 0 || gained&^p0fQuirkSet("id-,ecn") != 0 {
+				continue
+			}
+			inexact = true
+		}
+
+		if ref.badTTL {
+			if ref.ttl < sig.TTL {
+				continue
+			}
+		} else if ref.ttl < sig.TTL || int(ref.ttl-sig.TTL) > p0fMaxDistance {
+			inexact = true
+		}
+
+		if ref.mss != -1 && ref.mss != sig.MSS {
+			continue
+		}
+		switch ref.windowType {
+		case p0fWindowExact:
+			if ref.window != sig.Window {
+				continue
+			}
+		case p0fWindowModulo:
+			if sig.Window%ref.window != 0 {
+				continue
+			}
+		case p0fWindowMSS:
+			if mtu || ref.window != multiple {
+				continue
+			}
+		case p0fWindowMTU:
+			if !mtu || ref.window != multiple {
+				continue
+			}
+		}
+		if ref.scale != -1 && ref.scale != sig.WindowScale {
+			continue
+		}
+		if ref.payload != -1 && (ref.payload == 1) != sig.Payload {
+			continue
+		}
+
+		switch {
+		case inexact:
+			if fuzzy == nil {
+				fuzzy = ref
+			}
+		case ref.label.generic:
+			if generic == nil {
+				generic = ref
+			}
+		default:
+			return newP0fMatch(ref, sig, false)
+		}
+	}
+
+	if generic != nil {
+		return newP0fMatch(generic, sig, false)
+	}
+	if fuzzy != nil {
+		return newP0fMatch(fuzzy, sig, true)
+	}
+	return nil
+}
+
+// Builds the match result for a signature.
+func newP0fMatch(ref *p0fSignature, sig *models.TCPSignature, fuzzy bool) *P0fMatch {
+	m := &P0fMatch{
+		Name:    ref.label.name,
+		Flavor:  ref.label.flavor,
+		Class:   ref.label.class,
+		Generic: ref.label.generic,
+		Fuzzy:   fuzzy,
+	}
+	if !ref.badTTL && ref.ttl >= sig.TTL {
+		m.Distance = int(ref.ttl - sig.TTL)
+	} else {
+		m.Distance = int(parser.InitialTTL(sig.TTL) - sig.TTL)
+	}
+
+	switch {
+	case fuzzy:
+		m.Confidence = confidenceP0fFuzzy
+	case ref.label.generic:
+		m.Confidence = confidenceP0fGeneric
+	default:
+		m.Confidence = confidenceP0f
+	}
+	return m
+}
+
+// Returns the window size as a multiple of the MSS or, when mtu is set, of the
+// MTU, trying the divisors p0f does. Returns -1 when it is neither.
+func p0fWindowMultiple(sig *models.TCPSignature) (multiple int, mtu bool) {
+	if sig.Window == 0 || sig.MSS < 100 {
+		return -1, false
+	}
+
+	const minIPv4, minIPv6 = 40, 60 // Bare IP and TCP headers
+	timestamps := strings.Contains(","+sig.Options+",", ",ts,")
+	ipv6 := sig.Version == 6
+	divisors := []struct {
+		divisor int
+		mtu     bool
+		applies bool
+	}{
+		{sig.MSS, false, true},
+		// Some stacks take the timestamp option off the MSS first
+		{sig.MSS - 12, false, timestamps},
+		// Or use the MSS of another interface, most often Ethernet
+		{1500 - minIPv4, false, true},
+		{1500 - minIPv4 - 12, false, timestamps},
+		{1500 - minIPv6, false, ipv6},
+		{1500 - minIPv6 - 12, false, ipv6 && timestamps},
+		// And some the MTU in place of the MSS
+		{sig.MSS + minIPv4, true, true},
+		{sig.MSS + minIPv6, true, ipv6},
+		{1500, true, true},
+	}
+	for _, d := range divisors {
+		if d.applies && sig.Window%d.divisor == 0 {
+			return sig.Window / d.divisor, d.mtu
+		}
+	}
+	return -1, false
+}
+
+// Parses a label: "type:class:name:flavor".
+func parseP0fLabel(value string) (*p0fLabel, error) {
+	fields := strings.SplitN(value, ":", 4)
+	if len(fields) != 4 || fields[2] == "" {
+		return nil, fmt.Errorf("malformed label %q", value)
+	}
+	label := &p0fLabel{class: fields[1], name: fields[2], flavor: fields[3]}
+	switch fields[0] {
+	case "s":
+	case "g":
+		label.generic = true
+	default:
+		return nil, fmt.Errorf("unknown label type %q", fields[0])
+	}
+	return label, nil
+}
+
+// Parses a signature: "ver:ittl:olen:mss:wsize,scale:olayout:quirks:pclass".
+func parseP0fSignature(value string) (p0fSignature, error) {
+	var sig p0fSignature
+	fields := strings.Split(value, ":")
+	if len(fields) != 8 {
+		return sig, fmt.Errorf("malformed signature %q", value)
+	}
+
+	switch fields[0] {
+	case "4":
+		sig.version = 4
+	case "6":
+		sig.version = 6
+	case "*":
+	default:
+		return sig, fmt.Errorf("unknown IP version %q", fields[0])
+	}
+
+	ttl := fields[1]
+	if strings.HasSuffix(ttl, "-") {
+		sig.badTTL = true
+		ttl = strings.TrimSuffix(ttl, "-")
+	}
+	hops := 0
+	if base, distance, ok := strings.Cut(ttl, "+"); ok {
+		// Observed TTL and distance, as p0f prints raw signatures
+		n, err := strconv.Atoi(distance)
+		if err != nil {
+			return sig, fmt.Errorf("malformed TTL %q", fields[1])
+		}
+		ttl, hops = base, n
+	}
+	n, err := strconv.Atoi(ttl)
+	if err != nil || n+hops < 1 || n+hops > 255 {
+		return sig, fmt.Errorf("malformed TTL %q", fields[1])
+	}
+	sig.ttl = uint8(n + hops)
+
+	if sig.ipOptionLen, err = strconv.Atoi(fields[2]); err != nil {
+		return sig, fmt.Errorf("malformed IP options length %q", fields[2])
+	}
+	if sig.mss, err = p0fWildcard(fields[3]); err != nil {
+		return sig, fmt.Errorf("malformed MSS %q", fields[3])
+	}
+
+	window, scale, ok := strings.Cut(fields[4], ",")
+	if !ok {
+		return sig, fmt.Errorf("malformed window %q", fields[4])
+	}
+	if err := sig.parseWindow(window); err != nil {
+		return sig, err
+	}
+	if sig.scale, err = p0fWildcard(scale); err != nil {
+		return sig, fmt.Errorf("malformed window scale %q", scale)
+	}
+
+	sig.options = fields[5]
+	for _, quirk := range strings.Split(fields[6], ",") {
+		if quirk != "" && p0fQuirkSet(quirk) == 0 {
+			return sig, fmt.Errorf("unknown quirk %q", quirk)
+		}
+	}
+	sig.quirks = p0fQuirkSet(fields[6])
+
+	switch fields[7] {
+	case "0":
+		sig.payload = 0
+	case "+":
+		sig.payload = 1
+	case "*":
+		sig.payload = -1
+	default:
+		return sig, fmt.Errorf("unknown payload class %q", fields[7])
+	}
+	return sig, nil
+}
+
+// Parses a window size: "*", "N", "mss*N", "mtu*N" or "%N".
+func (sig *p0fSignature) parseWindow(window string) error {
+	sig.windowType = p0fWindowExact
+	number := window
+	switch {
+	case window == "*":
+		sig.windowType = p0fWindowAny
+		return nil
+	case strings.HasPrefix(window, "mss*"):
+		sig.windowType, number = p0fWindowMSS, window[4:]
+	case strings.HasPrefix(window, "mtu*"):
+		sig.windowType, number = p0fWindowMTU, window[4:]
+	case strings.HasPrefix(window, "%"):
+		sig.windowType, number = p0fWindowModulo, window[1:]
+	}
+	n, err := strconv.Atoi(number)
+	if err != nil || n < 0 || (sig.windowType == p0fWindowModulo && n == 0) {
+		return fmt.Errorf("malformed window size %q", window)
+	}
+	sig.window = n
+	return nil
+}
+
+// Parses a number, or "*" as -1.
+func p0fWildcard(value string) (int, error) {
+	if value == "*" {
+		return -1, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// Returns the bits of a comma-separated quirk list; unknown quirks have none.
+func p0fQuirkSet(quirks string) uint32 {
+	var set uint32
+	for _, quirk := range strings.Split(quirks, ",") {
+		for i, name := range p0fQuirks {
+			if quirk == name {
+				set |= 1 << i
+				break
+			}
+		}
+	}
+	return set
+}
+
+// Built-in signatures, from the database p0f 3.09b ships unless marked otherwise.
+const p0fDefaults = `
+[tcp:request]
+
+label = s:unix:Linux:3.11 and newer
+sig   = *:64:0:*:mss*20,10:mss,sok,ts,nop,ws:df,id+:0
+sig   = *:64:0:*:mss*20,7:mss,sok,ts,nop,ws:df,id+:0
+# Not in p0f 3.09b: the 64240 byte window of Linux 4.19 and newer, and its
+# IPv6 counterpart
+sig   = *:64:0:*:mss*44,7:mss,sok,ts,nop,ws:df,id+:0
+sig   = *:64:0:*:mss*45,7:mss,sok,ts,nop,ws:df,id+:0
+
+label = s:unix:Linux:3.1-3.10
+sig   = *:64:0:*:mss*10,4:mss,sok,ts,nop,ws:df,id+:0
+sig   = *:64:0:*:mss*10,5:mss,sok,ts,nop,ws:df,id+:0
+sig   = *:64:0:*:mss*10,6:mss,sok,ts,nop,ws:df,id+:0
+sig   = *:64:0:*:mss*10,7:mss,sok,ts,nop,ws:df,id+:0
+
+label = s:unix:Linux:2.6.x
+sig   = *:64:0:*:mss*4,6:mss,sok,ts,nop,ws:df,id+:0
+sig   = *:64:0:*:mss*4,7:mss,sok,ts,nop,ws:df,id+:0
+sig   = *:64:0:*:mss*4,8:mss,sok,ts,nop,ws:df,id+:0
+
+label = s:unix:Linux:2.4.x
+sig   = *:64:0:*:mss*4,0:mss,sok,ts,nop,ws:df,id+:0
+sig   = *:64:0:*:mss*4,1:mss,sok,ts,nop,ws:df,id+:0
+sig   = *:64:0:*:mss*4,2:mss,sok,ts,nop,ws:df,id+:0
+
+label = s:unix:Linux:2.2.x
+sig   = *:64:0:*:mss*11,0:mss,sok,ts,nop,ws:df,id+:0
+sig   = *:64:0:*:mss*20,0:mss,sok,ts,nop,ws:df,id+:0
+sig   = *:64:0:*:mss*22,0:mss,sok,ts,nop,ws:df,id+:0
+
+label = s:unix:Linux:2.0
+sig   = *:64:0:*:mss*12,0:mss::0
+sig   = *:64:0:*:16384,0:mss::0
+
+label = s:unix:Linux:3.x (loopback)
+sig   = *:64:0:16396:mss*2,4:mss,sok,ts,nop,ws:df,id+:0
+sig   = *:64:0:16376:mss*2,4:mss,sok,ts,nop,ws:df,id+:0
+
+label = s:unix:Linux:2.6.x (loopback)
+sig   = *:64:0:16396:mss*2,2:mss,sok,ts,nop,ws:df,id+:0
+sig   = *:64:0:16376:mss*2,2:mss,sok,ts,nop,ws:df,id+:0
+
+label = s:unix:Linux:2.4.x (loopback)
+sig   = *:64:0:16396:mss*2,0:mss,sok,ts,nop,ws:df,id+:0
+
+label = g:unix:Linux:2.2.x-3.x
+sig   = *:64:0:*:*,*:mss,sok,ts,nop,ws:df,id+:0
+sig   = *:64:0:*:*,*:mss,sok,ts:df,id+:0
+sig   = *:64:0:*:*,*:mss,nop,nop,sok,nop,ws:df,id+:0
+sig   = *:64:0:*:*,*:mss,nop,nop,ts:df,id+:0
+
+label = g:unix:Linux:2.2.x-3.x (no timestamps)
+sig   = *:64:0:*:*,*:mss,nop,nop,sok,nop,ws:df,id+:0
+sig   = *:64:0:*:*,*:mss,nop,nop,sok:df,id+:0
+
+label = g:unix:Linux:2.2.x-3.x (barebone)
+sig   = *:64:0:*:*,0:mss:df,id+:0
+
+label = s:win:Windows:XP
+sig   = *:128:0:*:16384,0:mss,nop,nop,sok:df,id+:0
+sig   = *:128:0:*:65535,0:mss,nop,nop,sok:df,id+:0
+sig   = *:128:0:*:65535,0:mss,nop,ws,nop,nop,sok:df,id+:0
+sig   = *:128:0:*:65535,1:mss,nop,ws,nop,nop,sok:df,id+:0
+sig   = *:128:0:*:65535,2:mss,nop,ws,nop,nop,sok:df,id+:0
+
+label = s:win:Windows:7 or 8
+sig   = *:128:0:*:8192,0:mss,nop,nop,sok:df,id+:0
+sig   = *:128:0:*:8192,2:mss,nop,ws,nop,nop,sok:df,id+:0
+sig   = *:128:0:*:8192,8:mss,nop,ws,nop,nop,sok:df,id+:0
+sig   = *:128:0:*:8192,2:mss,nop,ws,sok,ts:df,id+:0
+
+# Not in p0f 3.09b
+label = s:win:Windows:10 or 11
+sig   = *:128:0:*:64240,8:mss,nop,ws,nop,nop,sok:df,id+:0
+sig   = *:128:0:*:65535,8:mss,nop,ws,nop,nop,sok:df,id+:0
+
+label = g:win:Windows:XP/2000
+sig   = *:128:0:*:*,*:mss,nop,nop,sok:df,id+:0
+sig   = *:128:0:*:*,*:mss,nop,ws,nop,nop,sok:df,id+:0
+
+label = s:unix:Mac OS X:10.x
+sig   = *:64:0:*:65535,1:mss,nop,ws,nop,nop,ts,sok,eol+1:df,id+:0
+sig   = *:64:0:*:65535,3:mss,nop,ws,nop,nop,ts,sok,eol+1:df,id+:0
+
+label = s:unix:MacOS X:10.9 or newer (sometimes iPhone or iPad)
+sig   = *:64:0:*:65535,4:mss,nop,ws,nop,nop,ts,sok,eol+1:df,id+:0
+
+label = s:unix:iOS:iPhone or iPad
+sig   = *:64:0:*:65535,2:mss,nop,ws,nop,nop,ts,sok,eol+1:df,id+:0
+
+# Not in p0f 3.09b: macOS 11 and newer, iOS 14 and newer
+label = s:unix:Mac OS X:11 or newer (or iOS)
+sig   = *:64:0:*:65535,6:mss,nop,ws,nop,nop,ts,sok,eol+1:df,id+:0
+
+label = g:unix:Mac OS X:
+sig   = *:64:0:*:65535,*:mss,nop,ws,nop,nop,ts,sok,eol+1:df,id+:0
+
+label = s:unix:FreeBSD:9.x or newer
+sig   = *:64:0:*:65535,6:mss,nop,ws,sok,ts:df,id+:0
+
+label = s:unix:FreeBSD:8.x
+sig   = *:64:0:*:65535,3:mss,nop,ws,sok,ts:df,id+:0
+
+label = g:unix:FreeBSD:
+sig   = *:64:0:*:65535,*:mss,nop,ws,sok,ts:df,id+:0
+
+label = s:unix:OpenBSD:3.x
+sig   = *:64:0:*:16384,0:mss,nop,nop,sok,nop,ws,nop,nop,ts:df,id+:0
+
+label = s:unix:OpenBSD:4.x-5.x
+sig   = *:64:0:*:16384,3:mss,nop,nop,sok,nop,ws,nop,nop,ts:df,id+:0
+
+label = s:unix:Solaris:8
+sig   = *:64:0:*:32850,1:nop,ws,nop,nop,ts,nop,nop,sok,mss:df,id+:0
+
+label = s:unix:Solaris:10
+sig   = *:64:0:*:mss*34,0:mss,nop,ws,nop,nop,sok:df,id+:0
+
+label = s:!:NMap:SYN scan
+sig   = *:64-:0:1460:1024,0:mss::0
+sig   = *:64-:0:1460:2048,0:mss::0
+sig   = *:64-:0:1460:3072,0:mss::0
+sig   = *:64-:0:1460:4096,0:mss::0
+
+[tcp:response]
+
+label = s:unix:Linux:3.x
+sig   = *:64:0:*:mss*10,0:mss:df:0
+sig   = *:64:0:*:mss*10,0:mss,sok,ts:df:0
+sig   = *:64:0:*:mss*10,0:mss,nop,nop,ts:df:0
+sig   = *:64:0:*:mss*10,0:mss,nop,nop,sok:df:0
+sig   = *:64:0:*:mss*10,*:mss,nop,ws:df:0
+sig   = *:64:0:*:mss*10,*:mss,sok,ts,nop,ws:df:0
+sig   = *:64:0:*:mss*10,*:mss,nop,nop,ts,nop,ws:df:0
+sig   = *:64:0:*:mss*10,*:mss,nop,nop,sok,nop,ws:df:0
+
+label = s:unix:Linux:2.6.x
+sig   = *:64:0:*:mss*4,0:mss:df:0
+sig   = *:64:0:*:mss*4,0:mss,sok,ts:df:0
+sig   = *:64:0:*:mss*4,0:mss,nop,nop,sok:df:0
+sig   = *:64:0:*:mss*4,*:mss,nop,ws:df:0
+sig   = *:64:0:*:mss*4,*:mss,sok,ts,nop,ws:df:0
+sig   = *:64:0:*:mss*4,*:mss,nop,nop,sok,nop,ws:df:0
+
+# Not in p0f 3.09b: the 65160 byte window of Linux 4.19 and newer
+label = s:unix:Linux:4.19 and newer
+sig   = *:64:0:*:65160,*:mss,sok,ts,nop,ws:df:0
+sig   = *:64:0:*:65160,*:mss,nop,nop,sok,nop,ws:df:0
+
+label = g:unix:Linux:
+sig   = *:64:0:*:*,*:mss,sok,ts,nop,ws:df:0
+sig   = *:64:0:*:*,*:mss,nop,nop,sok,nop,ws:df:0
+sig   = *:64:0:*:*,*:mss,sok,ts:df:0
+sig   = *:64:0:*:*,0:mss:df:0
+
+label = s:win:Windows:XP
+sig   = *:128:0:*:65535,0:mss:df,id+:0
+sig   = *:128:0:*:65535,0:mss,nop,nop,sok:df,id+:0
+sig   = *:128:0:*:65535,0:mss,nop,ws,nop,nop,sok:df,id+:0
+sig   = *:128:0:*:16384,0:mss:df,id+:0
+sig   = *:128:0:*:16384,0:mss,nop,nop,sok:df,id+:0
+
+label = s:win:Windows:7 or 8
+sig   = *:128:0:*:8192,0:mss:df,id+:0
+sig   = *:128:0:*:8192,0:mss,sok,ts:df,id+:0
+sig   = *:128:0:*:8192,8:mss,nop,ws,sok,ts:df,id+:0
+sig   = *:128:0:*:8192,0:mss,nop,nop,sok:df,id+:0
+sig   = *:128:0:*:8192,8:mss,nop,ws,nop,nop,sok:df,id+:0
+
+# Not in p0f 3.09b
+label = s:win:Windows:10 or 11
+sig   = *:128:0:*:65535,8:mss,nop,ws,nop,nop,sok:df,id+:0
+sig   = *:128:0:*:65535,8:mss,nop,ws,sok,ts:df,id+:0
+
+label = g:win:Windows:
+sig   = *:128:0:*:*,*:mss,nop,nop,sok:df,id+:0
+sig   = *:128:0:*:*,*:mss,nop,ws,nop,nop,sok:df,id+:0
+
+label = s:unix:Mac OS X:10.x
+sig   = *:64:0:*:65535,1:mss,nop,ws,sok,eol+1:df,id+:0
+sig   = *:64:0:*:65535,3:mss,nop,ws,sok,eol+1:df,id+:0
+sig   = *:64:0:*:65535,4:mss,nop,ws,sok,eol+1:df,id+:0
+sig   = *:64:0:*:65535,*:mss,nop,ws,nop,nop,ts,sok,eol+1:df,id+:0
+
+label = s:unix:FreeBSD:9.x or newer
+sig   = *:64:0:*:65535,6:mss,nop,ws,sok,ts:df,id+:0
+
+label = s:unix:FreeBSD:8.x
+sig   = *:64:0:*:65535,3:mss,nop,ws,sok,ts:df,id+:0
+
+label = s:unix:OpenBSD:5.x
+sig   = *:64:0:1460:16384,0:mss,nop,nop,sok:df,id+:0
+sig   = *:64:0:1460:16384,3:mss,nop,nop,sok,nop,ws,nop,nop,ts:df,id+:0
+
+label = s:unix:Solaris:10
+sig   = *:64:0:*:mss*34,0:mss,nop,ws,nop,nop,sok:df,id+:0
+`
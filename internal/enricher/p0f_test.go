@@ -0,0 +1,140 @@
+/**
+ * p0f TCP Signature Database Tests.
+ *
+ * Validates parsing of p0f v3 databases and matching of SYN and SYN+ACK
+ * signatures, exact, generic and fuzzy.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package enricher
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kleaSCM/netscope/internal/models"
+)
+
+// Verifies that signatures match the built-in database by layout, window, scale,
+// quirks and TTL, preferring specific over generic over fuzzy matches.
+func TestP0fDatabase_Match(t *testing.T) {
+	db := NewP0fDatabase()
+	linux := func(ttl uint8, window, scale int, quirks string) *models.TCPSignature {
+		return &models.TCPSignature{Version: 4, TTL: ttl, MSS: 1460, Window: window, WindowScale: scale,
+			Options: "mss,sok,ts,nop,ws", Quirks: quirks}
+	}
+
+	tests := []struct {
+		name       string
+		sig        *models.TCPSignature
+		want       string
+		confidence int
+		distance   int
+	}{
+		{"linux", linux(61, 64240, 7, "df,id+"), "Linux 3.11 and newer", confidenceP0f, 3},
+		{"linux generic", linux(64, 5000, 9, "df,id+"), "Linux 2.2.x-3.x", confidenceP0fGeneric, 0},
+		{"linux far away", linux(20, 64240, 7, "df,id+"), "Linux 3.11 and newer", confidenceP0fFuzzy, 44},
+		{"linux behind a scrubbing firewall", linux(64, 64240, 7, "id-"), "Linux 3.11 and newer", confidenceP0fFuzzy, 0},
+		{"linux over ipv6", &models.TCPSignature{Version: 6, TTL: 57, MSS: 1440, Window: 64800, WindowScale: 7,
+			Options: "mss,sok,ts,nop,ws", Quirks: "flow"}, "Linux 3.11 and newer", confidenceP0f, 7},
+		{"linux with an unexpected quirk", linux(64, 64240, 7, "df,id+,ack+"), "", 0, 0},
+		{"windows", &models.TCPSignature{Version: 4, TTL: 118, MSS: 1460, Window: 64240, WindowScale: 8,
+			Options: "mss,nop,ws,nop,nop,sok", Quirks: "df,id+"}, "Windows 10 or 11", confidenceP0f, 10},
+		{"mac", &models.TCPSignature{Version: 4, TTL: 64, MSS: 1460, Window: 65535, WindowScale: 6,
+			Options: "mss,nop,ws,nop,nop,ts,sok,eol+1", Quirks: "df,id+"}, "Mac OS X 11 or newer (or iOS)", confidenceP0f, 0},
+		{"linux syn+ack", &models.TCPSignature{Version: 4, Response: true, TTL: 64, MSS: 1460, Window: 65160, WindowScale: 7,
+			Options: "mss,sok,ts,nop,ws", Quirks: "df"}, "Linux 4.19 and newer", confidenceP0f, 0},
+		{"nmap", &models.TCPSignature{Version: 4, TTL: 44, MSS: 1460, Window: 1024,
+			Options: "mss"}, "NMap SYN scan", confidenceP0f, 20},
+		{"unknown layout", &models.TCPSignature{Version: 4, TTL: 64, MSS: 1460, Window: 65535, WindowScale: 2,
+			Options: "ws,mss", Quirks: "df,id+"}, "", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match := db.Match(tt.sig)
+			if tt.want == "" {
+				if match != nil {
+					t.Errorf("Expected no match, got %+v", match)
+				}
+				return
+			}
+			if match == nil {
+				t.Fatalf("Expected %s, got no match", tt.want)
+			}
+			if match.String() != tt.want || match.Confidence != tt.confidence || match.Distance != tt.distance {
+				t.Errorf("Expected %s at %d%% %d hops away, got %s at %d%% %d hops away",
+					tt.want, tt.confidence, tt.distance, match, match.Confidence, match.Distance)
+			}
+		})
+	}
+}
+
+// Verifies that a database file replaces the built-in signatures, that other
+// sections are skipped, and that a malformed file leaves the database unchanged.
+func TestP0fDatabase_Load(t *testing.T) {
+	db := NewP0fDatabase()
+	if requests, responses := db.Len(); requests == 0 || responses == 0 {
+		t.Fatalf("Expected built-in signatures, got %d and %d", requests, responses)
+	}
+
+	file := `
+classes = win,unix,other
+
+[mtu]
+label = Ethernet or modem
+sig   = 1500
+
+[tcp:request]
+label = s:unix:Haiku:R1
+sig   = *:64:0:*:%8192,0:mss,nop,nop,sok,nop,ws:df:*
+sig   = 4:64+2:0:1460:mtu*2,0:mss:df:+
+
+[http:request]
+label = s:!:curl:
+sig   = *:User-Agent:?Accept:curl
+`
+	path := filepath.Join(t.TempDir(), "p0f.fp")
+	if err := os.WriteFile(path, []byte(file), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.LoadFile(path); err != nil {
+		t.Fatalf("Failed to load %s: %v", path, err)
+	}
+	if requests, responses := db.Len(); requests != 2 || responses != 0 {
+		t.Errorf("Expected only the file's two signatures, got %d and %d", requests, responses)
+	}
+
+	haiku := &models.TCPSignature{Version: 4, TTL: 60, MSS: 1460, Window: 32768, WindowScale: 0,
+		Options: "mss,nop,nop,sok,nop,ws", Quirks: "df"}
+	if match := db.Match(haiku); match == nil || match.String() != "Haiku R1" {
+		t.Errorf("Expected Haiku R1 by window modulus, got %+v", match)
+	}
+	haiku = &models.TCPSignature{Version: 4, TTL: 64, MSS: 1460, Window: 3000,
+		Options: "mss", Quirks: "df", Payload: true}
+	if match := db.Match(haiku); match == nil || match.Distance != 2 {
+		t.Errorf("Expected Haiku R1 by MTU multiple 2 hops from TTL 66, got %+v", match)
+	}
+
+	for _, bad := range []string{
+		"[tcp:request]\nsig = *:64:0:*:*,*:mss:df:0",
+		"[tcp:request]\nlabel = x:unix:Linux:\nsig = *:64:0:*:*,*:mss:df:0",
+		"[tcp:request]\nlabel = s:unix:Linux:\nsig = *:64:0:*:*,*:mss:df,sparkly:0",
+		"[tcp:request]\nlabel = s:unix:Linux:\nsig = *:64:0:*:mss*,*:mss:df:0",
+		"[tcp:request]\nlabel = s:unix:Linux:\nsig = *:64:0:*:*,*:mss:df",
+	} {
+		if err := db.Load(strings.NewReader(bad)); err == nil {
+			t.Errorf("Expected %q to fail", bad)
+		}
+	}
+	if requests, _ := db.Len(); requests != 2 {
+		t.Errorf("Expected failed loads to keep the signatures, got %d", requests)
+	}
+	if err := db.LoadFile(filepath.Join(t.TempDir(), "missing.fp")); err == nil {
+		t.Error("Expected a missing file to fail")
+	}
+}
@@ -0,0 +1,93 @@
+/**
+ * User-Agent Fingerprinting.
+ *
+ * Derives the operating system and device type from the User-Agent
+ * header of plain HTTP requests. Browsers name their platform, and
+ * many IoT devices and media players announce themselves by product,
+ * which is far more specific than a TTL-based guess.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package enricher
+
+import "strings"
+
+// One User-Agent rule: a lower-case substring and what it reveals. Empty
+// fields reveal nothing about that attribute.
+type userAgentRule struct {
+	token      string
+	os         string
+	deviceType string
+}
+
+// Rules are checked in order, so specific products come before the platforms they
+// run on (Android TV before Android, iPad before Mac OS X).
+var userAgentRules = []userAgentRule{
+	// Media players and smart TVs
+	{"roku", "Roku OS", "Smart TV"},
+	{"tizen", "Tizen", "Smart TV"},
+	{"webos", "webOS", "Smart TV"},
+	{"smart-tv", "", "Smart TV"},
+	{"smarttv", "", "Smart TV"},
+	{"appletv", "tvOS", "Smart TV"},
+	{"android tv", "Android", "Smart TV"},
+	{"; aft", "Fire OS", "Smart TV"}, // Amazon Fire TV models (AFTS, AFTMM, ...)
+	{"crkey", "Chromecast", "Smart TV"},
+
+	// Consoles
+	{"playstation", "PlayStation", "Game Console"},
+	{"xbox", "Windows", "Game Console"},
+	{"nintendo", "Nintendo", "Game Console"},
+
+	// IoT, printers and embedded HTTP clients
+	{"sonos", "Sonos", "Speaker"},
+	{"printer", "", "Printer"},
+	{"cups/", "", "Printer"},
+	{"hp-chai", "", "Printer"},
+	{"ipcam", "", "Camera"},
+	{"hikvision", "", "Camera"},
+	{"esp8266", "", "IoT"},
+	{"esp32", "", "IoT"},
+	{"tasmota", "", "IoT"},
+	{"shelly", "", "IoT"},
+	{"tuya", "", "IoT"},
+
+	// Mobile platforms
+	{"iphone", "iOS", "Mobile"},
+	{"ipad", "iPadOS", "Tablet"},
+	{"android", "Android", "Mobile"},
+
+	// Desktop platforms
+	{"windows nt", "Windows", "Desktop"},
+	{"mac os x", "macOS", "Desktop"},
+	{"macintosh", "macOS", "Desktop"},
+	{"cros ", "ChromeOS", "Desktop"},
+	{"linux", "Linux", ""},
+}
+
+// Returns the OS and device type a User-Agent reveals; either may be empty.
+func ParseUserAgent(userAgent string) (os, deviceType string) {
+	ua := strings.ToLower(userAgent)
+	for _, rule := range userAgentRules {
+		if !strings.Contains(ua, rule.token) {
+			continue
+		}
+		if os == "" {
+			os = rule.os
+		}
+		if deviceType == "" {
+			deviceType = rule.deviceType
+		}
+		if os != "" && deviceType != "" {
+			break
+		}
+	}
+
+	// Android tablets omit "Mobile" from their User-Agent
+	if deviceType == "Mobile" && os == "Android" && !strings.Contains(ua, "mobile") {
+		deviceType = "Tablet"
+	}
+	return os, deviceType
+}
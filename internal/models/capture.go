@@ -0,0 +1,42 @@
+/**
+ * Capture Run Model.
+ *
+ * Records one capture session: what was captured and how, the limits
+ * and schedule it ran under, why it stopped, and the engine's final
+ * statistics, so unattended captures leave an audit trail.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package models
+
+import "time"
+
+// Reasons a capture run ended.
+const (
+	StopInterrupted   = "interrupted"    // Stopped by the user or the process being signalled
+	StopSourceEnded   = "source ended"   // Capture file or stream exhausted, or live handle closed
+	StopDurationLimit = "duration limit" // Configured run time elapsed, or the schedule window closed
+	StopPacketLimit   = "packet limit"   // Configured packet count reached
+	StopByteLimit     = "byte limit"     // Configured byte count reached
+	StopError         = "error"          // Capture failed
+)
+
+// Represents one capture session and its final statistics.
+type CaptureRun struct {
+	ID            int64
+	Mode          string // "live", "replay" or "stream"
+	Source        string // Interfaces, capture file or pipe
+	Filter        string
+	DurationLimit time.Duration // Zero when unlimited
+	PacketLimit   uint64        // Zero when unlimited
+	ByteLimit     uint64        // Zero when unlimited
+	Schedule      string        // Daily window for scheduled runs, e.g. "22:00-06:00"
+	StartedAt     time.Time
+	EndedAt       time.Time
+	StopReason    string
+	Packets       uint64
+	Dropped       uint64
+	Bytes         uint64
+}
@@ -2,7 +2,8 @@
  * Device Model.
  *
  * Represents a physical or virtual device on the network, tracked by
- * its MAC address and enriched with fingerprinting data.
+ * its MAC address (or its IP address on links without MACs) and
+ * enriched with fingerprinting data.
  *
  * Author: KleaSCM
  * Email: KleaSCM@gmail.com
@@ -15,13 +16,38 @@ import "time"
 // Represents a network device identified by MAC address.
 type Device struct {
 	ID            int64
-	MACAddress    string
+	MACAddress    string // Empty for devices seen only on links without MAC addresses
 	Vendor        string
 	Hostname      string
 	IPAddress     string
 	OSFingerprint string
+	OSConfidence  int // Percent; how strongly the source of OSFingerprint identifies the OS
 	DeviceType    string
+	Model         string // Model a device announced over mDNS or SSDP
 	FirstSeen     time.Time
 	LastSeen      time.Time
 	UserLabel     string
+
+	// Identity the device announced over DHCP
+	DHCPVendorClass string // Option 60, e.g. "MSFT 5.0" or "android-dhcp-9"
+	DHCPFingerprint string // Parameter request list, e.g. "1,3,6,15,31,33"
+}
+
+// Represents an address a device used, learned from DHCP, ARP or NDP, or seen as a packet source.
+type DeviceIP struct {
+	DeviceID     int64
+	IPAddress    string
+	Source       string // "DHCP" for leases, "ARP" or "NDP" for announced bindings, "Observed" for addresses seen in traffic
+	FirstSeen    time.Time
+	LastSeen     time.Time
+	LeaseExpires time.Time // Zero unless a DHCP server gave a finite lease
+}
+
+// Returns the key a device is tracked under: its MAC address, or its IP address
+// when it was only ever seen on links without MAC addresses.
+func (d *Device) Identity() string {
+	if d.MACAddress != "" {
+		return d.MACAddress
+	}
+	return d.IPAddress
 }
@@ -15,13 +15,16 @@ import (
 	"time"
 )
 
-// Uniquely identifies a network flow (5-tuple keys).
+// Uniquely identifies a network flow (5-tuple keys). VLAN and TunnelID keep the
+// same 5-tuple in different VLANs or tunnels from colliding.
 type FlowKey struct {
 	SrcIP    string
 	DstIP    string
 	SrcPort  uint16
 	DstPort  uint16
 	Protocol string
+	VLAN     uint16 // Outer 802.1Q VLAN ID, 0 when untagged
+	TunnelID uint32 // Outer tunnel ID (VXLAN VNI, GRE key, GTP TEID, ...), 0 when none
 }
 
 // Represents a network connection or conversation.
@@ -29,11 +32,15 @@ type Flow struct {
 	ID          int64 // DB ID
 	DeviceID    int64 // Foreign key to Device
 	Key         FlowKey
+	Interface   string // Capture interface the flow was first seen on
+	Tunnel      string // Outer tunnel type the flow was carried in, if any
 	FirstSeen   time.Time
 	LastSeen    time.Time
-	PacketCount uint64
-	ByteCount   uint64
-	Protocol    string
+	PacketCount uint64 // Scaled by the sampling rate when Sampled
+	ByteCount   uint64 // Scaled by the sampling rate when Sampled
+	Sampled     bool   // Counts are estimates from sampled packets
+	Protocol    string // Transport, or the application protocol once recognised (e.g. QUIC)
+	QUICVersion string // QUIC version, when the flow is QUIC
 	DNSQuery    string // If applicable
 	TLSSNI      string // If applicable
 	DstDomain   string // Correlated domain name
@@ -42,18 +49,47 @@ type Flow struct {
 	DstASN      string // GeoIP ASN
 
 	// TLS Fingerprinting
-	JA3            string // JA3 fingerprint hash
-	JA3Application string // Identified application from JA3
+	JA3            string       // JA3 fingerprint hash
+	JA3S           string       // JA3S fingerprint hash of the server's reply
+	JA4            string       // JA4 fingerprint of the ClientHello
+	JA4S           string       // JA4S fingerprint of the ServerHello
+	JA4H           string       // JA4H fingerprint of the first HTTP request
+	JA4X           string       // JA4X fingerprint of the server's certificate
+	JA3Application string       // Identified client from JA3 or JA4, or from the JA3 and JA3S pair
+	TLSVersion     string       // Version the server negotiated
+	TLSCipherSuite string       // Cipher suite the server selected
+	TLSALPN        string       // Application protocol the server selected
+	ClientHello    *ClientHello // What the client offered
+	Certificate    *Certificate // Server's leaf certificate, when sent in cleartext (TLS 1.2 and below)
+
+	// Plain HTTP metadata, from the first request and response seen
+	HTTPHost      string // Host header
+	HTTPUserAgent string // User-Agent header
+	HTTPServer    string // Server header
+
+	// SSH software and fingerprints, from the cleartext start of the connection
+	SSHClient   string // Client software, e.g. "OpenSSH_9.6p1" or "Go"
+	SSHServer   string // Server software
+	HASSH       string // HASSH of the client's KEXINIT
+	HASSHServer string // HASSHServer of the server's KEXINIT
 
 	// Application Identification & Classification
 	Application  string // Identified application (e.g., "YouTube", "Spotify")
 	TrafficClass string // Traffic category (e.g., "Streaming", "Social Media")
 
 	// Runtime Internal
-	LastPersisted time.Time `json:"-"` // Not persisted to DB, used for delta tracking
+	LastPersisted  time.Time `json:"-"` // Not persisted to DB, used for delta tracking
+	TLSHandshakeID int64     `json:"-"` // DB ID of the flow's tls_handshakes row, 0 until saved
 }
 
 // Returns a human-readable string representation of the flow key.
 func (k FlowKey) String() string {
-	return fmt.Sprintf("%s:%d -> %s:%d [%s]", k.SrcIP, k.SrcPort, k.DstIP, k.DstPort, k.Protocol)
+	s := fmt.Sprintf("%s:%d -> %s:%d [%s]", k.SrcIP, k.SrcPort, k.DstIP, k.DstPort, k.Protocol)
+	if k.VLAN != 0 {
+		s += fmt.Sprintf(" vlan %d", k.VLAN)
+	}
+	if k.TunnelID != 0 {
+		s += fmt.Sprintf(" tunnel %d", k.TunnelID)
+	}
+	return s
 }
@@ -0,0 +1,57 @@
+/**
+ * Neighbor Model.
+ *
+ * Represents the IP to MAC bindings hosts announce over ARP and IPv6
+ * Neighbor Discovery, and what IPv6 routers advertise about their link.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package models
+
+import "time"
+
+// Represents a binding of an IP address to a MAC address, learned passively from
+// ARP or NDP. The same address bound to several MACs yields one entry per MAC.
+type Neighbor struct {
+	ID         int64
+	IPAddress  string
+	MACAddress string
+	VLAN       uint16 // Outer 802.1Q VLAN ID, 0 when untagged
+	Protocol   string // "ARP" or "NDP"
+	Interface  string // Capture interface the binding was first seen on
+	FirstSeen  time.Time
+	LastSeen   time.Time
+	Gratuitous int  // Unsolicited announcements: gratuitous ARPs and unsolicited Neighbor Advertisements
+	Probes     int  // Duplicate address detection probes the MAC sent for the address
+	Router     bool // The MAC claimed to be a router (Router Advertisement or the NA router flag)
+}
+
+// Represents what an IPv6 router advertised about its link.
+type RouterAdvertisement struct {
+	ID          int64
+	RouterIP    string // Link-local address the advertisement came from
+	RouterMAC   string // Source link-layer address option, or the frame's source
+	VLAN        uint16
+	Interface   string
+	HopLimit    uint8         // Hop limit hosts should use, 0 when unspecified
+	Managed     bool          // M flag: addresses come from DHCPv6
+	OtherConfig bool          // O flag: other configuration comes from DHCPv6
+	Preference  string        // Default router preference: "high", "medium" or "low"
+	Lifetime    time.Duration // Zero when the router is not a default router
+	MTU         uint32        // Link MTU, 0 when not advertised
+	Prefixes    []RouterPrefix
+	DNSServers  []string // Recursive DNS servers (RDNSS)
+	FirstSeen   time.Time
+	LastSeen    time.Time
+}
+
+// Represents a prefix a router advertised.
+type RouterPrefix struct {
+	Prefix            string // e.g. "2001:db8:1::/64"
+	OnLink            bool   // L flag
+	Autonomous        bool   // A flag: hosts may form addresses with SLAAC
+	ValidLifetime     time.Duration
+	PreferredLifetime time.Duration
+}
@@ -17,12 +17,24 @@ import (
 // Represents a parsed network packet with layered data.
 type Packet struct {
 	Timestamp time.Time
+	Interface string // Capture interface the packet was read from
 	Length    int
+	VLAN      uint16 // Outer 802.1Q VLAN ID, 0 when untagged
+	Tunnel    string // Outer tunnel type (e.g. "VXLAN"), empty when not tunneled
+	TunnelID  uint32 // Outer tunnel ID, 0 when none
+	Sampling  uint32 // Packets this one stands for when sampled (1 in Sampling), 0 when not sampled
 	Layer2    *Layer2
 	Layer3    *Layer3
 	Layer4    *Layer4
 	DNS       *DNS
 	TLS       *TLS
+	HTTP      *HTTP
+	QUIC      *QUIC
+	DHCP      *DHCP
+	Discovery *Discovery
+	SSH       *SSH
+	Neighbor  *NeighborMessage // ARP and NDP only
+	TCPSig    *TCPSignature    // SYN and SYN+ACK only
 	Metadata  map[string]interface{}
 }
 
@@ -42,6 +54,7 @@ type DNSAnswer struct {
 	IP    string
 	TTL   uint32
 	CNAME string
+	Data  string // Presentation form of other record types (MX, TXT, SRV, HTTPS, ...)
 }
 
 // Represents TLS layer information, such as SNI and handshake details.
@@ -50,7 +63,77 @@ type TLS struct {
 	Version     string
 	CipherSuite string
 	Handshake   bool
-	JA3         string // JA3 fingerprint hash
+	ServerHello bool   // Server Hello rather than Client Hello
+	JA3         string // JA3 fingerprint hash (Client Hello)
+	JA3S        string // JA3S fingerprint hash (Server Hello)
+	JA4         string // JA4 fingerprint (Client Hello)
+	JA4S        string // JA4S fingerprint (Server Hello)
+	ALPN        string // Protocol the server selected (Server Hello)
+
+	ClientHello *ClientHello // What the client offered (Client Hello)
+
+	Certificate *Certificate // Server's leaf certificate (TLS 1.2 and below)
+}
+
+// Represents HTTP/1.x header information from the start of a request or response.
+type HTTP struct {
+	IsRequest   bool
+	Method      string // Requests only
+	URI         string // Requests only
+	Host        string // Requests only
+	UserAgent   string // Requests only
+	Referer     string // Requests only
+	StatusCode  int    // Responses only
+	Server      string // Responses only
+	ContentType string
+	JA4H        string // Requests only
+}
+
+// Represents QUIC information from a long header packet.
+type QUIC struct {
+	Version string // e.g. "QUIC v1"
+}
+
+// Represents what one side of an SSH connection revealed before encryption started.
+type SSH struct {
+	Client          bool   // Sent by the client rather than the server
+	Software        string // e.g. "OpenSSH_9.6p1", empty when only a KEXINIT was seen
+	Banner          string // Full identification line, e.g. "SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13"
+	HASSH           string // HASSH of a client's or HASSHServer of a server's KEXINIT
+	HASSHAlgorithms string // The algorithm lists HASSH hashes
+}
+
+// Represents what an ARP packet or NDP message revealed about its sender's binding.
+type NeighborMessage struct {
+	Protocol   string               // "ARP" or "NDP"
+	IP         string               // Address the sender bound, or probed for with Probe
+	MAC        string               // MAC bound to IP, or the prober's with Probe
+	Gratuitous bool                 // Announced unasked
+	Probe      bool                 // Duplicate address detection: IP is not yet the sender's
+	Router     bool                 // The sender claims to be a router
+	Advert     *RouterAdvertisement // Router Advertisements only, without IDs or times
+}
+
+// Represents what a DHCPv4 or DHCPv6 message reveals about the client it concerns.
+type DHCP struct {
+	Version     int    // 4 or 6
+	MessageType string // e.g. "Request", "Ack", "Solicit", "Reply"
+	FromServer  bool   // Sent by a server to the client, so the sender is not the client
+	ClientMAC   string // Empty when a DHCPv6 client DUID carries no link-layer address
+	Hostname    string // Option 12, or the client FQDN when it sent no hostname
+	VendorClass string
+	Fingerprint string        // Parameter request list, e.g. "1,3,6,15" (DHCPv4 only)
+	AssignedIP  string        // Address a server bound to the client
+	LeaseTime   time.Duration // Zero when infinite or not given
+}
+
+// Represents what a device announced about itself over mDNS, LLMNR, NetBIOS or SSDP.
+type Discovery struct {
+	Protocol string   // "mDNS", "LLMNR", "NBNS" or "SSDP"
+	Hostname string   // Friendly name or hostname the sender answers for
+	Services []string // DNS-SD service types or UPnP device and service types
+	Model    string
+	Server   string // SSDP SERVER header
 }
 
 // Represents Data Link Layer (Ethernet) information.
@@ -78,3 +161,18 @@ type Layer4 struct {
 	Seq      uint32
 	Ack      uint32
 }
+
+// Represents the TCP/IP stack traits of a SYN or SYN+ACK, in the terms of p0f v3
+// signatures.
+type TCPSignature struct {
+	Version     int    // IP version, 4 or 6
+	Response    bool   // SYN+ACK rather than SYN
+	TTL         uint8  // Observed TTL or hop limit
+	IPOptionLen int    // Length of IPv4 options
+	MSS         int    // -1 without the option
+	Window      int    // Window size
+	WindowScale int    // 0 without the option, as in p0f
+	Options     string // Option layout, e.g. "mss,sok,ts,nop,ws"
+	Quirks      string // Quirks in p0f order, e.g. "df,id+"
+	Payload     bool   // The segment carries data
+}
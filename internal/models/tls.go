@@ -0,0 +1,108 @@
+/**
+ * TLS Handshake Model.
+ *
+ * Defines the server certificate seen in a TLS handshake and the handshake
+ * record persisted per flow: the client and server fingerprints, the
+ * negotiated parameters and the server's identity.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package models
+
+import "time"
+
+// Represents a server's leaf certificate, from a Certificate message sent in cleartext.
+type Certificate struct {
+	Subject    string   // Distinguished name
+	CommonName string   // Subject CN
+	SANs       []string // DNS names and IP addresses
+	Issuer     string   // Distinguished name
+	NotBefore  time.Time
+	NotAfter   time.Time
+	Serial     string   // Hex
+	SHA256     string   // Hex fingerprint of the DER encoding
+	Chain      []string // Subjects of the intermediates, leaf's issuer first
+	JA4X       string   // JA4X fingerprint of how the certificate was generated
+}
+
+// Represents what a client offered in its Client Hello.
+type ClientHello struct {
+	RecordVersion       string   // Version in the record header
+	LegacyVersion       string   // legacy_version field, the highest version before TLS 1.3
+	SupportedVersions   []string // Every version offered; before TLS 1.3 only the legacy version is known
+	ALPN                []string // Application protocols offered (h2, http/1.1, ...)
+	SupportedGroups     []string // Key exchange groups, in preference order
+	SignatureAlgorithms []string // In preference order
+	ECH                 bool     // Offers Encrypted Client Hello
+	GREASE              bool     // Sends GREASE values
+}
+
+// Reports whether the client offers a version older than TLS 1.2. Clients that
+// predate supported_versions name only their highest version, so a client whose
+// highest is TLS 1.2 is not counted even though it may accept older ones.
+func (c *ClientHello) OffersLegacyVersion() bool {
+	for _, v := range c.SupportedVersions {
+		switch v {
+		case "SSL 3.0", "TLS 1.0", "TLS 1.1":
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether the client offers HTTP/2 through ALPN.
+func (c *ClientHello) OffersHTTP2() bool {
+	for _, protocol := range c.ALPN {
+		if protocol == "h2" {
+			return true
+		}
+	}
+	return false
+}
+
+// Represents the TLS handshake of a flow as stored in tls_handshakes.
+type TLSHandshake struct {
+	ID            int64
+	FlowID        int64
+	SNI           string
+	JA3           string
+	JA3S          string
+	CipherSuite   string
+	TLSVersion    string       // Negotiated, or the highest offered when the Server Hello was not seen
+	ALPN          string       // Protocol the server selected
+	ClientHello   *ClientHello // Nil when the Client Hello was not seen
+	Certificate   *Certificate // Nil when the chain was encrypted or not seen
+	IdentifiedApp string
+	Timestamp     time.Time
+}
+
+// Returns the flow's TLS handshake, or nil when the flow carried none.
+func (f *Flow) TLSHandshake() *TLSHandshake {
+	if f.JA3 == "" && f.JA3S == "" && f.Certificate == nil {
+		return nil
+	}
+	version := f.TLSVersion
+	if version == "" && f.ClientHello != nil && len(f.ClientHello.SupportedVersions) > 0 {
+		version = f.ClientHello.SupportedVersions[0]
+	}
+	app := f.JA3Application
+	if app == "" {
+		app = f.Application
+	}
+	return &TLSHandshake{
+		ID:            f.TLSHandshakeID,
+		FlowID:        f.ID,
+		SNI:           f.TLSSNI,
+		JA3:           f.JA3,
+		JA3S:          f.JA3S,
+		CipherSuite:   f.TLSCipherSuite,
+		TLSVersion:    version,
+		ALPN:          f.TLSALPN,
+		ClientHello:   f.ClientHello,
+		Certificate:   f.Certificate,
+		IdentifiedApp: app,
+		Timestamp:     f.FirstSeen,
+	}
+}
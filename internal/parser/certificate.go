@@ -0,0 +1,105 @@
+/**
+ * TLS Certificate Parser.
+ *
+ * Decodes the server's certificate chain from the Certificate handshake
+ * message, which TLS 1.2 and earlier send in cleartext. The leaf names
+ * the server even when the client sent no SNI, and its fingerprint ties
+ * connections to the same server across addresses.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package parser
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// Holds the identity of a server's leaf certificate and the shape of its chain.
+type CertificateInfo struct {
+	Subject    string   // Distinguished name
+	CommonName string   // Subject CN
+	SANs       []string // DNS names and IP addresses
+	Issuer     string   // Distinguished name
+	NotBefore  time.Time
+	NotAfter   time.Time
+	Serial     string   // Hex
+	SHA256     string   // Hex fingerprint of the DER encoding
+	Chain      []string // Subjects of the intermediates, leaf's issuer first
+	JA4X       string   // JA4X fingerprint of the leaf
+}
+
+// Decodes the body of a TLS 1.2 or earlier Certificate handshake message (after
+// its 4-byte header). Intermediates that fail to parse are left out of Chain.
+func ParseCertificateMessage(body []byte) (_ *CertificateInfo, err error) {
+	defer recoverMalformed("certificate message", &err)
+	if len(body) < 3 {
+		return nil, fmt.Errorf("certificate message too short")
+	}
+	listLen := int(body[0])<<16 | int(body[1])<<8 | int(body[2])
+	if listLen == 0 {
+		return nil, fmt.Errorf("empty certificate list")
+	}
+	if 3+listLen > len(body) {
+		return nil, fmt.Errorf("certificate list truncated")
+	}
+
+	var info *CertificateInfo
+	list := body[3 : 3+listLen]
+	for len(list) >= 3 {
+		certLen := int(list[0])<<16 | int(list[1])<<8 | int(list[2])
+		if 3+certLen > len(list) {
+			return nil, fmt.Errorf("certificate truncated")
+		}
+		der := list[3 : 3+certLen]
+		list = list[3+certLen:]
+
+		cert, err := x509.ParseCertificate(der)
+		if info == nil {
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse leaf certificate: %w", err)
+			}
+			info = leafCertificate(cert, der)
+		} else if err == nil {
+			info.Chain = append(info.Chain, cert.Subject.String())
+		}
+	}
+
+	if info == nil {
+		return nil, fmt.Errorf("empty certificate list")
+	}
+	return info, nil
+}
+
+// Extracts the fields recorded for a leaf certificate.
+func leafCertificate(cert *x509.Certificate, der []byte) *CertificateInfo {
+	fingerprint := sha256.Sum256(der)
+	info := &CertificateInfo{
+		Subject:    cert.Subject.String(),
+		CommonName: cert.Subject.CommonName,
+		Issuer:     cert.Issuer.String(),
+		NotBefore:  cert.NotBefore,
+		NotAfter:   cert.NotAfter,
+		Serial:     fmt.Sprintf("%x", cert.SerialNumber),
+		SHA256:     hex.EncodeToString(fingerprint[:]),
+		JA4X:       calculateJA4X(cert),
+	}
+	info.SANs = append(info.SANs, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		info.SANs = append(info.SANs, ip.String())
+	}
+	return info
+}
+
+// Returns the name the certificate is for: the CN, or the first SAN without one.
+func (c *CertificateInfo) Name() string {
+	if c.CommonName != "" || len(c.SANs) == 0 {
+		return c.CommonName
+	}
+	return c.SANs[0]
+}
@@ -0,0 +1,250 @@
+/**
+ * TLS Client Hello Parser.
+ *
+ * Decodes the fields of a Client Hello that fingerprints and handshake
+ * records are built from: cipher suites, extensions in the order sent,
+ * and the contents of the extensions that describe the client (SNI,
+ * ALPN, supported versions, groups and signature algorithms).
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package parser
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Extension types read from a Client Hello.
+const (
+	extServerName           = 0x0000
+	extSupportedGroups      = 0x000a
+	extSignatureAlgorithms  = 0x000d
+	extALPN                 = 0x0010
+	extSupportedVersions    = 0x002b
+	extEncryptedClientHello = 0xfe0d
+)
+
+// Names of common key exchange groups (IANA TLS Supported Groups registry).
+var groupNames = map[uint16]string{
+	0x0017: "secp256r1",
+	0x0018: "secp384r1",
+	0x0019: "secp521r1",
+	0x001d: "x25519",
+	0x001e: "x448",
+	0x0100: "ffdhe2048",
+	0x0101: "ffdhe3072",
+	0x0102: "ffdhe4096",
+	0x0103: "ffdhe6144",
+	0x0104: "ffdhe8192",
+	0x11ec: "X25519MLKEM768",
+	0x6399: "X25519Kyber768Draft00",
+}
+
+// Names of common signature algorithms (IANA TLS SignatureScheme registry).
+var signatureAlgorithmNames = map[uint16]string{
+	0x0201: "rsa_pkcs1_sha1",
+	0x0203: "ecdsa_sha1",
+	0x0401: "rsa_pkcs1_sha256",
+	0x0403: "ecdsa_secp256r1_sha256",
+	0x0501: "rsa_pkcs1_sha384",
+	0x0503: "ecdsa_secp384r1_sha384",
+	0x0601: "rsa_pkcs1_sha512",
+	0x0603: "ecdsa_secp521r1_sha512",
+	0x0804: "rsa_pss_rsae_sha256",
+	0x0805: "rsa_pss_rsae_sha384",
+	0x0806: "rsa_pss_rsae_sha512",
+	0x0807: "ed25519",
+	0x0808: "ed448",
+	0x0809: "rsa_pss_pss_sha256",
+	0x080a: "rsa_pss_pss_sha384",
+	0x080b: "rsa_pss_pss_sha512",
+}
+
+// Returns the name of a key exchange group, or its hex value when not listed.
+func GroupName(group uint16) string {
+	if name, ok := groupNames[group]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%04x", group)
+}
+
+// Returns the name of a signature algorithm, or its hex value when not listed.
+func SignatureAlgorithmName(alg uint16) string {
+	if name, ok := signatureAlgorithmNames[alg]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%04x", alg)
+}
+
+// Holds the decoded fields of a Client Hello. Lists keep GREASE values and the
+// order they were sent in; each fingerprint filters them as it specifies.
+type clientHello struct {
+	LegacyVersion       uint16
+	CipherSuites        []uint16
+	Extensions          []uint16
+	SNI                 string
+	ALPN                []string
+	SupportedVersions   []uint16
+	SupportedGroups     []uint16
+	SignatureAlgorithms []uint16
+}
+
+// Parses a TLS record holding a Client Hello. Returns nil if the record is not one
+// or is cut off before its extensions.
+func parseClientHello(payload []byte) *clientHello {
+	// Record header (5) + handshake header (4) + version (2) + random (32) + session ID length (1)
+	if len(payload) < 44 || payload[0] != 22 || payload[5] != 1 {
+		return nil
+	}
+
+	hello := &clientHello{LegacyVersion: binary.BigEndian.Uint16(payload[9:11])}
+	offset := 11 + 32
+	offset += 1 + int(payload[offset]) // Session ID
+
+	// Cipher Suites
+	if offset+2 > len(payload) {
+		return nil
+	}
+	cipherSuitesLen := int(binary.BigEndian.Uint16(payload[offset : offset+2]))
+	offset += 2
+	if offset+cipherSuitesLen > len(payload) {
+		return nil
+	}
+	hello.CipherSuites = readUint16List(payload[offset : offset+cipherSuitesLen])
+	offset += cipherSuitesLen
+
+	// Compression Methods
+	if offset+1 > len(payload) {
+		return nil
+	}
+	offset += 1 + int(payload[offset])
+
+	// Extensions
+	if offset+2 > len(payload) {
+		return hello // No extensions
+	}
+	endOfExtensions := offset + 2 + int(binary.BigEndian.Uint16(payload[offset:offset+2]))
+	offset += 2
+	if endOfExtensions > len(payload) {
+		endOfExtensions = len(payload)
+	}
+
+	for offset+4 <= endOfExtensions {
+		extType := binary.BigEndian.Uint16(payload[offset : offset+2])
+		extLen := int(binary.BigEndian.Uint16(payload[offset+2 : offset+4]))
+		offset += 4
+		if offset+extLen > endOfExtensions {
+			break
+		}
+		hello.Extensions = append(hello.Extensions, extType)
+		hello.parseExtension(extType, payload[offset:offset+extLen])
+		offset += extLen
+	}
+
+	return hello
+}
+
+// Decodes the contents of the extensions that describe the client.
+func (hello *clientHello) parseExtension(extType uint16, data []byte) {
+	switch extType {
+	case extServerName:
+		// List length (2), then entries of type (1), length (2) and name
+		for offset := 2; offset+3 <= len(data); {
+			nameLen := int(binary.BigEndian.Uint16(data[offset+1 : offset+3]))
+			if offset+3+nameLen > len(data) {
+				break
+			}
+			if data[offset] == 0 { // Host Name
+				hello.SNI = string(data[offset+3 : offset+3+nameLen])
+				break
+			}
+			offset += 3 + nameLen
+		}
+	case extALPN:
+		// List length (2), then length-prefixed protocol names
+		for offset := 2; offset < len(data); {
+			nameLen := int(data[offset])
+			if offset+1+nameLen > len(data) {
+				break
+			}
+			hello.ALPN = append(hello.ALPN, string(data[offset+1:offset+1+nameLen]))
+			offset += 1 + nameLen
+		}
+	case extSupportedVersions:
+		if len(data) > 0 {
+			hello.SupportedVersions = readUint16List(data[1:]) // One-byte list length
+		}
+	case extSupportedGroups:
+		if len(data) >= 2 {
+			hello.SupportedGroups = readUint16List(data[2:])
+		}
+	case extSignatureAlgorithms:
+		if len(data) >= 2 {
+			hello.SignatureAlgorithms = readUint16List(data[2:])
+		}
+	}
+}
+
+// Returns the versions the client offers: the supported_versions list, or before
+// TLS 1.3 just the legacy version, which is the highest it accepts.
+func (hello *clientHello) offeredVersions() []uint16 {
+	if versions := withoutGREASE(hello.SupportedVersions); len(versions) > 0 {
+		return versions
+	}
+	return []uint16{hello.LegacyVersion}
+}
+
+// Returns the highest version the client offers.
+func (hello *clientHello) maxVersion() uint16 {
+	version := hello.LegacyVersion
+	for _, v := range withoutGREASE(hello.SupportedVersions) {
+		if v > version {
+			version = v
+		}
+	}
+	return version
+}
+
+// Reports whether the client sent an extension of the given type.
+func (hello *clientHello) hasExtension(extType uint16) bool {
+	for _, ext := range hello.Extensions {
+		if ext == extType {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether any list the client sent carries a GREASE value.
+func (hello *clientHello) hasGREASE() bool {
+	for _, list := range [][]uint16{hello.CipherSuites, hello.Extensions, hello.SupportedGroups, hello.SupportedVersions} {
+		if len(withoutGREASE(list)) != len(list) {
+			return true
+		}
+	}
+	return false
+}
+
+// Maps values to their names.
+func namesOf(values []uint16, name func(uint16) string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	names := make([]string, len(values))
+	for i, v := range values {
+		names[i] = name(v)
+	}
+	return names
+}
+
+// Reads consecutive big-endian 16-bit values, ignoring a trailing odd byte.
+func readUint16List(data []byte) []uint16 {
+	values := make([]uint16, 0, len(data)/2)
+	for i := 0; i+2 <= len(data); i += 2 {
+		values = append(values, binary.BigEndian.Uint16(data[i:i+2]))
+	}
+	return values
+}
@@ -0,0 +1,334 @@
+/**
+ * DHCP Protocol Parser.
+ *
+ * Parses DHCPv4 and DHCPv6 messages to extract what clients say about
+ * themselves: hostname, FQDN, vendor class and the options they ask for,
+ * whose order is a strong operating system fingerprint. Server replies
+ * give the address bound to a client and how long the lease runs.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package parser
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// UDP ports DHCP runs on (RFC 2131 and RFC 8415).
+const (
+	DHCPv4ServerPort = 67
+	DHCPv4ClientPort = 68
+	DHCPv6ClientPort = 546
+	DHCPv6ServerPort = 547
+)
+
+// Options without a gopacket constant.
+const (
+	dhcpOptRenewalTime   layers.DHCPOpt = 58
+	dhcpOptRebindingTime layers.DHCPOpt = 59
+	dhcpOptClientFQDN    layers.DHCPOpt = 81
+)
+
+// Holds what a DHCPv4 or DHCPv6 message reveals about the client it concerns.
+type DHCPInfo struct {
+	Version     int    // 4 or 6
+	MessageType string // e.g. "Request", "Ack", "Solicit", "Reply"
+	FromServer  bool   // Sent by a server (or relay) to the client
+	ClientMAC   string // chaddr, or the link-layer address in a DHCPv6 client DUID
+
+	// Sent by clients
+	Hostname             string // Option 12
+	ClientFQDN           string // Option 81, or DHCPv6 option 39
+	VendorClass          string // Option 60, or DHCPv6 option 16
+	ParameterRequestList []int  // Option 55, or the DHCPv6 Option Request option, in the client's order
+	RequestedIP          string // Option 50
+
+	// Sent by servers
+	AssignedIP    string        // yiaddr, or the address in a DHCPv6 IA_NA
+	ServerID      string        // Option 54
+	LeaseTime     time.Duration // Option 51, or the address's valid lifetime
+	RenewalTime   time.Duration // Option 58 (T1)
+	RebindingTime time.Duration // Option 59 (T2)
+}
+
+// Extracts DHCP information from a packet.
+func ParseDHCP(packet gopacket.Packet) (*DHCPInfo, error) {
+	udpLayer := packet.Layer(layers.LayerTypeUDP)
+	if udpLayer == nil {
+		return nil, nil // Not UDP
+	}
+
+	udp, _ := udpLayer.(*layers.UDP)
+	return ParseDHCPPayload(udp.Payload, uint16(udp.SrcPort), uint16(udp.DstPort))
+}
+
+// Extracts DHCP information from a UDP payload. Returns nil without an error when
+// neither port is a DHCP port.
+func ParseDHCPPayload(payload []byte, srcPort, dstPort uint16) (_ *DHCPInfo, err error) {
+	defer recoverMalformed("dhcp message", &err)
+	switch {
+	case srcPort == DHCPv4ServerPort || srcPort == DHCPv4ClientPort:
+		if dstPort == DHCPv4ServerPort || dstPort == DHCPv4ClientPort {
+			return parseDHCPv4(payload)
+		}
+	case srcPort == DHCPv6ClientPort || srcPort == DHCPv6ServerPort:
+		if dstPort == DHCPv6ClientPort || dstPort == DHCPv6ServerPort {
+			return parseDHCPv6(payload, srcPort == DHCPv6ServerPort)
+		}
+	}
+	return nil, nil
+}
+
+// Returns the client's name: its hostname, or its FQDN when it sent none.
+func (d *DHCPInfo) Name() string {
+	if d.Hostname != "" {
+		return d.Hostname
+	}
+	return d.ClientFQDN
+}
+
+// Returns the parameter request list as comma-separated option codes, the form
+// DHCP fingerprint databases use (e.g. "1,3,6,15,31,33").
+func (d *DHCPInfo) Fingerprint() string {
+	codes := make([]string, len(d.ParameterRequestList))
+	for i, code := range d.ParameterRequestList {
+		codes[i] = strconv.Itoa(code)
+	}
+	return strings.Join(codes, ",")
+}
+
+// Returns a one-line description of the message.
+func (d *DHCPInfo) Summary() string {
+	summary := d.MessageType
+	if name := d.Name(); name != "" {
+		summary += " " + name
+	}
+	if d.AssignedIP != "" {
+		summary += fmt.Sprintf(" → %s", d.AssignedIP)
+		if d.LeaseTime > 0 {
+			summary += fmt.Sprintf(" (lease %s)", d.LeaseTime)
+		}
+	} else if d.RequestedIP != "" {
+		summary += fmt.Sprintf(" for %s", d.RequestedIP)
+	}
+	if d.VendorClass != "" {
+		summary += fmt.Sprintf(" [%s]", d.VendorClass)
+	}
+	return summary
+}
+
+// Parses a DHCPv4 message (RFC 2131, RFC 2132).
+func parseDHCPv4(payload []byte) (*DHCPInfo, error) {
+	// gopacket slices chaddr by the header's hardware length without checking it
+	if len(payload) < 240 || payload[2] > 16 {
+		return nil, fmt.Errorf("invalid DHCPv4 message")
+	}
+	var dhcp layers.DHCPv4
+	if err := dhcp.DecodeFromBytes(payload, gopacket.NilDecodeFeedback); err != nil {
+		return nil, fmt.Errorf("invalid DHCPv4 message: %w", err)
+	}
+
+	info := &DHCPInfo{
+		Version:    4,
+		FromServer: dhcp.Operation == layers.DHCPOpReply,
+	}
+	if dhcp.HardwareType == layers.LinkTypeEthernet && len(dhcp.ClientHWAddr) == 6 {
+		info.ClientMAC = dhcp.ClientHWAddr.String()
+	}
+
+	for _, opt := range dhcp.Options {
+		data := opt.Data
+		switch opt.Type {
+		case layers.DHCPOptMessageType:
+			if len(data) == 1 {
+				info.MessageType = layers.DHCPMsgType(data[0]).String()
+			}
+		case layers.DHCPOptHostname:
+			info.Hostname = dhcpString(data)
+		case layers.DHCPOptClassID:
+			info.VendorClass = dhcpString(data)
+		case layers.DHCPOptParamsRequest:
+			for _, code := range data {
+				info.ParameterRequestList = append(info.ParameterRequestList, int(code))
+			}
+		case layers.DHCPOptRequestIP:
+			info.RequestedIP = dhcpIPv4(data)
+		case layers.DHCPOptServerID:
+			info.ServerID = dhcpIPv4(data)
+		case layers.DHCPOptLeaseTime:
+			info.LeaseTime = dhcpSeconds(data)
+		case dhcpOptRenewalTime:
+			info.RenewalTime = dhcpSeconds(data)
+		case dhcpOptRebindingTime:
+			info.RebindingTime = dhcpSeconds(data)
+		case dhcpOptClientFQDN:
+			// Flags and two deprecated RCODE bytes, then the name: DNS wire format when
+			// the E flag is set, ASCII otherwise (RFC 4702)
+			if len(data) > 3 {
+				if data[0]&0x04 != 0 {
+					info.ClientFQDN = dhcpDomainName(data[3:])
+				} else {
+					info.ClientFQDN = dhcpString(data[3:])
+				}
+			}
+		}
+	}
+	if info.MessageType == "" {
+		return nil, fmt.Errorf("invalid DHCPv4 message: no message type")
+	}
+
+	// yiaddr is only meaningful in an Offer or Ack
+	if info.FromServer && !dhcp.YourClientIP.IsUnspecified() {
+		info.AssignedIP = dhcp.YourClientIP.String()
+	}
+	return info, nil
+}
+
+// Parses a DHCPv6 message (RFC 8415). Relayed messages are only seen between relays
+// and servers, so they are not unwrapped.
+func parseDHCPv6(payload []byte, fromServer bool) (*DHCPInfo, error) {
+	var dhcp layers.DHCPv6
+	if err := dhcp.DecodeFromBytes(payload, gopacket.NilDecodeFeedback); err != nil {
+		return nil, fmt.Errorf("invalid DHCPv6 message: %w", err)
+	}
+	if dhcp.MsgType == layers.DHCPv6MsgTypeRelayForward || dhcp.MsgType == layers.DHCPv6MsgTypeRelayReply {
+		return nil, nil
+	}
+
+	info := &DHCPInfo{
+		Version:     6,
+		MessageType: dhcp.MsgType.String(),
+		FromServer:  fromServer,
+	}
+	if dhcp.MsgType == layers.DHCPv6MsgTypeAdverstise {
+		info.MessageType = "Advertise" // gopacket misspells it
+	}
+	for _, opt := range dhcp.Options {
+		data := opt.Data
+		switch opt.Code {
+		case layers.DHCPv6OptClientID:
+			info.ClientMAC = duidLinkLayerAddress(data)
+		case layers.DHCPv6OptOro:
+			for i := 0; i+1 < len(data); i += 2 {
+				info.ParameterRequestList = append(info.ParameterRequestList, int(data[i])<<8|int(data[i+1]))
+			}
+		case layers.DHCPv6OptVendorClass:
+			info.VendorClass = dhcpv6VendorClass(data)
+		case layers.DHCPv6OptClientFQDN:
+			// One byte of flags, then the name in DNS wire format (RFC 4704)
+			if len(data) > 1 {
+				info.ClientFQDN = dhcpDomainName(data[1:])
+			}
+		case layers.DHCPv6OptIANA:
+			// IAID, T1 and T2, then the IA's own options
+			if len(data) < 12 {
+				continue
+			}
+			info.RenewalTime = dhcpSeconds(data[4:8])
+			info.RebindingTime = dhcpSeconds(data[8:12])
+			for sub := data[12:]; len(sub) >= 4; {
+				code, length := int(sub[0])<<8|int(sub[1]), int(sub[2])<<8|int(sub[3])
+				if len(sub) < 4+length {
+					break
+				}
+				// IAADDR: address, preferred lifetime, valid lifetime
+				if code == int(layers.DHCPv6OptIAAddr) && length >= 24 && info.AssignedIP == "" {
+					if fromServer {
+						info.AssignedIP = net.IP(sub[4:20]).String()
+						info.LeaseTime = dhcpSeconds(sub[24:28])
+					} else {
+						info.RequestedIP = net.IP(sub[4:20]).String()
+					}
+				}
+				sub = sub[4+length:]
+			}
+		}
+	}
+	return info, nil
+}
+
+// Returns the link-layer address in a DUID-LLT or DUID-LL on Ethernet, or "" for
+// other DUID types, which carry no address.
+func duidLinkLayerAddress(duid []byte) string {
+	if len(duid) < 4 || int(duid[2])<<8|int(duid[3]) != 1 { // Hardware type Ethernet
+		return ""
+	}
+	var addr []byte
+	switch int(duid[0])<<8 | int(duid[1]) {
+	case 1: // DUID-LLT: type, hardware type, time, address
+		if len(duid) == 14 {
+			addr = duid[8:]
+		}
+	case 3: // DUID-LL: type, hardware type, address
+		if len(duid) == 10 {
+			addr = duid[4:]
+		}
+	}
+	if addr == nil {
+		return ""
+	}
+	return net.HardwareAddr(addr).String()
+}
+
+// Returns the first class in a DHCPv6 Vendor Class option: an enterprise number,
+// then length-prefixed class strings.
+func dhcpv6VendorClass(data []byte) string {
+	if len(data) < 6 {
+		return ""
+	}
+	length := int(data[4])<<8 | int(data[5])
+	if len(data) < 6+length {
+		return ""
+	}
+	return dhcpString(data[6 : 6+length])
+}
+
+// Decodes a domain name in DNS wire format, as the FQDN options carry it. Names
+// may stop without the root label when the client sends only its host part.
+func dhcpDomainName(data []byte) string {
+	var labels []string
+	for len(data) > 0 {
+		length := int(data[0])
+		if length == 0 || length > 63 || len(data) < 1+length {
+			break
+		}
+		labels = append(labels, string(data[1:1+length]))
+		data = data[1+length:]
+	}
+	return strings.Join(labels, ".")
+}
+
+// Returns a DHCP string option without the NUL padding some clients append.
+func dhcpString(data []byte) string {
+	return strings.TrimRight(string(data), "\x00")
+}
+
+// Returns a four-byte address option as a dotted quad.
+func dhcpIPv4(data []byte) string {
+	if len(data) != 4 {
+		return ""
+	}
+	return net.IP(data).String()
+}
+
+// Returns a four-byte count of seconds as a duration. The all-ones value means an
+// infinite lease and is reported as zero.
+func dhcpSeconds(data []byte) time.Duration {
+	if len(data) != 4 {
+		return 0
+	}
+	seconds := uint32(data[0])<<24 | uint32(data[1])<<16 | uint32(data[2])<<8 | uint32(data[3])
+	if seconds == 0xffffffff {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
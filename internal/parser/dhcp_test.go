@@ -0,0 +1,154 @@
+/**
+ * DHCP Parser Tests.
+ *
+ * Validates extraction of client identity and lease details from DHCPv4
+ * and DHCPv6 messages.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package parser
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Serializes a DHCPv4 message from the client with MAC 00:11:22:33:44:55.
+func buildDHCPv4(tb testing.TB, op layers.DHCPOp, yiaddr string, options ...layers.DHCPOption) []byte {
+	tb.Helper()
+	mac, _ := net.ParseMAC("00:11:22:33:44:55")
+	dhcp := &layers.DHCPv4{
+		Operation:    op,
+		HardwareType: layers.LinkTypeEthernet,
+		HardwareLen:  6,
+		Xid:          0x3903f326,
+		ClientIP:     net.IPv4zero,
+		YourClientIP: net.ParseIP(yiaddr).To4(),
+		NextServerIP: net.IPv4zero,
+		RelayAgentIP: net.IPv4zero,
+		ClientHWAddr: mac,
+		Options:      options,
+	}
+	if dhcp.YourClientIP == nil {
+		dhcp.YourClientIP = net.IPv4zero
+	}
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{}, dhcp); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// Serializes a DHCPv6 message.
+func buildDHCPv6(tb testing.TB, msgType layers.DHCPv6MsgType, options ...layers.DHCPv6Option) []byte {
+	tb.Helper()
+	dhcp := &layers.DHCPv6{MsgType: msgType, TransactionID: []byte{0x1c, 0x2d, 0x3e}, Options: options}
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{}, dhcp); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// Verifies that a DHCPv4 Request yields the client's name, vendor class, parameter
+// request list and requested address, and an Ack the lease bound to it.
+func TestParseDHCPPayload_v4(t *testing.T) {
+	request := buildDHCPv4(t, layers.DHCPOpRequest, "",
+		layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(layers.DHCPMsgTypeRequest)}),
+		layers.NewDHCPOption(layers.DHCPOptRequestIP, []byte{192, 168, 1, 23}),
+		layers.NewDHCPOption(layers.DHCPOptHostname, []byte("DESKTOP-4KQ1\x00")),
+		layers.NewDHCPOption(dhcpOptClientFQDN, append([]byte{0x04, 0, 0, 12}, "DESKTOP-4KQ1\x04corp\x00"...)),
+		layers.NewDHCPOption(layers.DHCPOptClassID, []byte("MSFT 5.0")),
+		layers.NewDHCPOption(layers.DHCPOptParamsRequest, []byte{1, 3, 6, 15, 31, 33, 43, 44, 46, 47, 119, 121, 249, 252}),
+	)
+	info, err := ParseDHCPPayload(request, DHCPv4ClientPort, DHCPv4ServerPort)
+	if err != nil || info == nil {
+		t.Fatalf("Expected a DHCPv4 Request, got %v", err)
+	}
+	if info.Version != 4 || info.MessageType != "Request" || info.FromServer || info.ClientMAC != "00:11:22:33:44:55" {
+		t.Errorf("Expected a client Request from 00:11:22:33:44:55, got %+v", info)
+	}
+	if info.Hostname != "DESKTOP-4KQ1" || info.ClientFQDN != "DESKTOP-4KQ1.corp" || info.VendorClass != "MSFT 5.0" {
+		t.Errorf("Expected the hostname, FQDN and vendor class, got %q %q %q", info.Hostname, info.ClientFQDN, info.VendorClass)
+	}
+	if info.Fingerprint() != "1,3,6,15,31,33,43,44,46,47,119,121,249,252" || info.RequestedIP != "192.168.1.23" {
+		t.Errorf("Expected the parameter request list and requested IP, got %q %q", info.Fingerprint(), info.RequestedIP)
+	}
+
+	ack := buildDHCPv4(t, layers.DHCPOpReply, "192.168.1.23",
+		layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(layers.DHCPMsgTypeAck)}),
+		layers.NewDHCPOption(layers.DHCPOptServerID, []byte{192, 168, 1, 1}),
+		layers.NewDHCPOption(layers.DHCPOptLeaseTime, []byte{0, 1, 0x51, 0x80}),
+		layers.NewDHCPOption(dhcpOptRenewalTime, []byte{0, 0, 0xa8, 0xc0}),
+		layers.NewDHCPOption(dhcpOptRebindingTime, []byte{0, 1, 0x27, 0x50}),
+	)
+	info, err = ParseDHCPPayload(ack, DHCPv4ServerPort, DHCPv4ClientPort)
+	if err != nil || info == nil || !info.FromServer || info.MessageType != "Ack" {
+		t.Fatalf("Expected a server Ack, got %+v, %v", info, err)
+	}
+	if info.AssignedIP != "192.168.1.23" || info.ServerID != "192.168.1.1" || info.ClientMAC != "00:11:22:33:44:55" {
+		t.Errorf("Expected 192.168.1.23 bound to the client by 192.168.1.1, got %+v", info)
+	}
+	if info.LeaseTime != 24*time.Hour || info.RenewalTime != 12*time.Hour || info.RebindingTime != 21*time.Hour {
+		t.Errorf("Expected a one day lease, got %s, %s, %s", info.LeaseTime, info.RenewalTime, info.RebindingTime)
+	}
+
+	t.Run("not DHCP", func(t *testing.T) {
+		if info, err := ParseDHCPPayload(request, 53, 53); info != nil || err != nil {
+			t.Errorf("Expected nothing on other ports, got %+v, %v", info, err)
+		}
+		if _, err := ParseDHCPPayload(request[:100], DHCPv4ClientPort, DHCPv4ServerPort); err == nil {
+			t.Error("Expected a truncated message to fail")
+		}
+		bad := append([]byte(nil), request...)
+		bad[2] = 200 // Hardware address length past chaddr
+		if _, err := ParseDHCPPayload(bad, DHCPv4ClientPort, DHCPv4ServerPort); err == nil {
+			t.Error("Expected an oversized hardware address length to fail")
+		}
+	})
+}
+
+// Verifies that a DHCPv6 Solicit yields the MAC in its DUID, vendor class, FQDN
+// and option request list, and a Reply the address and lifetime it binds.
+func TestParseDHCPPayload_v6(t *testing.T) {
+	duid := []byte{0, 1, 0, 1, 0x2a, 0x5b, 0x6c, 0x7d, 0x00, 0x11, 0x22, 0x33, 0x44, 0x55} // DUID-LLT
+	vendorClass := append([]byte{0, 0, 0x01, 0x37, 0, 8}, "MSFT 5.0"...)                   // Enterprise 311
+	fqdn := append([]byte{0x01}, "\x0cDESKTOP-4KQ1\x04corp\x00"...)
+	solicit := buildDHCPv6(t, layers.DHCPv6MsgTypeSolicit,
+		layers.NewDHCPv6Option(layers.DHCPv6OptClientID, duid),
+		layers.NewDHCPv6Option(layers.DHCPv6OptClientFQDN, fqdn),
+		layers.NewDHCPv6Option(layers.DHCPv6OptVendorClass, vendorClass),
+		layers.NewDHCPv6Option(layers.DHCPv6OptOro, []byte{0, 17, 0, 23, 0, 24, 0, 32}),
+	)
+	info, err := ParseDHCPPayload(solicit, DHCPv6ClientPort, DHCPv6ServerPort)
+	if err != nil || info == nil {
+		t.Fatalf("Expected a DHCPv6 Solicit, got %v", err)
+	}
+	if info.Version != 6 || info.MessageType != "Solicit" || info.FromServer || info.ClientMAC != "00:11:22:33:44:55" {
+		t.Errorf("Expected a client Solicit from 00:11:22:33:44:55, got %+v", info)
+	}
+	if info.ClientFQDN != "DESKTOP-4KQ1.corp" || info.Name() != "DESKTOP-4KQ1.corp" || info.VendorClass != "MSFT 5.0" || info.Fingerprint() != "17,23,24,32" {
+		t.Errorf("Expected the FQDN, vendor class and option request list, got %+v", info)
+	}
+
+	// IA_NA: IAID, T1, T2, then an IAADDR with preferred and valid lifetimes
+	iaaddr := append(net.ParseIP("2001:db8::23").To16(), 0, 0, 0x0e, 0x10, 0, 0, 0x1c, 0x20)
+	iana := append([]byte{0, 0, 0, 1, 0, 0, 0x07, 0x08, 0, 0, 0x0b, 0x40, 0, 5, 0, 24}, iaaddr...)
+	reply := buildDHCPv6(t, layers.DHCPv6MsgTypeReply,
+		layers.NewDHCPv6Option(layers.DHCPv6OptClientID, []byte{0, 2, 0, 0, 0x01, 0x37, 1, 2, 3}), // DUID-EN
+		layers.NewDHCPv6Option(layers.DHCPv6OptIANA, iana),
+	)
+	info, err = ParseDHCPPayload(reply, DHCPv6ServerPort, DHCPv6ClientPort)
+	if err != nil || info == nil || !info.FromServer || info.MessageType != "Reply" {
+		t.Fatalf("Expected a server Reply, got %+v, %v", info, err)
+	}
+	if info.AssignedIP != "2001:db8::23" || info.LeaseTime != 2*time.Hour || info.RenewalTime != 30*time.Minute || info.ClientMAC != "" {
+		t.Errorf("Expected 2001:db8::23 for two hours and no MAC from a DUID-EN, got %+v", info)
+	}
+}
@@ -0,0 +1,422 @@
+/**
+ * Local Service Discovery Parser.
+ *
+ * Parses the protocols devices use to announce themselves on the local
+ * network: multicast DNS with DNS-SD, LLMNR, NetBIOS Name Service and
+ * SSDP. Announcements and answers carry the sender's own name, the
+ * services it offers and often its model; queries only name what the
+ * sender is looking for.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/google/gopacket/layers"
+)
+
+// UDP ports of the discovery protocols.
+const (
+	MDNSPort  = 5353
+	LLMNRPort = 5355
+	NBNSPort  = 137
+	SSDPPort  = 1900
+)
+
+// DNS-SD TXT keys that name a device's model, in order of preference: Google Cast,
+// Apple device info, AirPlay, printers, HomeKit.
+var mdnsModelKeys = []string{"md", "model", "am", "ty", "usb_MDL", "rpMd"}
+
+// Holds what a discovery message reveals about its sender.
+type DiscoveryInfo struct {
+	Protocol string // "mDNS", "LLMNR", "NBNS" or "SSDP"
+	Query    bool   // A query or search rather than an answer or announcement
+	Question string // Name or service type a query looks for
+
+	// Answers and announcements only
+	Hostname     string   // Name the sender answers for or registers
+	FriendlyName string   // DNS-SD "fn" or UPnP friendly name
+	Services     []string // DNS-SD service types (e.g. "_googlecast._tcp") or UPnP device and service types
+	Model        string   // DNS-SD model, or the product in the SSDP SERVER header
+	Server       string   // SSDP SERVER header: OS, UPnP version and product
+	Location     string   // SSDP URL of the UPnP device description
+	Workgroup    string   // NetBIOS group name
+}
+
+// Extracts discovery information from a UDP payload. Returns nil without an error
+// when neither port is a discovery port.
+func ParseDiscoveryPayload(payload []byte, srcPort, dstPort uint16) (_ *DiscoveryInfo, err error) {
+	defer recoverMalformed("discovery message", &err)
+	switch {
+	case srcPort == MDNSPort || dstPort == MDNSPort:
+		return parseMDNS(payload)
+	case srcPort == LLMNRPort || dstPort == LLMNRPort:
+		return parseLLMNR(payload)
+	case srcPort == NBNSPort || dstPort == NBNSPort:
+		return parseNBNS(payload)
+	case srcPort == SSDPPort || dstPort == SSDPPort:
+		return parseSSDP(payload)
+	}
+	return nil, nil
+}
+
+// Returns the name the sender goes by: its friendly name, or its hostname.
+func (d *DiscoveryInfo) Name() string {
+	if d.FriendlyName != "" {
+		return d.FriendlyName
+	}
+	return d.Hostname
+}
+
+// Returns a one-line description of the message.
+func (d *DiscoveryInfo) Summary() string {
+	if d.Query {
+		return fmt.Sprintf("Query %s", d.Question)
+	}
+	summary := "Announce"
+	if name := d.Name(); name != "" {
+		summary += " " + name
+	}
+	if d.Model != "" {
+		summary += fmt.Sprintf(" (%s)", d.Model)
+	}
+	if len(d.Services) > 0 {
+		summary += " [" + strings.Join(d.Services, ", ") + "]"
+	}
+	return summary
+}
+
+// Adds a service type once.
+func (d *DiscoveryInfo) addService(service string) {
+	if service == "" {
+		return
+	}
+	for _, known := range d.Services {
+		if known == service {
+			return
+		}
+	}
+	d.Services = append(d.Services, service)
+}
+
+// Parses a multicast DNS message (RFC 6762) and the DNS-SD records it carries
+// (RFC 6763). Responses are unsolicited or answer a query; both describe the
+// responder.
+func parseMDNS(payload []byte) (*DiscoveryInfo, error) {
+	var dns layers.DNS
+	if err := DecodeDNS(&dns, payload); err != nil {
+		return nil, fmt.Errorf("invalid mDNS message: %w", err)
+	}
+
+	info := &DiscoveryInfo{Protocol: "mDNS"}
+	if !dns.QR {
+		info.Query = true
+		if len(dns.Questions) > 0 {
+			info.Question = trimLocal(string(dns.Questions[0].Name))
+		}
+		return info, nil
+	}
+
+	records := append(append(dns.Answers, dns.Authorities...), dns.Additionals...)
+	var target string
+	for _, rr := range records {
+		name := string(rr.Name)
+		switch rr.Type {
+		case layers.DNSTypeA, layers.DNSTypeAAAA:
+			if info.Hostname == "" {
+				info.Hostname = trimLocal(name)
+			}
+		case layers.DNSTypePTR:
+			switch {
+			case name == "_services._dns-sd._udp.local":
+				info.addService(serviceType(string(rr.PTR)))
+			case strings.HasSuffix(name, ".in-addr.arpa") || strings.HasSuffix(name, ".ip6.arpa"):
+				if target == "" {
+					target = trimLocal(string(rr.PTR))
+				}
+			default:
+				info.addService(serviceType(name))
+			}
+		case layers.DNSTypeSRV:
+			info.addService(serviceType(name))
+			if target == "" {
+				target = trimLocal(string(rr.SRV.Name))
+			}
+		case layers.DNSTypeTXT:
+			for _, txt := range rr.TXTs {
+				key, value, ok := bytes.Cut(txt, []byte("="))
+				if !ok || len(value) == 0 {
+					continue
+				}
+				if string(key) == "fn" && info.FriendlyName == "" {
+					info.FriendlyName = string(value)
+				}
+			}
+			if info.Model == "" {
+				info.Model = txtModel(rr.TXTs)
+			}
+		}
+	}
+	if info.Hostname == "" {
+		info.Hostname = target
+	}
+	return info, nil
+}
+
+// Returns the service type of a DNS-SD name: the "_service._proto" labels, without
+// any instance name before them, subtype or domain.
+func serviceType(name string) string {
+	labels := strings.Split(trimLocal(name), ".")
+	for i := 0; i+1 < len(labels); i++ {
+		proto := labels[i+1]
+		if strings.HasPrefix(labels[i], "_") && (proto == "_tcp" || proto == "_udp") {
+			return labels[i] + "." + proto
+		}
+	}
+	return ""
+}
+
+// Returns the model a DNS-SD TXT record names, if any.
+func txtModel(txts [][]byte) string {
+	for _, want := range mdnsModelKeys {
+		for _, txt := range txts {
+			key, value, ok := bytes.Cut(txt, []byte("="))
+			if ok && len(value) > 0 && string(key) == want {
+				return string(value)
+			}
+		}
+	}
+	return ""
+}
+
+// Removes the ".local" domain and trailing dot from an mDNS name.
+func trimLocal(name string) string {
+	name = strings.TrimSuffix(name, ".")
+	return strings.TrimSuffix(name, ".local")
+}
+
+// Parses an LLMNR message (RFC 4795). A host answers only for its own name.
+func parseLLMNR(payload []byte) (*DiscoveryInfo, error) {
+	var dns layers.DNS
+	if err := DecodeDNS(&dns, payload); err != nil {
+		return nil, fmt.Errorf("invalid LLMNR message: %w", err)
+	}
+
+	info := &DiscoveryInfo{Protocol: "LLMNR", Query: !dns.QR}
+	if len(dns.Questions) > 0 {
+		info.Question = string(dns.Questions[0].Name)
+	}
+	if info.Query {
+		return info, nil
+	}
+	for _, rr := range dns.Answers {
+		if rr.Type == layers.DNSTypeA || rr.Type == layers.DNSTypeAAAA {
+			info.Hostname = string(rr.Name)
+			break
+		}
+	}
+	return info, nil
+}
+
+// NetBIOS Name Service opcodes and resource record types (RFC 1002).
+const (
+	nbnsOpcodeQuery        = 0
+	nbnsOpcodeRegistration = 5
+	nbnsOpcodeRefresh      = 8
+	nbnsOpcodeRefreshAlt   = 9 // Sent by most implementations instead of 8
+	nbnsTypeNB             = 0x20
+	nbnsTypeNBSTAT         = 0x21
+	nbnsSuffixWorkstation  = 0x00
+	nbnsSuffixServer       = 0x20
+	nbnsGroupFlag          = 0x8000
+)
+
+// Parses a NetBIOS Name Service message (RFC 1002). Hosts announce their names by
+// registering and refreshing them, and answer queries and node status requests
+// for them.
+func parseNBNS(payload []byte) (*DiscoveryInfo, error) {
+	if len(payload) < 12 {
+		return nil, fmt.Errorf("invalid NBNS message")
+	}
+	flags := int(payload[2])<<8 | int(payload[3])
+	response := flags&0x8000 != 0
+	opcode := flags >> 11 & 0xf
+	questions := int(payload[4])<<8 | int(payload[5])
+	answers := int(payload[6])<<8 | int(payload[7])
+
+	info := &DiscoveryInfo{Protocol: "NBNS"}
+	offset := 12
+	var question string
+	var suffix byte
+	if questions > 0 {
+		var err error
+		question, suffix, offset, err = nbnsName(payload, offset)
+		if err != nil || offset+4 > len(payload) {
+			return nil, fmt.Errorf("invalid NBNS question")
+		}
+		offset += 4 // Type and class
+		info.Question = question
+	}
+
+	switch {
+	case !response && opcode == nbnsOpcodeQuery:
+		info.Query = true
+	case !response && (opcode == nbnsOpcodeRegistration || opcode == nbnsOpcodeRefresh || opcode == nbnsOpcodeRefreshAlt):
+		// The additional record repeats the name with its flags
+		group := false
+		if _, _, next, err := nbnsName(payload, offset); err == nil && next+12 <= len(payload) {
+			group = int(payload[next+10])<<8&nbnsGroupFlag != 0
+		}
+		nbnsAddName(info, question, suffix, group)
+	case response && opcode == nbnsOpcodeQuery && answers > 0:
+		name, suffix, next, err := nbnsName(payload, offset)
+		if err != nil || next+10 > len(payload) {
+			return nil, fmt.Errorf("invalid NBNS answer")
+		}
+		rrType := int(payload[next])<<8 | int(payload[next+1])
+		length := int(payload[next+8])<<8 | int(payload[next+9])
+		rdata := payload[next+10:]
+		if len(rdata) < length {
+			return nil, fmt.Errorf("invalid NBNS answer")
+		}
+		rdata = rdata[:length]
+
+		switch rrType {
+		case nbnsTypeNB:
+			group := len(rdata) >= 2 && int(rdata[0])<<8&nbnsGroupFlag != 0
+			nbnsAddName(info, name, suffix, group)
+		case nbnsTypeNBSTAT:
+			// Node status: the count, then each name with its suffix and flags
+			if len(rdata) == 0 {
+				break
+			}
+			count := int(rdata[0])
+			for i := 0; i < count && 1+18*(i+1) <= len(rdata); i++ {
+				entry := rdata[1+18*i : 1+18*(i+1)]
+				nbnsAddName(info, strings.TrimRight(string(entry[:15]), " "), entry[15], int(entry[16])<<8&nbnsGroupFlag != 0)
+			}
+		}
+	}
+	return info, nil
+}
+
+// Records a NetBIOS name by what its suffix and group flag say it is.
+func nbnsAddName(info *DiscoveryInfo, name string, suffix byte, group bool) {
+	if name == "" || name == "*" {
+		return
+	}
+	switch {
+	case group && suffix == nbnsSuffixWorkstation:
+		if info.Workgroup == "" {
+			info.Workgroup = name
+		}
+	case !group && (suffix == nbnsSuffixWorkstation || suffix == nbnsSuffixServer):
+		if info.Hostname == "" {
+			info.Hostname = name
+		}
+	}
+}
+
+// Decodes a NetBIOS name at offset: 32 half-byte encoded characters holding a
+// space-padded 15-character name and a suffix byte, then any scope labels.
+// Follows one compression pointer. Returns the name, its suffix and the offset
+// after it.
+func nbnsName(payload []byte, offset int) (string, byte, int, error) {
+	next := -1
+	if offset+2 <= len(payload) && payload[offset]&0xc0 == 0xc0 {
+		next = offset + 2
+		offset = int(payload[offset]&0x3f)<<8 | int(payload[offset+1])
+	}
+	if offset+34 > len(payload) || payload[offset] != 32 {
+		return "", 0, 0, fmt.Errorf("invalid NetBIOS name")
+	}
+	var decoded [16]byte
+	for i := range decoded {
+		hi, lo := payload[offset+1+2*i]-'A', payload[offset+2+2*i]-'A'
+		if hi > 15 || lo > 15 {
+			return "", 0, 0, fmt.Errorf("invalid NetBIOS name")
+		}
+		decoded[i] = hi<<4 | lo
+	}
+	end := offset + 33
+	for end < len(payload) && payload[end] != 0 { // Scope labels
+		end += 1 + int(payload[end])
+	}
+	if end >= len(payload) {
+		return "", 0, 0, fmt.Errorf("invalid NetBIOS name")
+	}
+	if next < 0 {
+		next = end + 1
+	}
+	return strings.TrimRight(string(decoded[:15]), " "), decoded[15], next, nil
+}
+
+// Parses an SSDP message (UPnP Device Architecture): a NOTIFY announcement, an
+// M-SEARCH query, or the response to one.
+func parseSSDP(payload []byte) (*DiscoveryInfo, error) {
+	lines := strings.Split(string(payload), "\n")
+	start := strings.TrimSpace(lines[0])
+	info := &DiscoveryInfo{Protocol: "SSDP"}
+	switch {
+	case strings.HasPrefix(start, "M-SEARCH "):
+		info.Query = true
+	case strings.HasPrefix(start, "NOTIFY "), strings.HasPrefix(start, "HTTP/1.1 200"):
+	default:
+		return nil, fmt.Errorf("invalid SSDP message")
+	}
+
+	byebye := false
+	for _, line := range lines[1:] {
+		name, value, ok := strings.Cut(strings.TrimRight(line, "\r"), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToUpper(strings.TrimSpace(name)) {
+		case "SERVER":
+			info.Server = value
+		case "LOCATION":
+			info.Location = value
+		case "NT", "ST":
+			if info.Query {
+				info.Question = value
+			} else if strings.HasPrefix(value, "urn:") {
+				info.addService(value)
+			}
+		case "NTS":
+			byebye = value == "ssdp:byebye"
+		}
+	}
+	if byebye {
+		info.Server, info.Location, info.Services = "", "", nil // The device is leaving
+	}
+	info.Model = ssdpProduct(info.Server)
+	return info, nil
+}
+
+// Returns the product in an SSDP SERVER header, "OS/version UPnP/1.0
+// product/version", or "" when it names only the OS and UPnP version.
+func ssdpProduct(server string) string {
+	var tokens []string
+	if strings.Contains(server, ",") {
+		tokens = strings.Split(server, ",")
+	} else {
+		tokens = strings.Fields(server)
+	}
+	if len(tokens) < 2 {
+		return ""
+	}
+	for _, token := range tokens[1:] {
+		token = strings.TrimSpace(token)
+		if token != "" && !strings.HasPrefix(strings.ToUpper(token), "UPNP/") && !strings.HasPrefix(strings.ToUpper(token), "DLNADOC/") {
+			return token
+		}
+	}
+	return ""
+}
@@ -0,0 +1,221 @@
+/**
+ * Local Service Discovery Parser Tests.
+ *
+ * Validates extraction of names, services and models from mDNS/DNS-SD,
+ * LLMNR, NetBIOS Name Service and SSDP messages.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package parser
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Serializes a DNS message.
+func buildDNS(tb testing.TB, dns *layers.DNS) []byte {
+	tb.Helper()
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, dns); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// Encodes a NetBIOS name with its suffix in the half-byte form used on the wire.
+func encodeNBNSName(name string, suffix byte) []byte {
+	padded := []byte(name + strings.Repeat(" ", 15-len(name)))
+	padded = append(padded, suffix)
+	encoded := []byte{32}
+	for _, c := range padded {
+		encoded = append(encoded, 'A'+c>>4, 'A'+c&0xf)
+	}
+	return append(encoded, 0)
+}
+
+// Verifies that an mDNS response yields the responder's friendly name, hostname,
+// service types and model, and a query only what it looks for.
+func TestParseDiscoveryPayload_mDNS(t *testing.T) {
+	instance := []byte("Chromecast-5f2a._googlecast._tcp.local")
+	response := buildDNS(t, &layers.DNS{
+		QR: true, AA: true,
+		Answers: []layers.DNSResourceRecord{
+			{Name: []byte("_googlecast._tcp.local"), Type: layers.DNSTypePTR, Class: layers.DNSClassIN, TTL: 120, PTR: instance},
+			{Name: []byte("_services._dns-sd._udp.local"), Type: layers.DNSTypePTR, Class: layers.DNSClassIN, TTL: 120, PTR: []byte("_googlecast._tcp.local")},
+		},
+		Additionals: []layers.DNSResourceRecord{
+			{Name: instance, Type: layers.DNSTypeTXT, Class: layers.DNSClassIN, TTL: 120,
+				TXTs: [][]byte{[]byte("id=5f2a"), []byte("md=Chromecast Ultra"), []byte("fn=Living Room TV")}},
+			{Name: instance, Type: layers.DNSTypeSRV, Class: layers.DNSClassIN, TTL: 120,
+				SRV: layers.DNSSRV{Port: 8009, Name: []byte("5f2a-cast.local")}},
+			{Name: []byte("5f2a-cast.local"), Type: layers.DNSTypeA, Class: layers.DNSClassIN, TTL: 120, IP: net.ParseIP("192.168.1.40").To4()},
+		},
+	})
+	info, err := ParseDiscoveryPayload(response, MDNSPort, MDNSPort)
+	if err != nil || info == nil {
+		t.Fatalf("Expected an mDNS response, got %v", err)
+	}
+	if info.Protocol != "mDNS" || info.Query || info.Name() != "Living Room TV" || info.Hostname != "5f2a-cast" {
+		t.Errorf("Expected the Chromecast's names, got %+v", info)
+	}
+	if info.Model != "Chromecast Ultra" || !reflect.DeepEqual(info.Services, []string{"_googlecast._tcp"}) {
+		t.Errorf("Expected the model and one Cast service, got %q %v", info.Model, info.Services)
+	}
+	if summary := info.Summary(); summary != "Announce Living Room TV (Chromecast Ultra) [_googlecast._tcp]" {
+		t.Errorf("Unexpected summary %q", summary)
+	}
+
+	query := buildDNS(t, &layers.DNS{
+		Questions: []layers.DNSQuestion{{Name: []byte("_airplay._tcp.local"), Type: layers.DNSTypePTR, Class: layers.DNSClassIN}},
+	})
+	info, err = ParseDiscoveryPayload(query, MDNSPort, MDNSPort)
+	if err != nil || info == nil || !info.Query || info.Question != "_airplay._tcp" || info.Name() != "" {
+		t.Errorf("Expected a query for _airplay._tcp, got %+v, %v", info, err)
+	}
+}
+
+// Verifies that an LLMNR response yields the responder's name.
+func TestParseDiscoveryPayload_LLMNR(t *testing.T) {
+	response := buildDNS(t, &layers.DNS{
+		QR:        true,
+		Questions: []layers.DNSQuestion{{Name: []byte("fileserver"), Type: layers.DNSTypeA, Class: layers.DNSClassIN}},
+		Answers: []layers.DNSResourceRecord{
+			{Name: []byte("fileserver"), Type: layers.DNSTypeA, Class: layers.DNSClassIN, TTL: 30, IP: net.ParseIP("192.168.1.10").To4()},
+		},
+	})
+	info, err := ParseDiscoveryPayload(response, LLMNRPort, 50123)
+	if err != nil || info == nil || info.Protocol != "LLMNR" || info.Query || info.Hostname != "fileserver" {
+		t.Errorf("Expected fileserver to answer for itself, got %+v, %v", info, err)
+	}
+}
+
+// Verifies that a response whose answer is cut off inside its fixed fields, which
+// gopacket indexes past, is reported as malformed rather than panicking.
+func TestParseDiscoveryPayload_TruncatedRecord(t *testing.T) {
+	truncated := []byte{0, 0, 0x84, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 1}
+
+	for name, port := range map[string]uint16{"mDNS": MDNSPort, "LLMNR": LLMNRPort} {
+		t.Run(name, func(t *testing.T) {
+			if info, err := ParseDiscoveryPayload(truncated, port, port); err == nil || info != nil {
+				t.Errorf("Expected a malformed message error, got %+v, %v", info, err)
+			}
+		})
+	}
+}
+
+// Verifies that NetBIOS name registrations and node status responses yield the
+// host and workgroup names.
+func TestParseDiscoveryPayload_NBNS(t *testing.T) {
+	registration := func(name string, suffix byte, flags byte) []byte {
+		msg := []byte{0x12, 0x34, 0x29, 0x10, 0, 1, 0, 0, 0, 0, 0, 1} // Opcode 5, recursion desired, broadcast
+		msg = append(msg, encodeNBNSName(name, suffix)...)
+		msg = append(msg, 0, 0x20, 0, 1)
+		msg = append(msg, 0xc0, 12, 0, 0x20, 0, 1, 0, 0x04, 0x93, 0xe0, 0, 6, flags, 0, 192, 168, 1, 22)
+		return msg
+	}
+
+	tests := []struct {
+		name      string
+		payload   []byte
+		hostname  string
+		workgroup string
+	}{
+		{"workstation", registration("DESKTOP-4KQ1", 0x00, 0x00), "DESKTOP-4KQ1", ""},
+		{"workgroup", registration("WORKGROUP", 0x00, 0x80), "", "WORKGROUP"},
+		{"domain controller", registration("CORP", 0x1c, 0x80), "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := ParseDiscoveryPayload(tt.payload, NBNSPort, NBNSPort)
+			if err != nil || info == nil || info.Query {
+				t.Fatalf("Expected a registration, got %+v, %v", info, err)
+			}
+			if info.Hostname != tt.hostname || info.Workgroup != tt.workgroup {
+				t.Errorf("Expected %q in %q, got %q in %q", tt.hostname, tt.workgroup, info.Hostname, info.Workgroup)
+			}
+		})
+	}
+
+	t.Run("node status", func(t *testing.T) {
+		entry := func(name string, suffix, flags byte) []byte {
+			return append([]byte(name+strings.Repeat(" ", 15-len(name))), suffix, flags, 0)
+		}
+		rdata := []byte{3}
+		rdata = append(rdata, entry("NAS", 0x00, 0x04)...)
+		rdata = append(rdata, entry("NAS", 0x20, 0x04)...)
+		rdata = append(rdata, entry("HOME", 0x00, 0x84)...)
+		msg := []byte{0x12, 0x34, 0x84, 0x00, 0, 0, 0, 1, 0, 0, 0, 0}
+		msg = append(msg, encodeNBNSName("*", 0x00)...)
+		msg = append(msg, 0, 0x21, 0, 1, 0, 0, 0, 0, 0, byte(len(rdata)))
+		msg = append(msg, rdata...)
+
+		info, err := ParseDiscoveryPayload(msg, NBNSPort, 50123)
+		if err != nil || info == nil || info.Hostname != "NAS" || info.Workgroup != "HOME" {
+			t.Errorf("Expected NAS in HOME, got %+v, %v", info, err)
+		}
+	})
+
+	t.Run("query", func(t *testing.T) {
+		msg := []byte{0x12, 0x34, 0x01, 0x10, 0, 1, 0, 0, 0, 0, 0, 0}
+		msg = append(msg, encodeNBNSName("PRINTER", 0x20)...)
+		msg = append(msg, 0, 0x20, 0, 1)
+		info, err := ParseDiscoveryPayload(msg, NBNSPort, NBNSPort)
+		if err != nil || info == nil || !info.Query || info.Question != "PRINTER" || info.Hostname != "" {
+			t.Errorf("Expected a query for PRINTER, got %+v, %v", info, err)
+		}
+		if _, err := ParseDiscoveryPayload(msg[:20], NBNSPort, NBNSPort); err == nil {
+			t.Error("Expected a truncated name to fail")
+		}
+	})
+}
+
+// Verifies that SSDP announcements yield the SERVER header, the product in it,
+// the description URL and the device type, and searches only what they look for.
+func TestParseDiscoveryPayload_SSDP(t *testing.T) {
+	notify := "NOTIFY * HTTP/1.1\r\n" +
+		"HOST: 239.255.255.250:1900\r\n" +
+		"CACHE-CONTROL: max-age=1800\r\n" +
+		"LOCATION: http://192.168.1.30:1400/xml/device_description.xml\r\n" +
+		"NT: urn:schemas-upnp-org:device:ZonePlayer:1\r\n" +
+		"NTS: ssdp:alive\r\n" +
+		"SERVER: Linux UPnP/1.0 Sonos/70.3-35220 (ZPS1)\r\n" +
+		"USN: uuid:RINCON_000E58A1B2C301400::urn:schemas-upnp-org:device:ZonePlayer:1\r\n\r\n"
+	info, err := ParseDiscoveryPayload([]byte(notify), 1900, SSDPPort)
+	if err != nil || info == nil || info.Protocol != "SSDP" || info.Query {
+		t.Fatalf("Expected an SSDP announcement, got %+v, %v", info, err)
+	}
+	if info.Server != "Linux UPnP/1.0 Sonos/70.3-35220 (ZPS1)" || info.Model != "Sonos/70.3-35220" {
+		t.Errorf("Expected the Sonos SERVER header and product, got %q %q", info.Server, info.Model)
+	}
+	if info.Location != "http://192.168.1.30:1400/xml/device_description.xml" ||
+		!reflect.DeepEqual(info.Services, []string{"urn:schemas-upnp-org:device:ZonePlayer:1"}) {
+		t.Errorf("Expected the description URL and device type, got %q %v", info.Location, info.Services)
+	}
+
+	byebye := strings.Replace(notify, "ssdp:alive", "ssdp:byebye", 1)
+	info, err = ParseDiscoveryPayload([]byte(byebye), 1900, SSDPPort)
+	if err != nil || info == nil || info.Server != "" || len(info.Services) != 0 {
+		t.Errorf("Expected a departing device to announce nothing, got %+v, %v", info, err)
+	}
+
+	search := "M-SEARCH * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nMAN: \"ssdp:discover\"\r\nMX: 1\r\nST: urn:dial-multiscreen-org:service:dial:1\r\n\r\n"
+	info, err = ParseDiscoveryPayload([]byte(search), 50123, SSDPPort)
+	if err != nil || info == nil || !info.Query || info.Question != "urn:dial-multiscreen-org:service:dial:1" {
+		t.Errorf("Expected a search for DIAL, got %+v, %v", info, err)
+	}
+
+	if info, err := ParseDiscoveryPayload([]byte("GET / HTTP/1.1\r\n\r\n"), 50123, SSDPPort); info != nil || err == nil {
+		t.Errorf("Expected a non-SSDP message to fail, got %+v", info)
+	}
+	if info, err := ParseDiscoveryPayload([]byte(search), 50123, 80); info != nil || err != nil {
+		t.Errorf("Expected nothing on other ports, got %+v, %v", info, err)
+	}
+}
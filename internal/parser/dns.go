@@ -1,8 +1,10 @@
 /**
  * DNS Protocol Parser.
  *
- * Decodes DNS queries and responses, extracting QNAMEs, answers,
- * and related metadata for correlation and analysis.
+ * Decodes DNS queries and responses, extracting every question and
+ * record section, the header flags and EDNS options, and the contents of
+ * modern record types such as HTTPS and SVCB, for correlation and
+ * analysis.
  *
  * Author: KleaSCM
  * Email: KleaSCM@gmail.com
@@ -11,19 +13,48 @@
 package parser
 
 import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
+	"net"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
 )
 
+// Record and query types gopacket does not name.
+const (
+	dnsTypeSVCB  layers.DNSType = 64
+	dnsTypeHTTPS layers.DNSType = 65
+	dnsTypeIXFR  layers.DNSType = 251 // Incremental zone transfer (RFC 1995)
+	dnsTypeAXFR  layers.DNSType = 252 // Full zone transfer (RFC 5936)
+	dnsTypeANY   layers.DNSType = 255
+)
+
+// SVCB and HTTPS service parameter keys (RFC 9460).
+const (
+	svcParamMandatory     = 0
+	svcParamALPN          = 1
+	svcParamNoDefaultALPN = 2
+	svcParamPort          = 3
+	svcParamIPv4Hint      = 4
+	svcParamECH           = 5
+	svcParamIPv6Hint      = 6
+)
+
 // Represents a DNS query.
 type DNSQuery struct {
 	Timestamp     time.Time
 	TransactionID uint16
-	QueryName     string
+	QueryName     string // First question
 	QueryType     string
+	Questions     []DNSQuestion
+	Flags         DNSFlags
+	EDNS          *DNSEDNS // Nil without an OPT record
 	SrcIP         string
 	DstIP         string
 }
@@ -32,20 +63,68 @@ type DNSQuery struct {
 type DNSResponse struct {
 	Timestamp     time.Time
 	TransactionID uint16
-	QueryName     string
+	QueryName     string // First question
+	Questions     []DNSQuestion
 	Answers       []DNSAnswer
+	Authorities   []DNSAnswer
+	Additionals   []DNSAnswer // Without the OPT record, which is in EDNS
 	ResponseCode  string
+	Flags         DNSFlags
+	EDNS          *DNSEDNS // Nil without an OPT record
 	SrcIP         string
 	DstIP         string
 }
 
-// Represents a single DNS answer record.
+// Represents a single DNS question.
+type DNSQuestion struct {
+	Name  string
+	Type  string
+	Class string
+}
+
+// Holds the DNS header flags.
+type DNSFlags struct {
+	Authoritative      bool // AA
+	Truncated          bool // TC
+	RecursionDesired   bool // RD
+	RecursionAvailable bool // RA
+	AuthenticData      bool // AD: the resolver validated the answer with DNSSEC
+	CheckingDisabled   bool // CD
+}
+
+// Holds the EDNS(0) pseudo-record (RFC 6891) and the options it carries.
+type DNSEDNS struct {
+	UDPSize      uint16
+	Version      uint8
+	DNSSECOK     bool     // DO bit
+	ClientSubnet string   // EDNS Client Subnet (RFC 7871), e.g. "192.0.2.0/24"
+	Cookie       string   // Hex client cookie, followed by the server cookie if any (RFC 7873)
+	Padding      int      // Length of the padding option (RFC 7830)
+	Options      []string // Names of all options present, in order
+}
+
+// Represents a single DNS resource record from any section.
 type DNSAnswer struct {
 	Name  string
 	Type  string
 	IP    string
 	TTL   uint32
-	CNAME string
+	CNAME string   // CNAME or PTR target
+	Data  string   // Presentation form of other record types, e.g. "10 mail.example.com" for MX
+	TXT   []string // TXT character strings
+	SVCB  *DNSSVCB // HTTPS and SVCB records
+}
+
+// Holds an HTTPS or SVCB record (RFC 9460).
+type DNSSVCB struct {
+	Priority      uint16 // 0 for an alias to Target
+	Target        string // "." for the owner name itself
+	ALPN          []string
+	NoDefaultALPN bool
+	Port          uint16 // 0 when not given
+	IPv4Hints     []string
+	IPv6Hints     []string
+	ECHConfigList []byte // Encrypted Client Hello configurations
 }
 
 // Extracts DNS information from a packet.
@@ -70,16 +149,25 @@ func ParseDNS(packet gopacket.Packet) (*DNSQuery, *DNSResponse, error) {
 		dstIP = ip.DstIP.String()
 	}
 
-	timestamp := packet.Metadata().Timestamp
+	query, response := ParseDNSLayer(dns, packet.Metadata().Timestamp, srcIP, dstIP)
+	return query, response, nil
+}
+
+// Decodes a DNS message into dns, which may be reused across messages. gopacket
+// indexes past the end of some truncated resource records; that is returned as an
+// error instead of panicking.
+func DecodeDNS(dns *layers.DNS, data []byte) (err error) {
+	defer recoverMalformed("dns message", &err)
+	return dns.DecodeFromBytes(data, gopacket.NilDecodeFeedback)
+}
 
-	// Check if this is a query or response
+// Extracts DNS information from an already decoded DNS layer. Exactly one of
+// the results is non-nil, depending on whether the message is a query.
+func ParseDNSLayer(dns *layers.DNS, timestamp time.Time, srcIP, dstIP string) (*DNSQuery, *DNSResponse) {
 	if !dns.QR {
-		// This is a query
-		return parseDNSQuery(dns, timestamp, srcIP, dstIP), nil, nil
-	} else {
-		// This is a response
-		return nil, parseDNSResponse(dns, timestamp, srcIP, dstIP), nil
+		return parseDNSQuery(dns, timestamp, srcIP, dstIP), nil
 	}
+	return nil, parseDNSResponse(dns, timestamp, srcIP, dstIP)
 }
 
 func parseDNSQuery(dns *layers.DNS, timestamp time.Time, srcIP, dstIP string) *DNSQuery {
@@ -90,11 +178,12 @@ func parseDNSQuery(dns *layers.DNS, timestamp time.Time, srcIP, dstIP string) *D
 		DstIP:         dstIP,
 	}
 
-	// Extract query information
-	if len(dns.Questions) > 0 {
-		q := dns.Questions[0]
-		query.QueryName = string(q.Name)
-		query.QueryType = q.Type.String()
+	query.Questions = dnsQuestions(dns)
+	query.Flags = dnsFlags(dns)
+	query.EDNS, _ = dnsRecords(dns.Additionals)
+	if len(query.Questions) > 0 {
+		query.QueryName = query.Questions[0].Name
+		query.QueryType = query.Questions[0].Type
 	}
 
 	return query
@@ -110,35 +199,327 @@ func parseDNSResponse(dns *layers.DNS, timestamp time.Time, srcIP, dstIP string)
 		DstIP:         dstIP,
 	}
 
-	// Extract query name from questions
-	if len(dns.Questions) > 0 {
-		response.QueryName = string(dns.Questions[0].Name)
+	response.Questions = dnsQuestions(dns)
+	response.Flags = dnsFlags(dns)
+	if len(response.Questions) > 0 {
+		response.QueryName = response.Questions[0].Name
+	}
+
+	// Parse the record sections
+	_, response.Answers = dnsRecords(dns.Answers)
+	_, response.Authorities = dnsRecords(dns.Authorities)
+	response.EDNS, response.Additionals = dnsRecords(dns.Additionals)
+
+	return response
+}
+
+// Returns every question of a message.
+func dnsQuestions(dns *layers.DNS) []DNSQuestion {
+	questions := make([]DNSQuestion, 0, len(dns.Questions))
+	for _, q := range dns.Questions {
+		questions = append(questions, DNSQuestion{Name: string(q.Name), Type: dnsTypeName(q.Type), Class: q.Class.String()})
 	}
+	return questions
+}
 
-	// Parse answer records
-	for _, answer := range dns.Answers {
-		dnsAnswer := DNSAnswer{
-			Name: string(answer.Name),
-			Type: answer.Type.String(),
-			TTL:  answer.TTL,
+// Returns the header flags of a message.
+func dnsFlags(dns *layers.DNS) DNSFlags {
+	return DNSFlags{
+		Authoritative:      dns.AA,
+		Truncated:          dns.TC,
+		RecursionDesired:   dns.RD,
+		RecursionAvailable: dns.RA,
+		AuthenticData:      dns.Z&0x2 != 0, // gopacket keeps AD and CD in the Z bits
+		CheckingDisabled:   dns.Z&0x1 != 0,
+	}
+}
+
+// Converts a record section, taking out the EDNS OPT pseudo-record.
+func dnsRecords(records []layers.DNSResourceRecord) (*DNSEDNS, []DNSAnswer) {
+	var edns *DNSEDNS
+	answers := make([]DNSAnswer, 0, len(records))
+	for i := range records {
+		if records[i].Type == layers.DNSTypeOPT {
+			edns = parseEDNS(&records[i])
+			continue
+		}
+		answers = append(answers, dnsRecord(&records[i]))
+	}
+	return edns, answers
+}
+
+// Converts a resource record, decoding its data by type.
+func dnsRecord(rr *layers.DNSResourceRecord) DNSAnswer {
+	answer := DNSAnswer{
+		Name: string(rr.Name),
+		Type: dnsTypeName(rr.Type),
+		TTL:  rr.TTL,
+	}
+
+	switch rr.Type {
+	case layers.DNSTypeA, layers.DNSTypeAAAA:
+		answer.IP = rr.IP.String()
+	case layers.DNSTypeCNAME:
+		answer.CNAME = string(rr.CNAME)
+	case layers.DNSTypePTR:
+		answer.CNAME = string(rr.PTR)
+	case layers.DNSTypeNS:
+		answer.Data = string(rr.NS)
+	case layers.DNSTypeMX:
+		answer.Data = fmt.Sprintf("%d %s", rr.MX.Preference, rr.MX.Name)
+	case layers.DNSTypeSRV:
+		answer.Data = fmt.Sprintf("%d %d %d %s", rr.SRV.Priority, rr.SRV.Weight, rr.SRV.Port, rr.SRV.Name)
+	case layers.DNSTypeSOA:
+		soa := rr.SOA
+		answer.Data = fmt.Sprintf("%s %s %d %d %d %d %d", soa.MName, soa.RName, soa.Serial, soa.Refresh, soa.Retry, soa.Expire, soa.Minimum)
+	case layers.DNSTypeTXT:
+		quoted := make([]string, len(rr.TXTs))
+		for i, txt := range rr.TXTs {
+			answer.TXT = append(answer.TXT, string(txt))
+			quoted[i] = strconv.Quote(string(txt))
 		}
+		answer.Data = strings.Join(quoted, " ")
+	case dnsTypeSVCB, dnsTypeHTTPS:
+		if svcb, err := parseSVCB(rr.Data); err == nil {
+			answer.SVCB = svcb
+			answer.Data = svcb.String()
+		}
+	}
+	return answer
+}
 
-		// Extract IP address or CNAME based on record type
-		switch answer.Type {
-		case layers.DNSTypeA:
-			dnsAnswer.IP = answer.IP.String()
-		case layers.DNSTypeAAAA:
-			dnsAnswer.IP = answer.IP.String()
-		case layers.DNSTypeCNAME:
-			dnsAnswer.CNAME = string(answer.CNAME)
-		case layers.DNSTypePTR:
-			dnsAnswer.CNAME = string(answer.PTR)
+// Returns the mnemonic of a record type, or "TYPEn" for types without one (RFC 3597).
+func dnsTypeName(t layers.DNSType) string {
+	switch t {
+	case dnsTypeSVCB:
+		return "SVCB"
+	case dnsTypeHTTPS:
+		return "HTTPS"
+	case dnsTypeIXFR:
+		return "IXFR"
+	case dnsTypeAXFR:
+		return "AXFR"
+	case dnsTypeANY:
+		return "ANY"
+	}
+	if name := t.String(); name != "Unknown" {
+		return name
+	}
+	return fmt.Sprintf("TYPE%d", t)
+}
+
+// Decodes the EDNS OPT pseudo-record: the UDP payload size is in its class, and
+// the version and DO bit in its TTL.
+func parseEDNS(rr *layers.DNSResourceRecord) *DNSEDNS {
+	edns := &DNSEDNS{
+		UDPSize:  uint16(rr.Class),
+		Version:  uint8(rr.TTL >> 16),
+		DNSSECOK: rr.TTL&0x8000 != 0,
+	}
+	for _, opt := range rr.OPT {
+		edns.Options = append(edns.Options, ednsOptionName(opt.Code))
+		switch opt.Code {
+		case layers.DNSOptionCodeEDNSClientSubnet:
+			edns.ClientSubnet = ednsClientSubnet(opt.Data)
+		case layers.DNSOptionCodeCookie:
+			edns.Cookie = hex.EncodeToString(opt.Data)
+		case layers.DNSOptionCodePadding:
+			edns.Padding = len(opt.Data)
 		}
+	}
+	return edns
+}
 
-		response.Answers = append(response.Answers, dnsAnswer)
+// Returns the name of an EDNS option.
+func ednsOptionName(code layers.DNSOptionCode) string {
+	switch code {
+	case layers.DNSOptionCodeNSID:
+		return "NSID"
+	case layers.DNSOptionCodeEDNSClientSubnet:
+		return "ECS"
+	case layers.DNSOptionCodeEDNSExpire:
+		return "EXPIRE"
+	case layers.DNSOptionCodeCookie:
+		return "COOKIE"
+	case layers.DNSOptionCodeEDNSKeepAlive:
+		return "KEEPALIVE"
+	case layers.DNSOptionCodePadding:
+		return "PADDING"
+	case 15:
+		return "EDE" // Extended DNS Error (RFC 8914)
 	}
+	return fmt.Sprintf("OPT%d", code)
+}
 
-	return response
+// Decodes an EDNS Client Subnet option: the address family, source and scope
+// prefix lengths, then only as many address bytes as the source prefix needs.
+func ednsClientSubnet(data []byte) string {
+	if len(data) < 4 {
+		return ""
+	}
+	var ip net.IP
+	switch binary.BigEndian.Uint16(data) {
+	case 1:
+		ip = make(net.IP, net.IPv4len)
+	case 2:
+		ip = make(net.IP, net.IPv6len)
+	default:
+		return ""
+	}
+	if len(data)-4 > len(ip) {
+		return ""
+	}
+	copy(ip, data[4:])
+	return fmt.Sprintf("%s/%d", ip, data[2])
+}
+
+// Decodes the data of an HTTPS or SVCB record: the priority, an uncompressed
+// target name, then the service parameters as key, length and value.
+func parseSVCB(data []byte) (*DNSSVCB, error) {
+	if len(data) < 3 {
+		return nil, fmt.Errorf("SVCB record too short")
+	}
+	svcb := &DNSSVCB{Priority: binary.BigEndian.Uint16(data)}
+
+	offset := 2
+	var labels []string
+	for {
+		if offset >= len(data) {
+			return nil, fmt.Errorf("invalid SVCB target name")
+		}
+		length := int(data[offset])
+		offset++
+		if length == 0 {
+			break
+		}
+		if length > 63 || offset+length > len(data) {
+			return nil, fmt.Errorf("invalid SVCB target name")
+		}
+		labels = append(labels, string(data[offset:offset+length]))
+		offset += length
+	}
+	svcb.Target = strings.Join(labels, ".")
+	if svcb.Target == "" {
+		svcb.Target = "."
+	}
+
+	for offset+4 <= len(data) {
+		key := binary.BigEndian.Uint16(data[offset:])
+		length := int(binary.BigEndian.Uint16(data[offset+2:]))
+		offset += 4
+		if offset+length > len(data) {
+			return nil, fmt.Errorf("SVCB parameter %d truncated", key)
+		}
+		value := data[offset : offset+length]
+		offset += length
+
+		switch key {
+		case svcParamALPN:
+			for len(value) > 0 && int(value[0]) < len(value) {
+				svcb.ALPN = append(svcb.ALPN, string(value[1:1+value[0]]))
+				value = value[1+value[0]:]
+			}
+		case svcParamNoDefaultALPN:
+			svcb.NoDefaultALPN = true
+		case svcParamPort:
+			if len(value) == 2 {
+				svcb.Port = binary.BigEndian.Uint16(value)
+			}
+		case svcParamIPv4Hint:
+			for ; len(value) >= net.IPv4len; value = value[net.IPv4len:] {
+				svcb.IPv4Hints = append(svcb.IPv4Hints, net.IP(value[:net.IPv4len]).String())
+			}
+		case svcParamECH:
+			svcb.ECHConfigList = append([]byte(nil), value...)
+		case svcParamIPv6Hint:
+			for ; len(value) >= net.IPv6len; value = value[net.IPv6len:] {
+				svcb.IPv6Hints = append(svcb.IPv6Hints, net.IP(value[:net.IPv6len]).String())
+			}
+		}
+	}
+	return svcb, nil
+}
+
+// Returns the record in presentation form, e.g.
+// "1 . alpn=h3,h2 ipv4hint=104.16.132.229 ech=AEX+DQBB...".
+func (s *DNSSVCB) String() string {
+	parts := []string{strconv.Itoa(int(s.Priority)), s.Target}
+	if len(s.ALPN) > 0 {
+		parts = append(parts, "alpn="+strings.Join(s.ALPN, ","))
+	}
+	if s.NoDefaultALPN {
+		parts = append(parts, "no-default-alpn")
+	}
+	if s.Port != 0 {
+		parts = append(parts, fmt.Sprintf("port=%d", s.Port))
+	}
+	if len(s.IPv4Hints) > 0 {
+		parts = append(parts, "ipv4hint="+strings.Join(s.IPv4Hints, ","))
+	}
+	if len(s.ECHConfigList) > 0 {
+		parts = append(parts, "ech="+base64.StdEncoding.EncodeToString(s.ECHConfigList))
+	}
+	if len(s.IPv6Hints) > 0 {
+		parts = append(parts, "ipv6hint="+strings.Join(s.IPv6Hints, ","))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Returns the set flags as dig prints them, e.g. "rd ra ad".
+func (f DNSFlags) String() string {
+	var flags []string
+	for _, flag := range []struct {
+		set  bool
+		name string
+	}{
+		{f.Authoritative, "aa"},
+		{f.Truncated, "tc"},
+		{f.RecursionDesired, "rd"},
+		{f.RecursionAvailable, "ra"},
+		{f.AuthenticData, "ad"},
+		{f.CheckingDisabled, "cd"},
+	} {
+		if flag.set {
+			flags = append(flags, flag.name)
+		}
+	}
+	return strings.Join(flags, " ")
+}
+
+// Returns a one-line description of the EDNS record, e.g.
+// "EDNS0 udp=1232 do ecs=192.0.2.0/24 padding=468".
+func (e *DNSEDNS) String() string {
+	parts := []string{fmt.Sprintf("EDNS%d", e.Version), fmt.Sprintf("udp=%d", e.UDPSize)}
+	if e.DNSSECOK {
+		parts = append(parts, "do")
+	}
+	if e.ClientSubnet != "" {
+		parts = append(parts, "ecs="+e.ClientSubnet)
+	}
+	if e.Cookie != "" {
+		parts = append(parts, "cookie="+e.Cookie)
+	}
+	if e.Padding > 0 {
+		parts = append(parts, fmt.Sprintf("padding=%d", e.Padding))
+	}
+	for _, option := range e.Options {
+		switch option {
+		case "ECS", "COOKIE", "PADDING":
+		default:
+			parts = append(parts, strings.ToLower(option))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Returns "AXFR" or "IXFR" when the query requests a zone transfer, and "" otherwise.
+func (q *DNSQuery) ZoneTransfer() string {
+	for _, question := range q.Questions {
+		if question.Type == "AXFR" || question.Type == "IXFR" {
+			return question.Type
+		}
+	}
+	return ""
 }
 
 // Returns a human-readable string for a DNS query.
@@ -169,6 +550,9 @@ func (r *DNSResponse) FormatResponse() string {
 	} else if firstAnswer.CNAME != "" {
 		result = fmt.Sprintf("DNS Response: %s → %s (CNAME)",
 			r.QueryName, firstAnswer.CNAME)
+	} else if firstAnswer.Data != "" {
+		result = fmt.Sprintf("DNS Response: %s → %s (%s)",
+			r.QueryName, firstAnswer.Data, firstAnswer.Type)
 	} else {
 		result = fmt.Sprintf("DNS Response: %s (%s)",
 			r.QueryName, firstAnswer.Type)
@@ -186,11 +570,34 @@ func (r *DNSResponse) FormatResponse() string {
 // Returns detailed information about the DNS response.
 func (r *DNSResponse) FormatVerbose() string {
 	output := fmt.Sprintf("DNS Response [ID: %d]\n", r.TransactionID)
-	output += fmt.Sprintf("  Query: %s\n", r.QueryName)
+	for _, q := range r.Questions {
+		output += fmt.Sprintf("  Query: %s (%s)\n", q.Name, q.Type)
+	}
 	output += fmt.Sprintf("  Response Code: %s\n", r.ResponseCode)
+	if flags := r.Flags.String(); flags != "" {
+		output += fmt.Sprintf("  Flags: %s\n", flags)
+	}
+	if r.EDNS != nil {
+		output += fmt.Sprintf("  %s\n", r.EDNS)
+	}
 	output += fmt.Sprintf("  Answers: %d\n", len(r.Answers))
+	output += formatRecords(r.Answers)
+	if len(r.Authorities) > 0 {
+		output += fmt.Sprintf("  Authority: %d\n", len(r.Authorities))
+		output += formatRecords(r.Authorities)
+	}
+	if len(r.Additionals) > 0 {
+		output += fmt.Sprintf("  Additional: %d\n", len(r.Additionals))
+		output += formatRecords(r.Additionals)
+	}
+
+	return output
+}
 
-	for i, answer := range r.Answers {
+// Returns one entry per record, with its address, target or data beneath.
+func formatRecords(records []DNSAnswer) string {
+	var output string
+	for i, answer := range records {
 		output += fmt.Sprintf("  [%d] %s (%s, TTL: %ds)\n",
 			i+1, answer.Name, answer.Type, answer.TTL)
 		if answer.IP != "" {
@@ -199,8 +606,10 @@ func (r *DNSResponse) FormatVerbose() string {
 		if answer.CNAME != "" {
 			output += fmt.Sprintf("      CNAME: %s\n", answer.CNAME)
 		}
+		if answer.Data != "" {
+			output += fmt.Sprintf("      Data: %s\n", answer.Data)
+		}
 	}
-
 	return output
 }
 
@@ -0,0 +1,244 @@
+/**
+ * DNS Parser Tests.
+ *
+ * Validates dissection of every question and record section, header
+ * flags, EDNS options and the MX, TXT, SRV, NS, SOA and HTTPS record
+ * types.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package parser
+
+import (
+	"encoding/binary"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Decodes a serialized DNS message through ParseDNSLayer.
+func decodeDNSForTest(t *testing.T, data []byte) (*DNSQuery, *DNSResponse) {
+	t.Helper()
+	var dns layers.DNS
+	if err := dns.DecodeFromBytes(data, gopacket.NilDecodeFeedback); err != nil {
+		t.Fatalf("Failed to decode DNS message: %v", err)
+	}
+	return ParseDNSLayer(&dns, time.Time{}, "192.168.1.100", "192.168.1.1")
+}
+
+// Appends a resource record gopacket cannot serialize to a message with no
+// authority or additional records, counting it as an answer.
+func appendRawAnswer(msg []byte, name string, rrType layers.DNSType, ttl uint32, rdata []byte) []byte {
+	msg = append(msg, encodeDNSName(name)...)
+	msg = binary.BigEndian.AppendUint16(msg, uint16(rrType))
+	msg = binary.BigEndian.AppendUint16(msg, uint16(layers.DNSClassIN))
+	msg = binary.BigEndian.AppendUint32(msg, ttl)
+	msg = binary.BigEndian.AppendUint16(msg, uint16(len(rdata)))
+	msg = append(msg, rdata...)
+	binary.BigEndian.PutUint16(msg[6:], binary.BigEndian.Uint16(msg[6:])+1)
+	return msg
+}
+
+// Encodes a name as uncompressed labels.
+func encodeDNSName(name string) []byte {
+	var encoded []byte
+	for _, label := range strings.Split(name, ".") {
+		if label != "" {
+			encoded = append(encoded, byte(len(label)))
+			encoded = append(encoded, label...)
+		}
+	}
+	return append(encoded, 0)
+}
+
+// Verifies that a query yields every question, its flags and its EDNS options.
+func TestParseDNSLayer_Query(t *testing.T) {
+	msg := buildDNS(t, &layers.DNS{
+		ID: 0x1f2e, RD: true, Z: 0x2, // AD requested
+		Questions: []layers.DNSQuestion{
+			{Name: []byte("example.com"), Type: layers.DNSTypeA, Class: layers.DNSClassIN},
+			{Name: []byte("example.com"), Type: dnsTypeHTTPS, Class: layers.DNSClassIN},
+		},
+		Additionals: []layers.DNSResourceRecord{{
+			Type: layers.DNSTypeOPT, Class: 1232, TTL: 0x8000, // DO
+			OPT: []layers.DNSOPT{
+				{Code: layers.DNSOptionCodeEDNSClientSubnet, Data: []byte{0, 1, 24, 0, 192, 0, 2}},
+				{Code: layers.DNSOptionCodeCookie, Data: []byte{1, 2, 3, 4, 5, 6, 7, 8}},
+				{Code: layers.DNSOptionCodePadding, Data: make([]byte, 400)},
+			},
+		}},
+	})
+	query, response := decodeDNSForTest(t, msg)
+	if query == nil || response != nil {
+		t.Fatalf("Expected a query, got %+v %+v", query, response)
+	}
+	want := []DNSQuestion{{"example.com", "A", "IN"}, {"example.com", "HTTPS", "IN"}}
+	if !reflect.DeepEqual(query.Questions, want) || query.QueryName != "example.com" || query.QueryType != "A" {
+		t.Errorf("Expected both questions, got %+v", query.Questions)
+	}
+	if flags := query.Flags.String(); flags != "rd ad" {
+		t.Errorf("Expected flags rd ad, got %q", flags)
+	}
+	edns := query.EDNS
+	if edns == nil || edns.UDPSize != 1232 || !edns.DNSSECOK || edns.ClientSubnet != "192.0.2.0/24" || edns.Cookie != "0102030405060708" || edns.Padding != 400 {
+		t.Fatalf("Expected EDNS with subnet, cookie and padding, got %+v", edns)
+	}
+	if s := edns.String(); s != "EDNS0 udp=1232 do ecs=192.0.2.0/24 cookie=0102030405060708 padding=400" {
+		t.Errorf("Unexpected EDNS summary %q", s)
+	}
+	if kind := query.ZoneTransfer(); kind != "" {
+		t.Errorf("Expected no zone transfer, got %q", kind)
+	}
+
+	t.Run("zone transfer", func(t *testing.T) {
+		for _, tt := range []struct {
+			qtype layers.DNSType
+			want  string
+		}{{dnsTypeAXFR, "AXFR"}, {dnsTypeIXFR, "IXFR"}, {dnsTypeANY, ""}} {
+			query, _ := decodeDNSForTest(t, buildDNS(t, &layers.DNS{
+				Questions: []layers.DNSQuestion{{Name: []byte("corp.example"), Type: tt.qtype, Class: layers.DNSClassIN}},
+			}))
+			if kind := query.ZoneTransfer(); kind != tt.want {
+				t.Errorf("Expected %q for %s, got %q", tt.want, query.QueryType, kind)
+			}
+		}
+	})
+}
+
+// Verifies that a response yields its flags and every answer, authority and
+// additional record, decoded by type.
+func TestParseDNSLayer_Response(t *testing.T) {
+	in := layers.DNSClassIN
+	msg := buildDNS(t, &layers.DNS{
+		ID: 0x1f2e, QR: true, AA: true, RD: true, RA: true,
+		Questions: []layers.DNSQuestion{{Name: []byte("example.com"), Type: layers.DNSTypeMX, Class: in}},
+		Answers: []layers.DNSResourceRecord{
+			{Name: []byte("example.com"), Type: layers.DNSTypeMX, Class: in, TTL: 300, MX: layers.DNSMX{Preference: 10, Name: []byte("mail.example.com")}},
+			{Name: []byte("example.com"), Type: layers.DNSTypeTXT, Class: in, TTL: 300, TXTs: [][]byte{[]byte("v=spf1 -all"), []byte("x")}},
+			{Name: []byte("_sip._tcp.example.com"), Type: layers.DNSTypeSRV, Class: in, TTL: 300, SRV: layers.DNSSRV{Priority: 10, Weight: 60, Port: 5060, Name: []byte("sip.example.com")}},
+		},
+		Authorities: []layers.DNSResourceRecord{
+			{Name: []byte("example.com"), Type: layers.DNSTypeNS, Class: in, TTL: 86400, NS: []byte("ns1.example.com")},
+			{Name: []byte("example.com"), Type: layers.DNSTypeSOA, Class: in, TTL: 300, SOA: layers.DNSSOA{
+				MName: []byte("ns1.example.com"), RName: []byte("hostmaster.example.com"),
+				Serial: 2021031401, Refresh: 7200, Retry: 3600, Expire: 1209600, Minimum: 300}},
+		},
+		Additionals: []layers.DNSResourceRecord{
+			{Name: []byte("mail.example.com"), Type: layers.DNSTypeA, Class: in, TTL: 300, IP: net.IP{192, 0, 2, 25}},
+			{Type: layers.DNSTypeOPT, Class: 1232},
+		},
+	})
+	_, response := decodeDNSForTest(t, msg)
+	if response == nil {
+		t.Fatal("Expected a response")
+	}
+	if flags := response.Flags.String(); flags != "aa rd ra" {
+		t.Errorf("Expected flags aa rd ra, got %q", flags)
+	}
+
+	var data []string
+	for _, answer := range response.Answers {
+		data = append(data, answer.Data)
+	}
+	want := []string{"10 mail.example.com", `"v=spf1 -all" "x"`, "10 60 5060 sip.example.com"}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("Expected answers %q, got %q", want, data)
+	}
+	if txt := response.Answers[1].TXT; !reflect.DeepEqual(txt, []string{"v=spf1 -all", "x"}) {
+		t.Errorf("Expected the TXT strings, got %q", txt)
+	}
+
+	if len(response.Authorities) != 2 || response.Authorities[0].Data != "ns1.example.com" ||
+		response.Authorities[1].Data != "ns1.example.com hostmaster.example.com 2021031401 7200 3600 1209600 300" {
+		t.Errorf("Expected the NS and SOA authority records, got %+v", response.Authorities)
+	}
+	if len(response.Additionals) != 1 || response.Additionals[0].IP != "192.0.2.25" {
+		t.Errorf("Expected the mail server's address without the OPT record, got %+v", response.Additionals)
+	}
+	if response.EDNS == nil || response.EDNS.UDPSize != 1232 || response.EDNS.DNSSECOK {
+		t.Errorf("Expected EDNS with a 1232 byte payload, got %+v", response.EDNS)
+	}
+	if summary := response.FormatResponse(); summary != "DNS Response: example.com → 10 mail.example.com (MX) +2 more [ID: 7982]" {
+		t.Errorf("Unexpected summary %q", summary)
+	}
+}
+
+// Verifies that HTTPS records yield their ALPN, port, address hints and ECH
+// configuration, and that aliases keep only their target.
+func TestParseDNSLayer_HTTPS(t *testing.T) {
+	ech := []byte{0x00, 0x45, 0xfe, 0x0d, 0x00, 0x41}
+	rdata := []byte{0, 1, 0} // Priority 1, target "."
+	rdata = append(rdata, 0, svcParamALPN, 0, 6, 2, 'h', '3', 2, 'h', '2')
+	rdata = append(rdata, 0, svcParamPort, 0, 2, 0x01, 0xbb)
+	rdata = append(rdata, 0, svcParamIPv4Hint, 0, 8, 104, 16, 132, 229, 104, 16, 133, 229)
+	rdata = append(rdata, 0, svcParamECH, 0, byte(len(ech)))
+	rdata = append(rdata, ech...)
+	rdata = append(rdata, 0, svcParamIPv6Hint, 0, 16)
+	rdata = append(rdata, net.ParseIP("2606:4700::6810:84e5")...)
+	alias := append([]byte{0, 0}, encodeDNSName("cdn.example.net")...)
+
+	msg := buildDNS(t, &layers.DNS{
+		QR: true, RD: true, RA: true,
+		Questions: []layers.DNSQuestion{{Name: []byte("example.com"), Type: dnsTypeHTTPS, Class: layers.DNSClassIN}},
+	})
+	msg = appendRawAnswer(msg, "example.com", dnsTypeHTTPS, 300, rdata)
+	msg = appendRawAnswer(msg, "www.example.com", dnsTypeSVCB, 300, alias)
+
+	_, response := decodeDNSForTest(t, msg)
+	if response == nil || len(response.Answers) != 2 {
+		t.Fatalf("Expected two answers, got %+v", response)
+	}
+	https := response.Answers[0]
+	if https.Type != "HTTPS" || https.SVCB == nil {
+		t.Fatalf("Expected a decoded HTTPS record, got %+v", https)
+	}
+	want := &DNSSVCB{
+		Priority: 1, Target: ".", ALPN: []string{"h3", "h2"}, Port: 443,
+		IPv4Hints: []string{"104.16.132.229", "104.16.133.229"}, IPv6Hints: []string{"2606:4700::6810:84e5"},
+		ECHConfigList: ech,
+	}
+	if !reflect.DeepEqual(https.SVCB, want) {
+		t.Errorf("Expected %+v, got %+v", want, https.SVCB)
+	}
+	if https.Data != "1 . alpn=h3,h2 port=443 ipv4hint=104.16.132.229,104.16.133.229 ech=AEX+DQBB ipv6hint=2606:4700::6810:84e5" {
+		t.Errorf("Unexpected presentation %q", https.Data)
+	}
+
+	if svcb := response.Answers[1]; svcb.Type != "SVCB" || svcb.Data != "0 cdn.example.net" {
+		t.Errorf("Expected an alias to cdn.example.net, got %+v", svcb)
+	}
+
+	t.Run("truncated", func(t *testing.T) {
+		if _, err := parseSVCB(rdata[:12]); err == nil {
+			t.Error("Expected a truncated parameter to fail")
+		}
+		if _, err := parseSVCB([]byte{0, 1, 5, 'a'}); err == nil {
+			t.Error("Expected a truncated target name to fail")
+		}
+	})
+}
+
+// Verifies that messages gopacket panics on decode to an error, and that the layer
+// can be reused for a well-formed message afterwards.
+func TestDecodeDNS(t *testing.T) {
+	// One answer whose fixed fields stop after two bytes
+	truncated := []byte{0, 1, 0x81, 0x80, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 1}
+
+	var dns layers.DNS
+	if err := DecodeDNS(&dns, truncated); err == nil {
+		t.Error("Expected a truncated record to fail")
+	}
+
+	msg := []byte{0, 2, 0x81, 0x80, 0, 0, 0, 0, 0, 0, 0, 0}
+	msg = appendRawAnswer(msg, "example.com", layers.DNSTypeA, 300, []byte{93, 184, 216, 34})
+	if err := DecodeDNS(&dns, msg); err != nil || len(dns.Answers) != 1 || dns.ID != 2 {
+		t.Errorf("Expected the next message to decode, got %v", err)
+	}
+}
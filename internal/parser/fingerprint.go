@@ -2,7 +2,10 @@
  * OS Fingerprinting Parser.
  *
  * Utilizes TCP/IP stack signatures (TTL, Window Size, Options) to passively
- * fingerprint the operating system of remote hosts.
+ * fingerprint the operating system of remote hosts. SYN and SYN+ACK
+ * packets are described in the terms of p0f v3 signatures: initial TTL,
+ * IP options, MSS, window size and scale, TCP option layout, and the
+ * quirks of the IP and TCP headers. Other packets fall back to the TTL.
  *
  * Author: KleaSCM
  * Email: KleaSCM@gmail.com
@@ -11,8 +14,36 @@
 package parser
 
 import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
+	"github.com/kleaSCM/netscope/internal/models"
+)
+
+// TCP option kinds that p0f names.
+const (
+	tcpOptionEOL       = 0
+	tcpOptionNOP       = 1
+	tcpOptionMSS       = 2
+	tcpOptionWS        = 3
+	tcpOptionSACKOK    = 4
+	tcpOptionSACK      = 5
+	tcpOptionTimestamp = 8
+)
+
+// TCP header flags.
+const (
+	tcpFlagFIN = 0x01
+	tcpFlagSYN = 0x02
+	tcpFlagRST = 0x04
+	tcpFlagPSH = 0x08
+	tcpFlagACK = 0x10
+	tcpFlagURG = 0x20
+	tcpFlagECE = 0x40
+	tcpFlagCWR = 0x80
 )
 
 // GuessOS attempts to fingerprint the OS based on packet characteristics (TTL).
@@ -31,6 +62,12 @@ func GuessOS(packet gopacket.Packet) string {
 		return ""
 	}
 
+	return GuessOSFromTTL(ttl)
+}
+
+// Maps an observed IP TTL (or IPv6 hop limit) to the operating system family
+// whose initial TTL it most likely decremented from.
+func GuessOSFromTTL(ttl uint8) string {
 	// Simple Heuristics based on Initial TTL (which decrements)
 	// We check ranges because hops decrease the value
 	// Windows: Starts at 128
@@ -50,3 +87,214 @@ func GuessOS(packet gopacket.Packet) string {
 		return "Unknown"
 	}
 }
+
+// Returns the initial TTL an observed TTL most likely decremented from: the
+// next of the values operating systems start at.
+func InitialTTL(ttl uint8) uint8 {
+	switch {
+	case ttl <= 32:
+		return 32
+	case ttl <= 64:
+		return 64
+	case ttl <= 128:
+		return 128
+	default:
+		return 255
+	}
+}
+
+// Describes a SYN or SYN+ACK from its IP header (options included) and TCP header
+// (options included). Returns nil for other segments and for truncated headers.
+func ParseTCPSignature(ipHeader, tcpHeader []byte, payloadLen int) *models.TCPSignature {
+	defer recoverMalformed("tcp signature", nil)
+	if len(tcpHeader) < 20 || len(ipHeader) < 20 {
+		return nil
+	}
+	flags := tcpHeader[13]
+	if flags&tcpFlagSYN == 0 || flags&(tcpFlagFIN|tcpFlagRST) != 0 {
+		return nil
+	}
+
+	sig := &models.TCPSignature{
+		Response: flags&tcpFlagACK != 0,
+		Window:   int(binary.BigEndian.Uint16(tcpHeader[14:])),
+		MSS:      -1,
+		Payload:  payloadLen > 0,
+	}
+	var quirks []string
+
+	switch ipHeader[0] >> 4 {
+	case 4:
+		sig.Version = 4
+		sig.TTL = ipHeader[8]
+		sig.IPOptionLen = int(ipHeader[0]&0x0f)*4 - 20
+		id := binary.BigEndian.Uint16(ipHeader[4:])
+		df := ipHeader[6]&0x40 != 0
+		if df {
+			quirks = append(quirks, "df")
+		}
+		if df && id != 0 {
+			quirks = append(quirks, "id+")
+		}
+		if !df && id == 0 {
+			quirks = append(quirks, "id-")
+		}
+		if ipHeader[1]&0x03 != 0 || flags&(tcpFlagECE|tcpFlagCWR) != 0 || tcpHeader[12]&0x01 != 0 {
+			quirks = append(quirks, "ecn")
+		}
+		if ipHeader[6]&0x80 != 0 {
+			quirks = append(quirks, "0+") // Reserved "must be zero" flag
+		}
+	case 6:
+		if len(ipHeader) < 40 {
+			return nil
+		}
+		sig.Version = 6
+		sig.TTL = ipHeader[7]
+		trafficClass := ipHeader[0]<<4 | ipHeader[1]>>4
+		if trafficClass&0x03 != 0 || flags&(tcpFlagECE|tcpFlagCWR) != 0 || tcpHeader[12]&0x01 != 0 {
+			quirks = append(quirks, "ecn")
+		}
+		if binary.BigEndian.Uint32(ipHeader)&0xfffff != 0 {
+			quirks = append(quirks, "flow")
+		}
+	default:
+		return nil
+	}
+
+	seq := binary.BigEndian.Uint32(tcpHeader[4:])
+	ack := binary.BigEndian.Uint32(tcpHeader[8:])
+	urgent := binary.BigEndian.Uint16(tcpHeader[18:])
+	if seq == 0 {
+		quirks = append(quirks, "seq-")
+	}
+	if flags&tcpFlagACK == 0 && ack != 0 {
+		quirks = append(quirks, "ack+")
+	}
+	if flags&tcpFlagACK != 0 && ack == 0 {
+		quirks = append(quirks, "ack-")
+	}
+	if flags&tcpFlagURG == 0 && urgent != 0 {
+		quirks = append(quirks, "uptr+")
+	}
+	if flags&tcpFlagURG != 0 {
+		quirks = append(quirks, "urgf+")
+	}
+	if flags&tcpFlagPSH != 0 {
+		quirks = append(quirks, "pushf+")
+	}
+
+	dataOffset := int(tcpHeader[12]>>4) * 4
+	if dataOffset < 20 || dataOffset > len(tcpHeader) {
+		return nil
+	}
+	layout, optionQuirks := tcpOptionLayout(sig, tcpHeader[20:dataOffset])
+	sig.Options = strings.Join(layout, ",")
+	sig.Quirks = strings.Join(append(quirks, optionQuirks...), ",")
+	return sig
+}
+
+// Walks the TCP options, filling in the MSS and window scale. Returns the option
+// layout and the option quirks, in p0f order.
+func tcpOptionLayout(sig *models.TCPSignature, options []byte) ([]string, []string) {
+	var layout []string
+	var ts1Zero, ts2Set, trailing, excessiveScale, bad bool
+
+	for i := 0; i < len(options); {
+		kind := options[i]
+		switch kind {
+		case tcpOptionEOL:
+			// Whatever follows an explicit end of options is padding, and should be zero
+			padding := options[i+1:]
+			layout = append(layout, fmt.Sprintf("eol+%d", len(padding)))
+			for _, b := range padding {
+				trailing = trailing || b != 0
+			}
+			i = len(options)
+			continue
+		case tcpOptionNOP:
+			layout = append(layout, "nop")
+			i++
+			continue
+		}
+
+		if i+1 >= len(options) || options[i+1] < 2 || i+int(options[i+1]) > len(options) {
+			bad = true
+			break
+		}
+		length := int(options[i+1])
+		value := options[i+2 : i+length]
+		switch kind {
+		case tcpOptionMSS:
+			layout = append(layout, "mss")
+			if length != 4 {
+				bad = true
+			} else {
+				sig.MSS = int(binary.BigEndian.Uint16(value))
+			}
+		case tcpOptionWS:
+			layout = append(layout, "ws")
+			if length != 3 {
+				bad = true
+			} else {
+				sig.WindowScale = int(value[0])
+				excessiveScale = value[0] > 14
+			}
+		case tcpOptionSACKOK:
+			layout = append(layout, "sok")
+			bad = bad || length != 2
+		case tcpOptionSACK:
+			layout = append(layout, "sack")
+		case tcpOptionTimestamp:
+			layout = append(layout, "ts")
+			if length != 10 {
+				bad = true
+			} else {
+				ts1Zero = binary.BigEndian.Uint32(value) == 0
+				// A SYN has not seen the peer's timestamp to echo it
+				ts2Set = !sig.Response && binary.BigEndian.Uint32(value[4:]) != 0
+			}
+		default:
+			layout = append(layout, fmt.Sprintf("?%d", kind))
+		}
+		i += length
+	}
+
+	var quirks []string
+	for _, quirk := range []struct {
+		set  bool
+		name string
+	}{
+		{ts1Zero, "ts1-"},
+		{ts2Set, "ts2+"},
+		{trailing, "opt+"},
+		{excessiveScale, "exws"},
+		{bad, "bad"},
+	} {
+		if quirk.set {
+			quirks = append(quirks, quirk.name)
+		}
+	}
+	return layout, quirks
+}
+
+// Returns a signature as p0f prints what it observed, e.g.
+// "4:61+3:0:1460:mss*44,7:mss,sok,ts,nop,ws:df,id+:0". The TTL is shown as the
+// observed value plus the hops to the likely initial TTL, and the window as a
+// multiple of the MSS where it is one.
+func FormatTCPSignature(sig *models.TCPSignature) string {
+	mss := "*"
+	if sig.MSS >= 0 {
+		mss = fmt.Sprint(sig.MSS)
+	}
+	window := fmt.Sprint(sig.Window)
+	if sig.MSS > 0 && sig.Window > 0 && sig.Window%sig.MSS == 0 {
+		window = fmt.Sprintf("mss*%d", sig.Window/sig.MSS)
+	}
+	payload := "0"
+	if sig.Payload {
+		payload = "+"
+	}
+	return fmt.Sprintf("%d:%d+%d:%d:%s:%s,%d:%s:%s:%s", sig.Version, sig.TTL, InitialTTL(sig.TTL)-sig.TTL,
+		sig.IPOptionLen, mss, window, sig.WindowScale, sig.Options, sig.Quirks, payload)
+}
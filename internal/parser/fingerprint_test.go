@@ -0,0 +1,160 @@
+/**
+ * OS Fingerprinting Parser Tests.
+ *
+ * Validates extraction of p0f-style TCP/IP stack signatures from the
+ * SYN and SYN+ACK packets of common operating systems.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package parser
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/kleaSCM/netscope/internal/models"
+)
+
+// Serializes a TCP segment over IPv4 or IPv6 and returns its IP and TCP headers.
+func buildTCPHeaders(tb testing.TB, ip gopacket.SerializableLayer, tcp *layers.TCP) (ipHeader, tcpHeader []byte) {
+	tb.Helper()
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, ip, tcp); err != nil {
+		tb.Fatal(err)
+	}
+
+	first := layers.LayerTypeIPv4
+	if _, ok := ip.(*layers.IPv6); ok {
+		first = layers.LayerTypeIPv6
+	}
+	packet := gopacket.NewPacket(buf.Bytes(), first, gopacket.Default)
+	decoded, ok := packet.Layer(layers.LayerTypeTCP).(*layers.TCP)
+	if !ok {
+		tb.Fatalf("Failed to decode the segment: %v", packet.ErrorLayer())
+	}
+	return packet.NetworkLayer().LayerContents(), decoded.Contents
+}
+
+// TCP options as gopacket serializes them.
+func tcpOption(kind layers.TCPOptionKind, data ...byte) layers.TCPOption {
+	return layers.TCPOption{OptionType: kind, OptionData: data}
+}
+
+// Verifies that SYN and SYN+ACK packets yield their TTL, MSS, window, scale,
+// option layout and quirks, and that other segments yield nothing.
+func TestParseTCPSignature(t *testing.T) {
+	ipv4 := func(ttl uint8, df bool, id uint16) *layers.IPv4 {
+		ip := &layers.IPv4{Version: 4, TTL: ttl, Id: id, Protocol: layers.IPProtocolTCP,
+			SrcIP: net.IP{192, 168, 1, 60}, DstIP: net.IP{203, 0, 113, 7}}
+		if df {
+			ip.Flags = layers.IPv4DontFragment
+		}
+		return ip
+	}
+	nop := tcpOption(layers.TCPOptionKindNop)
+	mss := tcpOption(layers.TCPOptionKindMSS, 0x05, 0xb4) // 1460
+	sok := tcpOption(layers.TCPOptionKindSACKPermitted)
+	ts := tcpOption(layers.TCPOptionKindTimestamps, 0, 0x12, 0xd6, 0x87, 0, 0, 0, 0)
+
+	tests := []struct {
+		name string
+		ip   gopacket.SerializableLayer
+		tcp  *layers.TCP
+		want *models.TCPSignature
+		sig  string
+	}{
+		{
+			name: "linux syn",
+			ip:   ipv4(61, true, 0x3c1a),
+			tcp: &layers.TCP{SYN: true, Seq: 0x9e5f3a01, Window: 64240,
+				Options: []layers.TCPOption{mss, sok, ts, nop, tcpOption(layers.TCPOptionKindWindowScale, 7)}},
+			want: &models.TCPSignature{Version: 4, TTL: 61, MSS: 1460, Window: 64240, WindowScale: 7,
+				Options: "mss,sok,ts,nop,ws", Quirks: "df,id+"},
+			sig: "4:61+3:0:1460:mss*44,7:mss,sok,ts,nop,ws:df,id+:0",
+		},
+		{
+			name: "windows syn",
+			ip:   ipv4(128, true, 0x7a21),
+			tcp: &layers.TCP{SYN: true, Seq: 0x11, Window: 64240,
+				Options: []layers.TCPOption{mss, nop, tcpOption(layers.TCPOptionKindWindowScale, 8), nop, nop, sok}},
+			want: &models.TCPSignature{Version: 4, TTL: 128, MSS: 1460, Window: 64240, WindowScale: 8,
+				Options: "mss,nop,ws,nop,nop,sok", Quirks: "df,id+"},
+			sig: "4:128+0:0:1460:mss*44,8:mss,nop,ws,nop,nop,sok:df,id+:0",
+		},
+		{
+			name: "mac syn with end of options",
+			ip:   ipv4(64, true, 0),
+			tcp: &layers.TCP{SYN: true, Seq: 0x11, Window: 65535,
+				Options: []layers.TCPOption{mss, nop, tcpOption(layers.TCPOptionKindWindowScale, 6), nop, nop, ts, sok,
+					tcpOption(layers.TCPOptionKindEndList)}},
+			want: &models.TCPSignature{Version: 4, TTL: 64, MSS: 1460, Window: 65535, WindowScale: 6,
+				Options: "mss,nop,ws,nop,nop,ts,sok,eol+1", Quirks: "df"},
+			sig: "4:64+0:0:1460:65535,6:mss,nop,ws,nop,nop,ts,sok,eol+1:df:0",
+		},
+		{
+			name: "linux syn+ack",
+			ip:   ipv4(64, true, 0),
+			tcp: &layers.TCP{SYN: true, ACK: true, Seq: 0x22, Ack: 0x9e5f3a02, Window: 65160,
+				Options: []layers.TCPOption{mss, sok, ts, nop, tcpOption(layers.TCPOptionKindWindowScale, 7)}},
+			want: &models.TCPSignature{Version: 4, Response: true, TTL: 64, MSS: 1460, Window: 65160, WindowScale: 7,
+				Options: "mss,sok,ts,nop,ws", Quirks: "df"},
+			sig: "4:64+0:0:1460:65160,7:mss,sok,ts,nop,ws:df:0",
+		},
+		{
+			name: "ipv6 syn with ecn and a flow label",
+			ip: &layers.IPv6{Version: 6, HopLimit: 57, FlowLabel: 0x8e2b1, NextHeader: layers.IPProtocolTCP,
+				SrcIP: net.ParseIP("fd00::60"), DstIP: net.ParseIP("2001:db8::7")},
+			tcp: &layers.TCP{SYN: true, ECE: true, CWR: true, Seq: 0x11, Window: 64800,
+				Options: []layers.TCPOption{tcpOption(layers.TCPOptionKindMSS, 0x05, 0xa0), sok, ts, nop, tcpOption(layers.TCPOptionKindWindowScale, 7)}},
+			want: &models.TCPSignature{Version: 6, TTL: 57, MSS: 1440, Window: 64800, WindowScale: 7,
+				Options: "mss,sok,ts,nop,ws", Quirks: "ecn,flow"},
+			sig: "6:57+7:0:1440:mss*45,7:mss,sok,ts,nop,ws:ecn,flow:0",
+		},
+		{
+			name: "scanner syn",
+			ip:   ipv4(44, false, 0x51e3),
+			tcp:  &layers.TCP{SYN: true, Seq: 0, Ack: 0x5a5a, Window: 1024, Options: []layers.TCPOption{mss}},
+			want: &models.TCPSignature{Version: 4, TTL: 44, MSS: 1460, Window: 1024,
+				Options: "mss", Quirks: "seq-,ack+"},
+			sig: "4:44+20:0:1460:1024,0:mss:seq-,ack+:0",
+		},
+		{
+			name: "ack",
+			ip:   ipv4(64, true, 1),
+			tcp:  &layers.TCP{ACK: true, Seq: 0x11, Ack: 0x22, Window: 502},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ipHeader, tcpHeader := buildTCPHeaders(t, tt.ip, tt.tcp)
+			got := ParseTCPSignature(ipHeader, tcpHeader, 0)
+			if tt.want == nil {
+				if got != nil {
+					t.Errorf("Expected no signature, got %+v", got)
+				}
+				return
+			}
+			if got == nil || *got != *tt.want {
+				t.Fatalf("Expected %+v, got %+v", tt.want, got)
+			}
+			if sig := FormatTCPSignature(got); sig != tt.sig {
+				t.Errorf("Expected %s, got %s", tt.sig, sig)
+			}
+		})
+	}
+
+	t.Run("malformed options", func(t *testing.T) {
+		ipHeader, tcpHeader := buildTCPHeaders(t, ipv4(64, true, 1), &layers.TCP{SYN: true, Seq: 0x11, Window: 64240,
+			Options: []layers.TCPOption{mss, sok, ts, nop, tcpOption(layers.TCPOptionKindWindowScale, 7)}})
+		tcpHeader[38] = 4 // Window scale runs past the header
+		got := ParseTCPSignature(ipHeader, tcpHeader, 10)
+		if got == nil || got.Options != "mss,sok,ts,nop" || got.Quirks != "df,id+,bad" || !got.Payload {
+			t.Errorf("Expected the options up to the bad one, got %+v", got)
+		}
+	})
+}
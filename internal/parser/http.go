@@ -9,3 +9,171 @@
  */
 
 package parser
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Request methods recognised at the start of a payload. Matching the method
+// first keeps arbitrary TCP payloads from being mistaken for HTTP.
+var httpMethods = []string{"GET", "POST", "HEAD", "PUT", "DELETE", "OPTIONS", "PATCH", "CONNECT", "TRACE"}
+
+// Holds extracted HTTP/1.x header information.
+type HTTPInfo struct {
+	IsRequest   bool
+	Version     string // "HTTP/1.0" or "HTTP/1.1"
+	Method      string // Requests only
+	URI         string // Requests only
+	Host        string // Requests only
+	UserAgent   string // Requests only
+	Referer     string // Requests only
+	StatusCode  int    // Responses only
+	Server      string // Responses only
+	ContentType string
+	JA4H        string // Requests only
+
+	// Body framing, so a stream parser can skip to the next message
+	ContentLength int64 // -1 when the header is absent
+	Chunked       bool  // Transfer-Encoding: chunked
+}
+
+// Extracts HTTP information from a packet.
+func ParseHTTP(packet gopacket.Packet) (*HTTPInfo, error) {
+	tcpLayer := packet.Layer(layers.LayerTypeTCP)
+	if tcpLayer == nil {
+		return nil, nil // Not TCP
+	}
+
+	tcp, _ := tcpLayer.(*layers.TCP)
+	return ParseHTTPPayload(tcp.Payload)
+}
+
+// Extracts HTTP information from a TCP payload that has already been decoded. Only
+// the start of a message is recognised; headers cut off by the end of the segment
+// are parsed as far as they go.
+func ParseHTTPPayload(payload []byte) (_ *HTTPInfo, err error) {
+	defer recoverMalformed("http message", &err)
+	lineEnd := bytes.IndexByte(payload, '\n')
+	if lineEnd < 0 {
+		return nil, nil // No complete start line
+	}
+	startLine := strings.TrimRight(string(payload[:lineEnd]), "\r")
+
+	info, err := parseStartLine(startLine)
+	if info == nil || err != nil {
+		return nil, err
+	}
+
+	var headers []httpHeader
+	for _, line := range strings.Split(string(payload[lineEnd+1:]), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			break // End of headers
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		headers = append(headers, httpHeader{name: strings.TrimSpace(name), value: value})
+
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "host":
+			info.Host = value
+		case "user-agent":
+			info.UserAgent = value
+		case "referer":
+			info.Referer = value
+		case "content-type":
+			info.ContentType = value
+		case "server":
+			info.Server = value
+		case "content-length":
+			if length, err := strconv.ParseInt(value, 10, 64); err == nil && length >= 0 {
+				info.ContentLength = length
+			}
+		case "transfer-encoding":
+			info.Chunked = strings.Contains(strings.ToLower(value), "chunked")
+		}
+	}
+
+	// The request-only and response-only headers are meaningless in the other direction
+	if info.IsRequest {
+		info.Server = ""
+		info.JA4H = calculateJA4H(info.Method, info.Version, headers)
+	} else {
+		info.Host, info.UserAgent, info.Referer = "", "", ""
+	}
+	return info, nil
+}
+
+// Parses a request line ("GET /index.html HTTP/1.1") or a status line
+// ("HTTP/1.1 200 OK"). Returns nil without error when the line is neither.
+func parseStartLine(line string) (*HTTPInfo, error) {
+	if strings.HasPrefix(line, "HTTP/1.") {
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("malformed HTTP status line")
+		}
+		code, err := strconv.Atoi(fields[1])
+		if err != nil || code < 100 || code > 999 {
+			return nil, fmt.Errorf("invalid HTTP status code %q", fields[1])
+		}
+		return &HTTPInfo{Version: fields[0], StatusCode: code, ContentLength: -1}, nil
+	}
+
+	method, rest, ok := strings.Cut(line, " ")
+	if !ok || !isHTTPMethod(method) {
+		return nil, nil
+	}
+	uri, version, ok := strings.Cut(rest, " ")
+	if !ok || !strings.HasPrefix(version, "HTTP/1.") {
+		return nil, nil // HTTP/0.9 and non-HTTP protocols sharing a method word
+	}
+	return &HTTPInfo{IsRequest: true, Version: version, Method: method, URI: uri, ContentLength: -1}, nil
+}
+
+func isHTTPMethod(method string) bool {
+	for _, m := range httpMethods {
+		if method == m {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the length of the message body that follows the headers, or false when
+// it cannot be known without decoding it: chunked bodies, and responses delimited
+// by the connection closing. Responses to HEAD requests are indistinguishable
+// here and are assumed to carry the body their Content-Length describes.
+func (h *HTTPInfo) BodyLength() (int64, bool) {
+	switch {
+	case h.Chunked:
+		return 0, false
+	case h.ContentLength >= 0:
+		return h.ContentLength, true
+	case h.IsRequest:
+		return 0, true
+	case h.StatusCode < 200 || h.StatusCode == 204 || h.StatusCode == 304:
+		return 0, true
+	}
+	return 0, false
+}
+
+// Formats a one-line summary, e.g. "GET example.com/index.html" or "200 (nginx)".
+func (h *HTTPInfo) Summary() string {
+	if h.IsRequest {
+		return fmt.Sprintf("%s %s%s", h.Method, h.Host, h.URI)
+	}
+	if h.Server != "" {
+		return fmt.Sprintf("%d (%s)", h.StatusCode, h.Server)
+	}
+	return strconv.Itoa(h.StatusCode)
+}
@@ -0,0 +1,114 @@
+/**
+ * HTTP Parser Tests.
+ *
+ * Validates HTTP/1.x request and response parsing, including header
+ * case-insensitivity, truncated segments, and rejection of payloads
+ * that only resemble HTTP.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package parser
+
+import (
+	"testing"
+)
+
+// Verifies request and response header extraction.
+func TestParseHTTPPayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    *HTTPInfo
+		wantErr bool
+	}{
+		{
+			name: "request",
+			payload: "GET /index.html?q=1 HTTP/1.1\r\nHost: example.com\r\nUser-Agent: curl/8.0\r\n" +
+				"Referer: http://example.org/\r\nAccept: */*\r\n\r\n",
+			want: &HTTPInfo{IsRequest: true, Version: "HTTP/1.1", Method: "GET", URI: "/index.html?q=1",
+				Host: "example.com", UserAgent: "curl/8.0", Referer: "http://example.org/", ContentLength: -1},
+		},
+		{
+			name:    "headers are case-insensitive",
+			payload: "POST /api HTTP/1.0\nhost:device.local:8080\ncontent-TYPE: application/json\nContent-Length: 2\n\n{}",
+			want: &HTTPInfo{IsRequest: true, Version: "HTTP/1.0", Method: "POST", URI: "/api",
+				Host: "device.local:8080", ContentType: "application/json", ContentLength: 2},
+		},
+		{
+			name:    "response",
+			payload: "HTTP/1.1 404 Not Found\r\nServer: nginx/1.25\r\nContent-Type: text/html\r\nTransfer-Encoding: chunked\r\n\r\n<html>",
+			want: &HTTPInfo{Version: "HTTP/1.1", StatusCode: 404, Server: "nginx/1.25", ContentType: "text/html",
+				ContentLength: -1, Chunked: true},
+		},
+		{
+			name:    "response ignores request headers",
+			payload: "HTTP/1.1 200 OK\r\nHost: example.com\r\n\r\n",
+			want:    &HTTPInfo{Version: "HTTP/1.1", StatusCode: 200, ContentLength: -1},
+		},
+		{
+			name:    "headers cut off by the segment",
+			payload: "GET / HTTP/1.1\r\nHost: example.com\r\nUser-Ag",
+			want:    &HTTPInfo{IsRequest: true, Version: "HTTP/1.1", Method: "GET", URI: "/", Host: "example.com", ContentLength: -1},
+		},
+		{"no complete start line", "GET / HTTP/1.1", nil, false},
+		{"unknown method", "FETCH / HTTP/1.1\r\n\r\n", nil, false},
+		{"method without HTTP version", "GET /\r\n", nil, false},
+		{"not HTTP", "\x16\x03\x01\x00\x2d\x01\x00\x00\x29\n", nil, false},
+		{"invalid status code", "HTTP/1.1 OK\r\n\r\n", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseHTTPPayload([]byte(tt.payload))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if tt.want == nil {
+				if got != nil {
+					t.Errorf("Expected no HTTP info, got %+v", got)
+				}
+				return
+			}
+			if got != nil {
+				got.JA4H = "" // Covered by TestCalculateJA4H
+			}
+			if got == nil || *got != *tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+// Verifies the JA4H sections: method, version, cookie and referer flags, header count,
+// language, and the hashes of header names and cookies.
+func TestCalculateJA4H(t *testing.T) {
+	request := "GET /search HTTP/1.1\r\n" +
+		"Host: example.com\r\n" +
+		"User-Agent: Mozilla/5.0\r\n" +
+		"Accept-Language: en-US,en;q=0.9\r\n" +
+		"Referer: https://example.com/\r\n" +
+		"Cookie: session=abc; _ga=GA1.2; lang=en\r\n\r\n"
+	info, err := ParseHTTPPayload([]byte(request))
+	if err != nil || info == nil {
+		t.Fatalf("Failed to parse request: %v", err)
+	}
+
+	want := "ge11cr03enus_" + ja4Hash("Host,User-Agent,Accept-Language") + "_" +
+		ja4Hash("_ga,lang,session") + "_" + ja4Hash("_ga=GA1.2,lang=en,session=abc")
+	if info.JA4H != want {
+		t.Errorf("Expected JA4H %s, got %s", want, info.JA4H)
+	}
+
+	// Header order distinguishes clients; cookies are sorted so their order does not
+	reordered := "GET /search HTTP/1.1\r\nUser-Agent: Mozilla/5.0\r\nHost: example.com\r\n\r\n"
+	if other, _ := ParseHTTPPayload([]byte(reordered)); other.JA4H[:12] != "ge11nn020000" || other.JA4H == info.JA4H {
+		t.Errorf("Expected a different fingerprint for reordered headers, got %s", other.JA4H)
+	}
+
+	response, _ := ParseHTTPPayload([]byte("HTTP/1.1 200 OK\r\nServer: nginx\r\n\r\n"))
+	if response.JA4H != "" {
+		t.Errorf("Expected no JA4H on a response, got %s", response.JA4H)
+	}
+}
@@ -34,7 +34,18 @@ type JA3Data struct {
 // Computes the JA3 fingerprint from a TLS Client Hello packet.
 // Returns the MD5 hash string or empty string if not a valid Client Hello.
 func CalculateJA3(packet gopacket.Packet) string {
-	data := extractJA3Data(packet)
+	tcpLayer := packet.Layer(layers.LayerTypeTCP)
+	if tcpLayer == nil {
+		return ""
+	}
+
+	tcp, _ := tcpLayer.(*layers.TCP)
+	return CalculateJA3Payload(tcp.Payload)
+}
+
+// Computes the JA3 fingerprint from a TCP payload carrying a TLS Client Hello.
+func CalculateJA3Payload(payload []byte) string {
+	data := extractJA3Data(payload)
 	if data == nil {
 		return ""
 	}
@@ -51,15 +62,7 @@ func CalculateJA3(packet gopacket.Packet) string {
 }
 
 // Parses the Client Hello and extracts JA3-relevant fields needed for fingerprint calculation.
-func extractJA3Data(packet gopacket.Packet) *JA3Data {
-	tcpLayer := packet.Layer(layers.LayerTypeTCP)
-	if tcpLayer == nil {
-		return nil
-	}
-
-	tcp, _ := tcpLayer.(*layers.TCP)
-	payload := tcp.Payload
-
+func extractJA3Data(payload []byte) *JA3Data {
 	if len(payload) < 43 {
 		return nil // Too short for Client Hello
 	}
@@ -0,0 +1,114 @@
+/**
+ * JA3S TLS Server Fingerprinting.
+ *
+ * Implements JA3S, the server-side counterpart of JA3: an MD5 hash of the
+ * version, selected cipher suite and extensions of a Server Hello. A
+ * server answers the same client the same way, so the JA3 and JA3S pair
+ * identifies a client and server implementation together, even when the
+ * client mimics a browser.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package parser
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// JA3SData holds the Server Hello fields used to calculate the JA3S fingerprint.
+type JA3SData struct {
+	SSLVersion  uint16   // Legacy version field, as JA3S specifies
+	CipherSuite uint16   // Cipher suite the server selected
+	Extensions  []uint16 // In the order the server sent them
+
+	// Version negotiated through the supported_versions extension (TLS 1.3), zero when absent
+	SelectedVersion uint16
+	ALPN            string // Protocol selected through ALPN, empty when absent
+}
+
+// Computes the JA3S fingerprint from a TCP payload carrying a TLS Server Hello.
+// Returns the MD5 hash string or empty string if not a valid Server Hello.
+func CalculateJA3SPayload(payload []byte) string {
+	data := extractJA3SData(payload)
+	if data == nil {
+		return ""
+	}
+	return data.Hash()
+}
+
+// Returns the MD5 hash of the JA3S string.
+func (data *JA3SData) Hash() string {
+	hash := md5.Sum([]byte(data.String()))
+	return fmt.Sprintf("%x", hash)
+}
+
+// Formats the JA3S string: SSLVersion,Cipher,Extensions.
+func (data *JA3SData) String() string {
+	extensions := make([]string, len(data.Extensions))
+	for i, e := range data.Extensions {
+		extensions[i] = strconv.Itoa(int(e))
+	}
+	return fmt.Sprintf("%d,%d,%s", data.SSLVersion, data.CipherSuite, strings.Join(extensions, "-"))
+}
+
+// Parses a TLS record holding a Server Hello and extracts the JA3S fields.
+func extractJA3SData(payload []byte) *JA3SData {
+	// Record header (5) + handshake header (4) + version (2) + random (32) + session ID length (1)
+	if len(payload) < 44 {
+		return nil
+	}
+	if payload[0] != 22 || payload[5] != 2 {
+		return nil // Not a Server Hello
+	}
+
+	data := &JA3SData{SSLVersion: binary.BigEndian.Uint16(payload[9:11])}
+	offset := 11 + 32
+
+	// Session ID
+	offset += 1 + int(payload[offset])
+
+	// Cipher suite (2) + compression method (1)
+	if offset+3 > len(payload) {
+		return nil
+	}
+	data.CipherSuite = binary.BigEndian.Uint16(payload[offset : offset+2])
+	offset += 3
+
+	// Extensions are optional before TLS 1.3
+	if offset+2 > len(payload) {
+		return data
+	}
+	endOfExtensions := offset + 2 + int(binary.BigEndian.Uint16(payload[offset:offset+2]))
+	offset += 2
+	if endOfExtensions > len(payload) {
+		endOfExtensions = len(payload)
+	}
+
+	for offset+4 <= endOfExtensions {
+		extType := binary.BigEndian.Uint16(payload[offset : offset+2])
+		extLen := int(binary.BigEndian.Uint16(payload[offset+2 : offset+4]))
+		offset += 4
+		if offset+extLen > endOfExtensions {
+			break
+		}
+
+		data.Extensions = append(data.Extensions, extType)
+		switch {
+		case extType == extSupportedVersions && extLen == 2: // Carries the one selected
+			data.SelectedVersion = binary.BigEndian.Uint16(payload[offset : offset+2])
+		case extType == extALPN && extLen >= 3: // A list of exactly one protocol
+			if nameLen := int(payload[offset+2]); 3+nameLen <= extLen {
+				data.ALPN = string(payload[offset+3 : offset+3+nameLen])
+			}
+		}
+		offset += extLen
+	}
+
+	return data
+}
@@ -0,0 +1,177 @@
+/**
+ * JA4 and JA4S TLS Fingerprinting.
+ *
+ * Implements the FoxIO JA4 client and JA4S server fingerprints. Unlike
+ * JA3, JA4 sorts the cipher suites and extensions before hashing, so
+ * clients that randomise their extension order (Chrome since 110) keep
+ * one fingerprint, and its readable first section (protocol, version,
+ * SNI, counts and ALPN) can be matched on its own.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package parser
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Transport codes of the first JA4 character.
+const (
+	JA4OverTCP  = 't'
+	JA4OverQUIC = 'q'
+)
+
+// Computes the JA4 fingerprint from a TCP payload carrying a TLS Client Hello.
+// Returns empty string if not a valid Client Hello.
+func CalculateJA4Payload(payload []byte) string {
+	hello := parseClientHello(payload)
+	if hello == nil {
+		return ""
+	}
+	return hello.JA4(JA4OverTCP)
+}
+
+// Formats the JA4 fingerprint: protocol, version, SNI, counts and ALPN, then the
+// hashes of the sorted cipher suites and of the sorted extensions with the
+// signature algorithms.
+func (hello *clientHello) JA4(transport byte) string {
+	ciphers := ja4HexList(hello.CipherSuites)
+	sort.Strings(ciphers)
+
+	// SNI and ALPN are counted but left out of the hash; the first section shows them
+	extensions := withoutGREASE(hello.Extensions)
+	var hashed []string
+	for _, ext := range extensions {
+		if ext != extServerName && ext != extALPN {
+			hashed = append(hashed, fmt.Sprintf("%04x", ext))
+		}
+	}
+	sort.Strings(hashed)
+
+	sni := 'i'
+	if hello.SNI != "" {
+		sni = 'd'
+	}
+	alpn := ""
+	if len(hello.ALPN) > 0 {
+		alpn = hello.ALPN[0]
+	}
+
+	extensionsHash := "000000000000"
+	if len(hashed) > 0 {
+		input := strings.Join(hashed, ",")
+		if sigalgs := ja4HexList(hello.SignatureAlgorithms); len(sigalgs) > 0 {
+			input += "_" + strings.Join(sigalgs, ",")
+		}
+		extensionsHash = ja4Hash(input)
+	}
+
+	return fmt.Sprintf("%c%s%c%s%s%s_%s_%s", transport, ja4Version(hello.maxVersion()), sni,
+		ja4Count(len(ciphers)), ja4Count(len(extensions)), ja4ALPN(alpn),
+		ja4HashList(ciphers), extensionsHash)
+}
+
+// Formats the JA4S fingerprint: protocol, version, extension count and ALPN, then
+// the selected cipher suite and the hash of the extensions in the order sent.
+func (data *JA3SData) JA4S(transport byte) string {
+	version := data.SSLVersion
+	if data.SelectedVersion != 0 {
+		version = data.SelectedVersion
+	}
+	extensions := ja4HexList(data.Extensions)
+	return fmt.Sprintf("%c%s%s%s_%04x_%s", transport, ja4Version(version), ja4Count(len(extensions)),
+		ja4ALPN(data.ALPN), data.CipherSuite, ja4HashList(extensions))
+}
+
+// Returns the two-character JA4 code of a protocol version.
+func ja4Version(version uint16) string {
+	switch version {
+	case 0x0304:
+		return "13"
+	case 0x0303:
+		return "12"
+	case 0x0302:
+		return "11"
+	case 0x0301:
+		return "10"
+	case 0x0300:
+		return "s3"
+	case 0x0002:
+		return "s2"
+	case 0xfeff:
+		return "d1"
+	case 0xfefd:
+		return "d2"
+	case 0xfefc:
+		return "d3"
+	}
+	return "00"
+}
+
+// Formats a count as two digits, capped at 99.
+func ja4Count(n int) string {
+	if n > 99 {
+		n = 99
+	}
+	return fmt.Sprintf("%02d", n)
+}
+
+// Returns the first and last characters of an ALPN value, "00" when absent. Values
+// that start or end outside [0-9A-Za-z] are represented by their hex encoding.
+func ja4ALPN(alpn string) string {
+	if alpn == "" {
+		return "00"
+	}
+	first, last := alpn[0], alpn[len(alpn)-1]
+	if !isAlphanumeric(first) || !isAlphanumeric(last) {
+		encoded := hex.EncodeToString([]byte(alpn))
+		return encoded[:1] + encoded[len(encoded)-1:]
+	}
+	return string([]byte{first, last})
+}
+
+// Reports whether b is an ASCII letter or digit.
+func isAlphanumeric(b byte) bool {
+	return (b >= '0' && b <= '9') || (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z')
+}
+
+// Formats values as four-digit lower-case hex, skipping GREASE.
+func ja4HexList(values []uint16) []string {
+	values = withoutGREASE(values)
+	list := make([]string, len(values))
+	for i, v := range values {
+		list[i] = fmt.Sprintf("%04x", v)
+	}
+	return list
+}
+
+// Returns the values that are not GREASE, in order.
+func withoutGREASE(values []uint16) []uint16 {
+	kept := make([]uint16, 0, len(values))
+	for _, v := range values {
+		if !isGREASE(v) {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+// Hashes a comma-joined list, or returns the JA4 placeholder for an empty one.
+func ja4HashList(list []string) string {
+	if len(list) == 0 {
+		return "000000000000"
+	}
+	return ja4Hash(strings.Join(list, ","))
+}
+
+// Returns the first 12 hex characters of the SHA-256 of s.
+func ja4Hash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:6])
+}
@@ -0,0 +1,84 @@
+/**
+ * JA4H HTTP Client Fingerprinting.
+ *
+ * Implements the FoxIO JA4H fingerprint of an HTTP request: its method,
+ * version, cookie and referer presence, header count and language, then
+ * hashes of the header names in the order sent and of the cookies.
+ * Header order is set by the client's HTTP library, so JA4H tells tools
+ * apart even when they copy a browser's User-Agent.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// One request header as sent.
+type httpHeader struct {
+	name  string
+	value string
+}
+
+// Formats the JA4H fingerprint of a request from its method, version and headers.
+func calculateJA4H(method, version string, headers []httpHeader) string {
+	var names, cookieNames, cookies []string
+	hasReferer := false
+	language := "0000"
+	for _, h := range headers {
+		switch lower := strings.ToLower(h.name); {
+		case lower == "cookie":
+			for _, cookie := range strings.Split(h.value, ";") {
+				if cookie = strings.TrimSpace(cookie); cookie != "" {
+					name, _, _ := strings.Cut(cookie, "=")
+					cookieNames = append(cookieNames, name)
+					cookies = append(cookies, cookie)
+				}
+			}
+			continue
+		case lower == "referer":
+			hasReferer = true
+			continue
+		case strings.HasPrefix(lower, ":"):
+			continue // HTTP/2 pseudo-headers
+		case lower == "accept-language":
+			language = ja4hLanguage(h.value)
+		}
+		names = append(names, h.name)
+	}
+	sort.Strings(cookieNames)
+	sort.Strings(cookies)
+
+	cookie, referer := 'n', 'n'
+	if len(cookies) > 0 {
+		cookie = 'c'
+	}
+	if hasReferer {
+		referer = 'r'
+	}
+
+	methodCode := strings.ToLower(method)
+	if len(methodCode) > 2 {
+		methodCode = methodCode[:2]
+	}
+	versionCode := strings.ReplaceAll(strings.TrimPrefix(version, "HTTP/"), ".", "")
+	versionCode = (versionCode + "00")[:2]
+
+	return fmt.Sprintf("%s%s%c%c%s%s_%s_%s_%s", methodCode, versionCode, cookie, referer,
+		ja4Count(len(names)), language, ja4HashList(names), ja4HashList(cookieNames), ja4HashList(cookies))
+}
+
+// Returns the first four characters of the primary language, without hyphens and
+// padded with zeros ("en-US,en;q=0.9" becomes "enus").
+func ja4hLanguage(value string) string {
+	value = strings.ToLower(strings.ReplaceAll(value, "-", ""))
+	if i := strings.IndexAny(value, ",;"); i >= 0 {
+		value = value[:i]
+	}
+	return (strings.TrimSpace(value) + "0000")[:4]
+}
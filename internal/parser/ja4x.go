@@ -0,0 +1,51 @@
+/**
+ * JA4X Certificate Fingerprinting.
+ *
+ * Implements the FoxIO JA4X fingerprint of an X.509 certificate: hashes
+ * of the attribute types of its issuer and subject and of its extension
+ * types, in the order they appear. The values are ignored, so JA4X
+ * captures how a certificate was generated (the tool or library and its
+ * template) rather than whom it names, and stays the same across the
+ * certificates a C2 framework mints for each deployment.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package parser
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+)
+
+// Formats the JA4X fingerprint of a certificate: the hashes of the issuer's and
+// subject's attribute OIDs and of the extension OIDs, each as DER hex in order.
+func calculateJA4X(cert *x509.Certificate) string {
+	var issuer, subject, extensions []string
+	for _, attr := range cert.Issuer.Names {
+		issuer = append(issuer, oidHex(attr.Type))
+	}
+	for _, attr := range cert.Subject.Names {
+		subject = append(subject, oidHex(attr.Type))
+	}
+	for _, ext := range cert.Extensions {
+		extensions = append(extensions, oidHex(ext.Id))
+	}
+	return fmt.Sprintf("%s_%s_%s", ja4HashList(issuer), ja4HashList(subject), ja4HashList(extensions))
+}
+
+// Returns the hex of an OID's DER content octets, as JA4X hashes it (2.5.4.3 is "550403").
+func oidHex(oid asn1.ObjectIdentifier) string {
+	der, err := asn1.Marshal(oid)
+	if err != nil {
+		return ""
+	}
+	var raw asn1.RawValue
+	if _, err := asn1.Unmarshal(der, &raw); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(raw.Bytes)
+}
@@ -0,0 +1,318 @@
+/**
+ * ARP and IPv6 Neighbor Discovery Parser.
+ *
+ * Parses ARP packets and the Neighbor Discovery messages of ICMPv6
+ * (RFC 4861) for the IP to MAC binding each announces, and recognises
+ * gratuitous announcements and duplicate address detection probes.
+ * Router Advertisements also yield the router's flags, prefixes, MTU
+ * and DNS servers.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package parser
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/kleaSCM/netscope/internal/models"
+)
+
+// ICMPv6 Neighbor Discovery message types (RFC 4861 section 4).
+const (
+	ndpRouterSolicitation    = 133
+	ndpRouterAdvertisement   = 134
+	ndpNeighborSolicitation  = 135
+	ndpNeighborAdvertisement = 136
+)
+
+// Neighbor Discovery option types.
+const (
+	ndpOptSourceLinkAddr = 1
+	ndpOptTargetLinkAddr = 2
+	ndpOptPrefixInfo     = 3
+	ndpOptMTU            = 5
+	ndpOptRDNSS          = 25 // RFC 8106
+)
+
+// Holds what an ARP packet or Neighbor Discovery message reveals about its sender.
+type NeighborInfo struct {
+	Protocol  string // "ARP" or "NDP"
+	Message   string // e.g. "Request", "Reply", "Neighbor Solicitation", "Router Advertisement"
+	SenderIP  string // Empty when sent from the unspecified address
+	SenderMAC string // ARP sender address, or the source link-layer option, else the frame's source
+	TargetIP  string // Address asked about, or announced by a Neighbor Advertisement
+	TargetMAC string // ARP target address, or the target link-layer option
+
+	Gratuitous bool // Announces the sender's binding unasked
+	Probe      bool // Duplicate address detection: checks TargetIP is free before using it
+	Router     bool // A Router Advertisement, or a Neighbor Advertisement with the router flag
+	Solicited  bool // Neighbor Advertisements only: answers a solicitation
+
+	Advert *models.RouterAdvertisement // Router Advertisements only
+}
+
+// Parses an Ethernet/IPv4 ARP packet. Returns nil for other hardware or protocol
+// types and for operations other than request and reply.
+func ParseARPPacket(data []byte) (_ *NeighborInfo, err error) {
+	defer recoverMalformed("arp packet", &err)
+	if len(data) < 8 {
+		return nil, fmt.Errorf("arp packet too short: %d bytes", len(data))
+	}
+	hardware, protocol := binary.BigEndian.Uint16(data), binary.BigEndian.Uint16(data[2:])
+	if hardware != 1 || protocol != 0x0800 || data[4] != 6 || data[5] != 4 {
+		return nil, nil
+	}
+	if len(data) < 28 {
+		return nil, fmt.Errorf("arp packet too short: %d bytes", len(data))
+	}
+
+	info := &NeighborInfo{
+		Protocol:  "ARP",
+		SenderMAC: net.HardwareAddr(data[8:14]).String(),
+		SenderIP:  net.IP(data[14:18]).String(),
+		TargetMAC: net.HardwareAddr(data[18:24]).String(),
+		TargetIP:  net.IP(data[24:28]).String(),
+	}
+	switch binary.BigEndian.Uint16(data[6:]) {
+	case 1:
+		info.Message = "Request"
+	case 2:
+		info.Message = "Reply"
+	default:
+		return nil, nil
+	}
+
+	// RFC 5227: probes come from 0.0.0.0, announcements name the sender as the target
+	if info.SenderIP == "0.0.0.0" {
+		info.SenderIP = ""
+		info.Probe = info.Message == "Request"
+	} else if info.SenderIP == info.TargetIP {
+		info.Gratuitous = true
+	}
+	return info, nil
+}
+
+// Parses an ICMPv6 message, header included, as a Neighbor Discovery message.
+// Returns nil for other ICMPv6 types. Messages with a hop limit below 255 were
+// forwarded by a router and are rejected, as RFC 4861 requires.
+func ParseNDPMessage(msg []byte, srcIP net.IP, srcMAC net.HardwareAddr, hopLimit uint8) (_ *NeighborInfo, err error) {
+	defer recoverMalformed("ndp message", &err)
+	if len(msg) < 4 || msg[0] < ndpRouterSolicitation || msg[0] > ndpNeighborAdvertisement {
+		return nil, nil
+	}
+	if hopLimit != 255 || msg[1] != 0 {
+		return nil, fmt.Errorf("ndp message with hop limit %d and code %d", hopLimit, msg[1])
+	}
+
+	info := &NeighborInfo{Protocol: "NDP"}
+	if !srcIP.IsUnspecified() {
+		info.SenderIP = srcIP.String()
+	}
+	body := msg[4:]
+
+	var fixed int // Bytes before the options
+	switch msg[0] {
+	case ndpRouterSolicitation:
+		info.Message, fixed = "Router Solicitation", 4
+	case ndpRouterAdvertisement:
+		info.Message, fixed = "Router Advertisement", 12
+	case ndpNeighborSolicitation, ndpNeighborAdvertisement:
+		info.Message, fixed = "Neighbor Solicitation", 20
+		if msg[0] == ndpNeighborAdvertisement {
+			info.Message = "Neighbor Advertisement"
+		}
+	}
+	if len(body) < fixed {
+		return nil, fmt.Errorf("ndp %s too short: %d bytes", strings.ToLower(info.Message), len(body))
+	}
+	options, err := parseNDPOptions(body[fixed:])
+	if err != nil {
+		return nil, err
+	}
+
+	if mac := options.sourceMAC; mac != "" {
+		info.SenderMAC = mac
+	} else if srcMAC != nil {
+		info.SenderMAC = srcMAC.String()
+	}
+
+	switch msg[0] {
+	case ndpRouterAdvertisement:
+		info.Router = true
+		info.Advert = parseRouterAdvertisement(body, options)
+		info.Advert.RouterIP, info.Advert.RouterMAC = info.SenderIP, info.SenderMAC
+	case ndpNeighborSolicitation:
+		info.TargetIP = net.IP(body[4:20]).String()
+		info.Probe = info.SenderIP == "" // Duplicate address detection (RFC 4862 section 5.4)
+	case ndpNeighborAdvertisement:
+		info.TargetIP = net.IP(body[4:20]).String()
+		info.TargetMAC = options.targetMAC
+		info.Router = body[0]&0x80 != 0
+		info.Solicited = body[0]&0x40 != 0
+		info.Gratuitous = !info.Solicited
+	}
+	return info, nil
+}
+
+// Returns the IP and MAC the message binds together, or empty strings when it
+// binds none: probes are sent before the address is the sender's.
+func (n *NeighborInfo) Binding() (ip, mac string) {
+	switch {
+	case n.Probe:
+		return "", ""
+	case n.Message == "Neighbor Advertisement":
+		// The advertised address is the target, reachable at the target link-layer
+		// address when the advertisement carries one
+		if n.TargetMAC != "" {
+			return n.TargetIP, n.TargetMAC
+		}
+		return n.TargetIP, n.SenderMAC
+	case n.SenderIP == "" || n.SenderMAC == "":
+		return "", ""
+	}
+	return n.SenderIP, n.SenderMAC
+}
+
+// Returns a short human-readable summary, e.g. "Who has 192.168.1.1? Tell 192.168.1.100".
+func (n *NeighborInfo) Summary() string {
+	ip, mac := n.Binding()
+	switch {
+	case n.Probe && n.Protocol == "ARP":
+		return fmt.Sprintf("ARP probe for %s from %s", n.TargetIP, n.SenderMAC)
+	case n.Probe:
+		return fmt.Sprintf("DAD probe for %s from %s", n.TargetIP, n.SenderMAC)
+	case n.Advert != nil:
+		return fmt.Sprintf("Router Advertisement from %s (%s)", n.SenderIP, FormatRouterAdvertisement(n.Advert))
+	case n.Message == "Router Solicitation":
+		return fmt.Sprintf("Router Solicitation from %s", orUnspecified(n.SenderIP))
+	case n.Gratuitous:
+		return fmt.Sprintf("Gratuitous %s: %s is at %s", n.Protocol, ip, mac)
+	case n.Message == "Request" || n.Message == "Neighbor Solicitation":
+		return fmt.Sprintf("Who has %s? Tell %s", n.TargetIP, orUnspecified(n.SenderIP))
+	}
+	if n.Router {
+		return fmt.Sprintf("%s is at %s (router)", ip, mac)
+	}
+	return fmt.Sprintf("%s is at %s", ip, mac)
+}
+
+// Formats what a router advertised, e.g. "2001:db8:1::/64, default router (medium), M, MTU 1500".
+func FormatRouterAdvertisement(advert *models.RouterAdvertisement) string {
+	var parts []string
+	for _, prefix := range advert.Prefixes {
+		parts = append(parts, prefix.Prefix)
+	}
+	if advert.Lifetime > 0 {
+		parts = append(parts, fmt.Sprintf("default router (%s)", advert.Preference))
+	}
+	if advert.Managed {
+		parts = append(parts, "M")
+	}
+	if advert.OtherConfig {
+		parts = append(parts, "O")
+	}
+	if advert.MTU != 0 {
+		parts = append(parts, fmt.Sprintf("MTU %d", advert.MTU))
+	}
+	if len(advert.DNSServers) > 0 {
+		parts = append(parts, "DNS "+strings.Join(advert.DNSServers, " "))
+	}
+	if len(parts) == 0 {
+		return "no default route"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Returns ip, or "::" for messages sent from the unspecified address.
+func orUnspecified(ip string) string {
+	if ip == "" {
+		return "::"
+	}
+	return ip
+}
+
+// Options of one Neighbor Discovery message that this parser keeps.
+type ndpOptions struct {
+	sourceMAC  string
+	targetMAC  string
+	prefixes   []models.RouterPrefix
+	mtu        uint32
+	dnsServers []string
+}
+
+// Parses the type-length-value options that follow a message's fixed fields.
+// Lengths count 8 byte units and include the type and length bytes.
+func parseNDPOptions(data []byte) (*ndpOptions, error) {
+	options := &ndpOptions{}
+	for len(data) > 0 {
+		if len(data) < 2 || data[1] == 0 || len(data) < int(data[1])*8 {
+			return nil, fmt.Errorf("malformed ndp option")
+		}
+		option := data[:int(data[1])*8]
+		data = data[len(option):]
+
+		switch option[0] {
+		case ndpOptSourceLinkAddr, ndpOptTargetLinkAddr:
+			if len(option) != 8 {
+				continue // Not an Ethernet address
+			}
+			mac := net.HardwareAddr(option[2:8]).String()
+			if option[0] == ndpOptSourceLinkAddr {
+				options.sourceMAC = mac
+			} else {
+				options.targetMAC = mac
+			}
+		case ndpOptPrefixInfo:
+			if len(option) != 32 || option[2] > 128 {
+				return nil, fmt.Errorf("malformed ndp prefix information option")
+			}
+			prefix := net.IPNet{IP: net.IP(option[16:32]), Mask: net.CIDRMask(int(option[2]), 128)}
+			options.prefixes = append(options.prefixes, models.RouterPrefix{
+				Prefix:            prefix.String(),
+				OnLink:            option[3]&0x80 != 0,
+				Autonomous:        option[3]&0x40 != 0,
+				ValidLifetime:     time.Duration(binary.BigEndian.Uint32(option[4:])) * time.Second,
+				PreferredLifetime: time.Duration(binary.BigEndian.Uint32(option[8:])) * time.Second,
+			})
+		case ndpOptMTU:
+			if len(option) == 8 {
+				options.mtu = binary.BigEndian.Uint32(option[4:])
+			}
+		case ndpOptRDNSS:
+			for addresses := option[8:]; len(addresses) >= 16; addresses = addresses[16:] {
+				options.dnsServers = append(options.dnsServers, net.IP(addresses[:16]).String())
+			}
+		}
+	}
+	return options, nil
+}
+
+// Builds a Router Advertisement from its fixed fields and options.
+func parseRouterAdvertisement(body []byte, options *ndpOptions) *models.RouterAdvertisement {
+	flags := body[1]
+	advert := &models.RouterAdvertisement{
+		HopLimit:    body[0],
+		Managed:     flags&0x80 != 0,
+		OtherConfig: flags&0x40 != 0,
+		Lifetime:    time.Duration(binary.BigEndian.Uint16(body[2:])) * time.Second,
+		MTU:         options.mtu,
+		Prefixes:    options.prefixes,
+		DNSServers:  options.dnsServers,
+	}
+	// RFC 4191: 01 high, 00 medium, 11 low; the reserved 10 is treated as medium
+	switch (flags >> 3) & 0x3 {
+	case 1:
+		advert.Preference = "high"
+	case 3:
+		advert.Preference = "low"
+	default:
+		advert.Preference = "medium"
+	}
+	return advert
+}
@@ -0,0 +1,205 @@
+/**
+ * ARP and Neighbor Discovery Parser Tests.
+ *
+ * Validates the bindings, gratuitous announcements and duplicate address
+ * detection probes read from ARP packets and Neighbor Discovery messages,
+ * and the options of Router Advertisements.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package parser
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// Builds an Ethernet/IPv4 ARP packet.
+func buildARP(op uint16, senderMAC, senderIP, targetMAC, targetIP string) []byte {
+	packet := []byte{0, 1, 8, 0, 6, 4}
+	packet = binary.BigEndian.AppendUint16(packet, op)
+	packet = append(packet, mustMAC(senderMAC)...)
+	packet = append(packet, net.ParseIP(senderIP).To4()...)
+	packet = append(packet, mustMAC(targetMAC)...)
+	return append(packet, net.ParseIP(targetIP).To4()...)
+}
+
+// Builds a link-layer address option.
+func buildLinkAddrOption(kind byte, mac string) []byte {
+	return append([]byte{kind, 1}, mustMAC(mac)...)
+}
+
+func mustMAC(mac string) net.HardwareAddr {
+	addr, err := net.ParseMAC(mac)
+	if err != nil {
+		panic(err)
+	}
+	return addr
+}
+
+// Verifies that ARP requests and replies yield the sender's binding, and that
+// announcements and probes are recognised.
+func TestParseARPPacket(t *testing.T) {
+	const mac, zero = "00:11:22:33:44:55", "00:00:00:00:00:00"
+	tests := []struct {
+		name       string
+		packet     []byte
+		ip         string
+		gratuitous bool
+		probe      bool
+		summary    string
+	}{
+		{"request", buildARP(1, mac, "192.168.1.100", zero, "192.168.1.1"), "192.168.1.100", false, false,
+			"Who has 192.168.1.1? Tell 192.168.1.100"},
+		{"reply", buildARP(2, mac, "192.168.1.1", "66:77:88:99:aa:bb", "192.168.1.100"), "192.168.1.1", false, false,
+			"192.168.1.1 is at 00:11:22:33:44:55"},
+		{"gratuitous", buildARP(1, mac, "192.168.1.50", zero, "192.168.1.50"), "192.168.1.50", true, false,
+			"Gratuitous ARP: 192.168.1.50 is at 00:11:22:33:44:55"},
+		{"probe", buildARP(1, mac, "0.0.0.0", zero, "192.168.1.50"), "", false, true,
+			"ARP probe for 192.168.1.50 from 00:11:22:33:44:55"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := ParseARPPacket(tt.packet)
+			if err != nil || info == nil {
+				t.Fatalf("Failed to parse ARP packet: %v", err)
+			}
+			if ip, _ := info.Binding(); ip != tt.ip {
+				t.Errorf("Expected binding of %q, got %q", tt.ip, ip)
+			}
+			if info.Gratuitous != tt.gratuitous || info.Probe != tt.probe {
+				t.Errorf("Expected gratuitous %v and probe %v, got %+v", tt.gratuitous, tt.probe, info)
+			}
+			if got := info.Summary(); got != tt.summary {
+				t.Errorf("Expected summary %q, got %q", tt.summary, got)
+			}
+		})
+	}
+
+	if _, err := ParseARPPacket(buildARP(1, mac, "192.168.1.100", zero, "192.168.1.1")[:20]); err == nil {
+		t.Error("Expected a truncated packet to fail")
+	}
+	if info, _ := ParseARPPacket(buildARP(3, mac, "192.168.1.100", zero, "192.168.1.1")); info != nil {
+		t.Errorf("Expected RARP to be ignored, got %+v", info)
+	}
+}
+
+// Verifies that solicitations, advertisements and duplicate address detection
+// probes yield the right binding, and that forwarded messages are rejected.
+func TestParseNDPMessage(t *testing.T) {
+	const mac, frameMAC = "00:11:22:33:44:55", "66:77:88:99:aa:bb"
+	target := net.ParseIP("2001:db8::10")
+
+	solicitation := append([]byte{ndpNeighborSolicitation, 0, 0, 0, 0, 0, 0, 0}, target...)
+	advertisement := append([]byte{ndpNeighborAdvertisement, 0, 0, 0, 0xe0, 0, 0, 0}, target...) // Router, solicited, override
+
+	tests := []struct {
+		name       string
+		msg        []byte
+		src        string
+		ip         string
+		mac        string
+		gratuitous bool
+		probe      bool
+		router     bool
+	}{
+		{"solicitation", append(solicitation, buildLinkAddrOption(ndpOptSourceLinkAddr, mac)...), "2001:db8::20",
+			"2001:db8::20", mac, false, false, false},
+		{"solicitation without option", solicitation, "2001:db8::20", "2001:db8::20", frameMAC, false, false, false},
+		{"dad probe", solicitation, "::", "", "", false, true, false},
+		{"solicited advertisement", append(advertisement, buildLinkAddrOption(ndpOptTargetLinkAddr, mac)...), "2001:db8::10",
+			"2001:db8::10", mac, false, false, true},
+		{"unsolicited advertisement", append([]byte{ndpNeighborAdvertisement, 0, 0, 0, 0x20, 0, 0, 0}, target...), "2001:db8::10",
+			"2001:db8::10", frameMAC, true, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := ParseNDPMessage(tt.msg, net.ParseIP(tt.src), mustMAC(frameMAC), 255)
+			if err != nil || info == nil {
+				t.Fatalf("Failed to parse NDP message: %v", err)
+			}
+			if ip, mac := info.Binding(); ip != tt.ip || mac != tt.mac {
+				t.Errorf("Expected binding %s at %s, got %s at %s", tt.ip, tt.mac, ip, mac)
+			}
+			if info.Gratuitous != tt.gratuitous || info.Probe != tt.probe || info.Router != tt.router {
+				t.Errorf("Expected gratuitous %v, probe %v and router %v, got %+v", tt.gratuitous, tt.probe, tt.router, info)
+			}
+			if tt.probe && info.TargetIP != target.String() {
+				t.Errorf("Expected the probed address %s, got %s", target, info.TargetIP)
+			}
+		})
+	}
+
+	t.Run("rejected", func(t *testing.T) {
+		if _, err := ParseNDPMessage(solicitation, net.ParseIP("2001:db8::20"), nil, 64); err == nil {
+			t.Error("Expected a forwarded message to fail")
+		}
+		if _, err := ParseNDPMessage(solicitation[:12], net.ParseIP("2001:db8::20"), nil, 255); err == nil {
+			t.Error("Expected a truncated message to fail")
+		}
+		if _, err := ParseNDPMessage(append(solicitation, 1, 0), net.ParseIP("2001:db8::20"), nil, 255); err == nil {
+			t.Error("Expected a zero length option to fail")
+		}
+		if info, err := ParseNDPMessage([]byte{128, 0, 0, 0, 0, 1, 0, 1}, net.ParseIP("2001:db8::20"), nil, 64); info != nil || err != nil {
+			t.Errorf("Expected an echo request to be ignored, got %+v, %v", info, err)
+		}
+	})
+}
+
+// Verifies that a Router Advertisement yields the router's flags, preference,
+// prefixes, MTU and DNS servers.
+func TestParseRouterAdvertisement(t *testing.T) {
+	const mac = "00:11:22:33:44:55"
+
+	// Hop limit 64, M flag, high preference, 1800 second router lifetime
+	msg := []byte{ndpRouterAdvertisement, 0, 0, 0, 64, 0x88, 0x07, 0x08, 0, 0, 0, 0, 0, 0, 0, 0}
+	msg = append(msg, buildLinkAddrOption(ndpOptSourceLinkAddr, mac)...)
+	msg = append(msg, ndpOptMTU, 1, 0, 0, 0, 0, 0x05, 0xdc)
+
+	prefix := []byte{ndpOptPrefixInfo, 4, 64, 0xc0}
+	prefix = binary.BigEndian.AppendUint32(prefix, 86400)
+	prefix = binary.BigEndian.AppendUint32(prefix, 14400)
+	prefix = append(prefix, 0, 0, 0, 0)
+	msg = append(append(msg, prefix...), net.ParseIP("2001:db8:1::")...)
+
+	msg = append(msg, ndpOptRDNSS, 3, 0, 0, 0, 0, 0x0e, 0x10)
+	msg = append(msg, net.ParseIP("2001:db8:1::53")...)
+
+	info, err := ParseNDPMessage(msg, net.ParseIP("fe80::1"), nil, 255)
+	if err != nil || info == nil {
+		t.Fatalf("Failed to parse Router Advertisement: %v", err)
+	}
+	if ip, boundMAC := info.Binding(); ip != "fe80::1" || boundMAC != mac || !info.Router {
+		t.Errorf("Expected the router's binding, got %s at %s", ip, boundMAC)
+	}
+
+	advert := info.Advert
+	if advert == nil {
+		t.Fatal("Expected the advertisement")
+	}
+	if advert.RouterIP != "fe80::1" || advert.RouterMAC != mac || advert.HopLimit != 64 || !advert.Managed ||
+		advert.OtherConfig || advert.Preference != "high" || advert.Lifetime != 30*time.Minute || advert.MTU != 1500 {
+		t.Errorf("Unexpected advertisement %+v", advert)
+	}
+	if len(advert.Prefixes) != 1 {
+		t.Fatalf("Expected one prefix, got %+v", advert.Prefixes)
+	}
+	if p := advert.Prefixes[0]; p.Prefix != "2001:db8:1::/64" || !p.OnLink || !p.Autonomous ||
+		p.ValidLifetime != 24*time.Hour || p.PreferredLifetime != 4*time.Hour {
+		t.Errorf("Unexpected prefix %+v", p)
+	}
+	if len(advert.DNSServers) != 1 || advert.DNSServers[0] != "2001:db8:1::53" {
+		t.Errorf("Expected the RDNSS server, got %v", advert.DNSServers)
+	}
+
+	want := "2001:db8:1::/64, default router (high), M, MTU 1500, DNS 2001:db8:1::53"
+	if got := FormatRouterAdvertisement(advert); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
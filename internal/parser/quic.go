@@ -0,0 +1,340 @@
+/**
+ * QUIC Initial Packet Parser.
+ *
+ * Removes the protection from QUIC v1 and v2 Initial packets, whose keys
+ * are derived from the client's Destination Connection ID and so are
+ * known to any observer, and returns the CRYPTO frames they carry. The
+ * TLS Client Hello and Server Hello travel in those frames, giving QUIC
+ * flows (HTTP/3) the same SNI, ALPN and fingerprints as TLS over TCP.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package parser
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+// QUIC versions whose Initial packets can be decrypted.
+const (
+	QUICVersion1 uint32 = 0x00000001 // RFC 9000
+	QUICVersion2 uint32 = 0x6b3343cf // RFC 9369
+	QUICDraft29  uint32 = 0xff00001d // Final draft, still sent by older clients
+)
+
+// Salts the Initial secrets are extracted with (RFC 9001 section 5.2, RFC 9369 section
+// 3.3.1, draft-ietf-quic-tls-29 section 5.2).
+var (
+	quicV1Salt = []byte{0x38, 0x76, 0x2c, 0xf7, 0xf5, 0x59, 0x34, 0xb3, 0x4d, 0x17,
+		0x9a, 0xe6, 0xa4, 0xc8, 0x0c, 0xad, 0xcc, 0xbb, 0x7f, 0x0a}
+	quicV2Salt = []byte{0x0d, 0xed, 0xe3, 0xde, 0xf7, 0x00, 0xa6, 0xdb, 0x81, 0x93,
+		0x81, 0xbe, 0x6e, 0x26, 0x9d, 0xcb, 0xf9, 0xbd, 0x2e, 0xd9}
+	quicDraft29Salt = []byte{0xaf, 0xbf, 0xec, 0x28, 0x99, 0x93, 0xd2, 0x4c, 0x9e, 0x97,
+		0x86, 0xf1, 0x9c, 0x61, 0x11, 0xe0, 0x43, 0x90, 0xa8, 0x99}
+)
+
+// Names of the QUIC versions whose packets are parsed.
+var quicVersionNames = map[uint32]string{
+	QUICVersion1: "QUIC v1",
+	QUICVersion2: "QUIC v2",
+	QUICDraft29:  "QUIC draft-29",
+}
+
+// Returns the name of a QUIC version, or its hex value when not listed.
+func QUICVersionName(version uint32) string {
+	if name, ok := quicVersionNames[version]; ok {
+		return name
+	}
+	return fmt.Sprintf("QUIC 0x%08x", version)
+}
+
+// Holds the long header fields of the first packet in a QUIC datagram.
+type QUICHeader struct {
+	Version uint32
+	DCID    []byte // Destination Connection ID
+	SCID    []byte // Source Connection ID
+	Initial bool   // The packet is an Initial
+}
+
+// Holds the CRYPTO frames of one decrypted Initial packet.
+type QUICInitial struct {
+	PacketNumber uint64
+	Crypto       []QUICCryptoFrame
+}
+
+// A piece of the TLS handshake stream at the given offset.
+type QUICCryptoFrame struct {
+	Offset uint64
+	Data   []byte
+}
+
+// Parses the long header that starts a QUIC datagram. Returns nil for short header
+// packets, for versions not listed, and for anything that is not QUIC.
+func ParseQUICHeader(datagram []byte) *QUICHeader {
+	defer recoverMalformed("quic header", nil)
+	header, _, _ := parseQUICLongHeader(datagram)
+	return header
+}
+
+// Decrypts the Initial packets coalesced in a datagram with the keys derived from
+// dcid, the Destination Connection ID of the client's first Initial. fromServer
+// selects the server's keys. Packets of other types are skipped; an Initial that
+// fails to authenticate ends the datagram with an error.
+func DecryptQUICInitials(datagram, dcid []byte, fromServer bool) (_ []*QUICInitial, err error) {
+	defer recoverMalformed("quic datagram", &err)
+	var (
+		initials []*QUICInitial
+		keys     *quicKeys
+	)
+	for len(datagram) > 0 {
+		header, pnOffset, end := parseQUICLongHeader(datagram)
+		if header == nil || end == 0 {
+			break // Short header or Retry: the rest cannot be read
+		}
+		packet := datagram[:end]
+		datagram = datagram[end:]
+		if !header.Initial {
+			continue
+		}
+
+		if keys == nil {
+			var err error
+			if keys, err = quicInitialKeys(header.Version, dcid, fromServer); err != nil {
+				return initials, err
+			}
+		}
+		initial, err := keys.open(packet, pnOffset)
+		if err != nil {
+			return initials, err
+		}
+		initials = append(initials, initial)
+	}
+	return initials, nil
+}
+
+// Parses a long header. Returns the header, the offset of an Initial's packet number
+// and the length of the whole packet; the length is 0 for a Retry, which runs to the
+// end of the datagram, and for a truncated packet.
+func parseQUICLongHeader(data []byte) (*QUICHeader, int, int) {
+	// Header form (long) and fixed bit, version, DCID length
+	if len(data) < 7 || data[0]&0xc0 != 0xc0 {
+		return nil, 0, 0
+	}
+	header := &QUICHeader{Version: binary.BigEndian.Uint32(data[1:5])}
+	if _, ok := quicVersionNames[header.Version]; !ok {
+		return nil, 0, 0 // Version Negotiation, or a layout not known
+	}
+
+	offset := 5
+	dcidLen := int(data[offset])
+	if dcidLen > 20 || offset+1+dcidLen >= len(data) {
+		return nil, 0, 0
+	}
+	header.DCID = data[offset+1 : offset+1+dcidLen]
+	offset += 1 + dcidLen
+	scidLen := int(data[offset])
+	if scidLen > 20 || offset+1+scidLen > len(data) {
+		return nil, 0, 0
+	}
+	header.SCID = data[offset+1 : offset+1+scidLen]
+	offset += 1 + scidLen
+
+	// Version 2 renumbered the long header packet types
+	initialType, retryType := byte(0), byte(3)
+	if header.Version == QUICVersion2 {
+		initialType, retryType = 1, 0
+	}
+	packetType := data[0] >> 4 & 0x03
+	if packetType == retryType {
+		return header, 0, 0
+	}
+	header.Initial = packetType == initialType
+
+	if header.Initial {
+		tokenLen, n := readQUICVarint(data[offset:])
+		if n == 0 || uint64(len(data)-offset-n) < tokenLen {
+			return header, 0, 0
+		}
+		offset += n + int(tokenLen)
+	}
+	length, n := readQUICVarint(data[offset:])
+	if n == 0 || uint64(len(data)-offset-n) < length {
+		return header, 0, 0
+	}
+	offset += n
+	return header, offset, offset + int(length)
+}
+
+// Packet protection keys for one direction of the Initial packets.
+type quicKeys struct {
+	aead cipher.AEAD
+	iv   []byte
+	hp   cipher.Block
+}
+
+// Derives the Initial keys of a direction from the client's first Destination Connection ID.
+func quicInitialKeys(version uint32, dcid []byte, fromServer bool) (*quicKeys, error) {
+	key, iv, hpKey := quicInitialSecrets(version, dcid, fromServer)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Initial cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Initial AEAD: %w", err)
+	}
+	hp, err := aes.NewCipher(hpKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create header protection cipher: %w", err)
+	}
+	return &quicKeys{aead: aead, iv: iv, hp: hp}, nil
+}
+
+// Returns the packet protection key, IV and header protection key of a direction's
+// Initial packets (RFC 9001 section 5.2).
+func quicInitialSecrets(version uint32, dcid []byte, fromServer bool) (key, iv, hp []byte) {
+	salt, prefix := quicV1Salt, "quic "
+	switch version {
+	case QUICVersion2:
+		salt, prefix = quicV2Salt, "quicv2 "
+	case QUICDraft29:
+		salt = quicDraft29Salt
+	}
+	label := "client in"
+	if fromServer {
+		label = "server in"
+	}
+	secret := hkdfExpandLabel(hkdfExtract(salt, dcid), label, 32)
+	return hkdfExpandLabel(secret, prefix+"key", 16), hkdfExpandLabel(secret, prefix+"iv", 12),
+		hkdfExpandLabel(secret, prefix+"hp", 16)
+}
+
+// Removes header protection from an Initial packet and decrypts its payload. The
+// captured bytes are left untouched.
+func (k *quicKeys) open(packet []byte, pnOffset int) (*QUICInitial, error) {
+	// The header protection sample starts 4 bytes past the packet number offset
+	if pnOffset+4+16 > len(packet) {
+		return nil, fmt.Errorf("initial packet too short")
+	}
+	mask := make([]byte, 16)
+	k.hp.Encrypt(mask, packet[pnOffset+4:pnOffset+4+16])
+
+	header := append([]byte(nil), packet[:pnOffset+4]...)
+	header[0] ^= mask[0] & 0x0f
+	pnLen := int(header[0]&0x03) + 1
+	var pn uint64
+	for i := 0; i < pnLen; i++ {
+		header[pnOffset+i] ^= mask[1+i]
+		pn = pn<<8 | uint64(header[pnOffset+i])
+	}
+	header = header[:pnOffset+pnLen]
+
+	// Initial packet numbers start at zero, so the truncated number is the full one
+	nonce := append([]byte(nil), k.iv...)
+	for i := 0; i < 8; i++ {
+		nonce[len(nonce)-1-i] ^= byte(pn >> (8 * i))
+	}
+	payload, err := k.aead.Open(nil, nonce, packet[pnOffset+pnLen:], header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt Initial packet: %w", err)
+	}
+	return &QUICInitial{PacketNumber: pn, Crypto: parseQUICFrames(payload)}, nil
+}
+
+// Collects the CRYPTO frames of a decrypted Initial payload, stopping at a frame that
+// may not appear in one.
+func parseQUICFrames(payload []byte) []QUICCryptoFrame {
+	var frames []QUICCryptoFrame
+	for len(payload) > 0 {
+		frameType, n := readQUICVarint(payload)
+		if n == 0 {
+			break
+		}
+		payload = payload[n:]
+
+		switch frameType {
+		case 0x00, 0x01: // PADDING, PING
+		case 0x02, 0x03: // ACK: largest, delay, range count, first range, then ranges and ECN counts
+			var fields [4]uint64
+			for i := range fields {
+				if fields[i], n = readQUICVarint(payload); n == 0 {
+					return frames
+				}
+				payload = payload[n:]
+			}
+			skip := 2 * fields[2]
+			if frameType == 0x03 {
+				skip += 3
+			}
+			for ; skip > 0; skip-- {
+				if _, n = readQUICVarint(payload); n == 0 {
+					return frames
+				}
+				payload = payload[n:]
+			}
+		case 0x06: // CRYPTO: offset, length, data
+			offset, n := readQUICVarint(payload)
+			if n == 0 {
+				return frames
+			}
+			length, m := readQUICVarint(payload[n:])
+			if m == 0 || uint64(len(payload)-n-m) < length {
+				return frames
+			}
+			frames = append(frames, QUICCryptoFrame{Offset: offset, Data: payload[n+m : n+m+int(length)]})
+			payload = payload[n+m+int(length):]
+		default: // CONNECTION_CLOSE ends the packet; anything else is not allowed
+			return frames
+		}
+	}
+	return frames
+}
+
+// Reads a variable-length integer. Returns the value and its length, 0 when truncated.
+func readQUICVarint(data []byte) (uint64, int) {
+	if len(data) == 0 {
+		return 0, 0
+	}
+	length := 1 << (data[0] >> 6)
+	if len(data) < length {
+		return 0, 0
+	}
+	value := uint64(data[0] & 0x3f)
+	for _, b := range data[1:length] {
+		value = value<<8 | uint64(b)
+	}
+	return value, length
+}
+
+// HKDF-Extract with SHA-256 (RFC 5869).
+func hkdfExtract(salt, secret []byte) []byte {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write(secret)
+	return mac.Sum(nil)
+}
+
+// HKDF-Expand-Label with SHA-256 and an empty context (RFC 8446 section 7.1).
+func hkdfExpandLabel(secret []byte, label string, length int) []byte {
+	label = "tls13 " + label
+	info := []byte{byte(length >> 8), byte(length), byte(len(label))}
+	info = append(info, label...)
+	info = append(info, 0) // Context length
+
+	var out, block []byte
+	for counter := byte(1); len(out) < length; counter++ {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(block)
+		mac.Write(info)
+		mac.Write([]byte{counter})
+		block = mac.Sum(nil)
+		out = append(out, block...)
+	}
+	return out[:length]
+}
@@ -0,0 +1,172 @@
+/**
+ * QUIC Initial Parser Tests.
+ *
+ * Validates Initial key derivation against the RFC 9001 and RFC 9369 test
+ * vectors, and that protected Initial packets are decrypted into the
+ * CRYPTO frames carrying the TLS hellos.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package parser
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// Builds a protected Initial packet carrying frames, padded to at least pad bytes.
+func sealQUICInitial(tb testing.TB, version uint32, keyDCID, dcid, scid []byte, fromServer bool, pn uint16, frames []byte, pad int) []byte {
+	tb.Helper()
+	packetType := byte(0)
+	if version == QUICVersion2 {
+		packetType = 1
+	}
+	header := []byte{0xc0 | packetType<<4 | 0x01} // Two-byte packet number
+	header = binary.BigEndian.AppendUint32(header, version)
+	header = append(header, byte(len(dcid)))
+	header = append(header, dcid...)
+	header = append(header, byte(len(scid)))
+	header = append(header, scid...)
+	header = append(header, 0) // Token length
+
+	if len(frames) < pad {
+		frames = append(frames, make([]byte, pad-len(frames))...) // PADDING
+	}
+	header = binary.BigEndian.AppendUint16(header, 0x4000|uint16(2+len(frames)+16))
+	pnOffset := len(header)
+	header = binary.BigEndian.AppendUint16(header, pn)
+
+	key, iv, hpKey := quicInitialSecrets(version, keyDCID, fromServer)
+	block, _ := aes.NewCipher(key)
+	aead, _ := cipher.NewGCM(block)
+	nonce := append([]byte(nil), iv...)
+	nonce[len(nonce)-2] ^= byte(pn >> 8)
+	nonce[len(nonce)-1] ^= byte(pn)
+	packet := aead.Seal(append([]byte(nil), header...), nonce, frames, header)
+
+	hp, _ := aes.NewCipher(hpKey)
+	mask := make([]byte, 16)
+	hp.Encrypt(mask, packet[pnOffset+4:pnOffset+20])
+	packet[0] ^= mask[0] & 0x0f
+	packet[pnOffset] ^= mask[1]
+	packet[pnOffset+1] ^= mask[2]
+	return packet
+}
+
+// Encodes a CRYPTO frame with two-byte variable-length offset and length.
+func cryptoFrame(offset int, data []byte) []byte {
+	frame := []byte{0x06}
+	frame = binary.BigEndian.AppendUint16(frame, 0x4000|uint16(offset))
+	frame = binary.BigEndian.AppendUint16(frame, 0x4000|uint16(len(data)))
+	return append(frame, data...)
+}
+
+// Verifies the Initial keys against the test vectors of RFC 9001 Appendix A.1 and
+// RFC 9369 Appendix A.1.
+func TestQUICInitialSecrets(t *testing.T) {
+	dcid, _ := hex.DecodeString("8394c8f03e515708")
+	tests := []struct {
+		name       string
+		version    uint32
+		fromServer bool
+		key, iv    string
+		hp         string
+	}{
+		{"v1 client", QUICVersion1, false, "1f369613dd76d5467730efcbe3b1a22d", "fa044b2f42a3fd3b46fb255c", "9f50449e04a0e810283a1e9933adedd2"},
+		{"v1 server", QUICVersion1, true, "cf3a5331653c364c88f0f379b6067e37", "0ac1493ca1905853b0bba03e", "c206b8d9b9f0f37644430b490eeaa314"},
+		{"v2 client", QUICVersion2, false, "8b1a0bc121284290a29e0971b5cd045d", "91f73e2351d8fa91660e909f", "45b95e15235d6f45a6b19cbcb0294ba9"},
+		{"v2 server", QUICVersion2, true, "82db637861d55e1d011f19ea71d5d2a7", "dd13c276499c0249d3310652", "edf6d05c83121201b436e16877593c3a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, iv, hp := quicInitialSecrets(tt.version, dcid, tt.fromServer)
+			if hex.EncodeToString(key) != tt.key || hex.EncodeToString(iv) != tt.iv || hex.EncodeToString(hp) != tt.hp {
+				t.Errorf("Expected key %s, iv %s, hp %s, got %x, %x, %x", tt.key, tt.iv, tt.hp, key, iv, hp)
+			}
+		})
+	}
+}
+
+// Verifies that Initial packets are decrypted into their CRYPTO frames, coalesced
+// packets of other types are skipped, and the Client Hello they carry is parsed with
+// a QUIC JA4 and no record version.
+func TestDecryptQUICInitials(t *testing.T) {
+	dcid, _ := hex.DecodeString("8394c8f03e515708")
+	scid := []byte{0xc1, 0x01}
+	alpn := tlsExtension(16, 0, 3, 2, 'h', '3')
+	sni := tlsExtension(0, append([]byte{0, 14, 0, 0, 11}, "example.com"...)...)
+	versions := tlsExtension(43, 2, 0x03, 0x04)
+	hello := buildClientHelloRecord([]uint16{0x1301}, sni, alpn, versions)[5:]
+
+	for _, version := range []uint32{QUICVersion1, QUICVersion2} {
+		t.Run(QUICVersionName(version), func(t *testing.T) {
+			// The hello split over two CRYPTO frames, the second sent first
+			frames := append(cryptoFrame(20, hello[20:]), cryptoFrame(0, hello[:20])...)
+			datagram := sealQUICInitial(t, version, dcid, dcid, scid, false, 0, frames, 1162)
+			// A coalesced Handshake packet, which the Initial keys cannot open
+			handshake := []byte{0xe0, 0, 0, 0, 0, 0, 0, 5, 1, 2, 3, 4, 5} // Empty connection IDs
+			if version == QUICVersion2 {
+				handshake[0] = 0xf0 // Version 2 renumbered the Handshake type
+			}
+			binary.BigEndian.PutUint32(handshake[1:5], version)
+			datagram = append(datagram, handshake...)
+
+			header := ParseQUICHeader(datagram)
+			if header == nil || header.Version != version || !header.Initial || hex.EncodeToString(header.DCID) != "8394c8f03e515708" {
+				t.Fatalf("Expected an Initial header, got %+v", header)
+			}
+			initials, err := DecryptQUICInitials(datagram, dcid, false)
+			if err != nil || len(initials) != 1 || len(initials[0].Crypto) != 2 {
+				t.Fatalf("Expected one Initial with two CRYPTO frames, got %v, %+v", err, initials)
+			}
+			if frame := initials[0].Crypto[1]; frame.Offset != 0 || string(frame.Data) != string(hello[:20]) {
+				t.Errorf("Expected the first 20 bytes at offset 0, got %+v", frame)
+			}
+
+			info, _ := ParseQUICHandshake(hello)
+			if info == nil || info.SNI != "example.com" || strings.Join(info.ALPN, ",") != "h3" || info.RecordVersion != "" {
+				t.Fatalf("Expected the Client Hello with ALPN h3, got %+v", info)
+			}
+			if !strings.HasPrefix(info.JA4, "q13d0103h3_") {
+				t.Errorf("Expected a QUIC JA4, got %s", info.JA4)
+			}
+
+			if _, err := DecryptQUICInitials(datagram, dcid, true); err == nil {
+				t.Error("Expected the server's keys to fail on a client Initial")
+			}
+
+			// The server addresses the client's SCID but keys with the client's first DCID
+			serverHello := buildServerHello(0x0303, 0x1301, tlsExtension(43, 0x03, 0x04))[5:]
+			ack := []byte{0x02, 0, 0, 0, 0} // Largest 0, delay 0, no further ranges
+			datagram = sealQUICInitial(t, version, dcid, scid, nil, true, 0, append(ack, cryptoFrame(0, serverHello)...), 0)
+			initials, err = DecryptQUICInitials(datagram, dcid, true)
+			if err != nil || len(initials) != 1 || len(initials[0].Crypto) != 1 {
+				t.Fatalf("Expected the server Initial's CRYPTO frame after its ACK, got %v, %+v", err, initials)
+			}
+			info, _ = ParseQUICHandshake(initials[0].Crypto[0].Data)
+			if info == nil || !info.ServerHello || info.Version != "TLS 1.3" || !strings.HasPrefix(info.JA4S, "q13") {
+				t.Errorf("Expected the Server Hello with a QUIC JA4S, got %+v", info)
+			}
+		})
+	}
+
+	t.Run("not QUIC", func(t *testing.T) {
+		for _, datagram := range [][]byte{
+			{0x40, 1, 2, 3, 4, 5, 6, 7},                // Short header
+			{0xc0, 0, 0, 0, 0, 8, 1, 2, 3, 4, 5, 6},    // Version Negotiation
+			{0xc0, 0x51, 0x30, 0x35, 0x30, 0, 0, 0, 0}, // Google QUIC
+			{0xc0, 0, 0, 0, 1, 21, 0, 0, 0},            // Connection ID too long
+		} {
+			if header := ParseQUICHeader(datagram); header != nil {
+				t.Errorf("Expected no header for % x, got %+v", datagram, header)
+			}
+		}
+	})
+}
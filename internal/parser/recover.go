@@ -0,0 +1,58 @@
+/**
+ * Malformed Input Recovery.
+ *
+ * Parsers read bytes straight off the wire, and some of the gopacket layers
+ * they build on index past short input. Every entry point that takes packet
+ * bytes turns such a panic into an error, so one malformed packet cannot end
+ * a capture. The stack is logged, at most once a minute, so the bug behind
+ * the panic can still be found.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package parser
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// Least time between two logged panics; those in between are only counted.
+const panicLogInterval = time.Minute
+
+var (
+	lastPanicLog     atomic.Int64  // Unix nanoseconds of the last logged panic
+	suppressedPanics atomic.Uint64 // Panics recovered since then without being logged
+)
+
+// Recovers a panic raised while parsing a malformed what and reports it through err,
+// when err is not nil. Entry points defer it directly, as recover requires.
+func recoverMalformed(what string, err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	if err != nil {
+		*err = fmt.Errorf("malformed %s: %v", what, r)
+	}
+	logPanic(what, r)
+}
+
+// Logs a recovered panic with its stack, unless another was logged within the interval.
+func logPanic(what string, r interface{}) {
+	now := time.Now().UnixNano()
+	last := lastPanicLog.Load()
+	if now-last < int64(panicLogInterval) || !lastPanicLog.CompareAndSwap(last, now) {
+		suppressedPanics.Add(1)
+		return
+	}
+	suppressed := ""
+	if n := suppressedPanics.Swap(0); n > 0 {
+		suppressed = fmt.Sprintf(" (%d more since the last report)", n)
+	}
+	log.Printf("Recovered from a panic parsing a malformed %s%s: %v\n%s", what, suppressed, r, debug.Stack())
+}
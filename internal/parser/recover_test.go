@@ -0,0 +1,42 @@
+/**
+ * Malformed Input Recovery Tests.
+ *
+ * Verifies that a panic inside a parser entry point comes back as an error
+ * with the result left empty, and that repeated panics are counted rather
+ * than each logging a stack.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+// Stands in for an entry point whose parsing indexes past its input.
+func parseOverrun(data []byte) (_ *TLSInfo, err error) {
+	defer recoverMalformed("test message", &err)
+	info := &TLSInfo{}
+	info.SNI = string(data[:len(data)+1])
+	return info, nil
+}
+
+// Verifies that a recovered panic yields an error and no partial result, and that a
+// second panic within the log interval is only counted.
+func TestRecoverMalformed(t *testing.T) {
+	info, err := parseOverrun([]byte{1, 2})
+	if info != nil || err == nil || !strings.HasPrefix(err.Error(), "malformed test message: ") {
+		t.Fatalf("Expected a malformed message error and no result, got %+v, %v", info, err)
+	}
+
+	before := suppressedPanics.Load()
+	if _, err := parseOverrun(nil); err == nil {
+		t.Fatal("Expected the second panic to be recovered too")
+	}
+	if suppressedPanics.Load() != before+1 {
+		t.Error("Expected a panic within the log interval to be counted instead of logged")
+	}
+}
@@ -0,0 +1,218 @@
+/**
+ * SSH Protocol Parser.
+ *
+ * Parses the cleartext start of an SSH connection: the identification
+ * line each side sends first ("SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13")
+ * and the KEXINIT message listing the algorithms it supports. The lists
+ * in a client's KEXINIT fingerprint its SSH library as HASSH, and those
+ * in a server's as HASSHServer, so tools built on Go's x/crypto/ssh or
+ * Paramiko stand out even when they claim another name.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package parser
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+const (
+	// Identification lines are at most 255 bytes including CR LF (RFC 4253 section 4.2)
+	MaxSSHBanner = 255
+
+	// Binary packets a peer must accept, and so the most a KEXINIT is expected to need
+	// (RFC 4253 section 6.1)
+	MaxSSHPacket = 35000
+
+	sshMsgKexInit = 20
+)
+
+// Holds what one side of an SSH connection revealed before encryption started.
+type SSHInfo struct {
+	Client   bool   // Sent by the client; set by the caller, which knows the connection's direction
+	Banner   string // Identification line without CR LF, empty when only a KEXINIT was seen
+	Protocol string // "2.0", or "1.99" for servers also speaking SSH 1
+	Software string // e.g. "OpenSSH_9.6p1"
+	Comments string // e.g. "Ubuntu-3ubuntu13"
+
+	KexInit *SSHKexInit // nil until the side's KEXINIT is seen
+}
+
+// Holds the algorithm name-lists of a KEXINIT message, each in preference order.
+type SSHKexInit struct {
+	KexAlgorithms     []string
+	HostKeyAlgorithms []string
+	EncryptionC2S     []string
+	EncryptionS2C     []string
+	MACC2S            []string
+	MACS2C            []string
+	CompressionC2S    []string
+	CompressionS2C    []string
+	FirstKexFollows   bool
+}
+
+// Parses an identification line, without or with its CR LF. Returns nil when the line
+// is not an SSH identification.
+func ParseSSHBanner(line []byte) *SSHInfo {
+	line = bytes.TrimRight(line, "\r\n")
+	if !bytes.HasPrefix(line, []byte("SSH-")) || len(line) > MaxSSHBanner-2 {
+		return nil
+	}
+
+	banner := string(line)
+	protocol, rest, ok := strings.Cut(banner[4:], "-")
+	if !ok || protocol == "" || rest == "" {
+		return nil
+	}
+	software, comments, _ := strings.Cut(rest, " ")
+	return &SSHInfo{Banner: banner, Protocol: protocol, Software: software, Comments: comments}
+}
+
+// Splits one binary packet from the front of data. Returns the packet's payload and
+// the bytes it occupies, 0 until the packet is whole, or an error when the framing
+// is not SSH's. Only packets sent before encryption starts can be framed this way.
+func ParseSSHPacket(data []byte) (payload []byte, n int, err error) {
+	defer recoverMalformed("ssh packet", &err)
+	if len(data) < 5 {
+		return nil, 0, nil
+	}
+	length := int(binary.BigEndian.Uint32(data))
+	padding := int(data[4])
+	if length > MaxSSHPacket || padding < 4 || padding+1 > length {
+		return nil, 0, fmt.Errorf("invalid ssh packet length %d with %d padding bytes", length, padding)
+	}
+	if len(data) < 4+length {
+		return nil, 0, nil
+	}
+	return data[5 : 4+length-padding], 4 + length, nil
+}
+
+// Parses the payload of a KEXINIT message: the message code, a 16 byte cookie, ten
+// name-lists, the first_kex_packet_follows flag and a reserved word.
+func ParseSSHKexInit(payload []byte) (_ *SSHKexInit, err error) {
+	defer recoverMalformed("ssh kexinit", &err)
+	if len(payload) < 17 || payload[0] != sshMsgKexInit {
+		return nil, fmt.Errorf("not a kexinit message")
+	}
+	data := payload[17:]
+
+	var lists [10][]string
+	for i := range lists {
+		if len(data) < 4 {
+			return nil, fmt.Errorf("kexinit truncated in name-list %d", i)
+		}
+		length := binary.BigEndian.Uint32(data)
+		if uint32(len(data)-4) < length {
+			return nil, fmt.Errorf("kexinit name-list %d overruns the message", i)
+		}
+		if names := string(data[4 : 4+length]); names != "" {
+			lists[i] = strings.Split(names, ",")
+		}
+		data = data[4+length:]
+	}
+	if len(data) < 5 {
+		return nil, fmt.Errorf("kexinit truncated after the name-lists")
+	}
+
+	return &SSHKexInit{
+		KexAlgorithms:     lists[0],
+		HostKeyAlgorithms: lists[1],
+		EncryptionC2S:     lists[2],
+		EncryptionS2C:     lists[3],
+		MACC2S:            lists[4],
+		MACS2C:            lists[5],
+		CompressionC2S:    lists[6],
+		CompressionS2C:    lists[7],
+		// Languages (lists 8 and 9) are always empty in practice and not fingerprinted
+		FirstKexFollows: data[0] != 0,
+	}, nil
+}
+
+// Extracts SSH information from a TCP payload that has already been decoded: an
+// identification line, a KEXINIT packet, or a line followed by its KEXINIT. Returns
+// nil when the payload starts with neither. The caller sets Client.
+func ParseSSHPayload(payload []byte) (_ *SSHInfo, err error) {
+	defer recoverMalformed("ssh payload", &err)
+	info := &SSHInfo{}
+	if bytes.HasPrefix(payload, []byte("SSH-")) {
+		end := bytes.IndexByte(payload, '\n')
+		if end < 0 {
+			return nil, nil // Line cut off by the end of the segment
+		}
+		if info = ParseSSHBanner(payload[:end]); info == nil {
+			return nil, nil
+		}
+		payload = payload[end+1:]
+		if len(payload) == 0 {
+			return info, nil
+		}
+	}
+
+	message, n, err := ParseSSHPacket(payload)
+	if n == 0 || err != nil || len(message) == 0 || message[0] != sshMsgKexInit {
+		if info.Banner != "" {
+			return info, nil
+		}
+		return nil, nil // Not SSH, or a packet this parser does not follow
+	}
+	kex, err := ParseSSHKexInit(message)
+	if err != nil {
+		if info.Banner != "" {
+			return info, nil
+		}
+		return nil, err
+	}
+	info.KexInit = kex
+	return info, nil
+}
+
+// Returns the HASSH of a client's KEXINIT or the HASSHServer of a server's, empty
+// until the KEXINIT is seen.
+func (info *SSHInfo) HASSH() string {
+	algorithms := info.HASSHAlgorithms()
+	if algorithms == "" {
+		return ""
+	}
+	return fmt.Sprintf("%x", md5.Sum([]byte(algorithms)))
+}
+
+// Returns the string HASSH hashes: the key exchange, encryption, MAC and compression
+// lists the side offered for its own direction, separated by semicolons.
+func (info *SSHInfo) HASSHAlgorithms() string {
+	k := info.KexInit
+	if k == nil {
+		return ""
+	}
+	encryption, mac, compression := k.EncryptionC2S, k.MACC2S, k.CompressionC2S
+	if !info.Client {
+		encryption, mac, compression = k.EncryptionS2C, k.MACS2C, k.CompressionS2C
+	}
+	return strings.Join([]string{
+		strings.Join(k.KexAlgorithms, ","),
+		strings.Join(encryption, ","),
+		strings.Join(mac, ","),
+		strings.Join(compression, ","),
+	}, ";")
+}
+
+// Returns a short human-readable summary, e.g. "Client OpenSSH_9.6p1 (SSH-2.0)".
+func (info *SSHInfo) Summary() string {
+	role := "Server"
+	if info.Client {
+		role = "Client"
+	}
+	if info.KexInit != nil {
+		hassh := "HASSHServer"
+		if info.Client {
+			hassh = "HASSH"
+		}
+		return fmt.Sprintf("%s KEXINIT (%s %s)", role, hassh, info.HASSH())
+	}
+	return fmt.Sprintf("%s %s (SSH-%s)", role, info.Software, info.Protocol)
+}
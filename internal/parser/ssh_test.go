@@ -0,0 +1,186 @@
+/**
+ * SSH Parser Tests.
+ *
+ * Validates parsing of SSH identification lines and KEXINIT messages,
+ * and the HASSH and HASSHServer strings built from them.
+ *
+ * Author: KleaSCM
+ * Email: KleaSCM@gmail.com
+ */
+
+package parser
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Builds a KEXINIT payload from the ten name-lists, comma-joined.
+func buildKexInit(lists [10]string, firstKexFollows bool) []byte {
+	msg := append([]byte{sshMsgKexInit}, make([]byte, 16)...) // Message code, cookie
+	for _, list := range lists {
+		msg = binary.BigEndian.AppendUint32(msg, uint32(len(list)))
+		msg = append(msg, list...)
+	}
+	if firstKexFollows {
+		msg = append(msg, 1)
+	} else {
+		msg = append(msg, 0)
+	}
+	return append(msg, 0, 0, 0, 0) // Reserved
+}
+
+// Frames a payload as an unencrypted binary packet padded to a multiple of 8.
+func buildSSHPacket(payload []byte) []byte {
+	padding := 8 - (5+len(payload))%8
+	if padding < 4 {
+		padding += 8
+	}
+	packet := binary.BigEndian.AppendUint32(nil, uint32(1+len(payload)+padding))
+	packet = append(packet, byte(padding))
+	packet = append(packet, payload...)
+	return append(packet, make([]byte, padding)...)
+}
+
+// Name-lists in the shape of an OpenSSH client's KEXINIT.
+var testKexLists = [10]string{
+	"curve25519-sha256,ecdh-sha2-nistp256,ext-info-c",
+	"ssh-ed25519,rsa-sha2-512",
+	"chacha20-poly1305@openssh.com,aes128-ctr",
+	"aes256-gcm@openssh.com,aes128-ctr",
+	"umac-64-etm@openssh.com,hmac-sha2-256",
+	"hmac-sha2-512",
+	"none,zlib@openssh.com",
+	"none",
+	"",
+	"",
+}
+
+// Verifies that identification lines yield their protocol, software and comments,
+// and that other lines are rejected.
+func TestParseSSHBanner(t *testing.T) {
+	tests := []struct {
+		line     string
+		protocol string
+		software string
+		comments string
+	}{
+		{"SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13\r\n", "2.0", "OpenSSH_9.6p1", "Ubuntu-3ubuntu13"},
+		{"SSH-2.0-Go\r\n", "2.0", "Go", ""},
+		{"SSH-2.0-paramiko_3.4.0", "2.0", "paramiko_3.4.0", ""},
+		{"SSH-1.99-Cisco-1.25\n", "1.99", "Cisco-1.25", ""},
+		{"SSH-2.0-\r\n", "", "", ""},
+		{"HTTP/1.1 200 OK\r\n", "", "", ""},
+		{"SSH-2.0-" + strings.Repeat("x", MaxSSHBanner), "", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.TrimSpace(tt.line[:min(len(tt.line), 24)]), func(t *testing.T) {
+			info := ParseSSHBanner([]byte(tt.line))
+			if tt.software == "" {
+				if info != nil {
+					t.Errorf("Expected no banner, got %+v", info)
+				}
+				return
+			}
+			if info == nil {
+				t.Fatalf("Expected %s, got nothing", tt.software)
+			}
+			if info.Protocol != tt.protocol || info.Software != tt.software || info.Comments != tt.comments {
+				t.Errorf("Expected %s %s %q, got %s %s %q", tt.protocol, tt.software, tt.comments, info.Protocol, info.Software, info.Comments)
+			}
+			if info.Banner != strings.TrimRight(tt.line, "\r\n") {
+				t.Errorf("Expected the line without CR LF, got %q", info.Banner)
+			}
+		})
+	}
+}
+
+// Verifies that a KEXINIT yields its name-lists and that HASSH and HASSHServer hash
+// the lists for the sender's own direction.
+func TestParseSSHKexInit(t *testing.T) {
+	kex, err := ParseSSHKexInit(buildKexInit(testKexLists, true))
+	if err != nil {
+		t.Fatalf("Failed to parse KEXINIT: %v", err)
+	}
+	if !reflect.DeepEqual(kex.KexAlgorithms, []string{"curve25519-sha256", "ecdh-sha2-nistp256", "ext-info-c"}) ||
+		!reflect.DeepEqual(kex.CompressionS2C, []string{"none"}) || !kex.FirstKexFollows {
+		t.Errorf("Unexpected KEXINIT %+v", kex)
+	}
+
+	client := &SSHInfo{Client: true, KexInit: kex}
+	want := "curve25519-sha256,ecdh-sha2-nistp256,ext-info-c;chacha20-poly1305@openssh.com,aes128-ctr;umac-64-etm@openssh.com,hmac-sha2-256;none,zlib@openssh.com"
+	if got := client.HASSHAlgorithms(); got != want {
+		t.Errorf("Expected HASSH algorithms %q, got %q", want, got)
+	}
+	if got := client.HASSH(); got != fmt.Sprintf("%x", md5.Sum([]byte(want))) {
+		t.Errorf("Expected the MD5 of the algorithms, got %s", got)
+	}
+
+	server := &SSHInfo{KexInit: kex}
+	want = "curve25519-sha256,ecdh-sha2-nistp256,ext-info-c;aes256-gcm@openssh.com,aes128-ctr;hmac-sha2-512;none"
+	if got := server.HASSHAlgorithms(); got != want {
+		t.Errorf("Expected HASSHServer algorithms %q, got %q", want, got)
+	}
+	if (&SSHInfo{}).HASSH() != "" {
+		t.Error("Expected no HASSH without a KEXINIT")
+	}
+
+	t.Run("malformed", func(t *testing.T) {
+		msg := buildKexInit(testKexLists, false)
+		for name, bad := range map[string][]byte{
+			"other message":       append([]byte{21}, msg[1:]...),
+			"truncated name-list": msg[:40],
+			"missing reserved":    msg[:len(msg)-5],
+		} {
+			if _, err := ParseSSHKexInit(bad); err == nil {
+				t.Errorf("Expected %s to fail", name)
+			}
+		}
+	})
+}
+
+// Verifies that single segments yield a banner, a KEXINIT packet, or both.
+func TestParseSSHPayload(t *testing.T) {
+	packet := buildSSHPacket(buildKexInit(testKexLists, false))
+
+	tests := []struct {
+		name     string
+		payload  []byte
+		software string
+		kexInit  bool
+	}{
+		{"banner", []byte("SSH-2.0-OpenSSH_9.6p1\r\n"), "OpenSSH_9.6p1", false},
+		{"banner and kexinit", append([]byte("SSH-2.0-dropbear_2022.83\r\n"), packet...), "dropbear_2022.83", true},
+		{"kexinit", packet, "", true},
+		{"kexinit cut off", packet[:100], "", false},
+		{"banner cut off", []byte("SSH-2.0-Open"), "", false},
+		{"not ssh", []byte("\x00\x00\x00\x10binary"), "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, _ := ParseSSHPayload(tt.payload)
+			if tt.software == "" && !tt.kexInit {
+				if info != nil {
+					t.Errorf("Expected nothing, got %+v", info)
+				}
+				return
+			}
+			if info == nil {
+				t.Fatal("Expected SSH information, got nothing")
+			}
+			if info.Software != tt.software || (info.KexInit != nil) != tt.kexInit {
+				t.Errorf("Expected %q with KEXINIT %v, got %+v", tt.software, tt.kexInit, info)
+			}
+		})
+	}
+
+	if _, n, err := ParseSSHPacket([]byte{0, 1, 0, 0, 4}); n != 0 || err == nil {
+		t.Error("Expected an oversized packet length to fail")
+	}
+}
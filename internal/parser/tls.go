@@ -2,7 +2,9 @@
  * TLS Protocol Parser.
  *
  * Extracts unencrypted metadata from the TLS handshake, specifically the
- * Server Name Indication (SNI), to identify destination domains in encrypted traffic.
+ * Server Name Indication (SNI), to identify destination domains in encrypted traffic,
+ * the versions, protocols and algorithms the client offers, and the version and
+ * cipher suite the server negotiates in its Server Hello.
  *
  * Author: KleaSCM
  * Email: KleaSCM@gmail.com
@@ -12,18 +14,81 @@ package parser
 
 import (
 	"encoding/binary"
+	"fmt"
 
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
 )
 
-// Holds extracted TLS information.
+// Holds extracted TLS information from a Client Hello or a Server Hello.
 type TLSInfo struct {
 	SNI         string
 	Version     string
-	CipherSuite string
+	CipherSuite string // Selected by the server; empty for a Client Hello
 	Handshake   bool
-	JA3         string // JA3 fingerprint hash
+	ServerHello bool     // The handshake is a Server Hello rather than a Client Hello
+	JA3         string   // JA3 fingerprint hash (Client Hello)
+	JA3S        string   // JA3S fingerprint hash (Server Hello)
+	JA4         string   // JA4 fingerprint (Client Hello)
+	JA4S        string   // JA4S fingerprint (Server Hello)
+	Extensions  []uint16 // Extensions the server sent, in order (Server Hello)
+	ALPN        []string // Protocols offered (Client Hello) or the one selected (Server Hello)
+
+	// Client Hello only. Version is the highest version offered.
+	RecordVersion       string   // Version in the record header
+	LegacyVersion       string   // legacy_version field, the highest version before TLS 1.3
+	SupportedVersions   []string // Every version offered, highest first as sent
+	SupportedGroups     []string // Key exchange groups, in preference order
+	SignatureAlgorithms []string // In preference order
+	ECH                 bool     // Offers Encrypted Client Hello
+	GREASE              bool     // Sends GREASE values, as Chromium-based clients do
+}
+
+// Names of the protocol versions a handshake can negotiate.
+var tlsVersionNames = map[uint16]string{
+	0x0300: "SSL 3.0",
+	0x0301: "TLS 1.0",
+	0x0302: "TLS 1.1",
+	0x0303: "TLS 1.2",
+	0x0304: "TLS 1.3",
+}
+
+// Names of commonly negotiated cipher suites (IANA registry).
+var cipherSuiteNames = map[uint16]string{
+	0x002f: "TLS_RSA_WITH_AES_128_CBC_SHA",
+	0x0035: "TLS_RSA_WITH_AES_256_CBC_SHA",
+	0x009c: "TLS_RSA_WITH_AES_128_GCM_SHA256",
+	0x009d: "TLS_RSA_WITH_AES_256_GCM_SHA384",
+	0x1301: "TLS_AES_128_GCM_SHA256",
+	0x1302: "TLS_AES_256_GCM_SHA384",
+	0x1303: "TLS_CHACHA20_POLY1305_SHA256",
+	0xc009: "TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA",
+	0xc00a: "TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA",
+	0xc013: "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA",
+	0xc014: "TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA",
+	0xc027: "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256",
+	0xc02b: "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+	0xc02c: "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+	0xc02f: "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+	0xc030: "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+	0xcca8: "TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256",
+	0xcca9: "TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256",
+}
+
+// Returns the name of a protocol version, or its hex value when unknown.
+func TLSVersionName(version uint16) string {
+	if name, ok := tlsVersionNames[version]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%04x", version)
+}
+
+// Returns the IANA name of a cipher suite, or its hex value when not listed.
+func CipherSuiteName(suite uint16) string {
+	if name, ok := cipherSuiteNames[suite]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%04x", suite)
 }
 
 // Extracts TLS information from a packet.
@@ -35,8 +100,33 @@ func ParseTLS(packet gopacket.Packet) (*TLSInfo, error) {
 	}
 
 	tcp, _ := tcpLayer.(*layers.TCP)
-	payload := tcp.Payload
+	return ParseTLSPayload(tcp.Payload)
+}
+
+// Extracts TLS information from a TCP payload that has already been decoded.
+func ParseTLSPayload(payload []byte) (_ *TLSInfo, err error) {
+	defer recoverMalformed("tls record", &err)
+	return parseTLSRecord(payload, JA4OverTCP)
+}
 
+// Extracts TLS information from a Client Hello or Server Hello message reassembled
+// from QUIC CRYPTO frames. QUIC carries handshake messages without TLS records, so
+// RecordVersion is left empty.
+func ParseQUICHandshake(msg []byte) (_ *TLSInfo, err error) {
+	defer recoverMalformed("quic handshake", &err)
+	if len(msg) > 0xffff {
+		return nil, nil // Too long to be a hello
+	}
+	record := append([]byte{22, 3, 1, byte(len(msg) >> 8), byte(len(msg))}, msg...)
+	info, err := parseTLSRecord(record, JA4OverQUIC)
+	if info != nil {
+		info.RecordVersion = ""
+	}
+	return info, err
+}
+
+// Extracts TLS information from a handshake record; transport is the first JA4 character.
+func parseTLSRecord(payload []byte, transport byte) (*TLSInfo, error) {
 	if len(payload) < 5 {
 		return nil, nil // Too short for TLS record header
 	}
@@ -59,123 +149,73 @@ func ParseTLS(packet gopacket.Packet) (*TLSInfo, error) {
 	if int(recordLen)+5 > len(payload) {
 		return nil, nil // Incomplete record
 	}
+	if recordLen < 4 {
+		return nil, nil // Too short for a handshake message header
+	}
 
 	// Handshake Message
 	// Handshake Type (1 byte)
 	handshakeType := payload[5]
+	if handshakeType == 2 {
+		return parseServerHello(payload, transport), nil
+	}
 	if handshakeType != 1 {
 		return nil, nil // Not Client Hello
 	}
 
-	// Skip Handshake Header (4 bytes: type + 3 bytes length)
-	// payload[5] = type
-	// payload[6:9] = length
-	// payload[9:11] = client version
-	// payload[11:43] = random (32 bytes)
-
-	offset := 5 + 4 // Start of ClientHello body
-	if offset+2 > len(payload) {
-		return nil, nil
-	}
-
-	// Client Version
-	// clientVersion := binary.BigEndian.Uint16(payload[offset : offset+2])
-	offset += 2
-
-	// Random
-	offset += 32
-	if offset > len(payload) {
-		return nil, nil
-	}
-
-	// Session ID
-	if offset+1 > len(payload) {
-		return nil, nil
-	}
-	sessionIDLen := int(payload[offset])
-	offset += 1 + sessionIDLen
-	if offset > len(payload) {
+	hello := parseClientHello(payload)
+	if hello == nil {
 		return nil, nil
 	}
 
-	// Cipher Suites
-	if offset+2 > len(payload) {
-		return nil, nil
-	}
-	cipherSuitesLen := int(binary.BigEndian.Uint16(payload[offset : offset+2]))
-	offset += 2 + cipherSuitesLen
-	if offset > len(payload) {
-		return nil, nil
+	info := &TLSInfo{
+		Handshake:           true,
+		SNI:                 hello.SNI,
+		Version:             TLSVersionName(hello.maxVersion()),
+		RecordVersion:       TLSVersionName(binary.BigEndian.Uint16(payload[1:3])),
+		LegacyVersion:       TLSVersionName(hello.LegacyVersion),
+		ALPN:                hello.ALPN,
+		SupportedGroups:     namesOf(withoutGREASE(hello.SupportedGroups), GroupName),
+		SignatureAlgorithms: namesOf(withoutGREASE(hello.SignatureAlgorithms), SignatureAlgorithmName),
+		ECH:                 hello.hasExtension(extEncryptedClientHello),
+		GREASE:              hello.hasGREASE(),
+		JA3:                 CalculateJA3Payload(payload), // Calculate JA3 fingerprint
+		JA4:                 hello.JA4(transport),
+	}
+	for _, v := range hello.offeredVersions() {
+		info.SupportedVersions = append(info.SupportedVersions, TLSVersionName(v))
 	}
+	return info, nil
+}
 
-	// Compression Methods
-	if offset+1 > len(payload) {
-		return nil, nil
+// Extracts the negotiated parameters and JA3S fingerprint from a Server Hello record.
+// TLS 1.3 keeps the legacy version at TLS 1.2 and negotiates through supported_versions.
+func parseServerHello(payload []byte, transport byte) *TLSInfo {
+	data := extractJA3SData(payload)
+	if data == nil {
+		return nil
 	}
-	compMethodsLen := int(payload[offset])
-	offset += 1 + compMethodsLen
-	if offset > len(payload) {
-		return nil, nil
-	}
-
-	// Extensions
-	if offset+2 > len(payload) {
-		return nil, nil
-	} // No extensions
-	extensionsLen := int(binary.BigEndian.Uint16(payload[offset : offset+2]))
-	offset += 2
 
-	endOfExtensions := offset + extensionsLen
-	if endOfExtensions > len(payload) {
-		endOfExtensions = len(payload)
+	version := data.SSLVersion
+	if data.SelectedVersion != 0 {
+		version = data.SelectedVersion
 	}
-
-	info := &TLSInfo{
-		Handshake: true,
-		Version:   "TLS",                // General placeholder, specific version logic is complex with 1.3
-		JA3:       CalculateJA3(packet), // Calculate JA3 fingerprint
+	return &TLSInfo{
+		Handshake:   true,
+		ServerHello: true,
+		Version:     TLSVersionName(version),
+		CipherSuite: CipherSuiteName(data.CipherSuite),
+		JA3S:        data.Hash(),
+		JA4S:        data.JA4S(transport),
+		ALPN:        alpnSelected(data.ALPN),
+		Extensions:  data.Extensions,
 	}
+}
 
-	// Iterate extensions to find SNI (Type 0)
-	for offset+4 <= endOfExtensions {
-		extType := binary.BigEndian.Uint16(payload[offset : offset+2])
-		extLen := int(binary.BigEndian.Uint16(payload[offset+2 : offset+4]))
-		offset += 4
-
-		if offset+extLen > endOfExtensions {
-			break
-		}
-
-		if extType == 0 { // SNI
-			// SNI Extension parsing
-			// List Length (2 bytes)
-			if extLen < 2 {
-				break
-			}
-			// listLen := binary.BigEndian.Uint16(payload[offset : offset+2])
-
-			sniOffset := offset + 2
-			sniEnd := offset + extLen
-
-			for sniOffset+3 <= sniEnd {
-				nameType := payload[sniOffset]
-				nameLen := int(binary.BigEndian.Uint16(payload[sniOffset+1 : sniOffset+3]))
-				sniOffset += 3
-
-				if sniOffset+nameLen > sniEnd {
-					break
-				}
-
-				if nameType == 0 { // Host Name
-					info.SNI = string(payload[sniOffset : sniOffset+nameLen])
-					return info, nil
-				}
-				sniOffset += nameLen
-			}
-		}
-
-		offset += extLen
+// Returns the selected protocol as a one-element list, or nil when none was.
+func alpnSelected(alpn string) []string {
+	if alpn == "" {
+		return nil
 	}
-
-	return info, nil
+	return []string{alpn}
 }
@@ -2,7 +2,9 @@
  * TLS Parser Tests.
  *
  * Validates TLS handshake parsing logic, ensuring correct extraction of
- * SNI and version information from raw packet data.
+ * SNI and version information from raw packet data, and of the negotiated
+ * parameters and JA3S fingerprint from a Server Hello, and of the server's
+ * identity from its certificate chain.
  *
  * Author: KleaSCM
  * Email: KleaSCM@gmail.com
@@ -11,7 +13,19 @@
 package parser
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/hex"
+	"math/big"
+	"net"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
@@ -60,4 +74,332 @@ func TestParseTLS(t *testing.T) {
 			t.Error("Expected nil info for non-TCP packet")
 		}
 	})
+
+	// Records too short for the handshake header, or holding an empty hello
+	t.Run("Truncated records", func(t *testing.T) {
+		for _, payload := range [][]byte{
+			{22, 3, 1, 0, 0},
+			{22, 3, 1, 0, 1, 2},
+			{22, 3, 3, 0, 3, 1, 0, 0},
+			{22, 3, 1, 0, 4, 1, 0, 0, 0},
+			{22, 3, 3, 0, 4, 2, 0, 0, 0},
+		} {
+			if info, _ := ParseTLSPayload(payload); info != nil {
+				t.Errorf("Expected nothing from % x, got %+v", payload, info)
+			}
+		}
+	})
+}
+
+// Builds a Server Hello record with the given legacy version, cipher suite and extensions.
+func buildServerHello(version, cipher uint16, extensions ...[]byte) []byte {
+	body := binary.BigEndian.AppendUint16(nil, version)
+	body = append(body, make([]byte, 32)...) // Random
+	body = append(body, 32)                  // Session ID
+	body = append(body, make([]byte, 32)...)
+	body = binary.BigEndian.AppendUint16(body, cipher)
+	body = append(body, 0) // Compression
+
+	var exts []byte
+	for _, ext := range extensions {
+		exts = append(exts, ext...)
+	}
+	if len(extensions) > 0 {
+		body = binary.BigEndian.AppendUint16(body, uint16(len(exts)))
+		body = append(body, exts...)
+	}
+
+	handshake := append([]byte{2, 0, byte(len(body) >> 8), byte(len(body))}, body...)
+	record := []byte{22, 3, 3}
+	record = binary.BigEndian.AppendUint16(record, uint16(len(handshake)))
+	return append(record, handshake...)
+}
+
+// Builds one extension with the given type and data.
+func tlsExtension(extType uint16, data ...byte) []byte {
+	ext := binary.BigEndian.AppendUint16(nil, extType)
+	ext = binary.BigEndian.AppendUint16(ext, uint16(len(data)))
+	return append(ext, data...)
+}
+
+// Verifies the negotiated version, cipher suite and JA3S extracted from Server Hellos.
+func TestParseServerHello(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		version string
+		cipher  string
+		ja3s    string // JA3S string before hashing
+	}{
+		{
+			name:    "TLS 1.2 with extensions",
+			payload: buildServerHello(0x0303, 0xc030, tlsExtension(0xff01, 0), tlsExtension(11, 1, 0), tlsExtension(23)),
+			version: "TLS 1.2",
+			cipher:  "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+			ja3s:    "771,49200,65281-11-23",
+		},
+		{
+			name:    "TLS 1.3 negotiated through supported_versions",
+			payload: buildServerHello(0x0303, 0x1301, tlsExtension(51, make([]byte, 36)...), tlsExtension(43, 0x03, 0x04)),
+			version: "TLS 1.3",
+			cipher:  "TLS_AES_128_GCM_SHA256",
+			ja3s:    "771,4865,51-43",
+		},
+		{
+			name:    "TLS 1.0 without extensions",
+			payload: buildServerHello(0x0301, 0x002f),
+			version: "TLS 1.0",
+			cipher:  "TLS_RSA_WITH_AES_128_CBC_SHA",
+			ja3s:    "769,47,",
+		},
+		{
+			name:    "unlisted cipher suite",
+			payload: buildServerHello(0x0303, 0x00ff),
+			version: "TLS 1.2",
+			cipher:  "0x00ff",
+			ja3s:    "771,255,",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := ParseTLSPayload(tt.payload)
+			if err != nil || info == nil {
+				t.Fatalf("Expected a Server Hello, got %+v (%v)", info, err)
+			}
+			if !info.Handshake || !info.ServerHello || info.JA3 != "" {
+				t.Errorf("Expected a server handshake without JA3, got %+v", info)
+			}
+			if info.Version != tt.version || info.CipherSuite != tt.cipher {
+				t.Errorf("Expected %s with %s, got %s with %s", tt.version, tt.cipher, info.Version, info.CipherSuite)
+			}
+
+			data := extractJA3SData(tt.payload)
+			if got := data.String(); got != tt.ja3s {
+				t.Errorf("Expected JA3S string %q, got %q", tt.ja3s, got)
+			}
+			if info.JA3S != data.Hash() || CalculateJA3SPayload(tt.payload) != info.JA3S {
+				t.Errorf("Expected JA3S %s to be the hash of the JA3S string", info.JA3S)
+			}
+		})
+	}
+
+	t.Run("truncated", func(t *testing.T) {
+		payload := buildServerHello(0x0303, 0xc030)
+		if info, _ := ParseTLSPayload(payload[:40]); info != nil {
+			t.Errorf("Expected nil for a truncated Server Hello, got %+v", info)
+		}
+	})
+}
+
+// Creates a DER certificate for the names, signed by parent (self-signed when nil).
+func buildCertificate(tb testing.TB, commonName string, dnsNames []string, serial int64, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte) {
+	tb.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: commonName, Organization: []string{"Example"}},
+		DNSNames:              dnsNames,
+		IPAddresses:           []net.IP{net.IPv4(93, 184, 216, 34)},
+		NotBefore:             time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:              time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return cert, key, der
+}
+
+// Builds the body of a Certificate handshake message carrying the chain.
+func buildCertificateBody(chain ...[]byte) []byte {
+	var list []byte
+	for _, der := range chain {
+		list = append(list, byte(len(der)>>16), byte(len(der)>>8), byte(len(der)))
+		list = append(list, der...)
+	}
+	return append([]byte{byte(len(list) >> 16), byte(len(list) >> 8), byte(len(list))}, list...)
+}
+
+// Verifies the leaf identity and chain decoded from a Certificate message.
+func TestParseCertificateMessage(t *testing.T) {
+	ca, caKey, caDER := buildCertificate(t, "Example Issuing CA", nil, 1, nil, nil)
+	_, _, leafDER := buildCertificate(t, "www.example.com", []string{"www.example.com", "example.com"}, 0x1f2e3d, ca, caKey)
+	fingerprint := sha256.Sum256(leafDER)
+
+	info, err := ParseCertificateMessage(buildCertificateBody(leafDER, caDER))
+	if err != nil {
+		t.Fatalf("Failed to parse certificate message: %v", err)
+	}
+	if info.CommonName != "www.example.com" || info.Subject != "CN=www.example.com,O=Example" {
+		t.Errorf("Expected the leaf subject, got %q (%q)", info.Subject, info.CommonName)
+	}
+	if len(info.SANs) != 3 || info.SANs[1] != "example.com" || info.SANs[2] != "93.184.216.34" {
+		t.Errorf("Expected DNS and IP SANs, got %v", info.SANs)
+	}
+	if info.Issuer != "CN=Example Issuing CA,O=Example" || len(info.Chain) != 1 || info.Chain[0] != info.Issuer {
+		t.Errorf("Expected the issuer and its certificate in the chain, got %q, %v", info.Issuer, info.Chain)
+	}
+	if !info.NotBefore.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) || !info.NotAfter.Equal(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the 2024 validity window, got %v to %v", info.NotBefore, info.NotAfter)
+	}
+	if info.Serial != "1f2e3d" || info.SHA256 != hex.EncodeToString(fingerprint[:]) {
+		t.Errorf("Expected serial 1f2e3d and the DER fingerprint, got %s, %s", info.Serial, info.SHA256)
+	}
+
+	// Both names carry O then CN (2.5.4.10, 2.5.4.3); the extensions depend on the template
+	names := ja4Hash("55040a,550403")
+	if !strings.HasPrefix(info.JA4X, names+"_"+names+"_") || len(info.JA4X) != 38 {
+		t.Errorf("Expected JA4X to hash the issuer and subject attribute types, got %s", info.JA4X)
+	}
+
+	for name, body := range map[string][]byte{
+		"empty list":     buildCertificateBody(),
+		"truncated list": buildCertificateBody(leafDER)[:100],
+		"not DER":        buildCertificateBody([]byte("not a certificate")),
+	} {
+		if _, err := ParseCertificateMessage(body); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+// Builds a Client Hello record with the given cipher suites and extensions.
+func buildClientHelloRecord(ciphers []uint16, extensions ...[]byte) []byte {
+	body := []byte{3, 3}
+	body = append(body, make([]byte, 32)...) // Random
+	body = append(body, 0)                   // Session ID
+	body = binary.BigEndian.AppendUint16(body, uint16(2*len(ciphers)))
+	for _, c := range ciphers {
+		body = binary.BigEndian.AppendUint16(body, c)
+	}
+	body = append(body, 1, 0) // Null compression
+
+	var exts []byte
+	for _, ext := range extensions {
+		exts = append(exts, ext...)
+	}
+	body = binary.BigEndian.AppendUint16(body, uint16(len(exts)))
+	body = append(body, exts...)
+
+	handshake := append([]byte{1, 0, byte(len(body) >> 8), byte(len(body))}, body...)
+	record := []byte{22, 3, 1}
+	record = binary.BigEndian.AppendUint16(record, uint16(len(handshake)))
+	return append(record, handshake...)
+}
+
+// Verifies JA4 and JA4S: GREASE is ignored, the first section is readable, and the
+// client fingerprint survives extension-order randomisation where JA3 does not.
+func TestJA4(t *testing.T) {
+	sni := tlsExtension(0, append([]byte{0, 14, 0, 0, 11}, "example.com"...)...)
+	alpn := tlsExtension(16, append([]byte{0, 12, 2, 'h', '2', 8}, "http/1.1"...)...)
+	versions := tlsExtension(43, 6, 0x2a, 0x2a, 0x03, 0x04, 0x03, 0x03)
+	sigalgs := tlsExtension(13, 0, 4, 0x04, 0x03, 0x08, 0x04)
+	groups := tlsExtension(10, 0, 2, 0x00, 0x1d)
+	grease := tlsExtension(0x1a1a)
+	ciphers := []uint16{0x0a0a, 0x1302, 0x1301, 0xc02b}
+
+	hello := buildClientHelloRecord(ciphers, grease, sni, alpn, versions, sigalgs, groups)
+	shuffled := buildClientHelloRecord(ciphers, groups, sigalgs, versions, grease, alpn, sni)
+
+	want := "t13d0305h2_" + ja4Hash("1301,1302,c02b") + "_" + ja4Hash("000a,000d,002b_0403,0804")
+	info, _ := ParseTLSPayload(hello)
+	if info == nil || info.JA4 != want {
+		t.Fatalf("Expected JA4 %s, got %+v", want, info)
+	}
+	if CalculateJA4Payload(shuffled) != want {
+		t.Errorf("Expected the same JA4 with the extensions reordered, got %s", CalculateJA4Payload(shuffled))
+	}
+	if CalculateJA3Payload(shuffled) == info.JA3 {
+		t.Error("Expected JA3 to change with the extension order")
+	}
+
+	noSNI := buildClientHelloRecord([]uint16{0x002f}, tlsExtension(0xff01, 0))
+	if got := CalculateJA4Payload(noSNI); got != "t12i010100_"+ja4Hash("002f")+"_"+ja4Hash("ff01") {
+		t.Errorf("Expected a TLS 1.2 fingerprint without SNI or ALPN, got %s", got)
+	}
+
+	tests := []struct {
+		alpn string
+		want string
+	}{
+		{"h2", "h2"},
+		{"http/1.1", "h1"},
+		{"h", "hh"},
+		{"\xabx\xcd", "ad"}, // Not alphanumeric: first and last hex characters
+		{"", "00"},
+	}
+	for _, tt := range tests {
+		if got := ja4ALPN(tt.alpn); got != tt.want {
+			t.Errorf("ALPN %q: expected %s, got %s", tt.alpn, tt.want, got)
+		}
+	}
+
+	serverHello := buildServerHello(0x0303, 0x1301, tlsExtension(51, make([]byte, 36)...), tlsExtension(43, 0x03, 0x04))
+	if info, _ := ParseTLSPayload(serverHello); info == nil || info.JA4S != "t130200_1301_"+ja4Hash("0033,002b") {
+		t.Errorf("Expected the TLS 1.3 JA4S, got %+v", info)
+	}
+	withALPN := buildServerHello(0x0303, 0xc02f, tlsExtension(16, 0, 3, 2, 'h', '2'))
+	if got := extractJA3SData(withALPN).JA4S(JA4OverTCP); got != "t1201h2_c02f_"+ja4Hash("0010") {
+		t.Errorf("Expected the selected ALPN in JA4S, got %s", got)
+	}
+}
+
+// Verifies the Client Hello metadata: offered versions, ALPN, groups, signature
+// algorithms and the ECH/GREASE flags, and that a hello without supported_versions
+// offers only its legacy version.
+func TestParseClientHelloMetadata(t *testing.T) {
+	alpn := tlsExtension(16, append([]byte{0, 12, 2, 'h', '2', 8}, "http/1.1"...)...)
+	versions := tlsExtension(43, 6, 0x2a, 0x2a, 0x03, 0x04, 0x03, 0x03)
+	sigalgs := tlsExtension(13, 0, 4, 0x04, 0x03, 0x08, 0x04)
+	groups := tlsExtension(10, 0, 6, 0x3a, 0x3a, 0x00, 0x1d, 0x00, 0x17)
+	ech := tlsExtension(0xfe0d, 0)
+
+	info, _ := ParseTLSPayload(buildClientHelloRecord([]uint16{0x0a0a, 0x1301}, alpn, versions, sigalgs, groups, ech))
+	if info == nil {
+		t.Fatal("Expected a Client Hello")
+	}
+	checks := []struct {
+		field string
+		got   string
+		want  string
+	}{
+		{"Version", info.Version, "TLS 1.3"},
+		{"RecordVersion", info.RecordVersion, "TLS 1.0"},
+		{"LegacyVersion", info.LegacyVersion, "TLS 1.2"},
+		{"SupportedVersions", strings.Join(info.SupportedVersions, ","), "TLS 1.3,TLS 1.2"},
+		{"ALPN", strings.Join(info.ALPN, ","), "h2,http/1.1"},
+		{"SupportedGroups", strings.Join(info.SupportedGroups, ","), "x25519,secp256r1"},
+		{"SignatureAlgorithms", strings.Join(info.SignatureAlgorithms, ","), "ecdsa_secp256r1_sha256,rsa_pss_rsae_sha256"},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s: expected %q, got %q", c.field, c.want, c.got)
+		}
+	}
+	if !info.ECH || !info.GREASE {
+		t.Errorf("Expected ECH and GREASE, got %v and %v", info.ECH, info.GREASE)
+	}
+
+	legacy := buildClientHelloRecord([]uint16{0x002f})
+	legacy[9], legacy[10] = 3, 1
+	info, _ = ParseTLSPayload(legacy)
+	if info == nil || info.Version != "TLS 1.0" || strings.Join(info.SupportedVersions, ",") != "TLS 1.0" {
+		t.Fatalf("Expected a client offering only TLS 1.0, got %+v", info)
+	}
+	if info.ECH || info.GREASE || info.ALPN != nil {
+		t.Errorf("Expected no ECH, GREASE or ALPN, got %+v", info)
+	}
 }
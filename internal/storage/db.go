@@ -22,11 +22,23 @@ type Storage interface {
 	SaveDevice(device *models.Device) error
 	GetDeviceByMAC(mac string) (*models.Device, error)
 	ListDevices() ([]*models.Device, error)
+	SaveDeviceIP(ip *models.DeviceIP) error
+	ListDeviceIPs(deviceID int64) ([]*models.DeviceIP, error)
+
+	// Neighbors
+	SaveNeighbor(n *models.Neighbor) error
+	ListNeighbors() ([]*models.Neighbor, error)
+	SaveRouter(advert *models.RouterAdvertisement) error
+	ListRouters() ([]*models.RouterAdvertisement, error)
 
 	// Flows
 	SaveFlow(flow *models.Flow) error
 	GetRecentFlows(limit int) ([]*models.Flow, error)
 
+	// TLS handshakes
+	SaveTLSHandshake(hs *models.TLSHandshake) error
+	ListTLSHandshakes(limit int) ([]*models.TLSHandshake, error)
+
 	// WiFi
 	SaveAccessPoint(ap *models.AccessPoint) error
 	ListAccessPoints() ([]*models.AccessPoint, error)
@@ -34,4 +46,8 @@ type Storage interface {
 	ListWiFiClients() ([]*models.WiFiClient, error)
 	SaveHandshake(hs *models.Handshake) error
 	ListHandshakes() ([]*models.Handshake, error)
+
+	// Capture runs
+	SaveCaptureRun(run *models.CaptureRun) error
+	ListCaptureRuns(limit int) ([]*models.CaptureRun, error)
 }
@@ -2,7 +2,8 @@
  * Database Schema.
  *
  * Defines the DDL statements for creating the relational database structure,
- * including tables for devices, flows, DNS entries, and TLS handshakes.
+ * including tables for devices and their address history, flows, DNS
+ * entries, TLS handshakes, and the capture runs that recorded them.
  *
  * Author: KleaSCM
  * Email: KleaSCM@gmail.com
@@ -20,10 +21,65 @@ CREATE TABLE IF NOT EXISTS devices (
     hostname TEXT,
     ip_address TEXT,
     os_fingerprint TEXT,
+    os_confidence INTEGER,
     device_type TEXT,
     first_seen TIMESTAMP,
     last_seen TIMESTAMP,
-    user_label TEXT
+    user_label TEXT,
+    dhcp_vendor_class TEXT,
+    dhcp_fingerprint TEXT,
+    model TEXT
+);
+
+-- Addresses each device has used, from DHCP leases and observed traffic
+CREATE TABLE IF NOT EXISTS device_ips (
+    id INTEGER PRIMARY KEY,
+    device_id INTEGER,
+    ip_address TEXT,
+    source TEXT,
+    first_seen TIMESTAMP,
+    last_seen TIMESTAMP,
+    lease_expires TIMESTAMP,
+    UNIQUE (device_id, ip_address),
+    FOREIGN KEY (device_id) REFERENCES devices(id)
+);
+
+-- IP to MAC bindings announced over ARP and NDP; an address claimed by
+-- several MACs has a row per MAC
+CREATE TABLE IF NOT EXISTS neighbors (
+    id INTEGER PRIMARY KEY,
+    ip_address TEXT,
+    mac_address TEXT,
+    vlan INTEGER,
+    protocol TEXT,
+    interface TEXT,
+    first_seen TIMESTAMP,
+    last_seen TIMESTAMP,
+    gratuitous INTEGER,
+    probes INTEGER,
+    router BOOLEAN,
+    UNIQUE (ip_address, mac_address, vlan)
+);
+CREATE INDEX IF NOT EXISTS idx_neighbors_mac ON neighbors(mac_address);
+
+-- IPv6 routers and what they last advertised
+CREATE TABLE IF NOT EXISTS routers (
+    id INTEGER PRIMARY KEY,
+    router_ip TEXT,
+    router_mac TEXT,
+    vlan INTEGER,
+    interface TEXT,
+    hop_limit INTEGER,
+    managed BOOLEAN,
+    other_config BOOLEAN,
+    preference TEXT,
+    lifetime INTEGER, -- Seconds
+    mtu INTEGER,
+    prefixes TEXT, -- JSON array
+    dns_servers TEXT, -- JSON array
+    first_seen TIMESTAMP,
+    last_seen TIMESTAMP,
+    UNIQUE (router_ip, router_mac, vlan)
 );
 
 -- Flows Table
@@ -48,6 +104,16 @@ CREATE TABLE IF NOT EXISTS flows (
     bytes_received INTEGER,
     packets_sent INTEGER,
     packets_received INTEGER,
+    interface TEXT,
+    vlan INTEGER,
+    tunnel TEXT,
+    tunnel_id INTEGER,
+    sampled BOOLEAN,
+    quic_version TEXT,
+    ssh_client TEXT,
+    ssh_server TEXT,
+    hassh TEXT,
+    hassh_server TEXT,
     FOREIGN KEY (device_id) REFERENCES devices(id)
 );
 CREATE INDEX IF NOT EXISTS idx_flows_device ON flows(device_id);
@@ -78,14 +144,28 @@ CREATE TABLE IF NOT EXISTS tls_handshakes (
     ja3s_hash TEXT,
     cipher_suite TEXT,
     tls_version TEXT,
+    alpn TEXT,
+    record_version TEXT,
+    legacy_version TEXT,
+    client_versions TEXT, -- JSON array
+    client_alpn TEXT, -- JSON array
+    supported_groups TEXT, -- JSON array
+    signature_algorithms TEXT, -- JSON array
+    ech BOOLEAN,
+    grease BOOLEAN,
     cert_common_name TEXT,
     cert_issuer TEXT,
     cert_valid_from TIMESTAMP,
     cert_valid_to TIMESTAMP,
+    cert_subject TEXT,
+    cert_sans TEXT, -- JSON array
+    cert_serial TEXT,
+    cert_sha256 TEXT,
     identified_app TEXT,
     timestamp TIMESTAMP,
     FOREIGN KEY (flow_id) REFERENCES flows(id)
 );
+CREATE INDEX IF NOT EXISTS idx_tls_ja3 ON tls_handshakes(ja3_hash, ja3s_hash);
 
 -- Access Points (WiFi)
 CREATE TABLE IF NOT EXISTS access_points (
@@ -117,4 +197,62 @@ CREATE TABLE IF NOT EXISTS handshakes (
     is_full BOOLEAN,
     timestamp TIMESTAMP
 );
+
+-- Capture Runs
+CREATE TABLE IF NOT EXISTS capture_runs (
+    id INTEGER PRIMARY KEY,
+    mode TEXT,
+    source TEXT,
+    filter TEXT,
+    duration_limit_ms INTEGER,
+    packet_limit INTEGER,
+    byte_limit INTEGER,
+    schedule TEXT,
+    started_at TIMESTAMP,
+    ended_at TIMESTAMP,
+    stop_reason TEXT,
+    packets INTEGER,
+    dropped INTEGER,
+    bytes INTEGER
+);
+CREATE INDEX IF NOT EXISTS idx_capture_runs_start ON capture_runs(started_at);
 `
+
+// Describes a column added after a table was first released.
+type columnMigration struct {
+	Table      string
+	Column     string
+	Definition string
+}
+
+// Columns added to existing tables since their initial schema. CREATE TABLE IF NOT
+// EXISTS leaves older databases untouched, so Migrate adds any that are missing.
+var columnMigrations = []columnMigration{
+	{Table: "devices", Column: "dhcp_vendor_class", Definition: "TEXT"},
+	{Table: "devices", Column: "dhcp_fingerprint", Definition: "TEXT"},
+	{Table: "devices", Column: "model", Definition: "TEXT"},
+	{Table: "devices", Column: "os_confidence", Definition: "INTEGER"},
+	{Table: "flows", Column: "interface", Definition: "TEXT"},
+	{Table: "flows", Column: "vlan", Definition: "INTEGER"},
+	{Table: "flows", Column: "tunnel", Definition: "TEXT"},
+	{Table: "flows", Column: "tunnel_id", Definition: "INTEGER"},
+	{Table: "flows", Column: "sampled", Definition: "BOOLEAN"},
+	{Table: "flows", Column: "quic_version", Definition: "TEXT"},
+	{Table: "flows", Column: "ssh_client", Definition: "TEXT"},
+	{Table: "flows", Column: "ssh_server", Definition: "TEXT"},
+	{Table: "flows", Column: "hassh", Definition: "TEXT"},
+	{Table: "flows", Column: "hassh_server", Definition: "TEXT"},
+	{Table: "tls_handshakes", Column: "cert_subject", Definition: "TEXT"},
+	{Table: "tls_handshakes", Column: "cert_sans", Definition: "TEXT"},
+	{Table: "tls_handshakes", Column: "cert_serial", Definition: "TEXT"},
+	{Table: "tls_handshakes", Column: "cert_sha256", Definition: "TEXT"},
+	{Table: "tls_handshakes", Column: "alpn", Definition: "TEXT"},
+	{Table: "tls_handshakes", Column: "record_version", Definition: "TEXT"},
+	{Table: "tls_handshakes", Column: "legacy_version", Definition: "TEXT"},
+	{Table: "tls_handshakes", Column: "client_versions", Definition: "TEXT"},
+	{Table: "tls_handshakes", Column: "client_alpn", Definition: "TEXT"},
+	{Table: "tls_handshakes", Column: "supported_groups", Definition: "TEXT"},
+	{Table: "tls_handshakes", Column: "signature_algorithms", Definition: "TEXT"},
+	{Table: "tls_handshakes", Column: "ech", Definition: "BOOLEAN"},
+	{Table: "tls_handshakes", Column: "grease", Definition: "BOOLEAN"},
+}
@@ -14,6 +14,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/kleaSCM/netscope/internal/models"
 	_ "github.com/mattn/go-sqlite3"
@@ -38,6 +39,58 @@ func NewSQLiteStorage(dbPath string) (*SQLiteStorage, error) {
 	return &SQLiteStorage{db: db}, nil
 }
 
+// Records a finished capture run and sets its ID.
+func (s *SQLiteStorage) SaveCaptureRun(run *models.CaptureRun) error {
+	query := `
+	INSERT INTO capture_runs (mode, source, filter, duration_limit_ms, packet_limit, byte_limit, schedule,
+		started_at, ended_at, stop_reason, packets, dropped, bytes)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	result, err := s.db.Exec(query, run.Mode, run.Source, run.Filter, run.DurationLimit.Milliseconds(),
+		int64(run.PacketLimit), int64(run.ByteLimit), run.Schedule, run.StartedAt, run.EndedAt, run.StopReason,
+		int64(run.Packets), int64(run.Dropped), int64(run.Bytes))
+	if err != nil {
+		return fmt.Errorf("failed to save capture run: %w", err)
+	}
+	if id, err := result.LastInsertId(); err == nil {
+		run.ID = id
+	}
+	return nil
+}
+
+// Returns the most recent capture runs, newest first, up to the specified limit.
+func (s *SQLiteStorage) ListCaptureRuns(limit int) ([]*models.CaptureRun, error) {
+	query := `
+	SELECT id, mode, source, filter, duration_limit_ms, packet_limit, byte_limit, schedule,
+	       started_at, ended_at, stop_reason, packets, dropped, bytes
+	FROM capture_runs
+	ORDER BY started_at DESC
+	LIMIT ?`
+	rows, err := s.db.Query(query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list capture runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []*models.CaptureRun
+	for rows.Next() {
+		var run models.CaptureRun
+		var durationMs, packetLimit, byteLimit, packets, dropped, bytes int64
+		if err := rows.Scan(&run.ID, &run.Mode, &run.Source, &run.Filter, &durationMs, &packetLimit, &byteLimit,
+			&run.Schedule, &run.StartedAt, &run.EndedAt, &run.StopReason, &packets, &dropped, &bytes); err != nil {
+			return nil, err
+		}
+		run.DurationLimit = time.Duration(durationMs) * time.Millisecond
+		run.PacketLimit = uint64(packetLimit)
+		run.ByteLimit = uint64(byteLimit)
+		run.Packets = uint64(packets)
+		run.Dropped = uint64(dropped)
+		run.Bytes = uint64(bytes)
+		runs = append(runs, &run)
+	}
+	return runs, nil
+}
+
 // Closes the database connection.
 func (s *SQLiteStorage) Close() error {
 	return s.db.Close()
@@ -49,21 +102,104 @@ func (s *SQLiteStorage) Migrate() error {
 	if err != nil {
 		return fmt.Errorf("failed to apply schema: %w", err)
 	}
+
+	for _, m := range columnMigrations {
+		exists, err := s.columnExists(m.Table, m.Column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := s.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.Table, m.Column, m.Definition)); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %w", m.Table, m.Column, err)
+		}
+	}
 	return nil
 }
 
+// Reports whether a table already has the named column.
+func (s *SQLiteStorage) columnExists(table, column string) (bool, error) {
+	rows, err := s.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return false, fmt.Errorf("failed to inspect table %s: %w", table, err)
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
 // Saves or updates a device in the database.
 func (s *SQLiteStorage) SaveDevice(d *models.Device) error {
+	if d.MACAddress == "" {
+		return s.saveDeviceByIP(d)
+	}
+
 	query := `
-	INSERT INTO devices (mac_address, vendor, hostname, ip_address, os_fingerprint, device_type, first_seen, last_seen, user_label)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	INSERT INTO devices (mac_address, vendor, hostname, ip_address, os_fingerprint, os_confidence, device_type, first_seen, last_seen, user_label, dhcp_vendor_class, dhcp_fingerprint, model)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	ON CONFLICT(mac_address) DO UPDATE SET
 		vendor = excluded.vendor,
 		hostname = excluded.hostname,
 		ip_address = excluded.ip_address,
-		last_seen = excluded.last_seen;
+		os_fingerprint = excluded.os_fingerprint,
+		os_confidence = excluded.os_confidence,
+		device_type = excluded.device_type,
+		last_seen = excluded.last_seen,
+		dhcp_vendor_class = excluded.dhcp_vendor_class,
+		dhcp_fingerprint = excluded.dhcp_fingerprint,
+		model = excluded.model
+	RETURNING id;
+	`
+	// LastInsertId is stale when the upsert updates an existing row, so ask for the ID
+	row := s.db.QueryRow(query, d.MACAddress, d.Vendor, d.Hostname, d.IPAddress, d.OSFingerprint, d.OSConfidence, d.DeviceType, d.FirstSeen, d.LastSeen, d.UserLabel, d.DHCPVendorClass, d.DHCPFingerprint, d.Model)
+	if err := row.Scan(&d.ID); err != nil {
+		return fmt.Errorf("failed to save device: %w", err)
+	}
+	return nil
+}
+
+// Saves a device seen only on links without MAC addresses. Such devices are keyed
+// by IP and stored with a NULL MAC, which the UNIQUE constraint cannot match on,
+// so the upsert is done by hand.
+func (s *SQLiteStorage) saveDeviceByIP(d *models.Device) error {
+	update := `
+	UPDATE devices SET vendor = ?, hostname = ?, os_fingerprint = ?, os_confidence = ?, device_type = ?, model = ?, last_seen = ?
+	WHERE mac_address IS NULL AND ip_address = ?
+	`
+	res, err := s.db.Exec(update, d.Vendor, d.Hostname, d.OSFingerprint, d.OSConfidence, d.DeviceType, d.Model, d.LastSeen, d.IPAddress)
+	if err != nil {
+		return fmt.Errorf("failed to save device: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n > 0 {
+		row := s.db.QueryRow(`SELECT id FROM devices WHERE mac_address IS NULL AND ip_address = ?`, d.IPAddress)
+		if err := row.Scan(&d.ID); err != nil {
+			return fmt.Errorf("failed to save device: %w", err)
+		}
+		return nil
+	}
+
+	insert := `
+	INSERT INTO devices (mac_address, vendor, hostname, ip_address, os_fingerprint, os_confidence, device_type, first_seen, last_seen, user_label, model)
+	VALUES (NULL, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
-	res, err := s.db.Exec(query, d.MACAddress, d.Vendor, d.Hostname, d.IPAddress, d.OSFingerprint, d.DeviceType, d.FirstSeen, d.LastSeen, d.UserLabel)
+	res, err = s.db.Exec(insert, d.Vendor, d.Hostname, d.IPAddress, d.OSFingerprint, d.OSConfidence, d.DeviceType, d.FirstSeen, d.LastSeen, d.UserLabel, d.Model)
 	if err != nil {
 		return fmt.Errorf("failed to save device: %w", err)
 	}
@@ -78,11 +214,14 @@ func (s *SQLiteStorage) SaveDevice(d *models.Device) error {
 
 // Retrieves a device by its MAC address.
 func (s *SQLiteStorage) GetDeviceByMAC(mac string) (*models.Device, error) {
-	query := `SELECT id, mac_address, vendor, hostname, ip_address, os_fingerprint, device_type, first_seen, last_seen, user_label FROM devices WHERE mac_address = ?`
+	query := `SELECT id, mac_address, vendor, hostname, ip_address, os_fingerprint, device_type, first_seen, last_seen, user_label,
+	       COALESCE(dhcp_vendor_class, ''), COALESCE(dhcp_fingerprint, ''), COALESCE(model, ''), COALESCE(os_confidence, 0)
+	FROM devices WHERE mac_address = ?`
 	row := s.db.QueryRow(query, mac)
 
 	var d models.Device
-	err := row.Scan(&d.ID, &d.MACAddress, &d.Vendor, &d.Hostname, &d.IPAddress, &d.OSFingerprint, &d.DeviceType, &d.FirstSeen, &d.LastSeen, &d.UserLabel)
+	err := row.Scan(&d.ID, &d.MACAddress, &d.Vendor, &d.Hostname, &d.IPAddress, &d.OSFingerprint, &d.DeviceType, &d.FirstSeen, &d.LastSeen, &d.UserLabel,
+		&d.DHCPVendorClass, &d.DHCPFingerprint, &d.Model, &d.OSConfidence)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -100,8 +239,9 @@ func (s *SQLiteStorage) SaveFlow(f *models.Flow) error {
 	// We want to persist it.
 
 	query := `
-	INSERT INTO flows (device_id, src_ip, dst_ip, src_port, dst_port, protocol, dst_domain, traffic_type, start_time, end_time, bytes_sent, packets_sent, app_protocol)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	INSERT INTO flows (device_id, src_ip, dst_ip, src_port, dst_port, protocol, dst_domain, traffic_type, start_time, end_time, bytes_sent, packets_sent, app_protocol, interface, vlan, tunnel, tunnel_id, sampled, quic_version,
+	                   ssh_client, ssh_server, hassh, hassh_server)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 	// Insert flow record.
 	// Missing: dst_country, city, asn, ja3, etc. Phase 1 doesn't have them all.
@@ -115,6 +255,11 @@ func (s *SQLiteStorage) SaveFlow(f *models.Flow) error {
 		f.FirstSeen, f.LastSeen,
 		f.ByteCount, f.PacketCount,
 		f.Protocol, // app_protocol (e.g. TCP/UDP, reused)
+		f.Interface,
+		f.Key.VLAN, f.Tunnel, f.Key.TunnelID,
+		f.Sampled,
+		f.QUICVersion,
+		f.SSHClient, f.SSHServer, f.HASSH, f.HASSHServer,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to save flow: %w", err)
@@ -130,7 +275,9 @@ func (s *SQLiteStorage) SaveFlow(f *models.Flow) error {
 
 // Returns all registered devices ordered by last seen.
 func (s *SQLiteStorage) ListDevices() ([]*models.Device, error) {
-	query := `SELECT id, mac_address, vendor, hostname, ip_address, os_fingerprint, device_type, first_seen, last_seen, user_label FROM devices ORDER BY last_seen DESC`
+	query := `SELECT id, COALESCE(mac_address, ''), vendor, hostname, ip_address, os_fingerprint, device_type, first_seen, last_seen, user_label,
+	       COALESCE(dhcp_vendor_class, ''), COALESCE(dhcp_fingerprint, ''), COALESCE(model, ''), COALESCE(os_confidence, 0)
+	FROM devices ORDER BY last_seen DESC`
 	rows, err := s.db.Query(query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list devices: %w", err)
@@ -140,7 +287,8 @@ func (s *SQLiteStorage) ListDevices() ([]*models.Device, error) {
 	var devices []*models.Device
 	for rows.Next() {
 		var d models.Device
-		if err := rows.Scan(&d.ID, &d.MACAddress, &d.Vendor, &d.Hostname, &d.IPAddress, &d.OSFingerprint, &d.DeviceType, &d.FirstSeen, &d.LastSeen, &d.UserLabel); err != nil {
+		if err := rows.Scan(&d.ID, &d.MACAddress, &d.Vendor, &d.Hostname, &d.IPAddress, &d.OSFingerprint, &d.DeviceType, &d.FirstSeen, &d.LastSeen, &d.UserLabel,
+			&d.DHCPVendorClass, &d.DHCPFingerprint, &d.Model, &d.OSConfidence); err != nil {
 			return nil, err
 		}
 		devices = append(devices, &d)
@@ -148,10 +296,168 @@ func (s *SQLiteStorage) ListDevices() ([]*models.Device, error) {
 	return devices, nil
 }
 
+// Records that a device used an address. Recording a known address again extends
+// its last seen time and, for DHCP, replaces the lease expiry and source.
+func (s *SQLiteStorage) SaveDeviceIP(ip *models.DeviceIP) error {
+	query := `
+	INSERT INTO device_ips (device_id, ip_address, source, first_seen, last_seen, lease_expires)
+	VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT(device_id, ip_address) DO UPDATE SET
+		source = CASE WHEN excluded.lease_expires IS NULL THEN source ELSE excluded.source END,
+		last_seen = excluded.last_seen,
+		lease_expires = COALESCE(excluded.lease_expires, lease_expires);
+	`
+	var leaseExpires sql.NullTime
+	if !ip.LeaseExpires.IsZero() {
+		leaseExpires = sql.NullTime{Time: ip.LeaseExpires, Valid: true}
+	}
+	if _, err := s.db.Exec(query, ip.DeviceID, ip.IPAddress, ip.Source, ip.FirstSeen, ip.LastSeen, leaseExpires); err != nil {
+		return fmt.Errorf("failed to save device address: %w", err)
+	}
+	return nil
+}
+
+// Returns the addresses a device has used, most recently seen first.
+func (s *SQLiteStorage) ListDeviceIPs(deviceID int64) ([]*models.DeviceIP, error) {
+	query := `
+	SELECT device_id, ip_address, source, first_seen, last_seen, lease_expires
+	FROM device_ips
+	WHERE device_id = ?
+	ORDER BY last_seen DESC`
+
+	rows, err := s.db.Query(query, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list device addresses: %w", err)
+	}
+	defer rows.Close()
+
+	var ips []*models.DeviceIP
+	for rows.Next() {
+		var ip models.DeviceIP
+		var leaseExpires sql.NullTime
+		if err := rows.Scan(&ip.DeviceID, &ip.IPAddress, &ip.Source, &ip.FirstSeen, &ip.LastSeen, &leaseExpires); err != nil {
+			return nil, err
+		}
+		ip.LeaseExpires = leaseExpires.Time
+		ips = append(ips, &ip)
+	}
+	return ips, rows.Err()
+}
+
+// Records an IP to MAC binding. Saving a known binding again extends its last seen
+// time and keeps the larger announcement and probe counts.
+func (s *SQLiteStorage) SaveNeighbor(n *models.Neighbor) error {
+	query := `
+	INSERT INTO neighbors (ip_address, mac_address, vlan, protocol, interface, first_seen, last_seen, gratuitous, probes, router)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(ip_address, mac_address, vlan) DO UPDATE SET
+		last_seen = excluded.last_seen,
+		gratuitous = MAX(gratuitous, excluded.gratuitous),
+		probes = MAX(probes, excluded.probes),
+		router = router OR excluded.router;
+	`
+	_, err := s.db.Exec(query, n.IPAddress, n.MACAddress, n.VLAN, n.Protocol, n.Interface, n.FirstSeen, n.LastSeen, n.Gratuitous, n.Probes, n.Router)
+	if err != nil {
+		return fmt.Errorf("failed to save neighbor: %w", err)
+	}
+	return nil
+}
+
+// Returns every IP to MAC binding, ordered by address and then MAC.
+func (s *SQLiteStorage) ListNeighbors() ([]*models.Neighbor, error) {
+	query := `
+	SELECT id, ip_address, mac_address, vlan, protocol, COALESCE(interface, ''), first_seen, last_seen, gratuitous, probes, router
+	FROM neighbors
+	ORDER BY ip_address, mac_address`
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list neighbors: %w", err)
+	}
+	defer rows.Close()
+
+	var neighbors []*models.Neighbor
+	for rows.Next() {
+		var n models.Neighbor
+		if err := rows.Scan(&n.ID, &n.IPAddress, &n.MACAddress, &n.VLAN, &n.Protocol, &n.Interface, &n.FirstSeen, &n.LastSeen, &n.Gratuitous, &n.Probes, &n.Router); err != nil {
+			return nil, err
+		}
+		neighbors = append(neighbors, &n)
+	}
+	return neighbors, rows.Err()
+}
+
+// Records an IPv6 router's advertisement, replacing what it advertised before.
+func (s *SQLiteStorage) SaveRouter(advert *models.RouterAdvertisement) error {
+	prefixes, err := json.Marshal(advert.Prefixes)
+	if err != nil || advert.Prefixes == nil {
+		prefixes = []byte("[]")
+	}
+
+	query := `
+	INSERT INTO routers (router_ip, router_mac, vlan, interface, hop_limit, managed, other_config, preference, lifetime, mtu, prefixes, dns_servers, first_seen, last_seen)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(router_ip, router_mac, vlan) DO UPDATE SET
+		hop_limit = excluded.hop_limit,
+		managed = excluded.managed,
+		other_config = excluded.other_config,
+		preference = excluded.preference,
+		lifetime = excluded.lifetime,
+		mtu = excluded.mtu,
+		prefixes = excluded.prefixes,
+		dns_servers = excluded.dns_servers,
+		last_seen = excluded.last_seen;
+	`
+	_, err = s.db.Exec(query, advert.RouterIP, advert.RouterMAC, advert.VLAN, advert.Interface, advert.HopLimit,
+		advert.Managed, advert.OtherConfig, advert.Preference, int64(advert.Lifetime/time.Second), advert.MTU,
+		string(prefixes), jsonList(advert.DNSServers), advert.FirstSeen, advert.LastSeen)
+	if err != nil {
+		return fmt.Errorf("failed to save router: %w", err)
+	}
+	return nil
+}
+
+// Returns every IPv6 router's latest advertisement, most recently seen first.
+func (s *SQLiteStorage) ListRouters() ([]*models.RouterAdvertisement, error) {
+	query := `
+	SELECT id, router_ip, router_mac, vlan, COALESCE(interface, ''), hop_limit, managed, other_config, preference, lifetime, mtu, prefixes, dns_servers, first_seen, last_seen
+	FROM routers
+	ORDER BY last_seen DESC`
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list routers: %w", err)
+	}
+	defer rows.Close()
+
+	var routers []*models.RouterAdvertisement
+	for rows.Next() {
+		var advert models.RouterAdvertisement
+		var lifetime int64
+		var prefixes, dnsServers sql.NullString
+		if err := rows.Scan(&advert.ID, &advert.RouterIP, &advert.RouterMAC, &advert.VLAN, &advert.Interface, &advert.HopLimit,
+			&advert.Managed, &advert.OtherConfig, &advert.Preference, &lifetime, &advert.MTU,
+			&prefixes, &dnsServers, &advert.FirstSeen, &advert.LastSeen); err != nil {
+			return nil, err
+		}
+		advert.Lifetime = time.Duration(lifetime) * time.Second
+		// A malformed prefix list is dropped rather than failing the whole listing
+		if prefixes.String != "" && json.Unmarshal([]byte(prefixes.String), &advert.Prefixes) != nil || len(advert.Prefixes) == 0 {
+			advert.Prefixes = nil
+		}
+		advert.DNSServers = parseJSONList(dnsServers)
+		routers = append(routers, &advert)
+	}
+	return routers, rows.Err()
+}
+
 // Returns the most recent flows up to the specified limit.
 func (s *SQLiteStorage) GetRecentFlows(limit int) ([]*models.Flow, error) {
 	query := `
-	SELECT id, device_id, src_ip, dst_ip, src_port, dst_port, protocol, dst_domain, traffic_type, start_time, end_time, bytes_sent, packets_sent, app_protocol 
+	SELECT id, device_id, src_ip, dst_ip, src_port, dst_port, protocol, dst_domain, traffic_type, start_time, end_time, bytes_sent, packets_sent, app_protocol, COALESCE(interface, ''),
+	       COALESCE(vlan, 0), COALESCE(tunnel, ''), COALESCE(tunnel_id, 0), COALESCE(sampled, 0),
+	       COALESCE(quic_version, ''),
+	       COALESCE(ssh_client, ''), COALESCE(ssh_server, ''), COALESCE(hassh, ''), COALESCE(hassh_server, '')
 	FROM flows 
 	ORDER BY start_time DESC 
 	LIMIT ?`
@@ -175,6 +481,11 @@ func (s *SQLiteStorage) GetRecentFlows(limit int) ([]*models.Flow, error) {
 			&f.FirstSeen, &f.LastSeen,
 			&f.ByteCount, &f.PacketCount,
 			&f.Protocol, // app_protocol
+			&f.Interface,
+			&f.Key.VLAN, &f.Tunnel, &f.Key.TunnelID,
+			&f.Sampled,
+			&f.QUICVersion,
+			&f.SSHClient, &f.SSHServer, &f.HASSH, &f.HASSHServer,
 		)
 
 		if err != nil {
@@ -185,6 +496,156 @@ func (s *SQLiteStorage) GetRecentFlows(limit int) ([]*models.Flow, error) {
 	return flows, nil
 }
 
+// Saves a flow's TLS handshake, inserting it the first time and updating the same
+// row as the handshake completes (the certificate follows the Server Hello).
+func (s *SQLiteStorage) SaveTLSHandshake(hs *models.TLSHandshake) error {
+	var (
+		recordVersion, legacyVersion, versions, offeredALPN, groups, sigalgs sql.NullString
+		ech, grease                                                          sql.NullBool
+	)
+	if hello := hs.ClientHello; hello != nil {
+		recordVersion = sql.NullString{String: hello.RecordVersion, Valid: true}
+		legacyVersion = sql.NullString{String: hello.LegacyVersion, Valid: true}
+		versions = jsonList(hello.SupportedVersions)
+		offeredALPN = jsonList(hello.ALPN)
+		groups = jsonList(hello.SupportedGroups)
+		sigalgs = jsonList(hello.SignatureAlgorithms)
+		ech = sql.NullBool{Bool: hello.ECH, Valid: true}
+		grease = sql.NullBool{Bool: hello.GREASE, Valid: true}
+	}
+
+	var (
+		commonName, subject, issuer, sans, serial, fingerprint sql.NullString
+		validFrom, validTo                                     sql.NullTime
+	)
+	if cert := hs.Certificate; cert != nil {
+		commonName = sql.NullString{String: cert.CommonName, Valid: true}
+		subject = sql.NullString{String: cert.Subject, Valid: true}
+		issuer = sql.NullString{String: cert.Issuer, Valid: true}
+		serial = sql.NullString{String: cert.Serial, Valid: true}
+		fingerprint = sql.NullString{String: cert.SHA256, Valid: true}
+		sans = jsonList(cert.SANs)
+		validFrom = sql.NullTime{Time: cert.NotBefore, Valid: true}
+		validTo = sql.NullTime{Time: cert.NotAfter, Valid: true}
+	}
+	args := []interface{}{hs.FlowID, hs.SNI, hs.JA3, hs.JA3S, hs.CipherSuite, hs.TLSVersion, hs.ALPN,
+		recordVersion, legacyVersion, versions, offeredALPN, groups, sigalgs, ech, grease,
+		commonName, issuer, validFrom, validTo, subject, sans, serial, fingerprint, hs.IdentifiedApp, hs.Timestamp}
+
+	if hs.ID != 0 {
+		query := `
+		UPDATE tls_handshakes SET flow_id = ?, sni = ?, ja3_hash = ?, ja3s_hash = ?, cipher_suite = ?, tls_version = ?, alpn = ?,
+			record_version = ?, legacy_version = ?, client_versions = ?, client_alpn = ?, supported_groups = ?,
+			signature_algorithms = ?, ech = ?, grease = ?,
+			cert_common_name = ?, cert_issuer = ?, cert_valid_from = ?, cert_valid_to = ?, cert_subject = ?, cert_sans = ?,
+			cert_serial = ?, cert_sha256 = ?, identified_app = ?, timestamp = ?
+		WHERE id = ?
+		`
+		if _, err := s.db.Exec(query, append(args, hs.ID)...); err != nil {
+			return fmt.Errorf("failed to update TLS handshake: %w", err)
+		}
+		return nil
+	}
+
+	query := `
+	INSERT INTO tls_handshakes (flow_id, sni, ja3_hash, ja3s_hash, cipher_suite, tls_version, alpn,
+		record_version, legacy_version, client_versions, client_alpn, supported_groups, signature_algorithms, ech, grease,
+		cert_common_name, cert_issuer, cert_valid_from, cert_valid_to, cert_subject, cert_sans,
+		cert_serial, cert_sha256, identified_app, timestamp)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	result, err := s.db.Exec(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to save TLS handshake: %w", err)
+	}
+	if id, err := result.LastInsertId(); err == nil {
+		hs.ID = id
+	}
+	return nil
+}
+
+// Returns the most recent TLS handshakes, newest first, up to the specified limit.
+func (s *SQLiteStorage) ListTLSHandshakes(limit int) ([]*models.TLSHandshake, error) {
+	query := `
+	SELECT id, COALESCE(flow_id, 0), COALESCE(sni, ''), COALESCE(ja3_hash, ''), COALESCE(ja3s_hash, ''),
+	       COALESCE(cipher_suite, ''), COALESCE(tls_version, ''), COALESCE(alpn, ''),
+	       record_version, legacy_version, client_versions, client_alpn, supported_groups, signature_algorithms, ech, grease,
+	       cert_common_name, cert_issuer, cert_valid_from, cert_valid_to, cert_subject, cert_sans, cert_serial, cert_sha256,
+	       COALESCE(identified_app, ''), timestamp
+	FROM tls_handshakes
+	ORDER BY timestamp DESC
+	LIMIT ?`
+	rows, err := s.db.Query(query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list TLS handshakes: %w", err)
+	}
+	defer rows.Close()
+
+	var handshakes []*models.TLSHandshake
+	for rows.Next() {
+		var hs models.TLSHandshake
+		var recordVersion, legacyVersion, versions, offeredALPN, groups, sigalgs sql.NullString
+		var ech, grease sql.NullBool
+		var commonName, issuer, subject, sans, serial, fingerprint sql.NullString
+		var validFrom, validTo sql.NullTime
+		if err := rows.Scan(&hs.ID, &hs.FlowID, &hs.SNI, &hs.JA3, &hs.JA3S, &hs.CipherSuite, &hs.TLSVersion, &hs.ALPN,
+			&recordVersion, &legacyVersion, &versions, &offeredALPN, &groups, &sigalgs, &ech, &grease,
+			&commonName, &issuer, &validFrom, &validTo, &subject, &sans, &serial, &fingerprint,
+			&hs.IdentifiedApp, &hs.Timestamp); err != nil {
+			return nil, err
+		}
+
+		// Rows without a Client Hello or certificate leave those columns NULL
+		if recordVersion.Valid {
+			hs.ClientHello = &models.ClientHello{
+				RecordVersion:       recordVersion.String,
+				LegacyVersion:       legacyVersion.String,
+				SupportedVersions:   parseJSONList(versions),
+				ALPN:                parseJSONList(offeredALPN),
+				SupportedGroups:     parseJSONList(groups),
+				SignatureAlgorithms: parseJSONList(sigalgs),
+				ECH:                 ech.Bool,
+				GREASE:              grease.Bool,
+			}
+		}
+		if fingerprint.Valid {
+			hs.Certificate = &models.Certificate{
+				Subject:    subject.String,
+				CommonName: commonName.String,
+				SANs:       parseJSONList(sans),
+				Issuer:     issuer.String,
+				NotBefore:  validFrom.Time,
+				NotAfter:   validTo.Time,
+				Serial:     serial.String,
+				SHA256:     fingerprint.String,
+			}
+		}
+		handshakes = append(handshakes, &hs)
+	}
+	return handshakes, rows.Err()
+}
+
+// Encodes a list as a JSON array column; a list that fails to encode is stored empty.
+func jsonList(list []string) sql.NullString {
+	encoded, err := json.Marshal(list)
+	if err != nil || list == nil {
+		encoded = []byte("[]")
+	}
+	return sql.NullString{String: string(encoded), Valid: true}
+}
+
+// Decodes a JSON array column, returning nil when it is NULL or malformed.
+func parseJSONList(column sql.NullString) []string {
+	var list []string
+	if column.String == "" || json.Unmarshal([]byte(column.String), &list) != nil {
+		return nil
+	}
+	if len(list) == 0 {
+		return nil
+	}
+	return list
+}
+
 // SaveAccessPoint persists or updates a WiFi Access Point.
 func (s *SQLiteStorage) SaveAccessPoint(ap *models.AccessPoint) error {
 	query := `
@@ -1,7 +1,7 @@
 /**
  * SQLite Storage Tests.
  *
- * Verifies the full persistence API (Devices, Flows) against a temporary
+ * Verifies the full persistence API (Devices, Flows, TLS handshakes) against a temporary
  * SQLite database schema.
  *
  * Author: KleaSCM
@@ -12,6 +12,7 @@ package storage
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -71,13 +72,21 @@ func TestSQLiteStorage(t *testing.T) {
 			SrcPort:  12345,
 			DstPort:  53,
 			Protocol: "UDP",
+			VLAN:     20,
+			TunnelID: 5000,
 		},
+		Tunnel:      "VXLAN",
+		Sampled:     true,
+		QUICVersion: "QUIC v1",
+		SSHClient:   "OpenSSH_9.6p1",
+		HASSHServer: "0123456789abcdef0123456789abcdef",
 		FirstSeen:   time.Now(),
 		LastSeen:    time.Now(),
 		PacketCount: 1,
 		ByteCount:   100,
 		Protocol:    "UDP",
 		DNSQuery:    "google.com",
+		Interface:   "eth1",
 	}
 	if err := store.SaveFlow(flow); err != nil {
 		t.Fatalf("Failed to save flow: %v", err)
@@ -86,13 +95,76 @@ func TestSQLiteStorage(t *testing.T) {
 		t.Error("Expected flow ID to be set")
 	}
 
+	// Test SaveDevice without a MAC (tun, PPP): keyed by IP and updated in place
+	tunnelHost := &models.Device{IPAddress: "10.8.0.2", Hostname: "Device-10.8.0.2", FirstSeen: time.Now(), LastSeen: time.Now()}
+	if err := store.SaveDevice(tunnelHost); err != nil {
+		t.Fatalf("Failed to save device without MAC: %v", err)
+	}
+	firstID := tunnelHost.ID
+	tunnelHost.LastSeen = time.Now().Add(time.Minute)
+	if err := store.SaveDevice(tunnelHost); err != nil {
+		t.Fatalf("Failed to update device without MAC: %v", err)
+	}
+	if tunnelHost.ID != firstID {
+		t.Errorf("Expected the IP-keyed device updated in place, got IDs %d and %d", firstID, tunnelHost.ID)
+	}
+
 	// Test ListDevices
 	devices, err := store.ListDevices()
 	if err != nil {
 		t.Fatalf("Failed to list devices: %v", err)
 	}
-	if len(devices) == 0 {
-		t.Error("Expected at least one device")
+	if len(devices) != 2 {
+		t.Errorf("Expected 2 devices, got %d", len(devices))
+	}
+
+	// Test SaveDevice updating what DHCP revealed, keeping the device's ID
+	deviceID := device.ID
+	device.Hostname, device.OSFingerprint, device.DeviceType = "kitchen-ipad", "iOS", "Mobile"
+	device.DHCPVendorClass, device.DHCPFingerprint = "", "1,121,3,6,15,119,252"
+	if err := store.SaveDevice(device); err != nil {
+		t.Fatalf("Failed to update device: %v", err)
+	}
+	if device.ID != deviceID {
+		t.Errorf("Expected the device updated in place, got IDs %d and %d", deviceID, device.ID)
+	}
+	fetched, _ = store.GetDeviceByMAC("AA:BB:CC:DD:EE:FF")
+	if fetched.Hostname != "kitchen-ipad" || fetched.OSFingerprint != "iOS" || fetched.DHCPFingerprint != "1,121,3,6,15,119,252" {
+		t.Errorf("Expected the DHCP identity stored, got %q %q %q", fetched.Hostname, fetched.OSFingerprint, fetched.DHCPFingerprint)
+	}
+
+	// Test SaveDevice storing the model the device announced and the OS confidence
+	device.Model, device.OSConfidence = "iPad13,4", 85
+	if err := store.SaveDevice(device); err != nil {
+		t.Fatalf("Failed to update device: %v", err)
+	}
+	fetched, _ = store.GetDeviceByMAC("AA:BB:CC:DD:EE:FF")
+	if fetched.Model != "iPad13,4" || fetched.OSConfidence != 85 {
+		t.Errorf("Expected the announced model and OS confidence stored, got %q %d", fetched.Model, fetched.OSConfidence)
+	}
+
+	// Test SaveDeviceIP and ListDeviceIPs: an observed address later leased by DHCP
+	seen := time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC)
+	addresses := []*models.DeviceIP{
+		{DeviceID: device.ID, IPAddress: "192.168.1.100", Source: "Observed", FirstSeen: seen, LastSeen: seen},
+		{DeviceID: device.ID, IPAddress: "192.168.1.100", Source: "DHCP", FirstSeen: seen.Add(time.Hour), LastSeen: seen.Add(time.Hour), LeaseExpires: seen.Add(25 * time.Hour)},
+		{DeviceID: device.ID, IPAddress: "192.168.1.101", Source: "Observed", FirstSeen: seen.Add(2 * time.Hour), LastSeen: seen.Add(2 * time.Hour)},
+	}
+	for _, ip := range addresses {
+		if err := store.SaveDeviceIP(ip); err != nil {
+			t.Fatalf("Failed to save device address: %v", err)
+		}
+	}
+	history, err := store.ListDeviceIPs(device.ID)
+	if err != nil {
+		t.Fatalf("Failed to list device addresses: %v", err)
+	}
+	if len(history) != 2 || history[0].IPAddress != "192.168.1.101" || !history[0].LeaseExpires.IsZero() {
+		t.Fatalf("Expected two addresses, the latest observed first, got %+v", history)
+	}
+	leased := history[1]
+	if leased.Source != "DHCP" || !leased.FirstSeen.Equal(seen) || !leased.LeaseExpires.Equal(seen.Add(25*time.Hour)) {
+		t.Errorf("Expected the lease recorded on the first sighting, got %+v", leased)
 	}
 
 	// Test GetRecentFlows
@@ -106,4 +178,214 @@ func TestSQLiteStorage(t *testing.T) {
 	if flows[0].Key.SrcIP != "192.168.1.100" {
 		t.Errorf("Expected SrcIP 192.168.1.100, got %s", flows[0].Key.SrcIP)
 	}
+	if flows[0].Interface != "eth1" {
+		t.Errorf("Expected interface eth1, got %q", flows[0].Interface)
+	}
+	if flows[0].Key.VLAN != 20 || flows[0].Key.TunnelID != 5000 || flows[0].Tunnel != "VXLAN" {
+		t.Errorf("Expected VLAN 20 in VXLAN 5000, got %d in %s %d", flows[0].Key.VLAN, flows[0].Tunnel, flows[0].Key.TunnelID)
+	}
+	if !flows[0].Sampled {
+		t.Error("Expected the flow to be recorded as sampled")
+	}
+	if flows[0].QUICVersion != "QUIC v1" {
+		t.Errorf("Expected the QUIC version to round-trip, got %q", flows[0].QUICVersion)
+	}
+	if flows[0].SSHClient != "OpenSSH_9.6p1" || flows[0].SSHServer != "" || flows[0].HASSHServer != flow.HASSHServer {
+		t.Errorf("Expected the SSH software and HASSHServer to round-trip, got %q %q %q", flows[0].SSHClient, flows[0].SSHServer, flows[0].HASSHServer)
+	}
+
+	// Test SaveTLSHandshake: inserted at the Server Hello, updated once the certificate arrives
+	handshake := &models.TLSHandshake{
+		FlowID:      flows[0].ID,
+		JA3:         "a0e9f5d64349fb13191bc781f81f42e1",
+		JA3S:        "b742b407517bac9536a77a7b0fee28e9",
+		CipherSuite: "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+		TLSVersion:  "TLS 1.2",
+		ALPN:        "http/1.1",
+		ClientHello: &models.ClientHello{
+			RecordVersion:       "TLS 1.0",
+			LegacyVersion:       "TLS 1.2",
+			SupportedVersions:   []string{"TLS 1.2", "TLS 1.1", "TLS 1.0"},
+			ALPN:                []string{"h2", "http/1.1"},
+			SupportedGroups:     []string{"x25519"},
+			SignatureAlgorithms: []string{"rsa_pss_rsae_sha256"},
+			GREASE:              true,
+		},
+		Timestamp: time.Now(),
+	}
+	if err := store.SaveTLSHandshake(handshake); err != nil {
+		t.Fatalf("Failed to save TLS handshake: %v", err)
+	}
+	if handshake.ID == 0 {
+		t.Error("Expected TLS handshake ID to be set")
+	}
+	handshake.Certificate = &models.Certificate{
+		Subject:    "CN=www.example.com",
+		CommonName: "www.example.com",
+		SANs:       []string{"www.example.com", "example.com"},
+		Issuer:     "CN=Example CA",
+		NotBefore:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:   time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		Serial:     "1f2e3d",
+		SHA256:     "5e8a4f",
+	}
+	handshake.IdentifiedApp = "Cobalt Strike"
+	if err := store.SaveTLSHandshake(handshake); err != nil {
+		t.Fatalf("Failed to update TLS handshake: %v", err)
+	}
+	handshakes, err := store.ListTLSHandshakes(10)
+	if err != nil {
+		t.Fatalf("Failed to list TLS handshakes: %v", err)
+	}
+	if len(handshakes) != 1 {
+		t.Fatalf("Expected the update to keep one TLS handshake, got %d", len(handshakes))
+	}
+	saved := handshakes[0]
+	if saved.JA3S != handshake.JA3S || saved.IdentifiedApp != "Cobalt Strike" || saved.Certificate == nil {
+		t.Fatalf("Expected the paired fingerprints and certificate, got %+v", saved)
+	}
+	if cert := saved.Certificate; cert.CommonName != "www.example.com" || len(cert.SANs) != 2 || cert.Serial != "1f2e3d" ||
+		!cert.NotAfter.Equal(handshake.Certificate.NotAfter) {
+		t.Errorf("Expected the certificate round-tripped, got %+v", cert)
+	}
+	if hello := saved.ClientHello; hello == nil || saved.ALPN != "http/1.1" || len(hello.SupportedVersions) != 3 ||
+		!hello.OffersLegacyVersion() || !hello.OffersHTTP2() || !hello.GREASE || hello.ECH {
+		t.Errorf("Expected the Client Hello round-tripped, got %+v (ALPN %q)", hello, saved.ALPN)
+	}
+
+	// Test SaveCaptureRun and ListCaptureRuns
+	started := time.Date(2021, 3, 14, 22, 0, 0, 0, time.UTC)
+	for i, reason := range []string{models.StopDurationLimit, models.StopPacketLimit} {
+		run := &models.CaptureRun{
+			Mode:          "live",
+			Source:        "eth0",
+			Filter:        "tcp port 443",
+			DurationLimit: 8 * time.Hour,
+			PacketLimit:   1000000,
+			Schedule:      "22:00-06:00",
+			StartedAt:     started.AddDate(0, 0, i),
+			EndedAt:       started.AddDate(0, 0, i).Add(8 * time.Hour),
+			StopReason:    reason,
+			Packets:       uint64(1000 * (i + 1)),
+			Bytes:         1 << 20,
+		}
+		if err := store.SaveCaptureRun(run); err != nil {
+			t.Fatalf("Failed to save capture run: %v", err)
+		}
+		if run.ID == 0 {
+			t.Error("Expected capture run ID to be set")
+		}
+	}
+	runs, err := store.ListCaptureRuns(10)
+	if err != nil {
+		t.Fatalf("Failed to list capture runs: %v", err)
+	}
+	if len(runs) != 2 {
+		t.Fatalf("Expected 2 capture runs, got %d", len(runs))
+	}
+	latest := runs[0]
+	if latest.StopReason != models.StopPacketLimit || latest.Packets != 2000 || latest.DurationLimit != 8*time.Hour ||
+		latest.PacketLimit != 1000000 || latest.Schedule != "22:00-06:00" || latest.Bytes != 1<<20 {
+		t.Errorf("Expected the newest run first with its limits and stats, got %+v", latest)
+	}
+
+	// Test SaveNeighbor and ListNeighbors: a binding saved again keeps its first
+	// sighting and the larger counts, and a second MAC for the address gets its own row
+	neighbor := &models.Neighbor{
+		IPAddress:  "192.168.1.1",
+		MACAddress: "00:11:22:33:44:55",
+		Protocol:   "ARP",
+		Interface:  "eth0",
+		FirstSeen:  started,
+		LastSeen:   started,
+		Gratuitous: 2,
+	}
+	if err := store.SaveNeighbor(neighbor); err != nil {
+		t.Fatalf("Failed to save neighbor: %v", err)
+	}
+	neighbor.FirstSeen, neighbor.LastSeen, neighbor.Gratuitous = started.Add(time.Hour), started.Add(time.Hour), 1
+	if err := store.SaveNeighbor(neighbor); err != nil {
+		t.Fatalf("Failed to update neighbor: %v", err)
+	}
+	spoofed := *neighbor
+	spoofed.MACAddress = "de:ad:be:ef:00:01"
+	if err := store.SaveNeighbor(&spoofed); err != nil {
+		t.Fatalf("Failed to save second neighbor: %v", err)
+	}
+	neighbors, err := store.ListNeighbors()
+	if err != nil {
+		t.Fatalf("Failed to list neighbors: %v", err)
+	}
+	if len(neighbors) != 2 {
+		t.Fatalf("Expected a binding per MAC, got %d", len(neighbors))
+	}
+	if n := neighbors[0]; n.MACAddress != "00:11:22:33:44:55" || !n.FirstSeen.Equal(started) ||
+		!n.LastSeen.Equal(started.Add(time.Hour)) || n.Gratuitous != 2 || n.Interface != "eth0" {
+		t.Errorf("Expected the first sighting and larger count kept, got %+v", n)
+	}
+
+	// Test SaveRouter and ListRouters
+	advert := &models.RouterAdvertisement{
+		RouterIP:   "fe80::1",
+		RouterMAC:  "00:11:22:33:44:55",
+		Preference: "high",
+		Lifetime:   30 * time.Minute,
+		MTU:        1500,
+		Prefixes:   []models.RouterPrefix{{Prefix: "2001:db8:1::/64", OnLink: true, Autonomous: true, ValidLifetime: 24 * time.Hour}},
+		DNSServers: []string{"2001:db8:1::53"},
+		FirstSeen:  started,
+		LastSeen:   started,
+	}
+	if err := store.SaveRouter(advert); err != nil {
+		t.Fatalf("Failed to save router: %v", err)
+	}
+	advert.Managed, advert.LastSeen = true, started.Add(time.Hour)
+	if err := store.SaveRouter(advert); err != nil {
+		t.Fatalf("Failed to update router: %v", err)
+	}
+	routers, err := store.ListRouters()
+	if err != nil {
+		t.Fatalf("Failed to list routers: %v", err)
+	}
+	if len(routers) != 1 {
+		t.Fatalf("Expected the update to keep one router, got %d", len(routers))
+	}
+	if r := routers[0]; !r.Managed || r.Lifetime != 30*time.Minute || r.MTU != 1500 || len(r.Prefixes) != 1 ||
+		r.Prefixes[0] != advert.Prefixes[0] || len(r.DNSServers) != 1 || !r.FirstSeen.Equal(started) {
+		t.Errorf("Expected the latest advertisement round-tripped, got %+v", r)
+	}
+}
+
+// Verifies that Migrate upgrades a database created before later columns existed.
+func TestSQLiteStorage_ColumnMigrations(t *testing.T) {
+	store, err := NewSQLiteStorage(filepath.Join(t.TempDir(), "legacy.db"))
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer store.Close()
+
+	// The original flows table, without any migrated columns
+	if _, err := store.db.Exec(`CREATE TABLE flows (id INTEGER PRIMARY KEY, device_id INTEGER, src_ip TEXT, dst_ip TEXT,
+		src_port INTEGER, dst_port INTEGER, protocol TEXT, dst_domain TEXT, dst_country TEXT, dst_city TEXT, dst_asn TEXT,
+		app_protocol TEXT, traffic_type TEXT, ja3_hash TEXT, start_time TIMESTAMP, end_time TIMESTAMP, bytes_sent INTEGER,
+		bytes_received INTEGER, packets_sent INTEGER, packets_received INTEGER)`); err != nil {
+		t.Fatal(err)
+	}
+
+	// Running twice must be harmless
+	for i := 0; i < 2; i++ {
+		if err := store.Migrate(); err != nil {
+			t.Fatalf("Migrate run %d failed: %v", i+1, err)
+		}
+	}
+
+	for _, m := range columnMigrations {
+		exists, err := store.columnExists(m.Table, m.Column)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !exists {
+			t.Errorf("Expected column %s.%s after migration", m.Table, m.Column)
+		}
+	}
 }
@@ -11,8 +11,6 @@
 package wifi
 
 import (
-	"time"
-
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
 	"github.com/kleaSCM/netscope/internal/models"
@@ -138,7 +136,7 @@ func (s *Scanner) ParseEAPOL(packet gopacket.Packet) *models.Handshake {
 	hs := &models.Handshake{
 		BSSID:     d11.Address1.String(),
 		ClientMAC: d11.Address2.String(),
-		Timestamp: time.Now(),
+		Timestamp: packet.Metadata().Timestamp,
 		IsFull:    false,
 	}
 
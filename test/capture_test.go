@@ -9,3 +9,324 @@
  */
 
 package test
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/kleaSCM/netscope/internal/capture"
+	"github.com/kleaSCM/netscope/internal/storage"
+)
+
+var (
+	testClientMAC = net.HardwareAddr{0x00, 0x03, 0x93, 0xAA, 0xBB, 0xCC}
+	testRouterMAC = net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+)
+
+// Serializes a DNS answer for example.com followed by a TLS-port connection to the answered IP.
+func buildReplayPackets(t *testing.T) [][]byte {
+	t.Helper()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+
+	dnsIP := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP,
+		SrcIP: net.IP{8, 8, 8, 8}, DstIP: net.IP{192, 168, 1, 100}}
+	dnsUDP := &layers.UDP{SrcPort: 53, DstPort: 40000}
+	dnsUDP.SetNetworkLayerForChecksum(dnsIP)
+	dns := &layers.DNS{
+		ID: 7, QR: true, RD: true, RA: true,
+		Questions: []layers.DNSQuestion{{Name: []byte("example.com"), Type: layers.DNSTypeA, Class: layers.DNSClassIN}},
+		Answers: []layers.DNSResourceRecord{{
+			Name: []byte("example.com"), Type: layers.DNSTypeA, Class: layers.DNSClassIN,
+			TTL: 300, IP: net.IP{93, 184, 216, 34},
+		}},
+	}
+	dnsBuf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(dnsBuf, opts,
+		&layers.Ethernet{SrcMAC: testRouterMAC, DstMAC: testClientMAC, EthernetType: layers.EthernetTypeIPv4},
+		dnsIP, dnsUDP, dns); err != nil {
+		t.Fatal(err)
+	}
+
+	tcpIP := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP,
+		SrcIP: net.IP{192, 168, 1, 100}, DstIP: net.IP{93, 184, 216, 34}}
+	tcp := &layers.TCP{SrcPort: 54321, DstPort: 443, SYN: true, Seq: 1, Window: 64240}
+	tcp.SetNetworkLayerForChecksum(tcpIP)
+	tcpBuf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(tcpBuf, opts,
+		&layers.Ethernet{SrcMAC: testClientMAC, DstMAC: testRouterMAC, EthernetType: layers.EthernetTypeIPv4},
+		tcpIP, tcp); err != nil {
+		t.Fatal(err)
+	}
+
+	return [][]byte{dnsBuf.Bytes(), tcpBuf.Bytes()}
+}
+
+// Writes packets into a classic pcap file, spacing their timestamps by gap.
+func writePcap(t *testing.T, path string, packets [][]byte, start time.Time, gap time.Duration) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := pcapgo.NewWriter(f)
+	if err := w.WriteFileHeader(65536, layers.LinkTypeEthernet); err != nil {
+		t.Fatal(err)
+	}
+	for i, data := range packets {
+		ci := gopacket.CaptureInfo{Timestamp: start.Add(time.Duration(i) * gap), CaptureLength: len(data), Length: len(data)}
+		if err := w.WritePacket(ci, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Writes packets into a pcapng file, spacing their timestamps by gap.
+func writePcapng(t *testing.T, path string, packets [][]byte, start time.Time, gap time.Duration) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w, err := pcapgo.NewNgWriter(f, layers.LinkTypeEthernet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, data := range packets {
+		ci := gopacket.CaptureInfo{Timestamp: start.Add(time.Duration(i) * gap), CaptureLength: len(data), Length: len(data)}
+		if err := w.WritePacket(ci, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestStore(t *testing.T) storage.Storage {
+	t.Helper()
+	store, err := storage.NewSQLiteStorage(filepath.Join(t.TempDir(), "replay.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// Replays a capture and returns the packets delivered to the handler.
+func replay(t *testing.T, path string, realtime bool) (*capture.Engine, []capture.PacketInfo) {
+	t.Helper()
+	config := capture.DefaultConfig("")
+	config.ReplayRealtime = realtime
+
+	engine, err := capture.NewOfflineEngine(path, config, newTestStore(t))
+	if err != nil {
+		t.Fatalf("Failed to open replay: %v", err)
+	}
+	t.Cleanup(engine.Stop)
+
+	var seen []capture.PacketInfo
+	if err := engine.Start(context.Background(), func(info capture.PacketInfo) {
+		seen = append(seen, info)
+	}); err != nil {
+		t.Fatalf("Replay returned error: %v", err)
+	}
+	return engine, seen
+}
+
+// Verifies that pcap and pcapng files both drive the full pipeline, including DNS correlation
+// evaluated against packet timestamps from years ago rather than the wall clock.
+func TestOfflineReplay_Pipeline(t *testing.T) {
+	start := time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC)
+	packets := buildReplayPackets(t)
+
+	formats := map[string]func(*testing.T, string, [][]byte, time.Time, time.Duration){
+		"trace.pcap":   writePcap,
+		"trace.pcapng": writePcapng,
+	}
+
+	for name, write := range formats {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			write(t, path, packets, start, time.Second)
+
+			engine, seen := replay(t, path, false)
+
+			if len(seen) != 2 {
+				t.Fatalf("Expected 2 packets delivered, got %d", len(seen))
+			}
+
+			// The two packets belong to different flows, so workers may deliver them in either order
+			dnsInfo, tcpInfo := seen[0], seen[1]
+			if dnsInfo.Protocol != "DNS" {
+				dnsInfo, tcpInfo = tcpInfo, dnsInfo
+			}
+			if dnsInfo.Protocol != "DNS" {
+				t.Errorf("Expected one DNS packet, got %s and %s", seen[0].Protocol, seen[1].Protocol)
+			}
+			if !dnsInfo.Timestamp.Equal(start) {
+				t.Errorf("Expected packet timestamp %v, got %v", start, dnsInfo.Timestamp)
+			}
+			if tcpInfo.DstDomain != "example.com" {
+				t.Errorf("Expected TCP flow correlated to example.com, got %q", tcpInfo.DstDomain)
+			}
+
+			processed, _, _ := engine.Stats()
+			if processed != 2 {
+				t.Errorf("Expected 2 packets processed, got %d", processed)
+			}
+		})
+	}
+}
+
+// Verifies that real-time pacing honors recorded inter-packet gaps while the default mode does not.
+func TestOfflineReplay_Pacing(t *testing.T) {
+	gap := 300 * time.Millisecond
+	path := filepath.Join(t.TempDir(), "paced.pcap")
+	writePcap(t, path, buildReplayPackets(t), time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC), gap)
+
+	began := time.Now()
+	replay(t, path, true)
+	if elapsed := time.Since(began); elapsed < gap {
+		t.Errorf("Real-time replay finished in %v, expected at least %v", elapsed, gap)
+	}
+
+	// An hour-long recorded gap must not be slept through when pacing is off
+	slowPath := filepath.Join(t.TempDir(), "hour.pcap")
+	writePcap(t, slowPath, buildReplayPackets(t), time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC), time.Hour)
+
+	began = time.Now()
+	replay(t, slowPath, false)
+	if elapsed := time.Since(began); elapsed >= time.Minute {
+		t.Errorf("Fast replay took %v, expected it to ignore recorded gaps", elapsed)
+	}
+}
+
+// Verifies that a BPF filter applies to replayed packets as it would to a live handle,
+// and that an expression libpcap cannot compile is rejected up front.
+func TestOfflineReplay_Filter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filtered.pcap")
+	writePcap(t, path, buildReplayPackets(t), time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC), time.Second)
+
+	config := capture.DefaultConfig("")
+	config.BPFFilter = "udp port"
+	if _, err := capture.NewOfflineEngine(path, config, newTestStore(t)); err == nil {
+		t.Error("Expected an incomplete filter to be rejected")
+	}
+
+	if _, err := pcap.NewBPF(layers.LinkTypeEthernet, 65536, "udp"); err != nil {
+		t.Skipf("libpcap cannot compile filters here: %v", err)
+	}
+	config.BPFFilter = "udp port 53"
+	engine, err := capture.NewOfflineEngine(path, config, newTestStore(t))
+	if err != nil {
+		t.Fatalf("Failed to open filtered replay: %v", err)
+	}
+	t.Cleanup(engine.Stop)
+
+	var seen []capture.PacketInfo
+	if err := engine.Start(context.Background(), func(info capture.PacketInfo) {
+		seen = append(seen, info)
+	}); err != nil {
+		t.Fatalf("Replay returned error: %v", err)
+	}
+	if len(seen) != 1 || seen[0].Protocol != "DNS" {
+		t.Errorf("Expected only the DNS packet, got %d packets", len(seen))
+	}
+}
+
+// Verifies that the worker pool delivers every packet and keeps each flow's packets in
+// capture order, even when both directions of a conversation are interleaved.
+func TestOfflineReplay_FlowOrdering(t *testing.T) {
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	const flows, packetsPerFlow = 32, 40
+
+	var packets [][]byte
+	for p := 0; p < packetsPerFlow; p++ {
+		for f := 0; f < flows; f++ {
+			client, server := net.IP{192, 168, 1, byte(10 + f)}, net.IP{93, 184, 216, 34}
+			clientPort, serverPort := layers.TCPPort(40000+f), layers.TCPPort(443)
+
+			ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: client, DstIP: server}
+			tcp := &layers.TCP{SrcPort: clientPort, DstPort: serverPort, ACK: true, Seq: uint32(p), Window: 64240}
+			eth := &layers.Ethernet{SrcMAC: testClientMAC, DstMAC: testRouterMAC, EthernetType: layers.EthernetTypeIPv4}
+			if p%2 == 1 {
+				ip.SrcIP, ip.DstIP = server, client
+				tcp.SrcPort, tcp.DstPort = serverPort, clientPort
+				eth.SrcMAC, eth.DstMAC = testRouterMAC, testClientMAC
+			}
+			tcp.SetNetworkLayerForChecksum(ip)
+
+			buf := gopacket.NewSerializeBuffer()
+			if err := gopacket.SerializeLayers(buf, opts, eth, ip, tcp); err != nil {
+				t.Fatal(err)
+			}
+			packets = append(packets, buf.Bytes())
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "many.pcap")
+	writePcap(t, path, packets, time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC), time.Millisecond)
+
+	config := capture.DefaultConfig("")
+	config.Workers = 4
+	config.QueueSize = 8 // Small queues force the stages to block on each other
+	engine, err := capture.NewOfflineEngine(path, config, newTestStore(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Stop()
+
+	lastSeen := make(map[uint16]time.Time)
+	delivered := 0
+	if err := engine.Start(context.Background(), func(info capture.PacketInfo) {
+		delivered++
+		clientPort := info.SrcPort
+		if clientPort == 443 {
+			clientPort = info.DstPort
+		}
+		if info.Timestamp.Before(lastSeen[clientPort]) {
+			t.Errorf("Flow %d delivered out of order at %v", clientPort, info.Timestamp)
+		}
+		lastSeen[clientPort] = info.Timestamp
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if delivered != flows*packetsPerFlow {
+		t.Errorf("Expected %d packets delivered, got %d", flows*packetsPerFlow, delivered)
+	}
+
+	stats := engine.PipelineStats()
+	if stats.Read != uint64(flows*packetsPerFlow) || stats.Delivered != stats.Read {
+		t.Errorf("Expected read == delivered == %d, got %d and %d", flows*packetsPerFlow, stats.Read, stats.Delivered)
+	}
+	var worked uint64
+	busy := 0
+	for _, n := range stats.Worked {
+		worked += n
+		if n > 0 {
+			busy++
+		}
+	}
+	if worked != stats.Read {
+		t.Errorf("Workers processed %d packets, reader dispatched %d", worked, stats.Read)
+	}
+	if busy < 2 {
+		t.Errorf("Expected flows spread across workers, only %d of %d did work", busy, stats.Workers)
+	}
+}